@@ -4,6 +4,10 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -14,21 +18,68 @@ import (
 	"online-store/internal/config"
 	"online-store/internal/database"
 	"online-store/internal/handlers"
+	"online-store/internal/jwtkeys"
 	"online-store/internal/middleware"
 	"online-store/internal/mqtt"
+	"online-store/internal/orderids"
+	"online-store/internal/passwords"
+	"online-store/internal/sanitize"
 	"online-store/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Build information, set when building with
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD)"
+//
+// so /health shows exactly what is deployed
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+// startedAt is when the process started, for the uptime in /health
+var startedAt = time.Now()
+
 func main() {
 	// Load configuration from environment variables
 	// This is where we get database connection info, MQTT settings, etc.
 	cfg := config.Load()
 
+	// Decide how HTML in product names/descriptions is handled - a typo here should stop startup
+	sanitizePolicy, err := sanitize.ParsePolicy(cfg.SanitizePolicy)
+	if err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+
+	// How new passwords are hashed - existing hashes verify whatever this says
+	passwordHashing, err := passwords.ParseAlgorithm(cfg.PasswordHashAlgorithm)
+	if err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+	if cfg.MinPasswordScore < 0 || cfg.MinPasswordScore > passwords.MaxScore {
+		log.Fatalf("Invalid configuration: MIN_PASSWORD_SCORE must be between 0 and %d, not %d", passwords.MaxScore, cfg.MinPasswordScore)
+	}
+
+	// Load the keys our login tokens are signed with
+	jwtKeys, err := jwtkeys.Load(cfg.JWTAlgorithm, cfg.JWTSecret, cfg.JWTPrivateKeyFile, cfg.JWTPublicKeyFile)
+	if err != nil {
+		log.Fatal("Invalid JWT configuration:", err)
+	}
+
 	// Connect to the database (MariaDB)
 	// This creates a connection pool that our app will use
-	db, err := database.Connect(cfg.DatabaseURL)
+	// If MariaDB is still starting (common with docker compose), wait for it a while
+	dbRetry := database.Retry{
+		Attempts: cfg.DBConnectAttempts,
+		Backoff:  time.Duration(cfg.DBConnectBackoffMs) * time.Millisecond,
+	}
+	dbTimeouts := database.Timeouts{
+		Read:  time.Duration(cfg.DBReadTimeoutMs) * time.Millisecond,
+		Write: time.Duration(cfg.DBWriteTimeoutMs) * time.Millisecond,
+	}
+	db, err := database.Connect(cfg.DatabaseURL, time.Duration(cfg.SlowQueryMs)*time.Millisecond, dbRetry, cfg.SeedDataFile, cfg.StatementCacheSize, dbTimeouts)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -36,47 +87,134 @@ func main() {
 
 	// Set up MQTT client for publishing and subscribing to messages
 	// MQTT helps different parts of our system communicate
-	mqttClient, err := mqtt.NewClient(cfg.MQTTBroker)
+	// With MQTT_REQUIRED=false the HTTP API starts even if the broker is down;
+	// events wait in the outbox until the client connects in the background
+	// After repeated publish failures, publishing pauses instead of making every request wait
+	if cfg.MQTTBreakerPolicy != "queue" && cfg.MQTTBreakerPolicy != "drop" {
+		log.Fatalf("Invalid configuration: MQTT_BREAKER_POLICY must be queue or drop, not %q", cfg.MQTTBreakerPolicy)
+	}
+	mqttBreaker := mqtt.Breaker{
+		Failures:     cfg.MQTTBreakerFailures,
+		Cooldown:     time.Duration(cfg.MQTTBreakerCooldownSec) * time.Second,
+		DropWhenOpen: cfg.MQTTBreakerPolicy == "drop",
+	}
+	mqttClient, err := mqtt.NewClient(cfg.MQTTBroker, cfg.MQTTCompressMin, cfg.MQTTRequired, mqttBreaker)
 	if err != nil {
 		log.Fatal("Failed to connect to MQTT broker:", err)
 	}
-	defer mqttClient.Disconnect(250) // Clean disconnect when shutting down
+	// Clean disconnect when shutting down, giving in-flight messages time to finish
+	defer mqttClient.Disconnect(cfg.MQTTQuiesceMs)
+
+	// Create repositories - these are the only code that talks SQL
+	// Services depend on repository interfaces, so they can be tested without a database
+	userRepo := services.NewSQLUserRepository(db)
+	productRepo := services.NewSQLProductRepository(db)
+	orderRepo := services.NewSQLOrderRepository(db, cfg.Enabled(config.FeatureRichOrderEvents))
+	auditRepo := services.NewSQLAuditRepository(db)
+	paymentRepo := services.NewSQLPaymentRepository(db)
+	sessionRepo := services.NewSQLSessionRepository(db)
+	productEventRepo := services.NewSQLProductEventRepository(db)
+	outboxRepo := services.NewSQLOutboxRepository(db)
+	waitlistRepo := services.NewSQLWaitlistRepository(db)
+
+	// Services publish through the outbox: events that fail to publish are saved
+	// and retried by the outbox worker below, so downstream systems don't miss them
+	eventPublisher := services.NewOutboxPublisher(mqttClient, outboxRepo)
+	outboxWorker := services.NewOutboxWorker(mqttClient.Strict(), outboxRepo)
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go outboxWorker.Run(workerCtx, time.Duration(cfg.OutboxRetrySec)*time.Second)
 
 	// Create service layer - this is where our business logic lives
 	// Services handle the "what" and "how" of our application
-	authService := services.NewAuthService(db, mqttClient)
-	productService := services.NewProductService(db, mqttClient)
-	orderService := services.NewOrderService(db, mqttClient)
+	// Users whose access tokens an admin revoked - shared by the auth service and middleware
+	// It has to know the middleware's leeway, which keeps tokens working a bit past "exp"
+	jwtLeeway := time.Duration(cfg.JWTLeewaySec) * time.Second
+	tokenDenylist := services.NewTokenDenylist(jwtLeeway)
+
+	auditService := services.NewAuditService(auditRepo)
+	authService := services.NewAuthService(userRepo, sessionRepo, tokenDenylist, eventPublisher, jwtKeys, passwordHashing, cfg)
+	if cfg.BackInStockMin < 1 {
+		log.Fatalf("Invalid configuration: BACK_IN_STOCK_MIN_STOCK must be at least 1, not %d", cfg.BackInStockMin)
+	}
+	if cfg.RiskHoldThreshold < 0 || cfg.RiskHoldThreshold > 100 {
+		log.Fatalf("Invalid configuration: RISK_HOLD_THRESHOLD must be between 0 and 100, not %d", cfg.RiskHoldThreshold)
+	}
+	productService := services.NewProductService(productRepo, productEventRepo, waitlistRepo, eventPublisher, auditService, sanitizePolicy, cfg)
+	orderService := services.NewOrderService(orderRepo, productRepo, userRepo, eventPublisher, outboxWorker, auditService, cfg)
+
+	// Move delivered orders past the retention period to orders_archive, once an hour
+	if cfg.OrderRetentionDays > 0 {
+		orderArchiver := services.NewOrderArchiver(orderRepo, cfg.OrderRetentionDays)
+		go orderArchiver.Run(workerCtx, time.Hour)
+	}
+
+	// Catch up on payments confirmed while we were down
+	// Don't refuse to start if this fails - the next restart will try again
+	reconciliationService := services.NewReconciliationService(paymentRepo, orderService)
+	if applied, err := reconciliationService.ReconcilePayments(); err != nil {
+		log.Printf("Payment reconciliation failed: %v", err)
+	} else {
+		log.Printf("Payment reconciliation applied %d missed payments", applied)
+	}
 
 	// Create HTTP handlers - these handle incoming web requests
 	// Handlers are like receptionists that greet requests and hand them off
 	authHandler := handlers.NewAuthHandler(authService)
 	productHandler := handlers.NewProductHandler(productService)
-	orderHandler := handlers.NewOrderHandler(orderService)
+	// With the obfuscated_order_ids feature, customers see order codes instead of
+	// sequential IDs, which would tell anyone how many orders we get
+	var orderCodes *orderids.Codec
+	if cfg.Enabled(config.FeatureObfuscatedOrderIDs) {
+		orderCodes = orderids.NewCodec(cfg.OrderIDSecret)
+	}
+	orderHandler := handlers.NewOrderHandler(orderService, cfg.Currency, orderCodes)
+	auditHandler := handlers.NewAuditHandler(auditService)
 
 	// Set up MQTT message handlers
 	// These listen for MQTT messages and do something when they arrive
-	mqttHandlers := mqtt.NewHandlers(productService, orderService)
+	// With several instances running, shared topics are processed by only one of them
+	sharedSubscriptions := mqtt.NewSharedSubscriptions(cfg.MQTTShareGroup, cfg.MQTTSharedTopics)
+	mqttHandlers := mqtt.NewHandlers(productService, orderService, sharedSubscriptions)
 	mqttHandlers.Subscribe(mqttClient)
 
 	// Create Gin router (Gin is a web framework for Go)
 	// Think of this as the traffic director for web requests
-	router := gin.Default()
+	// gin.New instead of gin.Default, so we can use our own request logger
+	router := gin.New()
 
 	// Add middleware - code that runs before every request
+	// Log requests (errors always, successes only as sampled) and turn panics into 500s
+	router.Use(middleware.RequestLogger(middleware.PercentSampler(cfg.LogSamplePercent)), gin.Recovery())
+
+	// Give each request an ID first, so everything after it can log the ID
+	router.Use(middleware.RequestID(cfg.RequestIDHeader))
+
 	// CORS allows web browsers to make requests to our API
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	router.Use(middleware.CORS(cfg.CORSMaxAgeSec, cfg.RequestIDHeader))
+
+	// One client (by IP) may only have so many requests running at once,
+	// so it can't tie up the server for everyone else
+	router.Use(middleware.ClientConcurrencyLimit(cfg.MaxConcurrentPerClient))
+
+	// Compress large responses (product listings, CSV exports) for clients that support gzip
+	router.Use(middleware.Gzip(cfg.GzipMinBytes))
+
+	// Expensive routes (like the CSV export) get their own limit on parallel requests,
+	// so a few of them can't slow down everything else
+	router.Use(middleware.RouteConcurrencyLimits(cfg.RouteConcurrency))
+
+	// With the list_envelope feature, list endpoints answer {"data": [...], "meta": {...}}
+	if cfg.Enabled(config.FeatureListEnvelope) {
+		router.Use(middleware.ListEnvelope())
+	}
+
+	// Reject request bodies we can't parse (like HTML form posts) with 415 up front
+	router.Use(middleware.RequireContentType(cfg.AllowedContentTypes))
 
-		c.Next()
-	})
+	// Placing orders hits the database hardest, so only so many may run at once
+	// (shared by logged-in and guest checkout)
+	orderLimit := middleware.ConcurrencyLimit(cfg.MaxConcurrentOrders)
 
 	// Define API routes - these are the URLs our app responds to
 	api := router.Group("/api")
@@ -84,34 +222,96 @@ func main() {
 		// Authentication routes - no middleware needed, anyone can access
 		api.POST("/register", authHandler.Register)
 		api.POST("/login", authHandler.Login)
+		api.POST("/refresh", authHandler.Refresh)
+		api.GET("/register/check-email", middleware.RateLimit(cfg.EmailCheckLimit, time.Minute), authHandler.CheckEmail)
+		api.POST("/verify", authHandler.VerifyEmail)
+		api.POST("/verify/resend", middleware.RateLimit(cfg.VerificationResendLimit, time.Hour), authHandler.ResendVerification)
 
 		// Product routes - some need authentication, some don't
-		api.GET("/products", productHandler.GetProducts)    // Anyone can view products
-		api.GET("/products/:id", productHandler.GetProduct) // Anyone can view a product
+		api.GET("/products", productHandler.GetProducts)               // Anyone can view products
+		api.GET("/products/on-sale", productHandler.GetProductsOnSale) // Products with a running sale
+		api.GET("/products/stream", productHandler.StreamProducts)     // Whole catalog as NDJSON, for data pipelines
+		api.GET("/products/top", productHandler.GetTopSellers)         // Best sellers, by units or revenue
+		api.GET("/products/:id", productHandler.GetProduct)            // Anyone can view a product
+		api.GET("/products/:id/availability", productHandler.GetProductAvailability)
+		api.GET("/products/:id/related", productHandler.GetRelatedProducts)
+		api.GET("/products/by-sku/:sku", productHandler.GetProductBySKU)
+		api.GET("/categories", productHandler.GetCategories) // Categories with in-stock counts
+
+		// Guest checkout - order without an account, then track it with the returned token
+		// Tracking stays available when guest checkout is switched off, for orders placed before
+		if cfg.Enabled(config.FeatureGuestCheckout) {
+			api.POST("/guest/orders", orderLimit, orderHandler.CreateGuestOrder)
+		}
+		api.GET("/orders/track", orderHandler.TrackOrder)
+
+		// Check a shopping cart before checkout - no login needed, nothing is reserved
+		api.POST("/cart/validate", orderHandler.ValidateCart)
+
+		// Admin routes need the admin role on top of being logged in
+		// With ADMIN_ROLE_FROM_DB the role is read fresh from the database, so
+		// demoting an admin takes effect before their token expires
+		var adminRoles middleware.RoleLookup
+		if cfg.AdminRoleFromDB {
+			adminRoles = authService
+		}
+		adminOnly := middleware.AdminRequired(adminRoles)
 
 		// Protected routes - need to be logged in (JWT token required)
 		protected := api.Group("/")
-		protected.Use(middleware.AuthRequired(cfg.JWTSecret)) // Check if user is logged in
+		protected.Use(middleware.AuthRequired(jwtKeys, cfg.JWTIssuer, cfg.JWTAudience, jwtLeeway, tokenDenylist)) // Check if user is logged in
 		{
 			// Only logged-in users can create products, orders, etc.
+			protected.PUT("/me", authHandler.UpdateProfile)
+			protected.GET("/me/export", orderHandler.ExportMyData) // Everything we store about the user (GDPR)
+			protected.GET("/me/sessions", authHandler.ListSessions)
+			protected.DELETE("/me/sessions/:id", authHandler.RevokeSession)
 			protected.POST("/products", productHandler.CreateProduct)
 			protected.PUT("/products/:id", productHandler.UpdateProduct)
-			protected.POST("/orders", orderHandler.CreateOrder)
+			protected.PATCH("/products/:id", productHandler.PatchProduct)
+			protected.POST("/products/:id/clone", adminOnly, productHandler.CloneProduct) // Copy into a new draft
+			protected.GET("/products/:id/price-history", productHandler.GetPriceHistory)
+			protected.POST("/products/:id/waitlist", productHandler.JoinWaitlist) // Be told when a sold-out product is back
+			protected.POST("/orders", orderLimit, orderHandler.CreateOrder)
 			protected.GET("/orders", orderHandler.GetUserOrders)
 			protected.GET("/orders/:id", orderHandler.GetOrder)
+			protected.PATCH("/orders/:id", orderHandler.EditOrder) // Only while the order is pending
+			protected.POST("/orders/:id/reorder", orderHandler.ReorderOrder)
+
+			// Admin routes - logged in AND the user must have the admin role
+			admin := protected.Group("/admin")
+			admin.Use(adminOnly)
+			{
+				admin.PATCH("/orders/:id/status", orderHandler.UpdateOrderStatus)
+				admin.POST("/orders/bulk-status", orderHandler.BulkUpdateOrderStatus)
+				admin.POST("/orders/:id/release", orderHandler.ReleaseOrder) // Undo a hold from risk/flag
+				admin.GET("/orders/export", orderHandler.ExportOrders)
+				admin.GET("/metrics/sales", orderHandler.GetSalesMetrics)
+				admin.GET("/audit", auditHandler.ListAudit)
+				admin.GET("/users/:id/summary", orderHandler.GetUserSummary)
+				admin.POST("/users/:id/revoke-sessions", authHandler.RevokeUserSessions)
+				admin.GET("/products/low-stock", productHandler.GetLowStockProducts)
+				admin.GET("/products/:id/events", productHandler.GetProductEvents)
+				admin.GET("/products", productHandler.GetProducts) // ?include_drafts=true lists drafts too
+				admin.POST("/products/:id/publish", productHandler.PublishProduct)
+				admin.GET("/inventory/valuation", productHandler.GetInventoryValuation)
+			}
 		}
 	}
 
 	// Health check endpoint - useful for monitoring if the app is running
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok", "timestamp": time.Now()})
-	})
+	router.GET("/health", health(mqttClient))
+
+	// We use our own http.Server instead of router.Run so we can set timeouts
+	server, err := newServer(cfg, router)
+	if err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
 
 	// Start the HTTP server in a goroutine (concurrent execution)
 	// This means the server runs in the background while we wait for shutdown signals
 	go func() {
-		log.Printf("Server starting on port %s", cfg.Port)
-		if err := router.Run(":" + cfg.Port); err != nil && err != http.ErrServerClosed {
+		if err := serve(server, cfg); err != nil && err != http.ErrServerClosed {
 			log.Fatal("Failed to start server:", err)
 		}
 	}()
@@ -123,5 +323,95 @@ func main() {
 	<-quit // Wait for shutdown signal
 
 	log.Println("Shutting down server...")
+
+	// Give requests that are still running a few seconds to finish
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server did not shut down cleanly: %v", err)
+	}
+
+	// Stop taking MQTT messages, and let handlers that are still working finish
+	// (e.g. a payment confirmation halfway through updating its order)
+	mqttClient.UnsubscribeAll()
+	if !mqttHandlers.Drain(time.Duration(cfg.MQTTDrainTimeoutSec) * time.Second) {
+		log.Println("Some MQTT message handlers were still running at shutdown")
+	}
+
 	// App will automatically clean up database and MQTT connections due to defer statements above
 }
+
+// mqttStatus is what /health reports about our MQTT connection
+type mqttStatus interface {
+	Stats() map[string]mqtt.TopicStats
+	Connected() bool
+	BreakerState() string
+}
+
+// health answers /health with our status, the running build and how long we've been up
+func health(mqttClient mqttStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"status":    "ok",
+			"timestamp": time.Now(),
+			"mqtt":      mqttClient.Stats(), // Publish counters per topic
+
+			"mqtt_connected": mqttClient.Connected(),
+			"mqtt_breaker":   mqttClient.BreakerState(),
+
+			"version":        version,
+			"commit":         commit,
+			"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+		})
+	}
+}
+
+// newServer creates the HTTP server with the timeouts from our config
+// Without timeouts, a client that sends its request very slowly (a "slowloris"
+// attack) or never reads the response can keep a connection open forever
+// When TLS is configured, the server also gets the minimum TLS version
+func newServer(cfg *config.Config, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      handler,
+		ReadTimeout:  time.Duration(cfg.ReadTimeoutSec) * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeoutSec) * time.Second,
+		IdleTimeout:  time.Duration(cfg.IdleTimeoutSec) * time.Second,
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSCertFile != "" {
+		minVersion, err := tlsVersion(cfg.TLSMinVersion)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = &tls.Config{MinVersion: minVersion}
+	}
+
+	return server, nil
+}
+
+// serve runs the server until it is shut down, over HTTPS if TLS is configured
+func serve(server *http.Server, cfg *config.Config) error {
+	if cfg.TLSCertFile != "" {
+		log.Printf("Server starting on port %s (HTTPS)", cfg.Port)
+		return server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+
+	log.Printf("Server starting on port %s", cfg.Port)
+	return server.ListenAndServe()
+}
+
+// tlsVersion turns a version from config ("1.2" or "1.3") into its crypto/tls constant
+// Older versions have known weaknesses, so we don't offer them
+func tlsVersion(name string) (uint16, error) {
+	switch name {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("TLS_MIN_VERSION must be 1.2 or 1.3, not %q", name)
+}
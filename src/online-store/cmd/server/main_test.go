@@ -0,0 +1,104 @@
+// cmd/server/main_test.go
+// Tests for setting up the HTTP server
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"online-store/internal/config"
+	"online-store/internal/mqtt"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewServerTimeouts(t *testing.T) {
+	cfg := &config.Config{Port: "8080", ReadTimeoutSec: 15, WriteTimeoutSec: 60, IdleTimeoutSec: 120}
+
+	server, err := newServer(cfg, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	if server.Addr != ":8080" {
+		t.Errorf("Addr = %q, want :8080", server.Addr)
+	}
+	if server.ReadTimeout != 15*time.Second || server.WriteTimeout != time.Minute || server.IdleTimeout != 2*time.Minute {
+		t.Errorf("timeouts = %s/%s/%s, want 15s/1m/2m", server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+}
+
+// fakeMQTT is an MQTT client that never published anything
+type fakeMQTT struct {
+	disconnected bool
+}
+
+func (fakeMQTT) Stats() map[string]mqtt.TopicStats { return map[string]mqtt.TopicStats{} }
+func (m fakeMQTT) Connected() bool                 { return !m.disconnected }
+func (fakeMQTT) BreakerState() string              { return "closed" }
+
+// getHealth calls /health and decodes the response
+func getHealth(t *testing.T, router http.Handler) map[string]interface{} {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return body
+}
+
+func TestHealthReportsBuild(t *testing.T) {
+	oldVersion, oldCommit, oldStartedAt := version, commit, startedAt
+	t.Cleanup(func() { version, commit, startedAt = oldVersion, oldCommit, oldStartedAt })
+
+	// What go build -ldflags "-X main.version=... -X main.commit=..." sets
+	version, commit = "1.2.0", "abc1234"
+	startedAt = time.Now().Add(-time.Hour)
+
+	router := gin.New()
+	router.GET("/health", health(fakeMQTT{}))
+
+	body := getHealth(t, router)
+	for field, want := range map[string]interface{}{
+		"status":         "ok",
+		"version":        "1.2.0",
+		"commit":         "abc1234",
+		"mqtt_connected": true,
+		"mqtt_breaker":   "closed",
+	} {
+		if body[field] != want {
+			t.Errorf("%s = %v, want %v", field, body[field], want)
+		}
+	}
+	first, ok := body["uptime_seconds"].(float64)
+	if !ok || first < 3600 {
+		t.Fatalf("uptime_seconds = %v, want at least an hour", body["uptime_seconds"])
+	}
+
+	// Let five seconds pass
+	startedAt = startedAt.Add(-5 * time.Second)
+	if second := getHealth(t, router)["uptime_seconds"].(float64); second < first+5 {
+		t.Errorf("uptime_seconds = %v after %v and five more seconds, want it to grow", second, first)
+	}
+}
+
+func TestHealthWithoutMQTT(t *testing.T) {
+	// With MQTT_REQUIRED=false we serve HTTP while the broker is down, and say so
+	router := gin.New()
+	router.GET("/health", health(fakeMQTT{disconnected: true}))
+
+	body := getHealth(t, router)
+	if body["status"] != "ok" || body["mqtt_connected"] != false {
+		t.Errorf("status = %v, mqtt_connected = %v; want ok and false", body["status"], body["mqtt_connected"])
+	}
+}
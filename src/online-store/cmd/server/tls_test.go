@@ -0,0 +1,196 @@
+// cmd/server/tls_test.go
+// Tests for serving HTTPS when a certificate is configured
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"online-store/internal/config"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key,
+// and returns their paths and a pool that trusts the certificate
+func writeCertificate(t *testing.T) (certFile, keyFile string, roots *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "online-store test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	roots = x509.NewCertPool()
+	roots.AddCert(cert)
+	return certFile, keyFile, roots
+}
+
+// freePort returns a port nothing is listening on right now
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	return fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// startServer runs the server like main does, and returns its base address
+func startServer(t *testing.T, cfg *config.Config) string {
+	t.Helper()
+
+	cfg.Port = freePort(t)
+	server, err := newServer(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+
+	go serve(server, cfg)
+	t.Cleanup(func() { server.Close() })
+
+	// Wait until it accepts connections
+	address := "127.0.0.1:" + cfg.Port
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			return address
+		}
+	}
+	t.Fatal("server didn't start")
+	return ""
+}
+
+// clientFor returns an HTTP client trusting roots, speaking at most maxVersion of TLS
+func clientFor(roots *x509.CertPool, maxVersion uint16) *http.Client {
+	return &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MaxVersion: maxVersion}},
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile, roots := writeCertificate(t)
+	address := startServer(t, &config.Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "1.2"})
+
+	resp, err := clientFor(roots, 0).Get("https://" + address + "/")
+	if err != nil {
+		t.Fatalf("HTTPS request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("response TLS = %v, status = %d, want TLS and 200", resp.TLS, resp.StatusCode)
+	}
+
+	// Plain HTTP gets no answer from the handler
+	resp, err = clientFor(nil, 0).Get("http://" + address + "/")
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("plain HTTP request to the HTTPS server succeeded")
+		}
+	}
+}
+
+func TestServeTLSMinVersion(t *testing.T) {
+	certFile, keyFile, roots := writeCertificate(t)
+	address := startServer(t, &config.Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "1.3"})
+
+	if _, err := clientFor(roots, tls.VersionTLS12).Get("https://" + address + "/"); err == nil {
+		t.Error("TLS 1.2 client was accepted, want the handshake to fail")
+	}
+
+	resp, err := clientFor(roots, tls.VersionTLS13).Get("https://" + address + "/")
+	if err != nil {
+		t.Fatalf("TLS 1.3 request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("TLS version = %x, want 1.3", resp.TLS.Version)
+	}
+}
+
+func TestServePlainHTTP(t *testing.T) {
+	address := startServer(t, &config.Config{})
+
+	resp, err := clientFor(nil, 0).Get("http://" + address + "/")
+	if err != nil {
+		t.Fatalf("HTTP request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("response TLS = %v, status = %d, want plain HTTP and 200", resp.TLS, resp.StatusCode)
+	}
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantErr string
+	}{
+		{"cert without key", config.Config{TLSCertFile: "cert.pem", TLSMinVersion: "1.2"}, "must be set together"},
+		{"key without cert", config.Config{TLSKeyFile: "key.pem", TLSMinVersion: "1.2"}, "must be set together"},
+		{"old version", config.Config{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", TLSMinVersion: "1.0"}, "TLS_MIN_VERSION"},
+		{"plain HTTP ignores the version", config.Config{TLSMinVersion: "1.0"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := newServer(&tt.cfg, http.NotFoundHandler())
+			if tt.wantErr == "" {
+				if err != nil || server.TLSConfig != nil {
+					t.Errorf("newServer = %v, %v, want a plain HTTP server", server, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
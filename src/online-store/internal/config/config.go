@@ -4,15 +4,122 @@
 package config
 
 import (
+	"log"
+	"math/big"
 	"os"
+	"strconv"
+	"strings"
+)
+
+// Feature flags - behavior that can be switched on and off without a redeploy
+const (
+	FeatureGuestCheckout      = "guest_checkout"       // Ordering without an account (on by default)
+	FeatureObfuscatedOrderIDs = "obfuscated_order_ids" // Customers see order codes instead of sequential IDs (off by default)
+	FeatureListEnvelope       = "list_envelope"        // Lists come as {"data": [...], "meta": {...}} instead of bare arrays (off by default)
+	FeatureRichOrderEvents    = "rich_order_events"    // order/created also carries the product name and customer email (off by default)
 )
 
 // Config holds all our application settings
 type Config struct {
-	DatabaseURL string // Where to find our database
-	MQTTBroker  string // Where to find our MQTT broker
-	JWTSecret   string // Secret key for creating secure tokens
-	Port        string // What port our web server should listen on
+	DatabaseURL   string // Where to find our database
+	MQTTBroker    string // Where to find our MQTT broker
+	MQTTQuiesceMs uint   // How long (milliseconds) in-flight MQTT messages get to finish on shutdown
+	MQTTRequired  bool   // Refuse to start without the MQTT broker; if false, connect in the background
+	JWTSecret     string // Secret key for creating secure tokens (HS256)
+	JWTIssuer     string // Who issues our tokens (the "iss" claim)
+	JWTAudience   string // Who our tokens are meant for (the "aud" claim)
+	Port          string // What port our web server should listen on
+	GzipMinBytes  int    // Responses smaller than this aren't compressed
+	Currency      string // ISO 4217 code all our prices are in (e.g. USD, EUR, JPY)
+	MaxOrderQty   int    // Most units of a product a single order line may contain
+	RefreshTTL    int    // How many hours a refresh token stays valid
+	MaxSessions   int    // Most active sessions (refresh tokens) per user; 0 means no limit
+
+	MQTTShareGroup   string   // Shared subscription group for MQTTSharedTopics; empty turns sharing off
+	MQTTSharedTopics []string // Topics only one of our instances should process
+	MQTTCompressMin  int      // Gzip MQTT payloads at least this many bytes; 0 turns it off
+
+	MQTTDrainTimeoutSec int // How long (seconds) running MQTT message handlers get to finish on shutdown
+
+	// Circuit breaker for MQTT publishing: after MQTTBreakerFailures failures in a row,
+	// publishes fail right away for MQTTBreakerCooldownSec, then one probe is tried
+	MQTTBreakerFailures    int    // 0 turns the breaker off
+	MQTTBreakerCooldownSec int    // Seconds before a probe publish is tried
+	MQTTBreakerPolicy      string // While open: "queue" events in the outbox (default) or "drop" them
+
+	AllowedContentTypes []string // Media types accepted for POST/PUT/PATCH bodies
+	SanitizePolicy      string   // What to do with HTML in product text: "escape", "strip" or "none"
+	MaxPerCategory      int      // Most products a single category may hold; 0 means no limit
+	DefaultStock        int      // Stock of new products created without a stock_quantity
+	SlowQueryMs         int      // SQL statements slower than this (milliseconds) are logged; 0 turns it off
+
+	// JWT signing: HS256 uses JWTSecret, RS256 uses the two PEM key files
+	JWTAlgorithm      string // "HS256" (default) or "RS256"
+	JWTPrivateKeyFile string // RS256 private key, used to sign tokens
+	JWTPublicKeyFile  string // RS256 public key, used to check tokens
+	JWTLeewaySec      int    // Clock difference (seconds) tolerated when checking a token's expiry
+	EmailCheckLimit   int    // Email availability checks allowed per client IP per minute
+
+	AdminRoleFromDB bool // Admin routes check the user's role in the database, not just in their token
+
+	VerificationResendLimit int // Verification email resends allowed per client IP per hour
+
+	// Waiting for the database at startup (it may still be booting in a container setup)
+	DBConnectAttempts  int // How many times to try reaching the database before giving up
+	DBConnectBackoffMs int // Wait after the first failed attempt (milliseconds); doubles each time
+
+	SeedDataFile string // JSON file with the sample products for a new database; empty uses the built-in ones
+
+	StatementCacheSize int // Most SQL statements kept prepared for reuse; 0 turns statement caching off
+
+	// SQL statements running longer than this (milliseconds) are cancelled; 0 means no limit
+	// Streamed downloads (CSV export, NDJSON catalog, data export) have no read limit
+	DBReadTimeoutMs  int // Queries that only read
+	DBWriteTimeoutMs int // Statements that change data, and each transaction as a whole
+
+	MaxProductsListed int // Most products GET /api/products returns; 0 means no limit
+	CORSMaxAgeSec     int // How long browsers may cache a CORS preflight answer (seconds); 0 leaves it to the browser
+
+	RequestIDHeader string // Header a request's ID is read from and sent back in, e.g. X-Correlation-ID to match a tracing stack
+
+	ListDescriptionLength int // Product descriptions in list responses are shortened to this many characters; 0 means full text
+	OutboxRetrySec        int // How often events that failed to publish are retried (seconds)
+
+	OrderRetentionDays int // Delivered orders older than this many days are moved to orders_archive; 0 keeps them forever
+
+	PasswordHashAlgorithm string // How new passwords are hashed: "bcrypt" (default) or "argon2id"
+	MaxConcurrentOrders   int    // Orders that may be placed at the same moment; more get 503 (0 means no limit)
+
+	MinPasswordScore int // Weakest password strength (0-4, see passwords.Score) accepted at registration; 0 turns the check off
+
+	MaxConcurrentPerClient int // Requests a single client IP may have running at once; more get 429 (0 means no limit)
+
+	LogSamplePercent int // Percentage of successful requests that are logged; failed ones always are
+
+	SKUPrefix string // Products created without a SKU get one like "SKU-000123"; empty turns that off
+
+	BackInStockMin int // A product is "back in stock" once a restock lifts its stock from below this to at least this
+
+	RiskHoldThreshold int // Orders flagged on risk/flag with a score (0-100) at least this high are put on hold
+
+	CurrencyRates map[string]*big.Rat // What one unit of Currency is worth in other currencies, for showing converted prices
+
+	Features map[string]bool // Feature flags that are switched on - check them with Enabled
+
+	RouteConcurrency map[string]int // Most requests running at once per route, e.g. for expensive exports
+
+	OrderIDSecret string // Secret for turning order IDs into codes (feature obfuscated_order_ids); changing it breaks old codes
+
+	// HTTP server timeouts in seconds - they stop slow or stuck clients from holding connections forever
+	ReadTimeoutSec  int // Time allowed to read a whole request, body included
+	WriteTimeoutSec int // Time allowed to write a response (raise it if big CSV exports get cut off)
+	IdleTimeoutSec  int // How long an idle keep-alive connection stays open
+
+	// HTTPS: with both files set, the server speaks TLS itself; otherwise plain HTTP
+	// (e.g. behind a load balancer that terminates TLS for us)
+	TLSCertFile   string // PEM certificate (chain) file
+	TLSKeyFile    string // PEM private key file
+	TLSMinVersion string // Oldest TLS version accepted: "1.2" (default) or "1.3"
 }
 
 // Load reads environment variables and creates a Config struct
@@ -20,13 +127,109 @@ func Load() *Config {
 	return &Config{
 		// Fixed default database URL with parseTime=true parameter
 		// This is CRUCIAL for handling MySQL datetime columns properly
-		DatabaseURL: getEnv("DATABASE_URL", "storeuser:storepass@tcp(localhost:3306)/onlinestore?parseTime=true"),
-		MQTTBroker:  getEnv("MQTT_BROKER", "tcp://localhost:1883"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production"),
-		Port:        getEnv("PORT", "8080"),
+		DatabaseURL:   getEnv("DATABASE_URL", "storeuser:storepass@tcp(localhost:3306)/onlinestore?parseTime=true"),
+		MQTTBroker:    getEnv("MQTT_BROKER", "tcp://localhost:1883"),
+		MQTTQuiesceMs: uint(getEnvInt("MQTT_QUIESCE_MS", 250)), // Raise this if QoS 1 publishes get dropped under load
+		MQTTRequired:  getEnvBool("MQTT_REQUIRED", true),
+		JWTSecret:     getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production"),
+		JWTIssuer:     getEnv("JWT_ISSUER", "online-store"),
+		JWTAudience:   getEnv("JWT_AUDIENCE", "online-store-api"),
+		Port:          getEnv("PORT", "8080"),
+		GzipMinBytes:  getEnvInt("GZIP_MIN_BYTES", 1024),
+		Currency:      getEnv("CURRENCY", "USD"),
+		MaxOrderQty:   getEnvInt("MAX_ORDER_QUANTITY", 1000),
+		RefreshTTL:    getEnvInt("REFRESH_TOKEN_TTL_HOURS", 720), // 30 days
+		MaxSessions:   getEnvInt("MAX_SESSIONS_PER_USER", 0),
+
+		MQTTShareGroup:   getEnv("MQTT_SHARE_GROUP", ""),
+		MQTTSharedTopics: getEnvList("MQTT_SHARED_TOPICS", []string{"payment/confirmed", "inventory/update", "inventory/sync"}),
+		MQTTCompressMin:  getEnvInt("MQTT_COMPRESS_MIN_BYTES", 0),
+
+		MQTTDrainTimeoutSec: getEnvInt("MQTT_DRAIN_TIMEOUT_SEC", 10),
+
+		MQTTBreakerFailures:    getEnvInt("MQTT_BREAKER_FAILURES", 5),
+		MQTTBreakerCooldownSec: getEnvInt("MQTT_BREAKER_COOLDOWN_SEC", 30),
+		MQTTBreakerPolicy:      getEnv("MQTT_BREAKER_POLICY", "queue"),
+
+		AllowedContentTypes: getEnvList("ALLOWED_CONTENT_TYPES", []string{"application/json"}),
+		SanitizePolicy:      getEnv("SANITIZE_POLICY", "escape"),
+		MaxPerCategory:      getEnvInt("MAX_PRODUCTS_PER_CATEGORY", 0),
+		DefaultStock:        getEnvInt("DEFAULT_STOCK_QUANTITY", 0),
+		SlowQueryMs:         getEnvInt("SLOW_QUERY_MS", 200),
+
+		JWTAlgorithm:      getEnv("JWT_ALGORITHM", "HS256"),
+		JWTPrivateKeyFile: getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTPublicKeyFile:  getEnv("JWT_PUBLIC_KEY_FILE", ""),
+		JWTLeewaySec:      getEnvInt("JWT_LEEWAY_SEC", 30),
+		EmailCheckLimit:   getEnvInt("EMAIL_CHECK_RATE_LIMIT", 10),
+
+		AdminRoleFromDB: getEnvBool("ADMIN_ROLE_FROM_DB", false),
+
+		VerificationResendLimit: getEnvInt("VERIFICATION_RESEND_RATE_LIMIT", 5),
+
+		DBConnectAttempts:  getEnvInt("DB_CONNECT_ATTEMPTS", 10),
+		DBConnectBackoffMs: getEnvInt("DB_CONNECT_BACKOFF_MS", 500),
+
+		SeedDataFile: getEnv("SEED_DATA_FILE", ""),
+
+		StatementCacheSize: getEnvInt("DB_STATEMENT_CACHE_SIZE", 0),
+
+		DBReadTimeoutMs:  getEnvInt("DB_READ_TIMEOUT_MS", 0),
+		DBWriteTimeoutMs: getEnvInt("DB_WRITE_TIMEOUT_MS", 0),
+
+		MaxProductsListed: getEnvInt("MAX_PRODUCTS_LISTED", 500),
+		CORSMaxAgeSec:     getEnvInt("CORS_MAX_AGE_SEC", 600),
+
+		RequestIDHeader: getEnv("REQUEST_ID_HEADER", "X-Request-ID"),
+
+		ListDescriptionLength: getEnvInt("LIST_DESCRIPTION_LENGTH", 200),
+		OutboxRetrySec:        getEnvInt("OUTBOX_RETRY_INTERVAL_SEC", 30),
+
+		OrderRetentionDays: getEnvInt("ORDER_RETENTION_DAYS", 0),
+
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "bcrypt"),
+		MaxConcurrentOrders:   getEnvInt("MAX_CONCURRENT_ORDERS", 50),
+
+		MinPasswordScore: getEnvInt("MIN_PASSWORD_SCORE", 0),
+
+		MaxConcurrentPerClient: getEnvInt("MAX_CONCURRENT_REQUESTS_PER_IP", 20),
+
+		LogSamplePercent: getEnvInt("LOG_SAMPLE_PERCENT", 100),
+
+		SKUPrefix: getEnv("SKU_PREFIX", ""),
+
+		BackInStockMin: getEnvInt("BACK_IN_STOCK_MIN_STOCK", 1),
+
+		RiskHoldThreshold: getEnvInt("RISK_HOLD_THRESHOLD", 80),
+
+		// CURRENCY_RATES looks like "EUR=0.92,GBP=0.79,JPY=151.3"
+		CurrencyRates: getEnvRates("CURRENCY_RATES"),
+
+		// FEATURES lists the switched-on flags, e.g. "guest_checkout,auto_reorder"
+		// Set it to an empty value to switch every feature off
+		Features: getEnvSet("FEATURES", []string{FeatureGuestCheckout}),
+
+		// ROUTE_CONCURRENCY_LIMITS looks like "/api/admin/orders/export=2,/api/products/stream=5"
+		RouteConcurrency: getEnvLimits("ROUTE_CONCURRENCY_LIMITS", map[string]int{"/api/admin/orders/export": 2}),
+
+		OrderIDSecret: getEnv("ORDER_ID_SECRET", "your-order-id-secret-change-this-in-production"),
+
+		ReadTimeoutSec:  getEnvInt("HTTP_READ_TIMEOUT_SEC", 15),
+		WriteTimeoutSec: getEnvInt("HTTP_WRITE_TIMEOUT_SEC", 60),
+		IdleTimeoutSec:  getEnvInt("HTTP_IDLE_TIMEOUT_SEC", 120),
+
+		TLSCertFile:   getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:    getEnv("TLS_KEY_FILE", ""),
+		TLSMinVersion: getEnv("TLS_MIN_VERSION", "1.2"),
 	}
 }
 
+// Enabled reports whether a feature flag is switched on
+// Flags nobody switched on - including misspelled ones - are off
+func (c *Config) Enabled(feature string) bool {
+	return c.Features[feature]
+}
+
 // getEnv is a helper function that gets an environment variable
 // If the environment variable doesn't exist, it returns the fallback value
 func getEnv(key, fallback string) string {
@@ -35,3 +238,104 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvInt is like getEnv but for whole numbers
+// If the value is missing or not a valid number, it returns the fallback value
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %d", value, key, fallback)
+		return fallback
+	}
+	return number
+}
+
+// getEnvBool is like getEnv but for true/false values ("1", "true", "false", ...)
+// If the value is missing or not a valid boolean, it returns the fallback value
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %t", value, key, fallback)
+		return fallback
+	}
+	return enabled
+}
+
+// getEnvList is like getEnv but for comma-separated lists, e.g. "a, b,c"
+// Empty items are ignored; if nothing is left, it returns the fallback value
+func getEnvList(key string, fallback []string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
+		return fallback
+	}
+	return items
+}
+
+// getEnvSet reads a comma-separated list like getEnvList, as a set
+// Unlike getEnvList, a variable that is set but empty means "nothing", not the fallback
+func getEnvSet(key string, fallback []string) map[string]bool {
+	items := fallback
+	if value, ok := os.LookupEnv(key); ok {
+		items = strings.Split(value, ",")
+	}
+
+	set := make(map[string]bool)
+	for _, item := range items {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			set[item] = true
+		}
+	}
+	return set
+}
+
+// getEnvLimits reads a comma-separated list of name=number pairs
+// Invalid pairs are logged and skipped; if none are valid, fallback is used
+func getEnvLimits(key string, fallback map[string]int) map[string]int {
+	limits := make(map[string]int)
+	for _, item := range getEnvList(key, nil) {
+		name, value, ok := strings.Cut(item, "=")
+		number, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil {
+			log.Printf("Invalid entry %q in %s, expected name=number", item, key)
+			continue
+		}
+		limits[strings.TrimSpace(name)] = number
+	}
+
+	if len(limits) == 0 {
+		return fallback
+	}
+	return limits
+}
+
+// getEnvRates reads a comma-separated list of currency=rate pairs, e.g. "EUR=0.92"
+// Rates are read as exact decimals; invalid pairs and rates of 0 or less are logged and skipped
+func getEnvRates(key string) map[string]*big.Rat {
+	rates := make(map[string]*big.Rat)
+	for _, item := range getEnvList(key, nil) {
+		currency, value, ok := strings.Cut(item, "=")
+		rate, valid := new(big.Rat).SetString(strings.TrimSpace(value))
+		if !ok || !valid || rate.Sign() <= 0 {
+			log.Printf("Invalid entry %q in %s, expected currency=rate", item, key)
+			continue
+		}
+		rates[strings.ToUpper(strings.TrimSpace(currency))] = rate
+	}
+	return rates
+}
@@ -0,0 +1,137 @@
+// internal/config/config_test.go
+// Tests for reading settings from the environment
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMQTTQuiesce(t *testing.T) {
+	if got := Load().MQTTQuiesceMs; got != 250 {
+		t.Errorf("default MQTTQuiesceMs = %d, want 250", got)
+	}
+
+	t.Setenv("MQTT_QUIESCE_MS", "2000")
+	if got := Load().MQTTQuiesceMs; got != 2000 {
+		t.Errorf("MQTTQuiesceMs = %d, want 2000", got)
+	}
+
+	t.Setenv("MQTT_QUIESCE_MS", "soon")
+	if got := Load().MQTTQuiesceMs; got != 250 {
+		t.Errorf("MQTTQuiesceMs for an invalid value = %d, want the default 250", got)
+	}
+}
+
+func TestHTTPTimeouts(t *testing.T) {
+	cfg := Load()
+	if cfg.ReadTimeoutSec != 15 || cfg.WriteTimeoutSec != 60 || cfg.IdleTimeoutSec != 120 {
+		t.Errorf("default timeouts = %d/%d/%d, want 15/60/120", cfg.ReadTimeoutSec, cfg.WriteTimeoutSec, cfg.IdleTimeoutSec)
+	}
+
+	t.Setenv("HTTP_WRITE_TIMEOUT_SEC", "300")
+	if got := Load().WriteTimeoutSec; got != 300 {
+		t.Errorf("WriteTimeoutSec = %d, want 300", got)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	// Guest checkout is the only flag on by default
+	cfg := Load()
+	if !cfg.Enabled(FeatureGuestCheckout) || cfg.Enabled(FeatureListEnvelope) {
+		t.Errorf("default features = %v, want only %s", cfg.Features, FeatureGuestCheckout)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		enabled []string
+		off     []string
+	}{
+		{"list", "list_envelope, Rich_Order_Events", []string{FeatureListEnvelope, FeatureRichOrderEvents}, []string{FeatureGuestCheckout, FeatureObfuscatedOrderIDs}},
+		{"empty switches everything off", "", nil, []string{FeatureGuestCheckout, FeatureListEnvelope}},
+		{"blank entries are skipped", ",guest_checkout,,", []string{FeatureGuestCheckout}, []string{""}},
+		{"unknown flags are off", "auto_reorder", []string{"auto_reorder"}, []string{"auto_reoder", "caching", FeatureGuestCheckout}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FEATURES", tt.value)
+			cfg := Load()
+			for _, feature := range tt.enabled {
+				if !cfg.Enabled(feature) {
+					t.Errorf("%q is off, want on", feature)
+				}
+			}
+			for _, feature := range tt.off {
+				if cfg.Enabled(feature) {
+					t.Errorf("%q is on, want off", feature)
+				}
+			}
+		})
+	}
+
+	// A config built without Load has no flags at all
+	if (&Config{}).Enabled(FeatureGuestCheckout) {
+		t.Error("zero Config has guest checkout on, want off")
+	}
+}
+
+func TestRouteConcurrency(t *testing.T) {
+	if got, want := Load().RouteConcurrency, map[string]int{"/api/admin/orders/export": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("default RouteConcurrency = %v, want %v", got, want)
+	}
+
+	// Broken entries are skipped
+	t.Setenv("ROUTE_CONCURRENCY_LIMITS", " /api/admin/orders/export = 1, /api/products/:id=5, /api/orders, /api/cart=lots")
+	want := map[string]int{"/api/admin/orders/export": 1, "/api/products/:id": 5}
+	if got := Load().RouteConcurrency; !reflect.DeepEqual(got, want) {
+		t.Errorf("RouteConcurrency = %v, want %v", got, want)
+	}
+
+	// With nothing valid, the default stays
+	t.Setenv("ROUTE_CONCURRENCY_LIMITS", "nonsense")
+	if got := Load().RouteConcurrency["/api/admin/orders/export"]; got != 2 {
+		t.Errorf("export limit for an invalid value = %d, want the default 2", got)
+	}
+}
+
+func TestMQTTRequired(t *testing.T) {
+	if !Load().MQTTRequired {
+		t.Error("MQTTRequired is off by default, want on")
+	}
+
+	t.Setenv("MQTT_REQUIRED", "false")
+	if Load().MQTTRequired {
+		t.Error("MQTTRequired with MQTT_REQUIRED=false is on, want off")
+	}
+}
+
+func TestCurrencyRates(t *testing.T) {
+	if got := Load().CurrencyRates; len(got) != 0 {
+		t.Errorf("default CurrencyRates = %v, want none", got)
+	}
+
+	t.Setenv("CURRENCY_RATES", "eur=0.92, JPY=151.3,GBP,CHF=-1,XYZ=abc")
+	rates := Load().CurrencyRates
+	got := make(map[string]string, len(rates))
+	for currency, rate := range rates {
+		got[currency] = rate.RatString()
+	}
+	// Invalid pairs are skipped; rates are kept as exact fractions
+	want := map[string]string{"EUR": "23/25", "JPY": "1513/10"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CurrencyRates = %v, want %v", got, want)
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	if got := Load().RequestIDHeader; got != "X-Request-ID" {
+		t.Errorf("default RequestIDHeader = %q, want X-Request-ID", got)
+	}
+
+	t.Setenv("REQUEST_ID_HEADER", "X-Correlation-ID")
+	if got := Load().RequestIDHeader; got != "X-Correlation-ID" {
+		t.Errorf("RequestIDHeader = %q, want X-Correlation-ID", got)
+	}
+}
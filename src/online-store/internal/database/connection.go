@@ -4,15 +4,22 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql" // MySQL driver (MariaDB is compatible)
 )
 
 // Connect creates a connection to the database
 // Fixed to handle MySQL datetime properly
-func Connect(databaseURL string) (*sql.DB, error) {
+// Statements slower than slowQuery are logged (0 turns that off)
+// If the database isn't reachable yet, it is retried as retry says
+// A new, empty database gets the sample products from seedFile (see loadSeedProducts)
+// Up to statementCacheSize statements are prepared once and reused (0 turns that off)
+// Statements that run longer than timeouts allow are cancelled
+func Connect(databaseURL string, slowQuery time.Duration, retry Retry, seedFile string, statementCacheSize int, timeouts Timeouts) (*DB, error) {
 	// Add parseTime=true to handle datetime columns properly
 	// This tells the MySQL driver to parse TIME and DATETIME values to time.Time
 	if databaseURL != "" && !contains(databaseURL, "parseTime=true") {
@@ -30,8 +37,9 @@ func Connect(databaseURL string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Test the connection by pinging the database
-	if err := db.Ping(); err != nil {
+	// Test the connection by pinging the database, waiting for it to start if needed
+	if err := pingWithRetry(db.Ping, retry, time.Sleep); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
@@ -40,11 +48,17 @@ func Connect(databaseURL string) (*sql.DB, error) {
 	db.SetMaxIdleConns(25)
 
 	// Create tables if they don't exist
-	if err := createTables(db); err != nil {
+	if err := createTables(db, seedFile); err != nil {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
-	return db, nil
+	return &DB{
+		DB:            db,
+		slowThreshold: slowQuery,
+		statements:    newStatementCache(statementCacheSize),
+		timeouts:      timeouts,
+		withTimeout:   context.WithTimeout,
+	}, nil
 }
 
 // Helper function to check if string contains substring
@@ -66,7 +80,7 @@ func containsAt(s, substr string) bool {
 }
 
 // createTables creates all the database tables we need
-func createTables(db *sql.DB) error {
+func createTables(db *sql.DB, seedFile string) error {
 	// SQL queries to create our tables
 	// Fixed datetime handling for better compatibility
 	queries := []string{
@@ -74,15 +88,28 @@ func createTables(db *sql.DB) error {
 			id INT AUTO_INCREMENT PRIMARY KEY,
 			email VARCHAR(255) UNIQUE NOT NULL,
 			password_hash VARCHAR(255) NOT NULL,
+			role ENUM('customer', 'admin') NOT NULL DEFAULT 'customer',
+			is_guest BOOLEAN NOT NULL DEFAULT FALSE,
+			email_verified_at DATETIME NULL,
+			verification_token_hash CHAR(64) NULL UNIQUE,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
 		`CREATE TABLE IF NOT EXISTS products (
 			id INT AUTO_INCREMENT PRIMARY KEY,
+			sku VARCHAR(64) NULL UNIQUE,
 			name VARCHAR(255) NOT NULL,
 			description TEXT,
+			category VARCHAR(100) NULL,
 			price_cents INT NOT NULL,
 			stock_quantity INT DEFAULT 0,
+			sale_price_cents INT NULL,
+			sale_ends_at DATETIME NULL,
+			reorder_level INT NOT NULL DEFAULT 10,
+			max_per_order INT NULL,
+			status ENUM('draft', 'published') NOT NULL DEFAULT 'published',
+			available_from DATETIME NULL,
+			available_until DATETIME NULL,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
@@ -92,11 +119,170 @@ func createTables(db *sql.DB) error {
 			product_id INT NOT NULL,
 			quantity INT NOT NULL,
 			total_cents INT NOT NULL,
-			status ENUM('pending', 'paid', 'shipped', 'delivered') DEFAULT 'pending',
+			status ENUM('pending', 'paid', 'shipped', 'delivered', 'on_hold') DEFAULT 'pending',
+			held_from ENUM('pending', 'paid') NULL,
+			tracking_token_hash CHAR(64) NULL UNIQUE,
+			note TEXT NULL,
+			invoice_number VARCHAR(20) NULL UNIQUE,
+			tracking_number VARCHAR(100) NULL,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (user_id) REFERENCES users(id),
 			FOREIGN KEY (product_id) REFERENCES products(id)
 		)`,
+
+		// Recent events per product, for debugging what was published about it
+		`CREATE TABLE IF NOT EXISTS product_events (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			product_id INT NOT NULL,
+			event_type VARCHAR(50) NOT NULL,
+			topic VARCHAR(100) NULL,
+			payload JSON,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_product_events_product (product_id, id),
+			FOREIGN KEY (product_id) REFERENCES products(id)
+		)`,
+
+		// Events waiting for the outbox worker: ones that failed to publish, and
+		// ones saved in the same transaction as their change (like order/created)
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			topic VARCHAR(255) NOT NULL,
+			payload JSON NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// The last invoice number handed out in each year
+		// Replaced by the sequences table; kept so its numbers can be copied over
+		`CREATE TABLE IF NOT EXISTS invoice_sequences (
+			year INT PRIMARY KEY,
+			last_number INT NOT NULL
+		)`,
+
+		// Counters for numbers we hand out: "invoice-<year>" and "sku"
+		`CREATE TABLE IF NOT EXISTS sequences (
+			name VARCHAR(50) PRIMARY KEY,
+			last_value INT NOT NULL
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS product_price_history (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			product_id INT NOT NULL,
+			old_price_cents INT NOT NULL,
+			new_price_cents INT NOT NULL,
+			changed_by INT NULL,
+			changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_price_history_product (product_id, changed_at),
+			FOREIGN KEY (product_id) REFERENCES products(id),
+			FOREIGN KEY (changed_by) REFERENCES users(id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NULL,
+			action VARCHAR(50) NOT NULL,
+			entity VARCHAR(50) NOT NULL,
+			entity_id INT NOT NULL,
+			detail JSON,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_audit_entity (entity, entity_id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+
+		// One row per login session; only hashes of refresh tokens are stored
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			user_agent VARCHAR(255) NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME NULL,
+			INDEX idx_refresh_tokens_user (user_id, revoked_at),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+
+		// Written by the payment service; read on startup to catch up on
+		// payment/confirmed messages we missed while we were down
+		// order_id has no foreign key: the order may have been moved to orders_archive
+		`CREATE TABLE IF NOT EXISTS payments (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			order_id INT NOT NULL,
+			status ENUM('confirmed', 'failed') NOT NULL,
+			confirmed_at DATETIME NOT NULL,
+			INDEX idx_payments_confirmed_at (confirmed_at),
+			INDEX idx_payments_order (order_id)
+		)`,
+
+		// Delivered orders older than the retention period, moved out of orders by the archiver
+		// Same columns as orders, plus when the order was archived
+		`CREATE TABLE IF NOT EXISTS orders_archive (
+			id INT PRIMARY KEY,
+			user_id INT NOT NULL,
+			product_id INT NOT NULL,
+			quantity INT NOT NULL,
+			total_cents INT NOT NULL,
+			status ENUM('pending', 'paid', 'shipped', 'delivered', 'on_hold') NOT NULL,
+			held_from ENUM('pending', 'paid') NULL,
+			tracking_token_hash CHAR(64) NULL,
+			note TEXT NULL,
+			invoice_number VARCHAR(20) NULL,
+			tracking_number VARCHAR(100) NULL,
+			created_at DATETIME NOT NULL,
+			archived_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_orders_archive_user (user_id),
+			INDEX idx_orders_archive_created_at (created_at)
+		)`,
+
+		// Customers waiting for a sold-out product; cleared once they were notified
+		`CREATE TABLE IF NOT EXISTS waitlist (
+			product_id INT NOT NULL,
+			user_id INT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (product_id, user_id),
+			FOREIGN KEY (product_id) REFERENCES products(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+
+		// Remembers how far each reconciliation job got
+		`CREATE TABLE IF NOT EXISTS reconciliation_state (
+			name VARCHAR(50) PRIMARY KEY,
+			last_reconciled_at DATETIME NOT NULL
+		)`,
+
+		// Columns added after the first release
+		// IF NOT EXISTS lets these run safely against databases created earlier
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS role ENUM('customer', 'admin') NOT NULL DEFAULT 'customer'`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR(64) NULL UNIQUE`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS is_guest BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_token_hash CHAR(64) NULL UNIQUE`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS sale_price_cents INT NULL`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS sale_ends_at DATETIME NULL`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS reorder_level INT NOT NULL DEFAULT 10`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS category VARCHAR(100) NULL`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS note TEXT NULL`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS max_per_order INT NULL`,
+		`ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_agent VARCHAR(255) NULL`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS invoice_number VARCHAR(20) NULL UNIQUE`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_number VARCHAR(100) NULL`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at DATETIME NULL`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS status ENUM('draft', 'published') NOT NULL DEFAULT 'published'`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS verification_token_hash CHAR(64) NULL UNIQUE`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS available_from DATETIME NULL`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS available_until DATETIME NULL`,
+		`ALTER TABLE orders MODIFY COLUMN status ENUM('pending', 'paid', 'shipped', 'delivered', 'on_hold') DEFAULT 'pending'`,
+		`ALTER TABLE orders_archive MODIFY COLUMN status ENUM('pending', 'paid', 'shipped', 'delivered', 'on_hold') NOT NULL`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS held_from ENUM('pending', 'paid') NULL`,
+		`ALTER TABLE orders_archive ADD COLUMN IF NOT EXISTS held_from ENUM('pending', 'paid') NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_orders_archive_tracking ON orders_archive (tracking_token_hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_products_category ON products (category)`,
+		`ALTER TABLE payments DROP FOREIGN KEY IF EXISTS payments_ibfk_1`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_password_hash VARCHAR(255) NULL`,
+
+		// Carry invoice numbering over from invoice_sequences (IGNORE keeps counters already moved)
+		`INSERT IGNORE INTO sequences (name, last_value)
+			SELECT CONCAT('invoice-', year), last_number FROM invoice_sequences`,
 	}
 
 	// Execute each CREATE TABLE query
@@ -107,7 +293,7 @@ func createTables(db *sql.DB) error {
 	}
 
 	// Insert some sample products if the products table is empty
-	if err := insertSampleData(db); err != nil {
+	if err := insertSampleData(db, seedFile); err != nil {
 		return fmt.Errorf("failed to insert sample data: %w", err)
 	}
 
@@ -115,7 +301,8 @@ func createTables(db *sql.DB) error {
 }
 
 // insertSampleData adds some example products to the database
-func insertSampleData(db *sql.DB) error {
+// They come from seedFile, or are the built-in ones if it's empty
+func insertSampleData(db *sql.DB, seedFile string) error {
 	// Check if we already have products
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM products").Scan(&count)
@@ -129,23 +316,16 @@ func insertSampleData(db *sql.DB) error {
 	}
 
 	// Sample products to insert
-	products := []struct {
-		name        string
-		description string
-		priceCents  int
-		stock       int
-	}{
-		{"Go Programming Book", "Learn Go programming from scratch", 2999, 50},
-		{"MQTT Sensor Kit", "IoT sensor kit with MQTT support", 4999, 25},
-		{"Docker T-Shirt", "Comfortable cotton t-shirt with Docker logo", 1999, 100},
-		{"Wireless Mouse", "Ergonomic wireless mouse for developers", 3499, 75},
+	products, err := loadSeedProducts(seedFile)
+	if err != nil {
+		return err
 	}
 
 	// Insert each sample product
 	for _, product := range products {
 		_, err := db.Exec(
-			"INSERT INTO products (name, description, price_cents, stock_quantity) VALUES (?, ?, ?, ?)",
-			product.name, product.description, product.priceCents, product.stock,
+			"INSERT INTO products (name, description, category, price_cents, stock_quantity) VALUES (?, ?, NULLIF(?, ''), ?, ?)",
+			product.Name, product.Description, product.Category, product.PriceCents, product.StockQuantity,
 		)
 		if err != nil {
 			return err
@@ -0,0 +1,152 @@
+// internal/database/fakes_test.go
+// A fake SQL driver, so DB can be tested without MariaDB
+
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver answers every statement with one row holding 1
+// Statements listed in delays take that long (or until their context ends)
+type fakeDriver struct {
+	mu       sync.Mutex
+	delays   map[string]time.Duration
+	prepares int // How many statements were prepared
+	runs     int // How many statements were run
+}
+
+// Connect and Driver make fakeDriver a driver.Connector, for sql.OpenDB
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) { return &fakeConn{driver: d}, nil }
+func (d *fakeDriver) Driver() driver.Driver                        { return d }
+func (d *fakeDriver) Open(string) (driver.Conn, error)             { return &fakeConn{driver: d}, nil }
+
+// counts returns how many statements were prepared and run
+func (d *fakeDriver) counts() (prepares, runs int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.prepares, d.runs
+}
+
+// fakeConn is one connection of the pool
+// It has no Exec or Query of its own, so database/sql prepares every statement
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.driver.prepares++
+	return &fakeStmt{driver: c.driver, query: query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+// fakeStmt is a prepared statement
+type fakeStmt struct {
+	driver *fakeDriver
+	query  string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip // database/sql uses ExecContext
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, driver.ErrSkip // database/sql uses QueryContext
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.run(ctx); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.run(ctx); err != nil {
+		return nil, err
+	}
+	return &fakeRows{}, nil
+}
+
+// run waits as long as the statement is supposed to take
+func (s *fakeStmt) run(ctx context.Context) error {
+	s.driver.mu.Lock()
+	s.driver.runs++
+	delay := s.driver.delays[s.query]
+	s.driver.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fakeRows is a result with a single row holding 1
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+// newFakeDB returns a DB on a fakeDriver
+func newFakeDB(t testing.TB, slowThreshold time.Duration, statementCacheSize int, timeouts Timeouts) (*DB, *fakeDriver) {
+	t.Helper()
+
+	fake := &fakeDriver{delays: make(map[string]time.Duration)}
+	db := &DB{
+		DB:            sql.OpenDB(fake),
+		slowThreshold: slowThreshold,
+		statements:    newStatementCache(statementCacheSize),
+		timeouts:      timeouts,
+		withTimeout:   context.WithTimeout,
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+// captureLog collects what is logged until the test ends
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
@@ -0,0 +1,51 @@
+// internal/database/retry.go
+// Waiting for the database to come up at startup
+
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// maxRetryBackoff caps the wait between two connection attempts
+const maxRetryBackoff = 30 * time.Second
+
+// Retry says how patiently Connect waits for the database
+// In containers the app often starts before MariaDB is ready to accept connections
+type Retry struct {
+	Attempts int           // How many times to try; 1 (or less) means no retrying
+	Backoff  time.Duration // Wait after the first failure; doubles after each further failure
+}
+
+// pingWithRetry calls ping until it succeeds or the attempts run out
+// sleep is passed in so the waiting can be swapped out (time.Sleep in real use)
+func pingWithRetry(ping func() error, retry Retry, sleep func(time.Duration)) error {
+	attempts := retry.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	wait := retry.Backoff
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = ping(); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		log.Printf("Database not reachable (attempt %d of %d), retrying in %s: %v", attempt, attempts, wait, err)
+		sleep(wait)
+
+		// Wait longer each time, so a database that takes a while doesn't get hammered
+		wait *= 2
+		if wait > maxRetryBackoff {
+			wait = maxRetryBackoff
+		}
+	}
+
+	return fmt.Errorf("database not reachable after %d attempts: %w", attempts, err)
+}
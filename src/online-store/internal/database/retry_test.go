@@ -0,0 +1,81 @@
+// internal/database/retry_test.go
+// Tests for waiting for the database at startup
+
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// flakyPing fails until it has been called failures times
+type flakyPing struct {
+	failures int
+	calls    int
+}
+
+func (p *flakyPing) ping() error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+// recordSleeps collects the waits instead of sleeping
+func recordSleeps(waits *[]time.Duration) func(time.Duration) {
+	return func(d time.Duration) { *waits = append(*waits, d) }
+}
+
+func TestPingWithRetryBecomesReachable(t *testing.T) {
+	db := &flakyPing{failures: 3}
+	var waits []time.Duration
+
+	err := pingWithRetry(db.ping, Retry{Attempts: 5, Backoff: time.Second}, recordSleeps(&waits))
+	if err != nil {
+		t.Fatalf("pingWithRetry: %v", err)
+	}
+	if db.calls != 4 {
+		t.Errorf("pinged %d times, want 4", db.calls)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}; !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v (doubling)", waits, want)
+	}
+}
+
+func TestPingWithRetryGivesUp(t *testing.T) {
+	db := &flakyPing{failures: 100}
+	var waits []time.Duration
+
+	err := pingWithRetry(db.ping, Retry{Attempts: 8, Backoff: 10 * time.Second}, recordSleeps(&waits))
+	if err == nil || err.Error() != "database not reachable after 8 attempts: connection refused" {
+		t.Fatalf("err = %v, want the attempts and the last error", err)
+	}
+	if db.calls != 8 {
+		t.Errorf("pinged %d times, want 8", db.calls)
+	}
+
+	// No wait after the last attempt, and never longer than maxRetryBackoff
+	if len(waits) != 7 {
+		t.Fatalf("waited %d times, want 7", len(waits))
+	}
+	if last := waits[len(waits)-1]; last != maxRetryBackoff {
+		t.Errorf("last wait = %v, want it capped at %v", last, maxRetryBackoff)
+	}
+}
+
+func TestPingWithoutRetry(t *testing.T) {
+	for _, attempts := range []int{0, 1} {
+		db := &flakyPing{failures: 1}
+		var waits []time.Duration
+
+		if err := pingWithRetry(db.ping, Retry{Attempts: attempts, Backoff: time.Second}, recordSleeps(&waits)); err == nil {
+			t.Errorf("attempts %d: no error", attempts)
+		}
+		if db.calls != 1 || len(waits) != 0 {
+			t.Errorf("attempts %d: pinged %d times and waited %d times, want once and never", attempts, db.calls, len(waits))
+		}
+	}
+}
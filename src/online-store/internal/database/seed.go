@@ -0,0 +1,80 @@
+// internal/database/seed.go
+// This file decides which sample products a new, empty database starts with
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SeedProduct is one sample product, as written in a seed data file
+// A seed file is a JSON array of these, e.g.
+//
+//	[{"name": "Desk Lamp", "description": "LED lamp", "price_cents": 2499, "stock_quantity": 40}]
+type SeedProduct struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Category      string `json:"category"` // Optional
+	PriceCents    int    `json:"price_cents"`
+	StockQuantity int    `json:"stock_quantity"`
+}
+
+// defaultSeedProducts are the sample products used when no seed file is configured
+var defaultSeedProducts = []SeedProduct{
+	{Name: "Go Programming Book", Description: "Learn Go programming from scratch", PriceCents: 2999, StockQuantity: 50},
+	{Name: "MQTT Sensor Kit", Description: "IoT sensor kit with MQTT support", PriceCents: 4999, StockQuantity: 25},
+	{Name: "Docker T-Shirt", Description: "Comfortable cotton t-shirt with Docker logo", PriceCents: 1999, StockQuantity: 100},
+	{Name: "Wireless Mouse", Description: "Ergonomic wireless mouse for developers", PriceCents: 3499, StockQuantity: 75},
+}
+
+// loadSeedProducts returns the sample products from the seed file at path,
+// or the built-in ones if path is empty
+// A file that can't be read or has invalid products is an error - silently
+// falling back would hide a typo in a demo setup
+func loadSeedProducts(path string) ([]SeedProduct, error) {
+	if path == "" {
+		return defaultSeedProducts, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open seed data file: %w", err)
+	}
+	defer file.Close()
+
+	// Unknown fields are most likely misspelled ones, so they're rejected
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+
+	var products []SeedProduct
+	if err := decoder.Decode(&products); err != nil {
+		return nil, fmt.Errorf("invalid seed data file %s: %w", path, err)
+	}
+	if len(products) == 0 {
+		return nil, fmt.Errorf("invalid seed data file %s: no products", path)
+	}
+
+	for i, product := range products {
+		if err := product.validate(); err != nil {
+			return nil, fmt.Errorf("invalid seed data file %s: product %d: %w", path, i+1, err)
+		}
+	}
+
+	return products, nil
+}
+
+// validate checks a seed product against the same basic rules as the API
+func (p SeedProduct) validate() error {
+	switch {
+	case strings.TrimSpace(p.Name) == "":
+		return fmt.Errorf("name is required")
+	case p.PriceCents <= 0:
+		return fmt.Errorf("price_cents must be positive")
+	case p.StockQuantity < 0:
+		return fmt.Errorf("stock_quantity can't be negative")
+	}
+	return nil
+}
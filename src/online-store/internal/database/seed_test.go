@@ -0,0 +1,85 @@
+// internal/database/seed_test.go
+// Tests for choosing the sample products of a new database
+
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeSeedFile writes content to a seed file in a temp dir and returns its path
+func writeSeedFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "seed.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write seed file: %v", err)
+	}
+	return path
+}
+
+func TestLoadSeedProductsDefault(t *testing.T) {
+	products, err := loadSeedProducts("")
+	if err != nil {
+		t.Fatalf("loadSeedProducts: %v", err)
+	}
+	if !reflect.DeepEqual(products, defaultSeedProducts) {
+		t.Errorf("products = %+v, want the built-in ones", products)
+	}
+}
+
+func TestLoadSeedProductsFromFile(t *testing.T) {
+	path := writeSeedFile(t, `[
+		{"name": "Desk Lamp", "description": "LED lamp", "price_cents": 2499, "stock_quantity": 40},
+		{"name": "Notebook", "category": "paper", "price_cents": 399, "stock_quantity": 0}
+	]`)
+
+	products, err := loadSeedProducts(path)
+	if err != nil {
+		t.Fatalf("loadSeedProducts: %v", err)
+	}
+	want := []SeedProduct{
+		{Name: "Desk Lamp", Description: "LED lamp", PriceCents: 2499, StockQuantity: 40},
+		{Name: "Notebook", Category: "paper", PriceCents: 399, StockQuantity: 0},
+	}
+	if !reflect.DeepEqual(products, want) {
+		t.Errorf("products = %+v, want %+v", products, want)
+	}
+}
+
+func TestLoadSeedProductsRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"not JSON", `products`, "invalid seed data file"},
+		{"not an array", `{"name": "Lamp", "price_cents": 100}`, "invalid seed data file"},
+		{"empty", `[]`, "no products"},
+		{"unknown field", `[{"name": "Lamp", "price": 100, "stock_quantity": 1}]`, "unknown field"},
+		{"no name", `[{"name": " ", "price_cents": 100, "stock_quantity": 1}]`, "product 1: name is required"},
+		{"free", `[{"name": "Lamp", "price_cents": 100, "stock_quantity": 1}, {"name": "Mug", "price_cents": 0, "stock_quantity": 1}]`, "product 2: price_cents must be positive"},
+		{"negative stock", `[{"name": "Lamp", "price_cents": 100, "stock_quantity": -1}]`, "stock_quantity can't be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadSeedProducts(writeSeedFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSeedProductsMissingFile(t *testing.T) {
+	// A configured file that isn't there is an error, not a silent fallback
+	_, err := loadSeedProducts(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil || !strings.Contains(err.Error(), "failed to open seed data file") {
+		t.Errorf("err = %v, want a failure to open the file", err)
+	}
+}
@@ -0,0 +1,195 @@
+// internal/database/slow_query.go
+// This file wraps the connection pool so slow SQL statements get logged
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"online-store/internal/requestid"
+)
+
+// DB is a *sql.DB that times every statement
+// Statements slower than the threshold are logged with their SQL (with ?
+// placeholders - never the values) and how long they took
+// With a statement cache, statements are prepared once and reused (see statements.go)
+// Reads and writes are cancelled when they take longer than their timeout (see timeouts.go)
+// Because *sql.DB is embedded, every other method (Ping, Stats, ...) still works
+type DB struct {
+	*sql.DB
+	slowThreshold time.Duration   // 0 turns slow query logging off
+	statements    *statementCache // nil when statement caching is off
+	timeouts      Timeouts
+
+	// withTimeout is context.WithTimeout; tests replace it to end a timeout on demand
+	withTimeout func(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc)
+}
+
+// Tx is a transaction whose statements are timed like DB's
+// Its statements run with the transaction's context, so the write timeout
+// also interrupts a statement that is still running
+type Tx struct {
+	*sql.Tx
+	db     *DB
+	ctx    context.Context
+	cancel context.CancelFunc // Releases the transaction's write timeout
+}
+
+// Exec runs a statement that doesn't return rows
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext is Exec with a context
+// If the context carries a request ID, it is included in the slow query log
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := db.writeContext(ctx)
+	defer cancel()
+	defer db.logIfSlow(ctx, query, time.Now())
+	if stmt := db.statements.get(ctx, db.DB, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+// Query runs a statement that returns rows
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext is Query with a context
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.query(db.readContext(ctx), query, args...)
+}
+
+// StreamQuery is Query without the read timeout, for results that are handed
+// to a client row by row while it downloads them (like the CSV export)
+// How long that takes depends on the client, not on the database
+func (db *DB) StreamQuery(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.query(context.Background(), query, args...)
+}
+
+// query runs a statement that returns rows, using the cached statement if there is one
+func (db *DB) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer db.logIfSlow(ctx, query, time.Now())
+	if stmt := db.statements.get(ctx, db.DB, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+// QueryRow runs a statement that returns at most one row
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext is QueryRow with a context
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx = db.readContext(ctx)
+	defer db.logIfSlow(ctx, query, time.Now())
+	if stmt := db.statements.get(ctx, db.DB, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+// Close closes the cached statements, then the connection pool
+func (db *DB) Close() error {
+	db.statements.close()
+	return db.DB.Close()
+}
+
+// Begin starts a transaction whose statements are timed too
+// The whole transaction counts as one write: if it isn't committed within the
+// write timeout, it is rolled back and its statements fail
+func (db *DB) Begin() (*Tx, error) {
+	ctx, cancel := db.writeContext(context.Background())
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Tx{Tx: tx, db: db, ctx: ctx, cancel: cancel}, nil
+}
+
+// Commit commits the transaction
+func (tx *Tx) Commit() error {
+	defer tx.cancel()
+	return tx.Tx.Commit()
+}
+
+// Rollback aborts the transaction
+// Calling it after Commit does nothing (and returns sql.ErrTxDone)
+func (tx *Tx) Rollback() error {
+	defer tx.cancel()
+	return tx.Tx.Rollback()
+}
+
+// Exec runs a statement inside the transaction
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer tx.db.logIfSlow(tx.ctx, query, time.Now())
+	if stmt := tx.cached(query); stmt != nil {
+		defer stmt.Close()
+		return stmt.ExecContext(tx.ctx, args...)
+	}
+	return tx.Tx.ExecContext(tx.ctx, query, args...)
+}
+
+// Query runs a query inside the transaction
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	defer tx.db.logIfSlow(tx.ctx, query, time.Now())
+	if stmt := tx.cached(query); stmt != nil {
+		// Closing the transaction's copy leaves the cached statement (and these rows) alone
+		defer stmt.Close()
+		return stmt.QueryContext(tx.ctx, args...)
+	}
+	return tx.Tx.QueryContext(tx.ctx, query, args...)
+}
+
+// QueryRow runs a single-row query inside the transaction
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer tx.db.logIfSlow(tx.ctx, query, time.Now())
+	if stmt := tx.cached(query); stmt != nil {
+		defer stmt.Close()
+		return stmt.QueryRowContext(tx.ctx, args...)
+	}
+	return tx.Tx.QueryRowContext(tx.ctx, query, args...)
+}
+
+// cached returns the cached statement for query, bound to this transaction,
+// or nil if statement caching is off (or the query isn't cached)
+// The returned statement must be closed; the cached one stays open
+func (tx *Tx) cached(query string) *sql.Stmt {
+	stmt := tx.db.statements.get(tx.ctx, tx.db.DB, query)
+	if stmt == nil {
+		return nil
+	}
+	return tx.Tx.Stmt(stmt)
+}
+
+// logIfSlow logs the statement if it took longer than the threshold
+func (db *DB) logIfSlow(ctx context.Context, query string, start time.Time) {
+	if db.slowThreshold <= 0 {
+		return
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < db.slowThreshold {
+		return
+	}
+
+	id := requestid.FromContext(ctx)
+	if id == "" {
+		id = "-"
+	}
+	log.Printf("Slow query (%s, request %s): %s", elapsed.Round(time.Millisecond), id, compactSQL(query))
+}
+
+// compactSQL puts a multi-line SQL statement on one line for the log
+func compactSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
@@ -0,0 +1,105 @@
+// internal/database/slow_query_test.go
+// Tests for logging slow SQL statements
+
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"online-store/internal/requestid"
+)
+
+const slowSQL = `SELECT id
+	FROM products
+	WHERE price_cents > ?`
+
+func TestSlowQueryIsLogged(t *testing.T) {
+	logs := captureLog(t)
+	db, fake := newFakeDB(t, 20*time.Millisecond, 0, Timeouts{})
+	fake.delays[slowSQL] = 40 * time.Millisecond
+
+	ctx := requestid.NewContext(context.Background(), "req-42")
+	rows, err := db.QueryContext(ctx, slowSQL, 1000)
+	if err != nil {
+		t.Fatalf("QueryContext: %v", err)
+	}
+	rows.Close()
+
+	logged := logs.String()
+	if !strings.Contains(logged, "Slow query") || !strings.Contains(logged, "request req-42") {
+		t.Errorf("log = %q, want a slow query line with the request ID", logged)
+	}
+	// The SQL is on one line, with the placeholder and not the value
+	if !strings.Contains(logged, "SELECT id FROM products WHERE price_cents > ?") || strings.Contains(logged, "1000") {
+		t.Errorf("log = %q, want the compacted SQL without its arguments", logged)
+	}
+}
+
+func TestSlowQueryWithoutRequestID(t *testing.T) {
+	logs := captureLog(t)
+	db, fake := newFakeDB(t, 20*time.Millisecond, 0, Timeouts{})
+	fake.delays["UPDATE products SET stock_quantity = 0"] = 40 * time.Millisecond
+
+	if _, err := db.Exec("UPDATE products SET stock_quantity = 0"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if !strings.Contains(logs.String(), "request -") {
+		t.Errorf("log = %q, want a slow query line without a request ID", logs.String())
+	}
+}
+
+func TestFastQueryIsNotLogged(t *testing.T) {
+	logs := captureLog(t)
+	db, _ := newFakeDB(t, 20*time.Millisecond, 0, Timeouts{})
+
+	var n int
+	if err := db.QueryRow(slowSQL, 1000).Scan(&n); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("log = %q, want nothing for a fast query", logs.String())
+	}
+}
+
+func TestSlowQueryLoggingOff(t *testing.T) {
+	logs := captureLog(t)
+	db, fake := newFakeDB(t, 0, 0, Timeouts{})
+	fake.delays[slowSQL] = 30 * time.Millisecond
+
+	var n int
+	if err := db.QueryRow(slowSQL, 1000).Scan(&n); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("log = %q, want nothing with the threshold at 0", logs.String())
+	}
+}
+
+func TestSlowQueryInTransaction(t *testing.T) {
+	logs := captureLog(t)
+	db, fake := newFakeDB(t, 20*time.Millisecond, 0, Timeouts{})
+	fake.delays["DELETE FROM outbox"] = 40 * time.Millisecond
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM outbox"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if !strings.Contains(logs.String(), "DELETE FROM outbox") {
+		t.Errorf("log = %q, want the slow statement of the transaction", logs.String())
+	}
+}
+
+func TestCompactSQL(t *testing.T) {
+	if got := compactSQL(slowSQL); got != "SELECT id FROM products WHERE price_cents > ?" {
+		t.Errorf("compactSQL = %q", got)
+	}
+}
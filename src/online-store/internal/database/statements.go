@@ -0,0 +1,72 @@
+// internal/database/statements.go
+// This file keeps prepared statements around so hot queries are parsed only once
+// Without it, every query with arguments makes the MySQL driver prepare the
+// statement, run it and close it again - three round trips to the database
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// statementCache holds one prepared statement per SQL string
+// database/sql prepares a statement again by itself on every connection of the
+// pool that runs it, so one *sql.Stmt can be shared by all requests
+type statementCache struct {
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+	max   int // Most statements kept; queries beyond that run unprepared
+}
+
+// newStatementCache creates a cache of at most max statements (0 or less turns it off)
+func newStatementCache(max int) *statementCache {
+	if max <= 0 {
+		return nil
+	}
+	return &statementCache{stmts: make(map[string]*sql.Stmt), max: max}
+}
+
+// get returns the prepared statement for query, preparing it the first time
+// It returns nil when the cache is full or preparing fails; the caller then
+// runs the query the normal way (and gets the real error from that, if any)
+func (cache *statementCache) get(ctx context.Context, db *sql.DB, query string) *sql.Stmt {
+	if cache == nil {
+		return nil
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if stmt, ok := cache.stmts[query]; ok {
+		return stmt
+	}
+	// Queries built at runtime (like IN lists of varying length) could fill
+	// the cache forever, so stop adding once it's full
+	if len(cache.stmts) >= cache.max {
+		return nil
+	}
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+	cache.stmts[query] = stmt
+	return stmt
+}
+
+// close closes every cached statement
+func (cache *statementCache) close() {
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for query, stmt := range cache.stmts {
+		stmt.Close()
+		delete(cache.stmts, query)
+	}
+}
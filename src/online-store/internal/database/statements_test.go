@@ -0,0 +1,135 @@
+// internal/database/statements_test.go
+// Tests and benchmarks for the prepared statement cache
+
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+const stockSQL = "SELECT stock_quantity FROM products WHERE id = ?"
+
+// queryStock runs stockSQL n times, checking each result
+func queryStock(t testing.TB, db *DB, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		var stock int
+		if err := db.QueryRow(stockSQL, i).Scan(&stock); err != nil {
+			t.Fatalf("QueryRow: %v", err)
+		}
+		if stock != 1 {
+			t.Fatalf("stock = %d, want 1", stock)
+		}
+	}
+}
+
+func TestCachedStatementIsPreparedOnce(t *testing.T) {
+	db, fake := newFakeDB(t, time.Second, 10, Timeouts{})
+
+	queryStock(t, db, 5)
+	if _, err := db.Exec("UPDATE products SET stock_quantity = ? WHERE id = ?", 3, 1); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if _, err := db.Exec("UPDATE products SET stock_quantity = ? WHERE id = ?", 4, 2); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	prepares, runs := fake.counts()
+	if prepares != 2 {
+		t.Errorf("prepares = %d, want 2 (one per distinct statement)", prepares)
+	}
+	if runs != 7 {
+		t.Errorf("runs = %d, want 7", runs)
+	}
+}
+
+func TestStatementCacheOff(t *testing.T) {
+	db, fake := newFakeDB(t, time.Second, 0, Timeouts{})
+
+	queryStock(t, db, 5)
+
+	if prepares, runs := fake.counts(); prepares != 5 || runs != 5 {
+		t.Errorf("counts = %d prepares, %d runs, want 5 and 5", prepares, runs)
+	}
+}
+
+func TestFullStatementCacheRunsQueriesUnprepared(t *testing.T) {
+	db, fake := newFakeDB(t, time.Second, 1, Timeouts{})
+
+	// The first statement fills the cache; the second can't be kept
+	for i := 0; i < 3; i++ {
+		queryStock(t, db, 1)
+		rows, err := db.Query("SELECT id FROM products WHERE name = ?", "mug")
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		rows.Close()
+	}
+
+	if len(db.statements.stmts) != 1 {
+		t.Errorf("cached statements = %d, want 1", len(db.statements.stmts))
+	}
+	if prepares, _ := fake.counts(); prepares != 4 {
+		t.Errorf("prepares = %d, want 4 (1 cached, 3 unprepared)", prepares)
+	}
+}
+
+func TestCachedStatementInTransaction(t *testing.T) {
+	db, fake := newFakeDB(t, time.Second, 10, Timeouts{})
+
+	queryStock(t, db, 1)
+	for i := 0; i < 3; i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		var stock int
+		if err := tx.QueryRow(stockSQL, i).Scan(&stock); err != nil {
+			t.Fatalf("QueryRow: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+		if stock != 1 {
+			t.Errorf("stock = %d, want 1", stock)
+		}
+	}
+
+	// The transaction reuses the statement already prepared on its connection
+	if prepares, runs := fake.counts(); prepares != 1 || runs != 4 {
+		t.Errorf("counts = %d prepares, %d runs, want 1 and 4", prepares, runs)
+	}
+}
+
+func TestCloseClosesCachedStatements(t *testing.T) {
+	db, _ := newFakeDB(t, time.Second, 10, Timeouts{})
+
+	queryStock(t, db, 1)
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(db.statements.stmts) != 0 {
+		t.Errorf("cached statements = %d, want 0 after Close", len(db.statements.stmts))
+	}
+}
+
+// BenchmarkQuery compares a query with and without the statement cache
+// prepares/op is the per-query overhead the cache removes: with a real
+// MySQL server every prepare is an extra round trip
+func BenchmarkQuery(b *testing.B) {
+	for _, size := range []int{0, 10} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			db, fake := newFakeDB(b, time.Second, size, Timeouts{})
+
+			b.ResetTimer()
+			queryStock(b, db, b.N)
+			b.StopTimer()
+
+			prepares, _ := fake.counts()
+			b.ReportMetric(float64(prepares)/float64(b.N), "prepares/op")
+		})
+	}
+}
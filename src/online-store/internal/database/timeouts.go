@@ -0,0 +1,41 @@
+// internal/database/timeouts.go
+// This file limits how long SQL statements may run, with one limit for reads
+// and another for writes
+// A stuck query (waiting for a lock, or a bad plan on a big table) then fails
+// with context.DeadlineExceeded instead of holding a connection forever
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts says how long statements may run before they are cancelled
+// Reads are expected to be quick; writes may have to wait for row locks, so
+// they usually get a longer limit
+type Timeouts struct {
+	Read  time.Duration // Query and QueryRow; 0 means no limit
+	Write time.Duration // Exec, and every transaction as a whole; 0 means no limit
+}
+
+// readContext limits ctx to the read timeout
+// Rows are read after Query returns, so the context can't be cancelled when
+// it returns; it is released once its deadline has passed instead
+func (db *DB) readContext(ctx context.Context) context.Context {
+	if db.timeouts.Read <= 0 {
+		return ctx
+	}
+	ctx, cancel := db.withTimeout(ctx, db.timeouts.Read)
+	context.AfterFunc(ctx, cancel)
+	return ctx
+}
+
+// writeContext limits ctx to the write timeout
+// Call the returned function once the write (or transaction) is done
+func (db *DB) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.timeouts.Write <= 0 {
+		return ctx, func() {}
+	}
+	return db.withTimeout(ctx, db.timeouts.Write)
+}
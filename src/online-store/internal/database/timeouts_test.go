@@ -0,0 +1,133 @@
+// internal/database/timeouts_test.go
+// Tests for the read and write timeouts of SQL statements
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const (
+	slowRead  = "SELECT COUNT(*) FROM orders"
+	slowWrite = "UPDATE products SET stock_quantity = stock_quantity - 1 WHERE id = ?"
+)
+
+// newSlowDB returns a DB whose slowRead and slowWrite statements take 50ms
+func newSlowDB(t *testing.T, timeouts Timeouts) *DB {
+	t.Helper()
+	db, fake := newFakeDB(t, 0, 0, timeouts)
+	fake.delays[slowRead] = 50 * time.Millisecond
+	fake.delays[slowWrite] = 50 * time.Millisecond
+	return db
+}
+
+func TestReadTimeout(t *testing.T) {
+	// Writes may take longer than reads, so the same delay fails only a read
+	db := newSlowDB(t, Timeouts{Read: 10 * time.Millisecond, Write: time.Second})
+
+	var n int
+	if err := db.QueryRow(slowRead).Scan(&n); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("QueryRow: err = %v, want context.DeadlineExceeded", err)
+	}
+	if _, err := db.Query(slowRead); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Query: err = %v, want context.DeadlineExceeded", err)
+	}
+	if _, err := db.Exec(slowWrite, 1); err != nil {
+		t.Errorf("Exec under the write timeout: %v", err)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	db := newSlowDB(t, Timeouts{Read: time.Second, Write: 10 * time.Millisecond})
+
+	if _, err := db.Exec(slowWrite, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Exec: err = %v, want context.DeadlineExceeded", err)
+	}
+	var n int
+	if err := db.QueryRow(slowRead).Scan(&n); err != nil {
+		t.Errorf("QueryRow under the read timeout: %v", err)
+	}
+}
+
+// expirableTimeouts makes db's timeouts end only when the returned function
+// is called, as if they had just run out, so tests don't race the clock
+func expirableTimeouts(db *DB) (expire func()) {
+	var cancels []context.CancelFunc
+	db.withTimeout = func(ctx context.Context, _ time.Duration) (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		return ctx, cancel
+	}
+	return func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+}
+
+func TestWriteTimeoutCoversTransaction(t *testing.T) {
+	db, _ := newFakeDB(t, 0, 0, Timeouts{Read: time.Second, Write: time.Second})
+	expire := expirableTimeouts(db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Each statement is quick, but the transaction as a whole runs out of time
+	if _, err := tx.Exec("UPDATE orders SET status = 'paid' WHERE id = ?", 1); err != nil {
+		t.Fatalf("first statement: %v", err)
+	}
+	expire()
+	if _, err := tx.Exec("UPDATE orders SET status = 'paid' WHERE id = ?", 2); err == nil {
+		t.Errorf("statement after the write timeout: want an error")
+	}
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Commit after the write timeout: want an error")
+	}
+}
+
+func TestRowsReadableAfterQueryReturns(t *testing.T) {
+	db, _ := newFakeDB(t, 0, 0, Timeouts{Read: time.Second})
+
+	rows, err := db.Query("SELECT id FROM products")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+
+	// The read timeout's context must outlive Query, or the rows would be cut off
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	if err := rows.Err(); err != nil || count != 1 {
+		t.Errorf("read %d rows, err = %v, want 1 row", count, err)
+	}
+}
+
+func TestStreamQueryHasNoReadTimeout(t *testing.T) {
+	db := newSlowDB(t, Timeouts{Read: 10 * time.Millisecond, Write: 10 * time.Millisecond})
+
+	rows, err := db.StreamQuery(slowRead)
+	if err != nil {
+		t.Fatalf("StreamQuery: %v", err)
+	}
+	rows.Close()
+}
+
+func TestNoTimeouts(t *testing.T) {
+	db := newSlowDB(t, Timeouts{})
+
+	var n int
+	if err := db.QueryRow(slowRead).Scan(&n); err != nil {
+		t.Errorf("QueryRow: %v", err)
+	}
+	if _, err := db.Exec(slowWrite, 1); err != nil {
+		t.Errorf("Exec: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+// internal/handlers/audit.go
+// This file contains HTTP handlers for the audit log
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"online-store/internal/models"
+	"online-store/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandler handles audit log HTTP requests
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// ListAudit returns recent audit log entries, newest first
+// @Summary List audit log entries (admin only)
+// @Tags admin
+// @Produce json
+// @Param entity query string false "Only this kind of entity (product, order)"
+// @Param entity_id query int false "Only this entity ID"
+// @Param user_id query int false "Only changes made by this user"
+// @Param limit query int false "Maximum entries to return (default 100, max 1000)"
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/audit [get]
+func (h *AuditHandler) ListAudit(c *gin.Context) {
+	filter := models.AuditFilter{Entity: c.Query("entity")}
+
+	// Optional number filters - missing means "don't filter"
+	numberParams := map[string]*int{
+		"entity_id": &filter.EntityID,
+		"user_id":   &filter.UserID,
+		"limit":     &filter.Limit,
+	}
+	for param, target := range numberParams {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+			return
+		}
+		*target = number
+	}
+
+	entries, err := h.auditService.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, entries, nil)
+}
@@ -4,6 +4,8 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 
 	"online-store/internal/models"
@@ -46,6 +48,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	// Call the service to register the user
 	user, err := h.authService.Register(req)
 	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			respondValidationError(c, validationErr)
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -54,6 +61,90 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	c.JSON(http.StatusCreated, user)
 }
 
+// ResendVerification sends a new email verification link
+// The answer is the same whether or not the email has an unverified account,
+// so it can't be used to find out who has one (the route is rate limited, too)
+// @Summary Resend the email verification link
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.VerificationResend true "Email of the account"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /api/verify/resend [post]
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req models.VerificationResend
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.ResendVerification(req.Email); err != nil {
+		log.Printf("Failed to resend verification email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resend verification email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If this email belongs to an unverified account, a new verification link is on its way"})
+}
+
+// VerifyEmail confirms a user's email with the token from their verification link
+// @Summary Verify an email address
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.EmailVerification true "Token from the verification link"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /api/verify [post]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req models.EmailVerification
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.VerifyEmail(req.Token); err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to verify email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// CheckEmail tells a signup form whether an email is still free
+// The route is rate limited, so it can't be used to find out who has an account
+// @Summary Check if an email is available
+// @Tags auth
+// @Produce json
+// @Param email query string true "Email to check"
+// @Success 200 {object} models.EmailAvailability
+// @Failure 400 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /api/register/check-email [get]
+func (h *AuthHandler) CheckEmail(c *gin.Context) {
+	var req models.EmailCheck
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	availability, err := h.authService.CheckEmail(req.Email)
+	if err != nil {
+		log.Printf("Failed to check email availability: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, availability)
+}
+
 // Login handles user login requests
 // @Summary Login user
 // @Tags auth
@@ -72,15 +163,177 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Call the service to login the user
-	token, user, err := h.authService.Login(req)
+	tokens, user, err := h.authService.Login(req, c.Request.UserAgent())
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Return the token and user info
+	// Return the tokens and user info
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"user":          user,
 	})
 }
+
+// Refresh exchanges a refresh token for a new access token
+// @Summary Refresh an access token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh body models.RefreshRequest true "Refresh token from login"
+// @Success 200 {object} models.TokenPair
+// @Failure 401 {object} map[string]string
+// @Router /api/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// UpdateProfile changes the logged-in user's email
+// @Summary Update my profile
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param profile body models.ProfileUpdate true "New profile data"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/me [put]
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.ProfileUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.authService.UpdateProfile(userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Failed to update profile of user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// RevokeUserSessions logs a user out of every device
+// @Summary Revoke all of a user's sessions (admin only)
+// @Tags auth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]int64
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/users/{id}/revoke-sessions [post]
+func (h *AuthHandler) RevokeUserSessions(c *gin.Context) {
+	userID, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	revoked, err := h.authService.RevokeUserSessions(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to revoke sessions of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked_sessions": revoked})
+}
+
+// ListSessions shows the logged-in user where they are logged in
+// @Summary List my active sessions
+// @Tags auth
+// @Produce json
+// @Success 200 {array} models.Session
+// @Security BearerAuth
+// @Router /api/me/sessions [get]
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(userID)
+	if err != nil {
+		log.Printf("Failed to list sessions of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	respondList(c, sessions, nil)
+}
+
+// RevokeSession logs the user out of one of their sessions
+// @Summary Revoke one of my sessions
+// @Tags auth
+// @Param id path int true "Session ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/me/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	sessionID, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.authService.RevokeSession(userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to revoke session %d: %v", sessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+// internal/handlers/auth_test.go
+// Tests for the auth endpoints, with the user repository faked out
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"online-store/internal/config"
+	"online-store/internal/jwtkeys"
+	"online-store/internal/middleware"
+	"online-store/internal/models"
+	"online-store/internal/passwords"
+	"online-store/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeUsers holds a single user, ann@example.com, who hasn't verified their email
+// Methods a test doesn't need aren't implemented and panic when called
+type fakeUsers struct {
+	services.UserRepository
+	tokensSet int // SetVerificationToken calls
+}
+
+func (r *fakeUsers) GetByEmail(email string) (*models.User, error) {
+	if email != "ann@example.com" {
+		return nil, services.ErrUserNotFound
+	}
+	return &models.User{ID: 1, Email: email}, nil
+}
+
+func (r *fakeUsers) GetByID(id int) (*models.User, error) {
+	if id != 1 {
+		return nil, services.ErrUserNotFound
+	}
+	return &models.User{ID: 1, Email: "ann@example.com", PasswordHash: "$2a$10$not-a-real-hash", Role: models.RoleCustomer}, nil
+}
+
+func (r *fakeUsers) SetVerificationToken(userID int, tokenHash string) error {
+	r.tokensSet++
+	return nil
+}
+
+func TestResendVerificationIsRateLimited(t *testing.T) {
+	users := &fakeUsers{}
+	cfg := &config.Config{}
+	service := services.NewAuthService(users, nil, services.NewTokenDenylist(0), nopPublisher{}, jwtkeys.NewHS256("test-secret"), passwords.Bcrypt, cfg)
+
+	router := gin.New()
+	router.POST("/verify/resend", middleware.RateLimit(2, time.Hour), NewAuthHandler(service).ResendVerification)
+
+	resend := func(email, ip string) int {
+		req := httptest.NewRequest(http.MethodPost, "/verify/resend", strings.NewReader(`{"email": "`+email+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Unknown emails get the same answer, and count towards the limit too
+	if got := resend("ann@example.com", "10.0.0.1"); got != http.StatusAccepted {
+		t.Errorf("first resend: status = %d, want 202", got)
+	}
+	if got := resend("nobody@example.com", "10.0.0.1"); got != http.StatusAccepted {
+		t.Errorf("resend to an unknown email: status = %d, want 202", got)
+	}
+	if got := resend("ann@example.com", "10.0.0.1"); got != http.StatusTooManyRequests {
+		t.Errorf("third resend: status = %d, want 429", got)
+	}
+	if users.tokensSet != 1 {
+		t.Errorf("%d new verification tokens, want 1", users.tokensSet)
+	}
+
+	// Other clients aren't held up
+	if got := resend("ann@example.com", "10.0.0.2"); got != http.StatusAccepted {
+		t.Errorf("resend from another client: status = %d, want 202", got)
+	}
+}
@@ -0,0 +1,43 @@
+// internal/handlers/envelope.go
+// This file renders list responses, optionally wrapped in an envelope
+
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondList answers 200 OK with a list
+// Normally the body is the bare JSON array, as it always was. With the
+// list_envelope feature (see middleware.ListEnvelope) it is
+//
+//	{"data": [...], "meta": {"count": 2, ...}}
+//
+// which leaves room for metadata like paging, and avoids top-level arrays,
+// which some old browsers let other sites read
+// meta holds extra metadata (like next_cursor); it may be nil
+func respondList(c *gin.Context, items interface{}, meta gin.H) {
+	if !c.GetBool("list_envelope") {
+		c.JSON(http.StatusOK, items)
+		return
+	}
+
+	envelopeMeta := gin.H{"count": listLength(items)}
+	for key, value := range meta {
+		envelopeMeta[key] = value
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items, "meta": envelopeMeta})
+}
+
+// listLength returns how many items a slice holds (0 for nil or non-slices)
+// Reflection lets respondList take a slice of any type
+func listLength(items interface{}) int {
+	value := reflect.ValueOf(items)
+	if value.Kind() != reflect.Slice {
+		return 0
+	}
+	return value.Len()
+}
@@ -0,0 +1,99 @@
+// internal/handlers/envelope_test.go
+// Tests for the optional list envelope
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"online-store/internal/config"
+	"online-store/internal/middleware"
+	"online-store/internal/sanitize"
+	"online-store/internal/services"
+)
+
+// envelope is the wrapped shape of a list response
+type envelope struct {
+	Data []json.RawMessage      `json:"data"`
+	Meta map[string]interface{} `json:"meta"`
+}
+
+func TestRespondList(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		items    interface{}
+		meta     gin.H
+		wantBody string
+	}{
+		{"bare array", false, []int{1, 2}, gin.H{"truncated": true}, `[1,2]`},
+		{"envelope", true, []int{1, 2}, nil, `{"data":[1,2],"meta":{"count":2}}`},
+		{"envelope with meta", true, []int{1}, gin.H{"next_cursor": "abc"}, `{"data":[1],"meta":{"count":1,"next_cursor":"abc"}}`},
+		{"empty envelope", true, []int{}, nil, `{"data":[],"meta":{"count":0}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.enabled {
+				c.Set("list_envelope", true)
+			}
+
+			respondList(c, tt.items, tt.meta)
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", w.Code)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestGetProductsEnvelope(t *testing.T) {
+	cfg := &config.Config{Currency: "USD", MaxProductsListed: 2}
+	service := services.NewProductService(catalog(3), nil, nil, nopPublisher{}, services.NewAuditService(nil), sanitize.PolicyNone, cfg)
+	handler := NewProductHandler(service)
+
+	router := gin.New()
+	router.Use(middleware.ListEnvelope())
+	router.GET("/api/products", handler.GetProducts)
+
+	w := serve(router, http.MethodGet, "/api/products", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	var body envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not an envelope: %v (%s)", err, w.Body)
+	}
+	if len(body.Data) != 2 {
+		t.Errorf("len(data) = %d, want 2", len(body.Data))
+	}
+	if body.Meta["count"] != float64(2) {
+		t.Errorf("meta.count = %v, want 2", body.Meta["count"])
+	}
+	if body.Meta["truncated"] != true {
+		t.Errorf("meta.truncated = %v, want true", body.Meta["truncated"])
+	}
+}
+
+func TestGetProductsWithoutEnvelope(t *testing.T) {
+	w := serve(newProductRouter(catalog(2)), http.MethodGet, "/api/products", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	var products []json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &products); err != nil {
+		t.Fatalf("body is not a bare array: %v (%s)", err, w.Body)
+	}
+	if len(products) != 2 {
+		t.Errorf("len(products) = %d, want 2", len(products))
+	}
+}
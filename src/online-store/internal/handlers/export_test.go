@@ -0,0 +1,87 @@
+// internal/handlers/export_test.go
+// Tests for users downloading their own data
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"online-store/internal/config"
+	"online-store/internal/models"
+	"online-store/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportRouter serves GET /me/export as user 1 (ann@example.com, see fakeUsers)
+func exportRouter(orders *fakeOrders) *gin.Engine {
+	cfg := &config.Config{Currency: "USD", MaxOrderQty: 1000}
+	service := services.NewOrderService(orders, &fakeProducts{}, &fakeUsers{}, nopPublisher{}, nopNotifier{}, services.NewAuditService(nopAudit{}), cfg)
+
+	router := gin.New()
+	router.GET("/me/export", func(c *gin.Context) { c.Set("user_id", 1) }, NewOrderHandler(service, "USD", nil).ExportMyData)
+	return router
+}
+
+func TestExportMyData(t *testing.T) {
+	orders := &fakeOrders{created: []models.Order{
+		{UserID: 1, ProductID: 3, Quantity: 2, Status: models.OrderStatusPaid},
+		{UserID: 2, ProductID: 4, Quantity: 1, Status: models.OrderStatusPending}, // Someone else's
+		{UserID: 1, ProductID: 5, Quantity: 1, Status: models.OrderStatusPending},
+	}}
+
+	w := serve(exportRouter(orders), http.MethodGet, "/me/export", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "attachment") {
+		t.Errorf("Content-Disposition = %q, want an attachment", got)
+	}
+
+	var export struct {
+		ExportedAt string                 `json:"exported_at"`
+		Profile    map[string]interface{} `json:"profile"`
+		Orders     []models.OrderResponse `json:"orders"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatalf("export is not valid JSON: %v (%s)", err, w.Body)
+	}
+	if export.ExportedAt == "" || export.Profile["email"] != "ann@example.com" {
+		t.Errorf("export = %+v, want ann's profile and the export time", export)
+	}
+	if _, ok := export.Profile["password_hash"]; ok || strings.Contains(w.Body.String(), "not-a-real-hash") {
+		t.Error("export contains the password hash")
+	}
+	if len(export.Orders) != 2 || export.Orders[0].ID != 1 || export.Orders[1].ID != 3 {
+		t.Errorf("orders = %+v, want orders 1 and 3 only", export.Orders)
+	}
+}
+
+func TestExportMyDataWithoutOrders(t *testing.T) {
+	w := serve(exportRouter(&fakeOrders{}), http.MethodGet, "/me/export", "")
+
+	var export map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatalf("export is not valid JSON: %v (%s)", err, w.Body)
+	}
+	if orders, ok := export["orders"].([]interface{}); !ok || len(orders) != 0 {
+		t.Errorf("orders = %v, want an empty array", export["orders"])
+	}
+}
+
+func TestExportMyDataFailsHalfway(t *testing.T) {
+	orders := &fakeOrders{
+		created:   []models.Order{{UserID: 1, ProductID: 3, Quantity: 2, Status: models.OrderStatusPaid}},
+		streamErr: errors.New("connection lost"),
+	}
+
+	// The 200 is already sent, so the JSON is left unfinished for the client to notice
+	w := serve(exportRouter(orders), http.MethodGet, "/me/export", "")
+	if json.Valid(w.Body.Bytes()) {
+		t.Errorf("body = %s, want unfinished JSON", w.Body)
+	}
+}
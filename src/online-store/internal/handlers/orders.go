@@ -4,11 +4,20 @@
 package handlers
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
+
 	"online-store/internal/models"
+	"online-store/internal/money"
+	"online-store/internal/orderids"
 	"online-store/internal/services"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,12 +25,20 @@ import (
 // OrderHandler handles order HTTP requests
 type OrderHandler struct {
 	orderService *services.OrderService
+	currency     string // Currency our amounts are in, for formatting exports
+
+	// Turns order IDs into codes for customers; nil shows them the plain IDs
+	// Admin endpoints always use plain IDs
+	orderCodes *orderids.Codec
 }
 
 // NewOrderHandler creates a new order handler
-func NewOrderHandler(orderService *services.OrderService) *OrderHandler {
+// Pass a nil orderCodes to show customers the plain order IDs
+func NewOrderHandler(orderService *services.OrderService, currency string, orderCodes *orderids.Codec) *OrderHandler {
 	return &OrderHandler{
 		orderService: orderService,
+		currency:     currency,
+		orderCodes:   orderCodes,
 	}
 }
 
@@ -55,14 +72,80 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
+	h.hideOrderID(order)
+	c.JSON(http.StatusCreated, order)
+}
+
+// CreateGuestOrder creates an order without requiring a login
+// @Summary Place an order as a guest
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param order body models.GuestOrderRequest true "Guest order data"
+// @Success 201 {object} models.GuestOrderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/guest/orders [post]
+func (h *OrderHandler) CreateGuestOrder(c *gin.Context) {
+	var req models.GuestOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.orderService.CreateGuestOrder(req)
+	if err != nil {
+		if errors.Is(err, services.ErrAccountExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.hideOrderID(&order.OrderResponse)
 	c.JSON(http.StatusCreated, order)
 }
 
-// GetUserOrders returns all orders for the authenticated user
+// TrackOrder returns the status of an order given its tracking token
+// @Summary Track an order by token (no login needed)
+// @Tags orders
+// @Produce json
+// @Param token query string true "Tracking token from guest checkout or the order confirmation email"
+// @Success 200 {object} models.OrderTracking
+// @Failure 404 {object} map[string]string
+// @Router /api/orders/track [get]
+func (h *OrderHandler) TrackOrder(c *gin.Context) {
+	tracking, err := h.orderService.TrackOrder(c.Query("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to track order: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track order"})
+		return
+	}
+
+	if h.orderCodes != nil {
+		tracking.OrderCode = h.orderCodes.Encode(tracking.OrderID)
+		tracking.OrderID = 0
+	}
+	c.JSON(http.StatusOK, tracking)
+}
+
+// GetUserOrders returns the authenticated user's orders
+// Without paging parameters it returns every order as an array (as it always did)
+// With limit, cursor or offset it returns one page plus a next_cursor
 // @Summary Get user's orders
 // @Tags orders
 // @Produce json
+// @Param limit query int false "Orders per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param offset query int false "Orders to skip (use cursor instead where possible)"
 // @Success 200 {array} models.OrderResponse
+// @Success 200 {object} models.OrderPage
+// @Failure 400 {object} map[string]string
 // @Security BearerAuth
 // @Router /api/orders [get]
 func (h *OrderHandler) GetUserOrders(c *gin.Context) {
@@ -72,20 +155,71 @@ func (h *OrderHandler) GetUserOrders(c *gin.Context) {
 		return
 	}
 
-	orders, err := h.orderService.GetUserOrders(userID)
+	req := models.OrderPageRequest{Cursor: c.Query("cursor")}
+	paged := req.Cursor != ""
+	numberParams := map[string]*int{
+		"limit":  &req.Limit,
+		"offset": &req.Offset,
+	}
+	for param, target := range numberParams {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+			return
+		}
+		*target = number
+		paged = true
+	}
+
+	if !paged {
+		orders, err := h.orderService.GetUserOrders(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range orders {
+			h.hideOrderID(&orders[i])
+		}
+		respondList(c, orders, nil)
+		return
+	}
+
+	page, err := h.orderService.GetUserOrdersPage(userID, req)
 	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			respondValidationError(c, validationErr)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
+	for i := range page.Orders {
+		h.hideOrderID(&page.Orders[i])
+	}
+
+	// In the envelope, paging information goes under "meta" like on every other list
+	if c.GetBool("list_envelope") {
+		meta := gin.H{}
+		if page.NextCursor != "" {
+			meta["next_cursor"] = page.NextCursor
+		}
+		respondList(c, page.Orders, meta)
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 // GetOrder returns a specific order for the authenticated user
 // @Summary Get order by ID
 // @Tags orders
 // @Produce json
-// @Param id path int true "Order ID"
+// @Param id path string true "Order ID, or its code when order ID obfuscation is on"
 // @Success 200 {object} models.OrderResponse
 // @Failure 404 {object} map[string]string
 // @Security BearerAuth
@@ -97,7 +231,7 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		return
 	}
 
-	orderID, err := getIDFromParam(c, "id")
+	orderID, err := h.orderIDFromParam(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
 		return
@@ -109,11 +243,534 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		return
 	}
 
+	h.hideOrderID(order)
 	c.JSON(http.StatusOK, order)
 }
 
+// EditOrder changes the quantity of one of the user's orders before it is paid for
+// @Summary Change a pending order
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID, or its code when order ID obfuscation is on"
+// @Param order body models.OrderEdit true "New quantity"
+// @Success 200 {object} models.OrderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "The order was already paid for"
+// @Security BearerAuth
+// @Router /api/orders/{id} [patch]
+func (h *OrderHandler) EditOrder(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	orderID, err := h.orderIDFromParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req models.OrderEdit
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.orderService.EditOrder(userID, orderID, req)
+	if err != nil {
+		var validationErr *services.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			respondValidationError(c, validationErr)
+		case errors.Is(err, services.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrOrderNotEditable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInsufficientStock), errors.Is(err, services.ErrProductNotAvailable),
+			errors.Is(err, services.ErrProductNotFound):
+			// Adding items is checked like a new order of the product
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Failed to edit order %d: %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change order"})
+		}
+		return
+	}
+
+	h.hideOrderID(order)
+	c.JSON(http.StatusOK, order)
+}
+
+// ReorderOrder places a new order with the same items as a previous one
+// @Summary Reorder a previous order
+// @Tags orders
+// @Produce json
+// @Param id path string true "ID (or code) of the order to repeat"
+// @Success 201 {object} models.ReorderResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} models.ReorderResponse "No line could be ordered again"
+// @Security BearerAuth
+// @Router /api/orders/{id}/reorder [post]
+func (h *OrderHandler) ReorderOrder(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	orderID, err := h.orderIDFromParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	result, err := h.orderService.Reorder(userID, orderID)
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to reorder order %d: %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder"})
+		return
+	}
+
+	// Nothing could be ordered - tell the client which lines failed and why
+	if result.Order == nil {
+		c.JSON(http.StatusConflict, result)
+		return
+	}
+
+	h.hideOrderID(result.Order)
+	c.JSON(http.StatusCreated, result)
+}
+
+// UpdateOrderStatus lets an admin move an order to its next status
+// @Summary Update an order's status (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param status body models.OrderStatusUpdate true "New status"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/orders/{id}/status [patch]
+func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
+	adminID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	orderID, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req models.OrderStatusUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.orderService.UpdateOrderStatus(adminID, orderID, req.Status)
+	if err != nil {
+		var validationErr *services.ValidationError
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidStatusTransition):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.As(err, &validationErr):
+			respondValidationError(c, validationErr)
+		default:
+			log.Printf("Failed to update status of order %d: %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": orderID, "status": req.Status})
+}
+
+// ReleaseOrder takes an order that a risk check put on hold off hold again
+// It goes back to the status it had before (pending or paid)
+// @Summary Release an order from hold (admin only)
+// @Tags admin
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/orders/{id}/release [post]
+func (h *OrderHandler) ReleaseOrder(c *gin.Context) {
+	adminID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	orderID, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	status, err := h.orderService.ReleaseOrder(adminID, orderID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidStatusTransition):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Failed to release order %d: %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release order"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": orderID, "status": status})
+}
+
+// BulkUpdateOrderStatus lets an admin move many orders to the same status at once
+// Orders that can't make the move are reported as failed; the rest are changed
+// @Summary Update many orders' status (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.BulkStatusUpdate true "Order IDs and new status"
+// @Success 200 {array} models.BulkStatusResult
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/orders/bulk-status [post]
+func (h *OrderHandler) BulkUpdateOrderStatus(c *gin.Context) {
+	adminID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.BulkStatusUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.orderService.BulkUpdateOrderStatus(adminID, req)
+	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			respondValidationError(c, validationErr)
+			return
+		}
+		log.Printf("Failed to bulk update order status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order statuses"})
+		return
+	}
+
+	respondList(c, results, nil)
+}
+
+// GetUserSummary returns a customer's order count, spend and last order date
+// @Summary Get a user's order summary (admin only)
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.UserOrderSummary
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/users/{id}/summary [get]
+func (h *OrderHandler) GetUserSummary(c *gin.Context) {
+	userID, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	summary, err := h.orderService.GetUserSummary(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to summarize orders for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// ValidateCart checks a shopping cart: whether each line can be ordered, and what it costs
+// It needs no login and reserves nothing, so cart pages can call it freely
+// @Summary Validate a shopping cart
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param request body models.CartValidationRequest true "Cart lines"
+// @Success 200 {object} models.CartValidation
+// @Failure 400 {object} map[string]string
+// @Router /api/cart/validate [post]
+func (h *OrderHandler) ValidateCart(c *gin.Context) {
+	var req models.CartValidationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	validation, err := h.orderService.ValidateCart(req)
+	if err != nil {
+		log.Printf("Failed to validate cart: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, validation)
+}
+
+// GetSalesMetrics reports revenue and order counts of paid orders per day, week or month
+// from and to are optional dates (YYYY-MM-DD); both days are included
+// @Summary Sales metrics (admin only)
+// @Tags admin
+// @Produce json
+// @Param from query string false "First day to include (YYYY-MM-DD, default 30 days ago)"
+// @Param to query string false "Last day to include (YYYY-MM-DD, default today)"
+// @Param group_by query string false "day (default), week or month"
+// @Success 200 {object} models.SalesMetrics
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/metrics/sales [get]
+func (h *OrderHandler) GetSalesMetrics(c *gin.Context) {
+	from, err := parseDateParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+		return
+	}
+
+	to, err := parseDateParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+		return
+	}
+
+	metrics, err := h.orderService.GetSalesMetrics(from, to, c.Query("group_by"))
+	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			respondValidationError(c, validationErr)
+			return
+		}
+		log.Printf("Failed to get sales metrics: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sales metrics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, metrics)
+}
+
+// ExportOrders streams all orders as a CSV file for finance
+// from and to are optional dates (YYYY-MM-DD); both days are included
+// @Summary Export orders as CSV (admin only)
+// @Tags admin
+// @Produce text/csv
+// @Param from query string false "First day to include (YYYY-MM-DD)"
+// @Param to query string false "Last day to include (YYYY-MM-DD)"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/orders/export [get]
+func (h *OrderHandler) ExportOrders(c *gin.Context) {
+	from, err := parseDateParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+		return
+	}
+
+	to, err := parseDateParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+		return
+	}
+	if !to.IsZero() {
+		// Include the whole "to" day by stopping at midnight of the next day
+		to = to.AddDate(0, 0, 1)
+	}
+
+	// Read orders in the background and hand them over one by one,
+	// so a huge export never has to fit in memory
+	ctx := c.Request.Context()
+	rows := make(chan models.OrderExportRow)
+	exportErr := make(chan error, 1)
+	go func() {
+		defer close(rows)
+		exportErr <- h.orderService.ExportOrders(from, to, func(row models.OrderExportRow) error {
+			select {
+			case rows <- row:
+				return nil
+			case <-ctx.Done(): // The client went away, stop reading
+				return ctx.Err()
+			}
+		})
+	}()
+
+	// Tell the browser to download the response as a file
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="orders.csv"`)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"id", "user_email", "product", "quantity", "total", "currency", "status", "created_at"})
+
+	// c.Stream keeps calling our function (flushing after each call) until it returns false
+	c.Stream(func(w io.Writer) bool {
+		row, ok := <-rows
+		if !ok {
+			return false
+		}
+
+		writer.Write([]string{
+			strconv.Itoa(row.ID),
+			row.UserEmail,
+			row.ProductName,
+			strconv.Itoa(row.Quantity),
+			money.Format(int64(row.TotalCents), h.currency),
+			h.currency,
+			row.Status,
+			row.CreatedAt.Format(time.RFC3339),
+		})
+		writer.Flush()
+		return true
+	})
+
+	// The status code is already sent, so all we can do about errors is log them
+	if err := <-exportErr; err != nil {
+		log.Printf("Order export failed: %v", err)
+	}
+}
+
+// ExportMyData sends the logged-in user everything we store about them:
+// their profile and all their orders (a GDPR data access request)
+// Orders are streamed one at a time, so a long order history never has to fit in memory
+// @Summary Export my data
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{} "{"exported_at": ..., "profile": {...}, "orders": [...]}"
+// @Failure 401 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/me/export [get]
+func (h *OrderHandler) ExportMyData(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Read the profile before sending anything, so failures still get a proper status code
+	profile, err := h.orderService.GetUserData(userID)
+	if err != nil {
+		log.Printf("Failed to export data of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+	profileJSON, err := json.Marshal(profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+
+	// Read orders in the background and hand them over one by one
+	ctx := c.Request.Context()
+	orders := make(chan models.OrderResponse)
+	exportErr := make(chan error, 1)
+	go func() {
+		defer close(orders)
+		exportErr <- h.orderService.StreamUserOrders(userID, func(order models.OrderResponse) error {
+			select {
+			case orders <- order:
+				return nil
+			case <-ctx.Done(): // The client went away, stop reading
+				return ctx.Err()
+			}
+		})
+	}()
+
+	// Tell the browser to download the response as a file
+	c.Header("Content-Type", "application/json")
+	c.Header("Content-Disposition", `attachment; filename="my-data.json"`)
+
+	// We write the JSON object by hand, so the orders array can be sent piece by piece
+	fmt.Fprintf(c.Writer, `{"exported_at":%q,"profile":%s,"orders":[`, time.Now().UTC().Format(time.RFC3339), profileJSON)
+	first := true
+
+	// c.Stream keeps calling our function (flushing after each call) until it returns false
+	c.Stream(func(w io.Writer) bool {
+		order, ok := <-orders
+		if !ok {
+			return false
+		}
+
+		h.hideOrderID(&order)
+		orderJSON, err := json.Marshal(order)
+		if err != nil {
+			log.Printf("Failed to encode order for data export of user %d: %v", userID, err)
+			return true
+		}
+		if !first {
+			w.Write([]byte(","))
+		}
+		first = false
+		w.Write(orderJSON)
+		return true
+	})
+
+	// The status code is already sent, so all we can do about errors is log them
+	// (the JSON is left unfinished, so the client can tell the export is broken)
+	if err := <-exportErr; err != nil {
+		log.Printf("Data export of user %d failed: %v", userID, err)
+		return
+	}
+	c.Writer.Write([]byte("]}"))
+}
+
 // Helper functions
 
+// parseDateParam reads an optional YYYY-MM-DD query parameter
+// A missing parameter gives the zero time, which means "no limit"
+func parseDateParam(c *gin.Context, param string) (time.Time, error) {
+	value := c.Query(param)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// orderIDFromParam reads the order in the "id" URL parameter
+// With order ID obfuscation on, only order codes are accepted - otherwise
+// anyone could still count our orders by trying plain IDs
+func (h *OrderHandler) orderIDFromParam(c *gin.Context) (int, error) {
+	if h.orderCodes != nil {
+		return h.orderCodes.Decode(c.Param("id"))
+	}
+	return getIDFromParam(c, "id")
+}
+
+// hideOrderID replaces an order's ID with its code when order ID obfuscation is on
+func (h *OrderHandler) hideOrderID(order *models.OrderResponse) {
+	if h.orderCodes == nil {
+		return
+	}
+	order.Code = h.orderCodes.Encode(order.ID)
+	order.ID = 0
+}
+
 // getIDFromParam extracts an integer ID from URL parameters
 func getIDFromParam(c *gin.Context, param string) (int, error) {
 	// strconv package is used to convert strings to other types
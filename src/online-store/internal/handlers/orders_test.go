@@ -0,0 +1,405 @@
+// internal/handlers/orders_test.go
+// Tests for the order endpoints, with the repositories faked out
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"online-store/internal/config"
+	"online-store/internal/models"
+	"online-store/internal/orderids"
+	"online-store/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeOrders is an order repository for the handler tests
+// Methods a test doesn't need aren't implemented and panic when called
+type fakeOrders struct {
+	services.OrderRepository
+	exportRows []models.OrderExportRow
+	exportFrom time.Time // What Export was last called with
+	exportTo   time.Time
+	created    []models.Order // Orders given to Create
+	statuses   map[int]models.OrderStatus
+	streamErr  error // StreamByUser fails with this after the last order
+}
+
+func (r *fakeOrders) Create(order *models.Order) (int, error) {
+	r.created = append(r.created, *order)
+	return len(r.created), nil
+}
+
+// GetForUser finds orders given to Create; they all belong to user 7
+func (r *fakeOrders) GetForUser(orderID, userID int) (*models.OrderResponse, error) {
+	if userID != 7 || orderID < 1 || orderID > len(r.created) {
+		return nil, services.ErrOrderNotFound
+	}
+	order := r.created[orderID-1]
+	return &models.OrderResponse{ID: orderID, ProductID: order.ProductID, Quantity: order.Quantity, Status: order.Status}, nil
+}
+
+func (r *fakeOrders) GetByTrackingTokenHash(tokenHash string) (*models.OrderTracking, error) {
+	for i, order := range r.created {
+		if order.TrackingTokenHash == tokenHash {
+			return &models.OrderTracking{OrderID: i + 1, ProductName: "Mug", Quantity: order.Quantity, Status: order.Status}, nil
+		}
+	}
+	return nil, services.ErrOrderNotFound
+}
+
+// StreamByUser sends the orders given to Create that belong to userID
+func (r *fakeOrders) StreamByUser(userID int, fn func(order models.OrderResponse) error) error {
+	for i, order := range r.created {
+		if order.UserID != userID {
+			continue
+		}
+		if err := fn(models.OrderResponse{ID: i + 1, ProductID: order.ProductID, Quantity: order.Quantity, Status: order.Status}); err != nil {
+			return err
+		}
+	}
+	return r.streamErr
+}
+
+func (r *fakeOrders) GetStatus(orderID int) (models.OrderStatus, error) {
+	status, ok := r.statuses[orderID]
+	if !ok {
+		return "", services.ErrOrderNotFound
+	}
+	return status, nil
+}
+
+func (r *fakeOrders) UpdateStatus(orderID int, fromStatus, toStatus models.OrderStatus) error {
+	if r.statuses[orderID] != fromStatus {
+		return services.ErrInvalidStatusTransition
+	}
+	r.statuses[orderID] = toStatus
+	return nil
+}
+
+// Release takes an order off hold; held orders always go back to paid here
+func (r *fakeOrders) Release(orderID int) (models.OrderStatus, error) {
+	status, ok := r.statuses[orderID]
+	if !ok {
+		return "", services.ErrOrderNotFound
+	}
+	if status != models.OrderStatusOnHold {
+		return "", services.ErrInvalidStatusTransition
+	}
+	r.statuses[orderID] = models.OrderStatusPaid
+	return models.OrderStatusPaid, nil
+}
+
+func (r *fakeOrders) Export(from, to time.Time, fn func(row models.OrderExportRow) error) error {
+	r.exportFrom, r.exportTo = from, to
+	for _, row := range r.exportRows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newOrderHandler serves orders from orders and products from products
+func newOrderHandler(orders services.OrderRepository, products services.ProductRepository, currency string) *OrderHandler {
+	cfg := &config.Config{Currency: currency, MaxOrderQty: 1000}
+	service := services.NewOrderService(orders, products, nil, nopPublisher{}, nopNotifier{}, services.NewAuditService(nopAudit{}), cfg)
+	return NewOrderHandler(service, currency, nil)
+}
+
+// nopNotifier ignores outbox notifications
+type nopNotifier struct{}
+
+func (nopNotifier) Notify() {}
+
+// nopAudit throws audit entries away
+type nopAudit struct {
+	services.AuditRepository
+}
+
+func (nopAudit) Insert(entry models.AuditEntry) error {
+	return nil
+}
+
+func TestExportOrdersCSV(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	orders := &fakeOrders{exportRows: []models.OrderExportRow{
+		{ID: 1, UserEmail: "ann@example.com", ProductName: "Mug, large", Quantity: 2, TotalCents: 1800, Status: "paid", CreatedAt: createdAt},
+		{ID: 2, UserEmail: "bob@example.com", ProductName: "Tea", Quantity: 1, TotalCents: 450, Status: "pending", CreatedAt: createdAt},
+	}}
+	handler := newOrderHandler(orders, nil, "USD")
+
+	router := gin.New()
+	router.GET("/export", handler.ExportOrders)
+	w := serve(router, http.MethodGet, "/export?from=2024-03-01&to=2024-03-31", "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/csv" {
+		t.Errorf("Content-Type = %q, want text/csv", got)
+	}
+
+	want := "id,user_email,product,quantity,total,currency,status,created_at\n" +
+		"1,ann@example.com,\"Mug, large\",2,18.00,USD,paid,2024-03-01T12:00:00Z\n" +
+		"2,bob@example.com,Tea,1,4.50,USD,pending,2024-03-01T12:00:00Z\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+
+	// The whole "to" day is included
+	if want := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC); !orders.exportTo.Equal(want) {
+		t.Errorf("exported until %v, want %v", orders.exportTo, want)
+	}
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC); !orders.exportFrom.Equal(want) {
+		t.Errorf("exported from %v, want %v", orders.exportFrom, want)
+	}
+}
+
+func TestExportOrdersInvalidDate(t *testing.T) {
+	router := gin.New()
+	router.GET("/export", newOrderHandler(&fakeOrders{}, nil, "USD").ExportOrders)
+
+	w := serve(router, http.MethodGet, "/export?from=01.03.2024", "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "YYYY-MM-DD") {
+		t.Errorf("body = %s, want a hint at the date format", w.Body)
+	}
+}
+
+func TestCreateOrderIgnoresClientTotal(t *testing.T) {
+	products := &fakeProducts{products: map[int]models.Product{
+		1: {ID: 1, Name: "Mug", PriceCents: 900, EffectivePriceCents: 900, StockQuantity: 10, Status: models.ProductStatusPublished},
+	}}
+	orders := &fakeOrders{}
+	handler := newOrderHandler(orders, products, "USD")
+
+	router := gin.New()
+	router.POST("/orders", func(c *gin.Context) { c.Set("user_id", 7) }, handler.CreateOrder)
+	w := serve(router, http.MethodPost, "/orders", `{"product_id":1,"quantity":2,"total_cents":1,"status":"paid"}`)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201 (body %s)", w.Code, w.Body)
+	}
+	var order models.OrderResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if order.TotalCents != 1800 || order.Status != models.OrderStatusPending {
+		t.Errorf("response total = %d, status = %q, want 1800 and pending", order.TotalCents, order.Status)
+	}
+	if len(orders.created) != 1 || orders.created[0].TotalCents != 1800 || orders.created[0].Status != models.OrderStatusPending {
+		t.Errorf("stored orders = %+v, want one of 1800 cents, pending", orders.created)
+	}
+}
+
+func TestEditOrderOutsidePurchaseWindow(t *testing.T) {
+	closed := time.Now().Add(-time.Minute)
+	products := &fakeProducts{products: map[int]models.Product{
+		1: {ID: 1, Name: "Mug", PriceCents: 900, EffectivePriceCents: 900, StockQuantity: 10, Status: models.ProductStatusPublished, AvailableUntil: &closed},
+	}}
+	orders := &fakeOrders{created: []models.Order{{UserID: 7, ProductID: 1, Quantity: 2, TotalCents: 1800, Status: models.OrderStatusPending}}}
+
+	router := gin.New()
+	router.PATCH("/orders/:id", func(c *gin.Context) { c.Set("user_id", 7) }, newOrderHandler(orders, products, "USD").EditOrder)
+
+	// Adding items after the window closed is a client error, like ordering then
+	w := serve(router, http.MethodPatch, "/orders/1", `{"quantity":3}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), services.ErrProductNotAvailable.Error()) {
+		t.Errorf("status = %d, body = %s; want 400 saying the product can't be ordered", w.Code, w.Body)
+	}
+}
+
+func TestUpdateOrderStatusEndpoint(t *testing.T) {
+	orders := &fakeOrders{statuses: map[int]models.OrderStatus{1: models.OrderStatusPending}}
+	handler := newOrderHandler(orders, nil, "USD")
+
+	router := gin.New()
+	router.PUT("/orders/:id/status", func(c *gin.Context) { c.Set("user_id", 1) }, handler.UpdateOrderStatus)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantOrder  models.OrderStatus
+	}{
+		{"unknown status", `{"status": "payed"}`, http.StatusBadRequest, models.OrderStatusPending},
+		{"valid status", `{"status": "paid"}`, http.StatusOK, models.OrderStatusPaid},
+		{"valid status the order can't move to", `{"status": "pending"}`, http.StatusConflict, models.OrderStatusPaid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPut, "/orders/1/status", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := orders.statuses[1]; got != tt.wantOrder {
+				t.Errorf("order status = %q, want %q", got, tt.wantOrder)
+			}
+		})
+	}
+
+	// The error says which field was wrong
+	var body map[string]string
+	w := serve(router, http.MethodPut, "/orders/1/status", `{"status": "lost"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["field"] != "status" {
+		t.Errorf("body = %s, want the status field named", w.Body)
+	}
+}
+
+func TestGetOrderWithOrderCodes(t *testing.T) {
+	orders := &fakeOrders{}
+	for i := 0; i < 3; i++ {
+		orders.Create(&models.Order{UserID: 7, ProductID: 1, Quantity: i + 1, Status: models.OrderStatusPending})
+	}
+	codes := orderids.NewCodec("test-secret")
+
+	service := services.NewOrderService(orders, nil, nil, nopPublisher{}, nopNotifier{}, services.NewAuditService(nopAudit{}), &config.Config{Currency: "USD"})
+	router := gin.New()
+	router.GET("/orders/:id", func(c *gin.Context) { c.Set("user_id", 7) }, NewOrderHandler(service, "USD", codes).GetOrder)
+
+	// The code finds the order, and the response only has the code
+	w := serve(router, http.MethodGet, "/orders/"+codes.Encode(2), "")
+	var body map[string]interface{}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil {
+		t.Fatalf("status = %d, body = %s; want 200", w.Code, w.Body)
+	}
+	if _, ok := body["id"]; ok || body["code"] != codes.Encode(2) || body["quantity"] != float64(2) {
+		t.Errorf("body = %s, want order 2 by its code and without its ID", w.Body)
+	}
+
+	// Plain IDs and tampered codes don't work
+	tampered := []byte(codes.Encode(2))
+	tampered[0] ^= 1
+	for _, id := range []string{"2", string(tampered), codes.Encode(2) + "x"} {
+		if w := serve(router, http.MethodGet, "/orders/"+id, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /orders/%s: status = %d, want 400", id, w.Code)
+		}
+	}
+
+	// Without codes, the plain ID works as before
+	router = gin.New()
+	router.GET("/orders/:id", func(c *gin.Context) { c.Set("user_id", 7) }, NewOrderHandler(service, "USD", nil).GetOrder)
+	w = serve(router, http.MethodGet, "/orders/2", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":2`) || strings.Contains(w.Body.String(), `"code"`) {
+		t.Errorf("status = %d, body = %s; want order 2 with its plain ID", w.Code, w.Body)
+	}
+}
+
+func TestTrackOrderEndpoint(t *testing.T) {
+	products := &fakeProducts{products: map[int]models.Product{
+		1: {ID: 1, Name: "Mug", PriceCents: 900, EffectivePriceCents: 900, StockQuantity: 10, Status: models.ProductStatusPublished},
+	}}
+	orders := &fakeOrders{}
+	handler := newOrderHandler(orders, products, "USD")
+
+	router := gin.New()
+	router.POST("/orders", func(c *gin.Context) { c.Set("user_id", 7) }, handler.CreateOrder)
+	router.GET("/orders/track", handler.TrackOrder)
+	if w := serve(router, http.MethodPost, "/orders", `{"product_id":1,"quantity":2}`); w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want 201 (body %s)", w.Code, w.Body)
+	}
+	token := orders.created[0].TrackingToken
+	if token == "" {
+		t.Fatal("order was placed without a tracking token")
+	}
+
+	// No user_id is set: the token alone is enough
+	w := serve(router, http.MethodGet, "/orders/track?token="+token, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	var tracking map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &tracking); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if tracking["order_id"] != float64(1) || tracking["status"] != string(models.OrderStatusPending) {
+		t.Errorf("tracking = %v, want order 1, pending", tracking)
+	}
+	for _, field := range []string{"user_id", "email", "total_cents"} {
+		if _, ok := tracking[field]; ok {
+			t.Errorf("tracking shows %s: %v", field, tracking)
+		}
+	}
+
+	for _, path := range []string{"/orders/track?token=not-a-token", "/orders/track?token=", "/orders/track"} {
+		if w := serve(router, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestValidateCartEndpoint(t *testing.T) {
+	products := &fakeProducts{products: map[int]models.Product{
+		1: {ID: 1, Name: "Mug", PriceCents: 900, EffectivePriceCents: 900, StockQuantity: 10, Status: models.ProductStatusPublished},
+	}}
+	router := gin.New()
+	router.POST("/cart/validate", newOrderHandler(&fakeOrders{}, products, "USD").ValidateCart)
+
+	tooMany := strings.TrimSuffix(strings.Repeat(`{"product_id":1,"quantity":1},`, 101), ",")
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"mixed cart", `{"items":[{"product_id":1,"quantity":2},{"product_id":9,"quantity":1}]}`, http.StatusOK},
+		{"empty cart", `{"items":[]}`, http.StatusBadRequest},
+		{"zero quantity", `{"items":[{"product_id":1,"quantity":0}]}`, http.StatusBadRequest},
+		{"too many lines", `{"items":[` + tooMany + `]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPost, "/cart/validate", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var validation models.CartValidation
+			if err := json.Unmarshal(w.Body.Bytes(), &validation); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if validation.TotalCents != 1800 || validation.AllAvailable || !validation.Lines[0].Available || validation.Lines[1].Available {
+				t.Errorf("validation = %+v, want the mugs available for 1800 and product 9 not", validation)
+			}
+		})
+	}
+}
+
+func TestReleaseOrderEndpoint(t *testing.T) {
+	orders := &fakeOrders{statuses: map[int]models.OrderStatus{1: models.OrderStatusOnHold, 2: models.OrderStatusPending}}
+	router := gin.New()
+	router.POST("/orders/:id/release", func(c *gin.Context) { c.Set("user_id", 1) }, newOrderHandler(orders, nil, "USD").ReleaseOrder)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"held order", "/orders/1/release", http.StatusOK},
+		{"released already", "/orders/1/release", http.StatusConflict},
+		{"never held", "/orders/2/release", http.StatusConflict},
+		{"unknown order", "/orders/42/release", http.StatusNotFound},
+		{"invalid ID", "/orders/first/release", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPost, tt.path, "")
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+	if got := orders.statuses[1]; got != models.OrderStatusPaid {
+		t.Errorf("order status = %q, want paid", got)
+	}
+}
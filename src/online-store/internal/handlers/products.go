@@ -4,8 +4,15 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+
 	"online-store/internal/models"
+	"online-store/internal/money"
 	"online-store/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -27,16 +34,115 @@ func NewProductHandler(productService *services.ProductService) *ProductHandler
 // @Summary Get all products
 // @Tags products
 // @Produce json
-// @Success 200 {array} models.Product
+// @Param include_drafts query bool false "Also list draft products (admins only, via /api/admin/products)"
+// @Param available query bool false "Only list products that can be ordered right now"
+// @Param currency query string false "Also show prices in this currency, e.g. EUR (needs a configured rate)"
+// @Success 200 {array} models.ProductResponse
+// @Header 200 {string} X-Results-Truncated "true when more products exist than were returned"
+// @Failure 403 {object} map[string]string
 // @Router /api/products [get]
 func (h *ProductHandler) GetProducts(c *gin.Context) {
-	products, err := h.productService.GetProducts()
+	includeDrafts, err := strconv.ParseBool(c.DefaultQuery("include_drafts", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "include_drafts must be true or false"})
+		return
+	}
+	// user_role is only set on authenticated routes, so the public list never shows drafts
+	if includeDrafts && c.GetString("user_role") != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can see draft products"})
+		return
+	}
+	availableOnly, err := strconv.ParseBool(c.DefaultQuery("available", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "available must be true or false"})
+		return
+	}
+
+	products, truncated, err := h.productService.GetProducts(includeDrafts, availableOnly)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	responses := models.ProductResponses(products)
+	if !h.setDisplayPrices(c, responsePointers(responses)...) {
+		return
+	}
 
-	c.JSON(http.StatusOK, products)
+	// Without the envelope the body is a plain array, so the warning goes in a header
+	if truncated {
+		c.Header("X-Results-Truncated", "true")
+	}
+
+	respondList(c, responses, gin.H{"truncated": truncated})
+}
+
+// StreamProducts sends the whole catalog as newline-delimited JSON (one product per line)
+// Unlike GET /api/products it has no size cap: products are read and sent one
+// at a time, so even a huge catalog never has to fit in memory
+// @Summary Stream all products as NDJSON
+// @Tags products
+// @Produce application/x-ndjson
+// @Success 200 {string} string "One models.ProductResponse JSON object per line, in ID order"
+// @Router /api/products/stream [get]
+func (h *ProductHandler) StreamProducts(c *gin.Context) {
+	// Read products in the background and hand them over one by one
+	ctx := c.Request.Context()
+	products := make(chan models.Product)
+	streamErr := make(chan error, 1)
+	go func() {
+		defer close(products)
+		streamErr <- h.productService.StreamProducts(func(product models.Product) error {
+			select {
+			case products <- product:
+				return nil
+			case <-ctx.Done(): // The client went away, stop reading
+				return ctx.Err()
+			}
+		})
+	}()
+
+	c.Header("Content-Type", "application/x-ndjson")
+
+	// Encode adds the newline after each product
+	encoder := json.NewEncoder(c.Writer)
+
+	// c.Stream keeps calling our function (flushing after each call) until it returns false
+	c.Stream(func(w io.Writer) bool {
+		product, ok := <-products
+		if !ok {
+			return false
+		}
+		if err := encoder.Encode(product.ToResponse()); err != nil {
+			log.Printf("Failed to write product %d to stream: %v", product.ID, err)
+		}
+		return true
+	})
+
+	// The status code is already sent, so all we can do about errors is log them
+	if err := <-streamErr; err != nil {
+		log.Printf("Product stream failed: %v", err)
+	}
+}
+
+// GetProductsOnSale returns products with an active sale
+// @Summary Get products currently on sale
+// @Tags products
+// @Produce json
+// @Param currency query string false "Also show prices in this currency, e.g. EUR (needs a configured rate)"
+// @Success 200 {array} models.ProductResponse
+// @Router /api/products/on-sale [get]
+func (h *ProductHandler) GetProductsOnSale(c *gin.Context) {
+	products, err := h.productService.GetProductsOnSale()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	responses := models.ProductResponses(products)
+	if !h.setDisplayPrices(c, responsePointers(responses)...) {
+		return
+	}
+
+	respondList(c, responses, nil)
 }
 
 // GetProduct returns a specific product
@@ -44,8 +150,10 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 // @Tags products
 // @Produce json
 // @Param id path int true "Product ID"
-// @Success 200 {object} models.Product
+// @Param currency query string false "Also show prices in this currency, e.g. EUR (needs a configured rate)"
+// @Success 200 {object} models.ProductResponse
 // @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
 // @Router /api/products/{id} [get]
 func (h *ProductHandler) GetProduct(c *gin.Context) {
 	// Get ID from URL parameter
@@ -57,11 +165,412 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 
 	product, err := h.productService.GetProduct(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		// Only a missing product is a 404 - anything else is our fault
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to get product %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get product"})
+		return
+	}
+	response := product.ToResponse()
+	if !h.setDisplayPrices(c, &response) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetCategories lists product categories with how many in-stock products each has
+// @Summary List product categories
+// @Tags products
+// @Produce json
+// @Param hide_empty query bool false "Leave out categories with no products in stock"
+// @Success 200 {array} models.CategoryCount
+// @Failure 400 {object} map[string]string
+// @Router /api/categories [get]
+func (h *ProductHandler) GetCategories(c *gin.Context) {
+	hideEmpty, err := strconv.ParseBool(c.DefaultQuery("hide_empty", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hide_empty must be true or false"})
 		return
 	}
 
-	c.JSON(http.StatusOK, product)
+	categories, err := h.productService.GetCategories(hideEmpty)
+	if err != nil {
+		log.Printf("Failed to get categories: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get categories"})
+		return
+	}
+
+	respondList(c, categories, nil)
+}
+
+// GetLowStockProducts lists products whose stock is below their reorder level
+// @Summary Low-stock products report (admin only)
+// @Tags products
+// @Produce json
+// @Param order query string false "desc (default): furthest below the reorder level first; asc: closest first"
+// @Success 200 {array} models.LowStockProductResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/products/low-stock [get]
+func (h *ProductHandler) GetLowStockProducts(c *gin.Context) {
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+
+	products, err := h.productService.GetLowStockProducts(order == "desc")
+	if err != nil {
+		log.Printf("Failed to get low-stock products: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get low-stock products"})
+		return
+	}
+	responses := make([]models.LowStockProductResponse, len(products))
+	for i := range products {
+		responses[i] = products[i].ToResponse()
+	}
+
+	respondList(c, responses, nil)
+}
+
+// JoinWaitlist puts the user on a sold-out product's waitlist
+// They are notified (over MQTT, by the notification service) once it's restocked
+// @Summary Join a sold-out product's waitlist
+// @Tags products
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 201 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/products/{id}/waitlist [post]
+func (h *ProductHandler) JoinWaitlist(c *gin.Context) {
+	id, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.productService.JoinWaitlist(userID, id); err != nil {
+		switch {
+		case errors.Is(err, services.ErrProductNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAlreadyOnWaitlist), errors.Is(err, services.ErrProductInStock):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Failed to join waitlist of product %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join waitlist"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "We'll let you know when this product is back in stock"})
+}
+
+// GetInventoryValuation reports what the stock on hand is worth, for finance
+// @Summary Inventory valuation report (admin only)
+// @Tags admin
+// @Produce json
+// @Param group_by query string false "category: also break the total down per category"
+// @Success 200 {object} models.InventoryValuation
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/inventory/valuation [get]
+func (h *ProductHandler) GetInventoryValuation(c *gin.Context) {
+	groupBy := c.Query("group_by")
+	if groupBy != "" && groupBy != "category" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be category (or left out)"})
+		return
+	}
+
+	valuation, err := h.productService.GetInventoryValuation(groupBy == "category")
+	if err != nil {
+		log.Printf("Failed to get inventory valuation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get inventory valuation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, valuation)
+}
+
+// GetProductEvents lists recent events of a product, to debug what was published about it
+// @Summary Get a product's event history (admin only)
+// @Tags admin
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param limit query int false "Maximum events to return (default 50, max 500)"
+// @Success 200 {array} models.ProductEvent
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/products/{id}/events [get]
+func (h *ProductHandler) GetProductEvents(c *gin.Context) {
+	id, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	events, err := h.productService.GetProductEvents(id, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, events, nil)
+}
+
+// PublishProduct puts a draft product into the public catalog
+// Publishing a product that is already published does nothing
+// @Summary Publish a draft product (admin only)
+// @Tags admin
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} models.ProductResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/admin/products/{id}/publish [post]
+func (h *ProductHandler) PublishProduct(c *gin.Context) {
+	id, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	product, err := h.productService.PublishProduct(userID, id)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to publish product %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, product.ToResponse())
+}
+
+// GetProductBySKU looks up a product by its SKU (e.g. a scanned barcode)
+// @Summary Get product by SKU
+// @Tags products
+// @Produce json
+// @Param sku path string true "Stock keeping unit"
+// @Param currency query string false "Also show prices in this currency, e.g. EUR (needs a configured rate)"
+// @Success 200 {object} models.ProductResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/products/by-sku/{sku} [get]
+func (h *ProductHandler) GetProductBySKU(c *gin.Context) {
+	product, err := h.productService.GetProductBySKU(c.Param("sku"))
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := product.ToResponse()
+	if !h.setDisplayPrices(c, &response) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetRelatedProducts recommends products that customers who bought this one also bought
+// @Summary Get related products
+// @Tags products
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param limit query int false "How many products to return (default 5, max 20)"
+// @Param currency query string false "Also show prices in this currency, e.g. EUR (needs a configured rate)"
+// @Success 200 {array} models.ProductResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/products/{id}/related [get]
+func (h *ProductHandler) GetRelatedProducts(c *gin.Context) {
+	id, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	products, err := h.productService.GetRelatedProducts(id, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to get products related to %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get related products"})
+		return
+	}
+	responses := models.ProductResponses(products)
+	if !h.setDisplayPrices(c, responsePointers(responses)...) {
+		return
+	}
+
+	respondList(c, responses, nil)
+}
+
+// GetTopSellers lists the best-selling products of a period
+// from and to are optional dates (YYYY-MM-DD); both days are included
+// @Summary Get top-selling products
+// @Tags products
+// @Produce json
+// @Param from query string false "First day to include (YYYY-MM-DD, default 30 days ago)"
+// @Param to query string false "Last day to include (YYYY-MM-DD, default today)"
+// @Param sort query string false "units (default) or revenue"
+// @Param limit query int false "How many products to return (default 10, max 100)"
+// @Param currency query string false "Also show prices in this currency, e.g. EUR (needs a configured rate)"
+// @Success 200 {array} models.TopSellerResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/products/top [get]
+func (h *ProductHandler) GetTopSellers(c *gin.Context) {
+	from, err := parseDateParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+		return
+	}
+
+	to, err := parseDateParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	sellers, err := h.productService.GetTopSellers(from, to, c.Query("sort"), limit)
+	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			respondValidationError(c, validationErr)
+			return
+		}
+		log.Printf("Failed to get top sellers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get top sellers"})
+		return
+	}
+	responses := make([]models.TopSellerResponse, len(sellers))
+	products := make([]*models.ProductResponse, len(sellers))
+	for i := range sellers {
+		responses[i] = sellers[i].ToResponse()
+		products[i] = &responses[i].ProductResponse
+	}
+	if !h.setDisplayPrices(c, products...) {
+		return
+	}
+
+	respondList(c, responses, nil)
+}
+
+// GetPriceHistory lists how a product's price changed over time
+// @Summary Get product price history
+// @Tags products
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {array} models.PriceChange
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/products/{id}/price-history [get]
+func (h *ProductHandler) GetPriceHistory(c *gin.Context) {
+	id, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	history, err := h.productService.GetPriceHistory(id)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to get price history of product %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get price history"})
+		return
+	}
+
+	respondList(c, history, nil)
+}
+
+// GetProductAvailability checks whether a quantity of a product is in stock
+// @Summary Check product availability
+// @Tags products
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param quantity query int false "How many units the customer wants (default 1)"
+// @Success 200 {object} models.ProductAvailability
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/products/{id}/availability [get]
+func (h *ProductHandler) GetProductAvailability(c *gin.Context) {
+	id, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	quantity, err := strconv.Atoi(c.DefaultQuery("quantity", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity"})
+		return
+	}
+
+	availability, err := h.productService.GetAvailability(id, quantity)
+	if err != nil {
+		var validationErr *services.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			respondValidationError(c, validationErr)
+		case errors.Is(err, services.ErrProductNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Failed to check availability of product %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check availability"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, availability)
 }
 
 // CreateProduct creates a new product
@@ -70,11 +579,21 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param product body models.ProductRequest true "Product data"
-// @Success 201 {object} models.Product
+// @Param upsert query bool false "Update the existing product if the SKU is taken"
+// @Success 201 {object} models.ProductResponse
+// @Success 200 {object} models.ProductResponse "Existing product updated (upsert)"
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Security BearerAuth
 // @Router /api/products [post]
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
+	// The logged-in user is recorded in the audit log
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	var req models.ProductRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -82,13 +601,65 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := h.productService.CreateProduct(req)
+	upsert := c.Query("upsert") == "true"
+	product, created, err := h.productService.CreateProduct(userID, req, upsert)
+	if err != nil {
+		respondProductWriteError(c, err)
+		return
+	}
+
+	if !created {
+		c.JSON(http.StatusOK, product.ToResponse())
+		return
+	}
+	c.JSON(http.StatusCreated, product.ToResponse())
+}
+
+// CloneProduct copies a product into a new draft, e.g. to start a variant of it
+// The body is optional; it can give the clone another name or SKU
+// @Summary Clone a product (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "ID of the product to copy"
+// @Param clone body models.ProductCloneRequest false "Name and SKU for the clone"
+// @Success 201 {object} models.ProductResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/products/{id}/clone [post]
+func (h *ProductHandler) CloneProduct(c *gin.Context) {
+	id, err := getIDFromParam(c, "id")
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// An empty body just means "copy everything"
+	var req models.ProductCloneRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, product)
+	product, err := h.productService.CloneProduct(userID, id, req)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		respondProductWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, product.ToResponse())
 }
 
 // UpdateProduct updates an existing product
@@ -98,11 +669,18 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 // @Produce json
 // @Param id path int true "Product ID"
 // @Param product body models.ProductRequest true "Product data"
-// @Success 200 {object} models.Product
+// @Success 200 {object} models.ProductResponse
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Security BearerAuth
 // @Router /api/products/{id} [put]
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	id, err := getIDFromParam(c, "id")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
@@ -115,11 +693,101 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := h.productService.UpdateProduct(id, req)
+	product, err := h.productService.UpdateProduct(userID, id, req)
 	if err != nil {
+		respondProductWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product.ToResponse())
+}
+
+// PatchProduct updates only the fields sent in the request body
+// @Summary Partially update a product
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param product body object true "Fields to change, e.g. {\"price_cents\": 1999}"
+// @Success 200 {object} models.ProductResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/products/{id} [patch]
+func (h *ProductHandler) PatchProduct(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id, err := getIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	// A map lets us tell "field not sent" apart from "field sent as zero/empty"
+	var fields map[string]interface{}
+	if err := c.ShouldBindJSON(&fields); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, product)
+	product, err := h.productService.PatchProduct(userID, id, fields)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		respondProductWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product.ToResponse())
+}
+
+// respondProductWriteError turns an error from creating/updating a product into a response
+// Validation errors tell the client which field is wrong
+func respondProductWriteError(c *gin.Context, err error) {
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		respondValidationError(c, validationErr)
+		return
+	}
+
+	if errors.Is(err, services.ErrDuplicateSKU) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// setDisplayPrices fills in display_price of the products when the request asks
+// for a currency (?currency=EUR)
+// For a currency we have no rate for, it responds with 400 and returns false
+func (h *ProductHandler) setDisplayPrices(c *gin.Context, products ...*models.ProductResponse) bool {
+	err := h.productService.SetDisplayPrice(c.Query("currency"), products...)
+	if err == nil {
+		return true
+	}
+
+	if errors.Is(err, money.ErrUnknownCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	log.Printf("Failed to convert prices: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert prices"})
+	return false
+}
+
+// responsePointers returns a pointer to each product response, so they can be changed in place
+func responsePointers(products []models.ProductResponse) []*models.ProductResponse {
+	pointers := make([]*models.ProductResponse, len(products))
+	for i := range products {
+		pointers[i] = &products[i]
+	}
+	return pointers
 }
@@ -0,0 +1,612 @@
+// internal/handlers/products_test.go
+// Tests for the product endpoints, with the repository faked out
+
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"online-store/internal/config"
+	"online-store/internal/models"
+	"online-store/internal/sanitize"
+	"online-store/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// fakeProducts is a product repository holding a few products
+// Methods a test doesn't need aren't implemented and panic when called
+type fakeProducts struct {
+	services.ProductRepository
+	products map[int]models.Product
+	err      error // Returned by every lookup when set, like a broken database
+}
+
+func (r *fakeProducts) GetByID(id int) (*models.Product, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	product, ok := r.products[id]
+	if !ok {
+		return nil, services.ErrProductNotFound
+	}
+	return &product, nil
+}
+
+func (r *fakeProducts) GetAll(limit int, includeDrafts, availableOnly bool) ([]models.Product, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	products := []models.Product{}
+	for id := 1; id <= len(r.products) && (limit <= 0 || len(products) < limit); id++ {
+		product := r.products[id]
+		if product.Status == models.ProductStatusDraft && !includeDrafts {
+			continue
+		}
+		if availableOnly && !product.AvailableAt(time.Now()) {
+			continue
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+func (r *fakeProducts) GetBySKU(sku string) (*models.Product, error) {
+	for _, product := range r.products {
+		if product.SKU == sku {
+			return &product, nil
+		}
+	}
+	return nil, services.ErrProductNotFound
+}
+
+// ValueByCategory values all products as one category
+func (r *fakeProducts) ValueByCategory() ([]models.CategoryValuation, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	valuation := models.CategoryValuation{}
+	for _, product := range r.products {
+		valuation.Products++
+		valuation.Units += int64(product.StockQuantity)
+		valuation.ValueCents += int64(product.PriceCents) * int64(product.StockQuantity)
+	}
+	return []models.CategoryValuation{valuation}, nil
+}
+
+// Insert stores a new product with the next free ID
+func (r *fakeProducts) Insert(req models.ProductRequest) (int, error) {
+	id := len(r.products) + 1
+	product := models.Product{ID: id, SKU: req.SKU, Name: req.Name, PriceCents: req.PriceCents, Status: models.ProductStatusPublished}
+	if req.Draft {
+		product.Status = models.ProductStatusDraft
+	}
+	if req.StockQuantity != nil {
+		product.StockQuantity = *req.StockQuantity
+	}
+	r.products[id] = product
+	return id, nil
+}
+
+// GetTopSellers ranks the products by ID, as if product 1 sold best
+func (r *fakeProducts) GetTopSellers(from, to time.Time, byRevenue bool, limit int) ([]models.TopSeller, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	sellers := []models.TopSeller{}
+	for id := 1; id <= len(r.products) && len(sellers) < limit; id++ {
+		sellers = append(sellers, models.TopSeller{Product: r.products[id], UnitsSold: int64(100 - id)})
+	}
+	return sellers, nil
+}
+
+// Stream sends the products in ID order; with err set, it fails after the last one
+// like a connection that breaks halfway through
+func (r *fakeProducts) Stream(fn func(product models.Product) error) error {
+	for id := 1; id <= len(r.products); id++ {
+		if err := fn(r.products[id]); err != nil {
+			return err
+		}
+	}
+	return r.err
+}
+
+// nopPublisher drops every event
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(topic string, payload interface{}) error {
+	return nil
+}
+
+// nopEvents throws product events away
+type nopEvents struct {
+	services.ProductEventRepository
+}
+
+func (nopEvents) Insert(event models.ProductEvent) error {
+	return nil
+}
+
+// newProductRouter serves the product handlers on top of repo
+func newProductRouter(repo services.ProductRepository) *gin.Engine {
+	return newProductRouterWithConfig(repo, &config.Config{Currency: "USD"})
+}
+
+// newProductRouterWithConfig is newProductRouter with a config of the test's choosing
+func newProductRouterWithConfig(repo services.ProductRepository, cfg *config.Config) *gin.Engine {
+	service := services.NewProductService(repo, nil, nil, nopPublisher{}, services.NewAuditService(nil), sanitize.PolicyNone, cfg)
+	handler := NewProductHandler(service)
+
+	router := gin.New()
+	router.GET("/api/products", handler.GetProducts)
+	router.GET("/api/products/stream", handler.StreamProducts)
+	router.GET("/api/products/top", handler.GetTopSellers)
+	router.GET("/api/products/by-sku/:sku", handler.GetProductBySKU)
+	router.GET("/api/products/:id", handler.GetProduct)
+	return router
+}
+
+// streamRecorder is a ResponseRecorder that gin can stream to (c.Stream needs CloseNotify)
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r streamRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+// serve sends a request through router and returns the response
+func serve(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(streamRecorder{w}, req)
+	return w
+}
+
+func TestGetProductStatus(t *testing.T) {
+	products := map[int]models.Product{1: {ID: 1, Name: "Mug", PriceCents: 900, Status: models.ProductStatusPublished}}
+
+	tests := []struct {
+		name string
+		repo *fakeProducts
+		path string
+		want int
+	}{
+		{"found", &fakeProducts{products: products}, "/api/products/1", http.StatusOK},
+		{"missing", &fakeProducts{products: products}, "/api/products/2", http.StatusNotFound},
+		{"bad id", &fakeProducts{products: products}, "/api/products/abc", http.StatusBadRequest},
+		{"database down", &fakeProducts{err: errors.New("connection refused")}, "/api/products/1", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(newProductRouter(tt.repo), http.MethodGet, tt.path, "")
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestGetProductHidesDatabaseErrors(t *testing.T) {
+	w := serve(newProductRouter(&fakeProducts{err: errors.New("dial tcp 10.0.0.5:3306: connection refused")}), http.MethodGet, "/api/products/1", "")
+	if strings.Contains(w.Body.String(), "10.0.0.5") {
+		t.Errorf("body leaks the database error: %s", w.Body)
+	}
+}
+
+// catalog returns a repository with n products, numbered from 1
+func catalog(n int) *fakeProducts {
+	products := make(map[int]models.Product)
+	for id := 1; id <= n; id++ {
+		products[id] = models.Product{ID: id, Name: "Mug", PriceCents: 900, Status: models.ProductStatusPublished}
+	}
+	return &fakeProducts{products: products}
+}
+
+func TestGetProductsTruncatedHeader(t *testing.T) {
+	cfg := &config.Config{Currency: "USD", MaxProductsListed: 2}
+
+	w := serve(newProductRouterWithConfig(catalog(3), cfg), http.MethodGet, "/api/products", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	var products []models.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &products); err != nil || len(products) != 2 {
+		t.Errorf("body = %s, want 2 products", w.Body)
+	}
+	if got := w.Header().Get("X-Results-Truncated"); got != "true" {
+		t.Errorf("X-Results-Truncated = %q, want true", got)
+	}
+
+	w = serve(newProductRouterWithConfig(catalog(2), cfg), http.MethodGet, "/api/products", "")
+	if got := w.Header().Get("X-Results-Truncated"); got != "" {
+		t.Errorf("X-Results-Truncated = %q for a complete list, want none", got)
+	}
+}
+
+// streamedIDs reads an NDJSON product stream, checking every line is a product
+func streamedIDs(t *testing.T, body string) []int {
+	t.Helper()
+
+	var ids []int
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var product models.Product
+		if err := json.Unmarshal(scanner.Bytes(), &product); err != nil {
+			t.Fatalf("line %d is not a product: %q (%v)", len(ids)+1, scanner.Text(), err)
+		}
+		ids = append(ids, product.ID)
+	}
+	return ids
+}
+
+func TestStreamProducts(t *testing.T) {
+	// More than MaxProductsListed, which doesn't apply to the stream
+	cfg := &config.Config{Currency: "USD", MaxProductsListed: 10}
+	w := serve(newProductRouterWithConfig(catalog(250), cfg), http.MethodGet, "/api/products/stream", "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", got)
+	}
+	if !strings.HasSuffix(w.Body.String(), "}\n") {
+		t.Errorf("body doesn't end with a newline after the last product")
+	}
+
+	ids := streamedIDs(t, w.Body.String())
+	if len(ids) != 250 {
+		t.Fatalf("streamed %d products, want 250", len(ids))
+	}
+	for i, id := range ids {
+		if id != i+1 {
+			t.Fatalf("line %d has product %d, want %d (ID order)", i+1, id, i+1)
+		}
+	}
+}
+
+func TestStreamProductsEmptyCatalog(t *testing.T) {
+	w := serve(newProductRouter(catalog(0)), http.MethodGet, "/api/products/stream", "")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("status = %d, body = %q, want 200 and nothing", w.Code, w.Body)
+	}
+}
+
+func TestStreamProductsDatabaseFails(t *testing.T) {
+	repo := catalog(3)
+	repo.err = errors.New("connection reset")
+
+	// What was read before the error still arrives, and the handler doesn't hang
+	w := serve(newProductRouter(repo), http.MethodGet, "/api/products/stream", "")
+	if ids := streamedIDs(t, w.Body.String()); len(ids) != 3 {
+		t.Errorf("streamed %v, want the 3 products read before the error", ids)
+	}
+}
+
+func TestGetProductBySKU(t *testing.T) {
+	products := map[int]models.Product{1: {ID: 1, Name: "Mug", SKU: "MUG-1", PriceCents: 900, Status: models.ProductStatusPublished}}
+	router := newProductRouter(&fakeProducts{products: products})
+
+	w := serve(router, http.MethodGet, "/api/products/by-sku/MUG-1", "")
+	var product models.Product
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &product) != nil || product.ID != 1 {
+		t.Errorf("status = %d, body = %s, want 200 and the mug", w.Code, w.Body)
+	}
+
+	if w := serve(router, http.MethodGet, "/api/products/by-sku/TEA-1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown SKU: status = %d, want 404", w.Code)
+	}
+}
+
+func TestGetProductsDrafts(t *testing.T) {
+	repo := catalog(2)
+	draft := repo.products[2]
+	draft.Status = models.ProductStatusDraft
+	repo.products[2] = draft
+
+	service := services.NewProductService(repo, nil, nil, nopPublisher{}, services.NewAuditService(nil), sanitize.PolicyNone, &config.Config{Currency: "USD"})
+	handler := NewProductHandler(service)
+	router := gin.New()
+	router.GET("/api/products", handler.GetProducts)
+	router.GET("/api/admin/products", func(c *gin.Context) { c.Set("user_role", models.RoleAdmin) }, handler.GetProducts)
+	router.GET("/api/customer/products", func(c *gin.Context) { c.Set("user_role", models.RoleCustomer) }, handler.GetProducts)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantCount  int
+	}{
+		{"/api/products", http.StatusOK, 1},
+		{"/api/products?include_drafts=true", http.StatusForbidden, 0},
+		{"/api/customer/products?include_drafts=true", http.StatusForbidden, 0},
+		{"/api/admin/products", http.StatusOK, 1},
+		{"/api/admin/products?include_drafts=true", http.StatusOK, 2},
+		{"/api/admin/products?include_drafts=maybe", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.path, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var products []models.Product
+			if err := json.Unmarshal(w.Body.Bytes(), &products); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(products) != tt.wantCount {
+				t.Errorf("%d products, want %d", len(products), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestGetInventoryValuationEndpoint(t *testing.T) {
+	repo := catalog(2)
+	for id, product := range repo.products {
+		product.StockQuantity = 3
+		repo.products[id] = product
+	}
+	service := services.NewProductService(repo, nil, nil, nopPublisher{}, services.NewAuditService(nil), sanitize.PolicyNone, &config.Config{Currency: "USD"})
+	router := gin.New()
+	router.GET("/valuation", NewProductHandler(service).GetInventoryValuation)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/valuation", http.StatusOK, `{"total_cents":5400,"units":6,"categories":null}`},
+		{"/valuation?group_by=category", http.StatusOK, `{"total_cents":5400,"units":6,"categories":[{"category":"","products":2,"units":6,"value_cents":5400}]}`},
+		{"/valuation?group_by=sku", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.path, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+
+	repo.err = errors.New("connection refused")
+	if w := serve(router, http.MethodGet, "/valuation", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("broken database: status = %d, want 500", w.Code)
+	}
+}
+
+// fakeWaitlist remembers who joined which product's waitlist
+type fakeWaitlist struct {
+	joined map[[2]int]bool // {product ID, user ID}
+}
+
+func (w *fakeWaitlist) Add(productID, userID int) error {
+	if w.joined[[2]int{productID, userID}] {
+		return services.ErrAlreadyOnWaitlist
+	}
+	w.joined[[2]int{productID, userID}] = true
+	return nil
+}
+
+func (w *fakeWaitlist) TakeAll(productID int) ([]models.WaitlistEntry, error) {
+	return nil, nil
+}
+
+func TestJoinWaitlistEndpoint(t *testing.T) {
+	repo := catalog(2)
+	soldOut := repo.products[1]
+	soldOut.StockQuantity = 0
+	repo.products[1] = soldOut
+	inStock := repo.products[2]
+	inStock.StockQuantity = 5
+	repo.products[2] = inStock
+
+	cfg := &config.Config{Currency: "USD", BackInStockMin: 1}
+	service := services.NewProductService(repo, nil, &fakeWaitlist{joined: make(map[[2]int]bool)}, nopPublisher{}, services.NewAuditService(nil), sanitize.PolicyNone, cfg)
+	router := gin.New()
+	router.POST("/products/:id/waitlist", func(c *gin.Context) { c.Set("user_id", 7) }, NewProductHandler(service).JoinWaitlist)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"join", "/products/1/waitlist", http.StatusCreated},
+		{"join twice", "/products/1/waitlist", http.StatusConflict},
+		{"in stock", "/products/2/waitlist", http.StatusConflict},
+		{"unknown product", "/products/42/waitlist", http.StatusNotFound},
+		{"bad ID", "/products/mug/waitlist", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(router, http.MethodPost, tt.path, ""); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestGetProductsAvailable(t *testing.T) {
+	repo := catalog(2)
+	ended := time.Now().Add(-time.Hour)
+	flashSale := repo.products[2]
+	flashSale.AvailableUntil = &ended
+	repo.products[2] = flashSale
+	router := newProductRouter(repo)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantCount  int
+	}{
+		{"/api/products", http.StatusOK, 2},
+		{"/api/products?available=true", http.StatusOK, 1},
+		{"/api/products?available=false", http.StatusOK, 2},
+		{"/api/products?available=soon", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.path, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var products []models.Product
+			if err := json.Unmarshal(w.Body.Bytes(), &products); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(products) != tt.wantCount {
+				t.Errorf("%d products, want %d", len(products), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestGetTopSellersEndpoint(t *testing.T) {
+	router := newProductRouter(catalog(3))
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantCount  int
+	}{
+		{"/api/products/top", http.StatusOK, 3},
+		{"/api/products/top?limit=2&sort=revenue&from=2024-03-01&to=2024-03-31", http.StatusOK, 2},
+		{"/api/products/top?from=March", http.StatusBadRequest, 0},
+		{"/api/products/top?to=2024-13-01", http.StatusBadRequest, 0},
+		{"/api/products/top?limit=ten", http.StatusBadRequest, 0},
+		{"/api/products/top?sort=price", http.StatusBadRequest, 0},
+		{"/api/products/top?from=2024-03-31&to=2024-03-01", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.path, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var sellers []models.TopSeller
+			if err := json.Unmarshal(w.Body.Bytes(), &sellers); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(sellers) != tt.wantCount || sellers[0].ID != 1 || sellers[0].UnitsSold != 99 {
+				t.Errorf("sellers = %+v, want %d with product 1 first", sellers, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestDisplayCurrency(t *testing.T) {
+	repo := catalog(2)
+	for id, product := range repo.products {
+		product.EffectivePriceCents = product.PriceCents
+		repo.products[id] = product
+	}
+	cfg := &config.Config{Currency: "USD", CurrencyRates: map[string]*big.Rat{"JPY": big.NewRat(1513, 10)}}
+	router := newProductRouterWithConfig(repo, cfg)
+
+	w := serve(router, http.MethodGet, "/api/products?currency=jpy", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	var products []models.ProductResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &products); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := models.DisplayPrice{Currency: "JPY", Amount: 1362, Formatted: "1362 JPY"}
+	for _, product := range products {
+		if product.DisplayPrice == nil || *product.DisplayPrice != want || product.PriceCents != 900 {
+			t.Errorf("product %d: price %d, display price %+v; want 900 and %+v", product.ID, product.PriceCents, product.DisplayPrice, want)
+		}
+	}
+
+	w = serve(router, http.MethodGet, "/api/products/1?currency=JPY", "")
+	var product models.ProductResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &product); err != nil || product.DisplayPrice == nil || product.DisplayPrice.Amount != 1362 {
+		t.Errorf("single product: display price = %+v, err = %v, want 1362 JPY", product.DisplayPrice, err)
+	}
+
+	// Without ?currency the field is left out
+	w = serve(router, http.MethodGet, "/api/products/1", "")
+	if strings.Contains(w.Body.String(), "display_price") {
+		t.Errorf("body = %s, want no display_price", w.Body)
+	}
+
+	w = serve(router, http.MethodGet, "/api/products?currency=CHF", "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown currency") {
+		t.Errorf("unknown currency: status = %d, body %s; want 400", w.Code, w.Body)
+	}
+}
+
+func TestCloneProductEndpoint(t *testing.T) {
+	repo := catalog(1)
+	service := services.NewProductService(repo, nopEvents{}, nil, nopPublisher{}, services.NewAuditService(nopAudit{}), sanitize.PolicyNone, &config.Config{Currency: "USD"})
+	router := gin.New()
+	router.POST("/api/products/:id/clone", func(c *gin.Context) { c.Set("user_id", 1) }, NewProductHandler(service).CloneProduct)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantName   string
+	}{
+		{"no body", "/api/products/1/clone", "", http.StatusCreated, "Mug"},
+		{"new name", "/api/products/1/clone", `{"name": "Cup"}`, http.StatusCreated, "Cup"},
+		{"unknown product", "/api/products/42/clone", "", http.StatusNotFound, ""},
+		{"invalid ID", "/api/products/mug/clone", "", http.StatusBadRequest, ""},
+		{"invalid body", "/api/products/1/clone", `{"name": 7}`, http.StatusBadRequest, ""},
+		{"SKU too long", "/api/products/1/clone", `{"sku": "` + strings.Repeat("S", 65) + `"}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPost, tt.path, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			var clone models.Product
+			if err := json.Unmarshal(w.Body.Bytes(), &clone); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if clone.ID == 1 || clone.Name != tt.wantName || clone.Status != models.ProductStatusDraft {
+				t.Errorf("clone = %+v, want a new draft called %s", clone, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+// internal/handlers/validation.go
+// This file renders validation errors in the client's language
+
+package handlers
+
+import (
+	"net/http"
+
+	"online-store/internal/i18n"
+	"online-store/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondValidationError answers 400 Bad Request for a validation error
+// The message is translated into the language the client asked for with the
+// Accept-Language header (English if we don't speak it); "field" stays the
+// JSON field name, so clients can still match it in code
+func respondValidationError(c *gin.Context, validationErr *services.ValidationError) {
+	language := i18n.FromAcceptLanguage(c.GetHeader("Accept-Language"))
+	c.Header("Content-Language", string(language))
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": validationErr.Field + ": " + i18n.Translate(language, validationErr.Message),
+		"field": validationErr.Field,
+	})
+}
@@ -0,0 +1,63 @@
+// internal/handlers/validation_test.go
+// Tests for rendering validation errors in the client's language
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"online-store/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidationErrorLanguage(t *testing.T) {
+	orders := &fakeOrders{statuses: map[int]models.OrderStatus{1: models.OrderStatusPending}}
+	handler := newOrderHandler(orders, nil, "USD")
+	router := gin.New()
+	router.PUT("/orders/:id/status", func(c *gin.Context) { c.Set("user_id", 1) }, handler.UpdateOrderStatus)
+
+	tests := []struct {
+		acceptLanguage string
+		wantLanguage   string
+		wantError      string
+	}{
+		{"de-DE,de;q=0.9", "de", `status: unbekannter Status "lost" (erlaubt: pending, paid, shipped, delivered, on_hold)`},
+		{"en", "en", `status: unknown status "lost" (use pending, paid, shipped, delivered, on_hold)`},
+		{"fr", "en", `status: unknown status "lost" (use pending, paid, shipped, delivered, on_hold)`},
+		{"", "en", `status: unknown status "lost" (use pending, paid, shipped, delivered, on_hold)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/orders/1/status", strings.NewReader(`{"status": "lost"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", w.Code)
+			}
+			if got := w.Header().Get("Content-Language"); got != tt.wantLanguage {
+				t.Errorf("Content-Language = %q, want %q", got, tt.wantLanguage)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if body["error"] != tt.wantError {
+				t.Errorf("error = %q, want %q", body["error"], tt.wantError)
+			}
+			// The field name is for code, so it's never translated
+			if body["field"] != "status" {
+				t.Errorf("field = %q, want status", body["field"])
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// internal/i18n/i18n.go
+// This file translates error messages into the client's language
+// The English message is the key (like gettext's msgid), so services keep
+// writing plain English and only the response is translated
+
+package i18n
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Language is a primary language tag like "en" or "de"
+type Language string
+
+// Supported languages
+const (
+	English Language = "en" // The language our messages are written in
+	German  Language = "de"
+)
+
+// catalogs maps each language to its translations, keyed by the English message
+// Messages can contain %d, %q and %s like in fmt; the translation uses the same
+// verbs in the same order
+// English needs no catalog - a missing translation falls back to the English text
+var catalogs = map[Language]map[string]string{
+	German: {
+		"is required":                                       "ist erforderlich",
+		"is not valid":                                      "ist ungültig",
+		"invalid value":                                     "ungültiger Wert",
+		"must not be blank":                                 "darf nicht leer sein",
+		"must not be negative":                              "darf nicht negativ sein",
+		"must be at least 1":                                "muss mindestens 1 sein",
+		"must be at most %d":                                "darf höchstens %d sein",
+		"must be at most %d characters":                     "darf höchstens %d Zeichen lang sein",
+		"must be lower than price_cents":                    "muss kleiner als price_cents sein",
+		"must not be negative (product %d)":                 "darf nicht negativ sein (Produkt %d)",
+		"must not be after to":                              "darf nicht nach to liegen",
+		"must be day, week or month":                        "muss day, week oder month sein",
+		"must be units or revenue":                          "muss units oder revenue sein",
+		"no fields to update":                               "keine Felder zum Aktualisieren",
+		"unknown or read-only field":                        "unbekanntes oder schreibgeschütztes Feld",
+		"order total is too large":                          "Bestellsumme ist zu hoch",
+		"can't be combined with offset":                     "kann nicht mit offset kombiniert werden",
+		"at most %d of this product per order":              "höchstens %d Stück dieses Produkts pro Bestellung",
+		"already has the maximum of %d products":            "enthält bereits die Höchstzahl von %d Produkten",
+		"range has too many buckets, use a larger group_by": "Zeitraum hat zu viele Abschnitte, bitte ein größeres group_by wählen",
+		"unknown status %q (use %s)":                        "unbekannter Status %q (erlaubt: %s)",
+		"is too easy to guess, try a longer passphrase":     "ist zu leicht zu erraten, bitte eine längere Passphrase wählen",
+	},
+}
+
+// verbPattern finds the fmt verbs we support in catalog keys
+var verbPattern = regexp.MustCompile(`%[dqs]`)
+
+// entry is a catalog key turned into a regexp, so formatted messages can be matched
+type entry struct {
+	pattern     *regexp.Regexp
+	translation string
+}
+
+// compiled holds each catalog's entries with placeholders, built once at startup
+var compiled = compileCatalogs()
+
+// compileCatalogs turns keys like "must be at most %d" into regexps like ^must be at most (-?\d+)$
+func compileCatalogs() map[Language][]entry {
+	result := make(map[Language][]entry)
+	for language, catalog := range catalogs {
+		for key, translation := range catalog {
+			if !verbPattern.MatchString(key) {
+				continue // Plain messages are looked up directly
+			}
+			parts := verbPattern.Split(key, -1)
+			verbs := verbPattern.FindAllString(key, -1)
+			pattern := regexp.QuoteMeta(parts[0])
+			for i, verb := range verbs {
+				switch verb {
+				case "%d":
+					pattern += `(-?\d+)`
+				case "%q":
+					pattern += `("(?:[^"\\]|\\.)*")`
+				default:
+					pattern += `(.*)`
+				}
+				pattern += regexp.QuoteMeta(parts[i+1])
+			}
+			result[language] = append(result[language], entry{
+				pattern:     regexp.MustCompile("^" + pattern + "$"),
+				translation: translation,
+			})
+		}
+	}
+	return result
+}
+
+// Translate returns message in the given language
+// Messages (or languages) without a translation are returned in English
+func Translate(language Language, message string) string {
+	catalog, ok := catalogs[language]
+	if !ok {
+		return message
+	}
+	if translation, ok := catalog[message]; ok {
+		return translation
+	}
+
+	// Try the messages with placeholders, putting the original values back in
+	for _, e := range compiled[language] {
+		values := e.pattern.FindStringSubmatch(message)
+		if values == nil {
+			continue
+		}
+		args := make([]interface{}, 0, len(values)-1)
+		for _, value := range values[1:] {
+			args = append(args, value)
+		}
+		// The values are already formatted (e.g. with quotes), so every verb becomes %s
+		return fmt.Sprintf(verbPattern.ReplaceAllString(e.translation, "%s"), args...)
+	}
+
+	return message
+}
+
+// FromAcceptLanguage picks the language for an Accept-Language header,
+// like "de-AT,de;q=0.9,en;q=0.8"
+// The client's most preferred supported language wins; English is the fallback
+func FromAcceptLanguage(header string) Language {
+	type choice struct {
+		language Language
+		quality  float64
+	}
+
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+
+		// "de-AT" counts as "de" - we don't have regional catalogs
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		language := Language(primary)
+		if language == English || catalogs[language] != nil {
+			choices = append(choices, choice{language, quality})
+		}
+	}
+
+	// Stable, so equally preferred languages keep the client's order
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].quality > choices[j].quality })
+	if len(choices) == 0 || choices[0].quality <= 0 {
+		return English
+	}
+	return choices[0].language
+}
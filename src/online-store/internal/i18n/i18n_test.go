@@ -0,0 +1,75 @@
+// internal/i18n/i18n_test.go
+// Tests for translating error messages
+
+package i18n
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name     string
+		language Language
+		message  string
+		want     string
+	}{
+		{"plain message", German, "is required", "ist erforderlich"},
+		{"with a number", German, "must be at most 100 characters", "darf höchstens 100 Zeichen lang sein"},
+		{"with a negative number", German, "must not be negative (product -3)", "darf nicht negativ sein (Produkt -3)"},
+		{"with a quoted value and a list", German, `unknown status "lost" (use pending, paid)`, `unbekannter Status "lost" (erlaubt: pending, paid)`},
+		{"quote inside the quoted value", German, `unknown status "a\"b" (use paid)`, `unbekannter Status "a\"b" (erlaubt: paid)`},
+		{"no translation", German, "something new went wrong", "something new went wrong"},
+		{"number where the key has none", German, "must be at least 2", "must be at least 2"},
+		{"English", English, "is required", "is required"},
+		{"language we don't speak", Language("fr"), "is required", "is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Translate(tt.language, tt.message); got != tt.want {
+				t.Errorf("Translate(%s, %q) = %q, want %q", tt.language, tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+// A translation must use the same verbs in the same order as its key,
+// or Translate would put the values in the wrong places
+func TestCatalogVerbsMatch(t *testing.T) {
+	for language, catalog := range catalogs {
+		for key, translation := range catalog {
+			keyVerbs := verbPattern.FindAllString(key, -1)
+			translationVerbs := verbPattern.FindAllString(translation, -1)
+			if !reflect.DeepEqual(keyVerbs, translationVerbs) {
+				t.Errorf("%s: %q has verbs %v, its translation %q has %v", language, key, keyVerbs, translation, translationVerbs)
+			}
+		}
+	}
+}
+
+func TestFromAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Language
+	}{
+		{"", English},
+		{"de", German},
+		{"DE", German},
+		{"de-AT", German},
+		{"de-AT,de;q=0.9,en;q=0.8", German},
+		{"en-US,en;q=0.9,de;q=0.8", English},
+		{"fr", English},               // We don't speak French
+		{"fr,de;q=0.5", German},       // but German is next best
+		{"en;q=0.3,de;q=0.7", German}, // Quality wins over order
+		{"de;q=0", English},           // q=0 means "not German"
+		{"de;q=nonsense, fr", German}, // A broken quality counts as 1
+		{"de;q=0.5,en;q=0.5", German}, // Equal quality keeps the client's order
+		{"*", English},
+	}
+	for _, tt := range tests {
+		if got := FromAcceptLanguage(tt.header); got != tt.want {
+			t.Errorf("FromAcceptLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// internal/jwtkeys/keys.go
+// This file decides how our JWTs are signed and checked
+//   - HS256 (the default) signs and checks with one shared secret, so every
+//     service that checks tokens must know the secret
+//   - RS256 signs with a private key that only we have; other services can
+//     check tokens with the public key, which doesn't need to be kept secret
+
+package jwtkeys
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Keys holds the signing method and keys for our JWTs
+type Keys struct {
+	method    jwt.SigningMethod
+	signKey   interface{} // []byte secret (HS256) or *rsa.PrivateKey (RS256)
+	verifyKey interface{} // []byte secret (HS256) or *rsa.PublicKey (RS256)
+}
+
+// NewHS256 creates keys that sign and check tokens with a shared secret
+func NewHS256(secret string) *Keys {
+	return &Keys{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// NewRS256 creates keys from PEM-encoded RSA keys
+// privatePEM may be nil for a service that only checks tokens
+func NewRS256(privatePEM, publicPEM []byte) (*Keys, error) {
+	keys := &Keys{method: jwt.SigningMethodRS256}
+
+	if privatePEM != nil {
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA private key: %w", err)
+		}
+		keys.signKey = privateKey
+	}
+
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RSA public key: %w", err)
+	}
+	keys.verifyKey = publicKey
+
+	return keys, nil
+}
+
+// Load creates keys for the configured algorithm
+// For RS256 the keys are read from the given PEM files
+func Load(algorithm, secret, privateKeyFile, publicKeyFile string) (*Keys, error) {
+	switch algorithm {
+	case "", "HS256":
+		return NewHS256(secret), nil
+	case "RS256":
+		privatePEM, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT private key: %w", err)
+		}
+		publicPEM, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT public key: %w", err)
+		}
+		return NewRS256(privatePEM, publicPEM)
+	}
+	return nil, fmt.Errorf("unsupported JWT algorithm %q (use HS256 or RS256)", algorithm)
+}
+
+// Sign creates a signed token string from the claims
+func (k *Keys) Sign(claims jwt.Claims) (string, error) {
+	if k.signKey == nil {
+		return "", fmt.Errorf("no key configured for signing tokens")
+	}
+	return jwt.NewWithClaims(k.method, claims).SignedString(k.signKey)
+}
+
+// Verify is the key function for jwt.Parse
+// It only accepts tokens signed with exactly our algorithm - otherwise an
+// attacker could send an HS256 token "signed" with our public key
+func (k *Keys) Verify(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return k.verifyKey, nil
+}
@@ -0,0 +1,153 @@
+// internal/jwtkeys/keys_test.go
+// Tests for signing and checking JWTs with HS256 and RS256
+
+package jwtkeys
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// rsaPEM generates an RSA key pair and returns it PEM-encoded
+func rsaPEM(t *testing.T) (privatePEM, publicPEM []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+
+	privatePEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return privatePEM, publicPEM
+}
+
+// parse checks a token with keys
+func parse(token string, keys *Keys) error {
+	_, err := jwt.Parse(token, keys.Verify)
+	return err
+}
+
+var testClaims = jwt.MapClaims{"user_id": 1}
+
+func TestRS256SignAndVerify(t *testing.T) {
+	privatePEM, publicPEM := rsaPEM(t)
+	signer, err := NewRS256(privatePEM, publicPEM)
+	if err != nil {
+		t.Fatalf("NewRS256: %v", err)
+	}
+
+	token, err := signer.Sign(testClaims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// Another service only needs the public key to check it
+	verifier, err := NewRS256(nil, publicPEM)
+	if err != nil {
+		t.Fatalf("NewRS256 without private key: %v", err)
+	}
+	if err := parse(token, verifier); err != nil {
+		t.Errorf("checking with the public key: %v", err)
+	}
+
+	// ...but can't sign tokens of its own
+	if _, err := verifier.Sign(testClaims); err == nil {
+		t.Error("signing without a private key worked")
+	}
+}
+
+func TestRS256RejectsOtherKey(t *testing.T) {
+	privatePEM, _ := rsaPEM(t)
+	_, otherPublicPEM := rsaPEM(t)
+
+	signer, _ := NewRS256(privatePEM, otherPublicPEM)
+	token, err := signer.Sign(testClaims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	verifier, _ := NewRS256(nil, otherPublicPEM)
+	if err := parse(token, verifier); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("err = %v, want an invalid signature", err)
+	}
+}
+
+func TestRS256RejectsHS256SignedWithPublicKey(t *testing.T) {
+	_, publicPEM := rsaPEM(t)
+	verifier, _ := NewRS256(nil, publicPEM)
+
+	// The public key isn't secret, so anyone could "sign" an HS256 token with it
+	forged, err := NewHS256(string(publicPEM)).Sign(testClaims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := parse(forged, verifier); err == nil {
+		t.Error("an HS256 token signed with the public key was accepted")
+	}
+}
+
+func TestHS256(t *testing.T) {
+	token, err := NewHS256("secret").Sign(testClaims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := parse(token, NewHS256("secret")); err != nil {
+		t.Errorf("same secret: %v", err)
+	}
+	if err := parse(token, NewHS256("other")); err == nil {
+		t.Error("a token signed with another secret was accepted")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	privatePEM, publicPEM := rsaPEM(t)
+	dir := t.TempDir()
+	privateFile := filepath.Join(dir, "private.pem")
+	publicFile := filepath.Join(dir, "public.pem")
+	os.WriteFile(privateFile, privatePEM, 0o600)
+	os.WriteFile(publicFile, publicPEM, 0o644)
+
+	tests := []struct {
+		algorithm string
+		private   string
+		public    string
+		want      string // Expected signing algorithm; empty when Load should fail
+	}{
+		{"", "", "", "HS256"},
+		{"HS256", "", "", "HS256"},
+		{"RS256", privateFile, publicFile, "RS256"},
+		{"RS256", filepath.Join(dir, "missing.pem"), publicFile, ""},
+		{"RS256", publicFile, publicFile, ""}, // Not a private key
+		{"ES256", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		keys, err := Load(tt.algorithm, "secret", tt.private, tt.public)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("Load(%q, %q): no error", tt.algorithm, tt.private)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Load(%q): %v", tt.algorithm, err)
+			continue
+		}
+		if keys.method.Alg() != tt.want {
+			t.Errorf("Load(%q) signs with %s, want %s", tt.algorithm, keys.method.Alg(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// internal/middleware/admin.go
+// This file contains middleware that restricts routes to admins
+
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleLookup reads a user's current role from the database
+// (services.AuthService implements it)
+type RoleLookup interface {
+	CurrentRole(userID int) (string, error)
+}
+
+// AdminRequired only lets users with the admin role through
+// It must run after AuthRequired, which puts the user's role in the context
+// To make someone an admin: UPDATE users SET role = 'admin' WHERE email = '...'
+// (they need to log in again to get a token with the new role)
+// The role in a token stays what it was when the token was issued; with roles
+// set, the role is read from the database instead, so a demoted admin loses
+// access right away (pass nil to trust the token and skip the database read)
+func AdminRequired(roles RoleLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if roles != nil {
+			role, err := roles.CurrentRole(c.GetInt("user_id"))
+			if err != nil {
+				log.Printf("Failed to check role of user %d: %v", c.GetInt("user_id"), err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+				c.Abort()
+				return
+			}
+			// Handlers after us see the fresh role too
+			c.Set("user_role", role)
+		}
+
+		if c.GetString("user_role") != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
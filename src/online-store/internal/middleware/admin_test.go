@@ -0,0 +1,98 @@
+// internal/middleware/admin_test.go
+// Tests for restricting routes to admins
+
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"online-store/internal/jwtkeys"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeRoles is a RoleLookup backed by a map of user ID -> current role
+type fakeRoles struct {
+	roles map[int]string
+	err   error // Returned by every lookup when set, like a broken database
+	calls int
+}
+
+func (r *fakeRoles) CurrentRole(userID int) (string, error) {
+	r.calls++
+	if r.err != nil {
+		return "", r.err
+	}
+	return r.roles[userID], nil
+}
+
+// adminStatus sends a request with a token for role through AuthRequired and
+// AdminRequired(roles), and returns the status and the role the handler saw
+func adminStatus(t *testing.T, roles RoleLookup, tokenRole string) (int, string) {
+	t.Helper()
+
+	keys := jwtkeys.NewHS256("secret")
+	seen := ""
+	router := gin.New()
+	router.GET("/admin", AuthRequired(keys, testIssuer, testAudience, 0, nil), AdminRequired(roles), func(c *gin.Context) {
+		seen = c.GetString("user_role")
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, keys, jwt.MapClaims{"role": tokenRole}))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code, seen
+}
+
+func TestAdminRequiredTrustsTokenByDefault(t *testing.T) {
+	if got, _ := adminStatus(t, nil, "admin"); got != http.StatusOK {
+		t.Errorf("admin token: status = %d, want 200", got)
+	}
+	if got, _ := adminStatus(t, nil, "customer"); got != http.StatusForbidden {
+		t.Errorf("customer token: status = %d, want 403", got)
+	}
+}
+
+func TestAdminRequiredWithRoleFromDatabase(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenRole string
+		current   map[int]string
+		want      int
+	}{
+		// User 1's token still says admin, but they were demoted since
+		{"demoted admin", "admin", map[int]string{1: "customer"}, http.StatusForbidden},
+		{"still admin", "admin", map[int]string{1: "admin"}, http.StatusOK},
+		{"promoted customer", "customer", map[int]string{1: "admin"}, http.StatusOK},
+		{"deleted user", "admin", map[int]string{}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := &fakeRoles{roles: tt.current}
+			got, seen := adminStatus(t, roles, tt.tokenRole)
+			if got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+			if roles.calls != 1 {
+				t.Errorf("role looked up %d times, want 1", roles.calls)
+			}
+			if got == http.StatusOK && seen != "admin" {
+				t.Errorf("handler saw role %q, want the fresh admin role", seen)
+			}
+		})
+	}
+}
+
+func TestAdminRequiredRoleLookupFails(t *testing.T) {
+	roles := &fakeRoles{err: errors.New("connection refused")}
+	if got, _ := adminStatus(t, roles, "admin"); got != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", got)
+	}
+}
@@ -6,14 +6,29 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
+
+	"online-store/internal/jwtkeys"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// RevocationList tells us whether a user's token was revoked before it expired
+// (services.TokenDenylist implements it)
+type RevocationList interface {
+	IsRevoked(userID int, issuedAt time.Time) bool
+}
+
 // AuthRequired is middleware that checks for valid JWT tokens
 // Middleware is code that runs before your actual handler functions
-func AuthRequired(jwtSecret string) gin.HandlerFunc {
+// Tokens must be issued by jwtIssuer for jwtAudience, so tokens from other
+// services that happen to share the same secret are rejected
+// Tokens on the revocation list are rejected too (pass nil to skip that check)
+// keys decides which signing algorithm and key a token must use (HS256 or RS256)
+// leeway is how far a client's clock may be off: a token that expired less than
+// leeway ago (or is "issued" slightly in the future) is still accepted
+func AuthRequired(keys *jwtkeys.Keys, jwtIssuer, jwtAudience string, leeway time.Duration, revoked RevocationList) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		// Get the Authorization header
 		// Format should be: "Bearer <token>"
@@ -35,14 +50,13 @@ func AuthRequired(jwtSecret string) gin.HandlerFunc {
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
 		// Parse and validate the JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Make sure the signing method is what we expect
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			// Return our secret key for validation
-			return []byte(jwtSecret), nil
-		})
+		// The parser options also check that the "iss" and "aud" claims match what we expect
+		// keys.Verify makes sure the signing method is what we expect and returns the key to check with
+		token, err := jwt.Parse(tokenString, keys.Verify,
+			jwt.WithIssuer(jwtIssuer),
+			jwt.WithAudience(jwtAudience),
+			jwt.WithLeeway(leeway),
+		)
 
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -67,10 +81,28 @@ func AuthRequired(jwtSecret string) gin.HandlerFunc {
 				return
 			}
 
+			// Tokens issued before roles existed have no role claim - treat them as customers
+			role, ok := claims["role"].(string)
+			if !ok {
+				role = "customer"
+			}
+
+			// Tokens without "iat" were issued before we added it - treat them as very old
+			var issuedAt time.Time
+			if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+				issuedAt = iat.Time
+			}
+			if revoked != nil && revoked.IsRevoked(int(userID), issuedAt) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+
 			// Store user information in the context so handlers can access it
 			// This is how we pass data from middleware to handlers
 			c.Set("user_id", int(userID))
 			c.Set("user_email", email)
+			c.Set("user_role", role)
 
 			// Continue to the next handler
 			c.Next()
@@ -80,4 +112,4 @@ func AuthRequired(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,186 @@
+// internal/middleware/auth_test.go
+// Tests for the JWT authentication middleware
+
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"online-store/internal/jwtkeys"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "online-store"
+	testAudience = "online-store-api"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// signToken signs claims for user 1, on top of a valid issuer, audience and expiry
+// Set a claim to nil to leave it out
+func signToken(t *testing.T, keys *jwtkeys.Keys, overrides jwt.MapClaims) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{
+		"user_id": 1,
+		"email":   "user@example.com",
+		"role":    "customer",
+		"iss":     testIssuer,
+		"aud":     testAudience,
+		"iat":     time.Now().Unix(),
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+
+	token, err := keys.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+// authStatus sends a request with token through AuthRequired and returns the status
+func authStatus(t *testing.T, keys *jwtkeys.Keys, leeway time.Duration, revoked RevocationList, token string) int {
+	t.Helper()
+
+	router := gin.New()
+	router.GET("/", AuthRequired(keys, testIssuer, testAudience, leeway, revoked), func(c *gin.Context) {
+		c.String(http.StatusOK, "%d", c.GetInt("user_id"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAuthRequiredChecksIssuerAndAudience(t *testing.T) {
+	keys := jwtkeys.NewHS256("secret")
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   int
+	}{
+		{"valid", nil, http.StatusOK},
+		{"other issuer", jwt.MapClaims{"iss": "other-service"}, http.StatusUnauthorized},
+		{"no issuer", jwt.MapClaims{"iss": nil}, http.StatusUnauthorized},
+		{"other audience", jwt.MapClaims{"aud": "other-api"}, http.StatusUnauthorized},
+		{"no audience", jwt.MapClaims{"aud": nil}, http.StatusUnauthorized},
+		{"audience list", jwt.MapClaims{"aud": []string{"other-api", testAudience}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authStatus(t, keys, 0, nil, signToken(t, keys, tt.claims)); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthRequiredRejectsOtherSecret(t *testing.T) {
+	token := signToken(t, jwtkeys.NewHS256("someone else's secret"), nil)
+	if got := authStatus(t, jwtkeys.NewHS256("secret"), 0, nil, token); got != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthRequiredNeedsBearerToken(t *testing.T) {
+	if got := authStatus(t, jwtkeys.NewHS256("secret"), 0, nil, ""); got != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+// revokedUsers is a RevocationList that rejects every token of the listed users
+type revokedUsers map[int]bool
+
+func (r revokedUsers) IsRevoked(userID int, issuedAt time.Time) bool {
+	return r[userID]
+}
+
+func TestAuthRequiredRejectsRevokedTokens(t *testing.T) {
+	keys := jwtkeys.NewHS256("secret")
+	revoked := revokedUsers{1: true}
+
+	if got := authStatus(t, keys, 0, revoked, signToken(t, keys, nil)); got != http.StatusUnauthorized {
+		t.Errorf("revoked user: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := authStatus(t, keys, 0, revoked, signToken(t, keys, jwt.MapClaims{"user_id": 2})); got != http.StatusOK {
+		t.Errorf("other user: status = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestAuthRequiredWithRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	publicDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	signer, err := jwtkeys.NewRS256(privatePEM, publicPEM)
+	if err != nil {
+		t.Fatalf("NewRS256: %v", err)
+	}
+	verifier, err := jwtkeys.NewRS256(nil, publicPEM)
+	if err != nil {
+		t.Fatalf("NewRS256: %v", err)
+	}
+
+	if got := authStatus(t, verifier, 0, nil, signToken(t, signer, nil)); got != http.StatusOK {
+		t.Errorf("RS256 token: status = %d, want %d", got, http.StatusOK)
+	}
+	if got := authStatus(t, verifier, 0, nil, signToken(t, jwtkeys.NewHS256("secret"), nil)); got != http.StatusUnauthorized {
+		t.Errorf("HS256 token: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthRequiredLeeway(t *testing.T) {
+	keys := jwtkeys.NewHS256("secret")
+	leeway := 30 * time.Second
+
+	tests := []struct {
+		name   string
+		leeway time.Duration
+		exp    time.Duration // Relative to now
+		want   int
+	}{
+		{"expired within the leeway", leeway, -10 * time.Second, http.StatusOK},
+		{"expired beyond the leeway", leeway, -time.Minute, http.StatusUnauthorized},
+		{"expired without leeway", 0, -10 * time.Second, http.StatusUnauthorized},
+		{"not expired", leeway, time.Minute, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signToken(t, keys, jwt.MapClaims{
+				"iat": time.Now().Add(-time.Hour).Unix(),
+				"exp": time.Now().Add(tt.exp).Unix(),
+			})
+			if got := authStatus(t, keys, tt.leeway, nil, token); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// internal/middleware/concurrency.go
+// This file contains middleware that limits how many requests run at once
+
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// concurrencyRetryAfter is the Retry-After (seconds) sent when we're full
+// Requests like order creation finish quickly, so a second is plenty
+const concurrencyRetryAfter = "1"
+
+// ConcurrencyLimit lets at most max requests through the routes it guards at the same time
+// Requests beyond that don't wait - they get 503 Service Unavailable with a
+// Retry-After header, so a flash sale can't pile up work on the database
+// Use one ConcurrencyLimit for several routes to give them a shared limit
+// A max of 0 or less turns the limit off
+func ConcurrencyLimit(max int) gin.HandlerFunc {
+	if max <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	// A buffered channel works as a semaphore: each running request holds one slot
+	slots := make(chan struct{}, max)
+
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			c.Header("Retry-After", concurrencyRetryAfter)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Too many requests at once, please try again shortly"})
+			return
+		}
+		// Deferred, so the slot is freed however the handler ends (even by panicking)
+		defer func() { <-slots }()
+
+		c.Next()
+	}
+}
+
+// RouteConcurrencyLimits gives individual routes their own ConcurrencyLimit
+// limits maps a route pattern as registered (like "/api/admin/orders/export"
+// or "/api/products/:id") to how many requests may run on it at once
+// Use it with router.Use; routes not in the map aren't limited
+func RouteConcurrencyLimits(limits map[string]int) gin.HandlerFunc {
+	limiters := make(map[string]gin.HandlerFunc, len(limits))
+	for route, max := range limits {
+		limiters[route] = ConcurrencyLimit(max)
+	}
+
+	return func(c *gin.Context) {
+		// FullPath is the matched route pattern, so /api/products/1 and /api/products/2 share a limit
+		if limiter, ok := limiters[c.FullPath()]; ok {
+			limiter(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ClientConcurrencyLimit lets each client IP have at most max requests running at once
+// Unlike ConcurrencyLimit, which protects a route from everyone together, this
+// stops a single client from using up the server by opening many connections
+// Requests beyond the cap get 429 Too Many Requests - it's that client's fault,
+// not ours, and other clients are unaffected
+// A max of 0 or less turns the limit off
+func ClientConcurrencyLimit(max int) gin.HandlerFunc {
+	if max <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	var mu sync.Mutex
+	inFlight := make(map[string]int) // Running requests per client IP
+
+	return func(c *gin.Context) {
+		key := c.ClientIP()
+
+		mu.Lock()
+		if inFlight[key] >= max {
+			mu.Unlock()
+			c.Header("Retry-After", concurrencyRetryAfter)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests at once from your address, please try again shortly"})
+			return
+		}
+		inFlight[key]++
+		mu.Unlock()
+
+		// Deferred, so the count goes down however the handler ends (even by panicking)
+		defer func() {
+			mu.Lock()
+			// Forget idle clients, so the map only holds clients with running requests
+			if inFlight[key]--; inFlight[key] == 0 {
+				delete(inFlight, key)
+			}
+			mu.Unlock()
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,204 @@
+// internal/middleware/concurrency_test.go
+// Tests for limiting how many requests run at once
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blockingHandler holds every request until release is closed
+type blockingHandler struct {
+	entered chan struct{} // Receives once per request that got in
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{entered: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (h *blockingHandler) handle(c *gin.Context) {
+	h.entered <- struct{}{}
+	<-h.release
+	c.Status(http.StatusCreated)
+}
+
+// get sends a GET request for path from the client IP
+func get(router http.Handler, path, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = ip + ":12345"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// fill starts n requests that block inside the handler and waits until they're in
+// Call the returned function to let them finish and wait for them
+func fill(t *testing.T, router http.Handler, h *blockingHandler, path, ip string, n int) func() {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get(router, path, ip)
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-h.entered
+	}
+	return func() {
+		close(h.release)
+		wg.Wait()
+	}
+}
+
+func TestConcurrencyLimitRejectsBeyondMax(t *testing.T) {
+	h := newBlockingHandler()
+	router := gin.New()
+	router.GET("/orders", ConcurrencyLimit(2), h.handle)
+
+	finish := fill(t, router, h, "/orders", "10.0.0.1", 2)
+
+	w := get(router, "/orders", "10.0.0.1")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("third request: status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got != concurrencyRetryAfter {
+		t.Errorf("Retry-After = %q, want %q", got, concurrencyRetryAfter)
+	}
+
+	// Once they're done, the slots are free again
+	finish()
+	h.release = make(chan struct{})
+	close(h.release)
+	if w := get(router, "/orders", "10.0.0.1"); w.Code != http.StatusCreated {
+		t.Errorf("after the others finished: status = %d, want %d", w.Code, http.StatusCreated)
+	}
+}
+
+func TestConcurrencyLimitReleasesOnErrors(t *testing.T) {
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, err interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	limit := ConcurrencyLimit(1)
+	router.GET("/fails", limit, func(c *gin.Context) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "out of stock"})
+	})
+	router.GET("/panics", limit, func(c *gin.Context) {
+		panic("database exploded")
+	})
+
+	// With one slot, every request after the first only gets in if the slot was freed
+	for i, path := range []string{"/fails", "/fails", "/panics", "/panics", "/fails"} {
+		want := http.StatusBadRequest
+		if path == "/panics" {
+			want = http.StatusInternalServerError
+		}
+		if w := get(router, path, "10.0.0.1"); w.Code != want {
+			t.Errorf("request %d to %s: status = %d, want %d", i+1, path, w.Code, want)
+		}
+	}
+}
+
+func TestConcurrencyLimitOff(t *testing.T) {
+	h := newBlockingHandler()
+	router := gin.New()
+	router.GET("/orders", ConcurrencyLimit(0), h.handle)
+
+	// Many requests at once all get in
+	finish := fill(t, router, h, "/orders", "10.0.0.1", 10)
+	finish()
+}
+
+func TestRouteConcurrencyLimits(t *testing.T) {
+	exports, products := newBlockingHandler(), newBlockingHandler()
+	router := gin.New()
+	router.Use(RouteConcurrencyLimits(map[string]int{"/export": 2, "/products/:id": 1}))
+	router.GET("/export", exports.handle)
+	router.GET("/products/:id", products.handle)
+	router.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	finishExports := fill(t, router, exports, "/export", "10.0.0.1", 2)
+	defer finishExports()
+
+	if w := get(router, "/export", "10.0.0.2"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("export beyond the cap: status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	// Routes without a limit don't care
+	if w := get(router, "/health", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("unlimited route while exports are full: status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Other limited routes have their own slots; one product request fits
+	finishProducts := fill(t, router, products, "/products/1", "10.0.0.2", 1)
+	// and the limit is per route pattern, not per URL
+	if w := get(router, "/products/2", "10.0.0.3"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("second product request: status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	finishProducts()
+}
+
+func TestClientConcurrencyLimit(t *testing.T) {
+	orders, products := newBlockingHandler(), newBlockingHandler()
+	router := gin.New()
+	router.Use(ClientConcurrencyLimit(2))
+	router.GET("/orders", orders.handle)
+	router.GET("/products", products.handle)
+
+	finishOrders := fill(t, router, orders, "/orders", "10.0.0.1", 2)
+
+	// The cap is per client, over all routes
+	w := get(router, "/products", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("third request from one client: status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != concurrencyRetryAfter {
+		t.Errorf("Retry-After = %q, want %q", got, concurrencyRetryAfter)
+	}
+
+	// Another client is unaffected
+	finishProducts := fill(t, router, products, "/products", "10.0.0.2", 2)
+	finishProducts()
+
+	// Once its requests are done, the first client can go again
+	finishOrders()
+	for i := 0; i < 3; i++ {
+		if w := get(router, "/orders", "10.0.0.1"); w.Code != http.StatusCreated {
+			t.Errorf("request %d after the others finished: status = %d, want %d", i+1, w.Code, http.StatusCreated)
+		}
+	}
+}
+
+func TestClientConcurrencyLimitReleasesOnPanic(t *testing.T) {
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, err interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.Use(ClientConcurrencyLimit(1))
+	router.GET("/panics", func(c *gin.Context) { panic("database exploded") })
+
+	// With one slot, the second request only gets in if the first gave it back
+	for i := 0; i < 2; i++ {
+		if w := get(router, "/panics", "10.0.0.1"); w.Code != http.StatusInternalServerError {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, http.StatusInternalServerError)
+		}
+	}
+}
+
+func TestClientConcurrencyLimitOff(t *testing.T) {
+	h := newBlockingHandler()
+	router := gin.New()
+	router.Use(ClientConcurrencyLimit(0))
+	router.GET("/orders", h.handle)
+
+	finish := fill(t, router, h, "/orders", "10.0.0.1", 10)
+	finish()
+}
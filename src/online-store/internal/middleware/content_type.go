@@ -0,0 +1,48 @@
+// internal/middleware/content_type.go
+// This file contains middleware that checks the Content-Type of request bodies
+
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireContentType rejects POST, PUT and PATCH requests whose body isn't one
+// of the allowed media types (e.g. "application/json") with 415 Unsupported Media Type
+// Without this, a form POST reaches ShouldBindJSON and fails with a confusing parse error
+// Requests without a body (like POST /orders/:id/reorder) are let through
+func RequireContentType(allowed []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength == 0 {
+			c.Next()
+			return
+		}
+
+		// ParseMediaType drops parameters, so "application/json; charset=utf-8" matches too
+		mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if err == nil {
+			for _, allowedType := range allowed {
+				if strings.EqualFold(mediaType, allowedType) {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "Content-Type must be one of: " + strings.Join(allowed, ", "),
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,48 @@
+// internal/middleware/content_type_test.go
+// Tests for the Content-Type check on request bodies
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireContentType(t *testing.T) {
+	router := gin.New()
+	router.Use(RequireContentType([]string{"application/json"}))
+	router.Any("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"json", http.MethodPost, "application/json", `{}`, http.StatusNoContent},
+		{"json with charset", http.MethodPut, "application/json; charset=utf-8", `{}`, http.StatusNoContent},
+		{"case doesn't matter", http.MethodPatch, "Application/JSON", `{}`, http.StatusNoContent},
+		{"form", http.MethodPost, "application/x-www-form-urlencoded", "a=1", http.StatusUnsupportedMediaType},
+		{"no content type", http.MethodPost, "", `{}`, http.StatusUnsupportedMediaType},
+		{"no body", http.MethodPost, "", "", http.StatusNoContent},
+		{"GET isn't checked", http.MethodGet, "text/plain", "x", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// internal/middleware/cors.go
+// This file contains the CORS middleware
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS allows web browsers on other sites to call our API
+// Browsers ask first with an OPTIONS "preflight" request; maxAgeSec tells them
+// how long they may remember the answer instead of asking again before every
+// request (0 leaves the header out, so browsers use their own short default)
+// requestIDHeader is the header RequestID uses, so browser code may send and read it
+func CORS(maxAgeSec int, requestIDHeader string) gin.HandlerFunc {
+	if requestIDHeader == "" {
+		requestIDHeader = DefaultRequestIDHeader
+	}
+
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, "+requestIDHeader)
+		c.Header("Access-Control-Expose-Headers", requestIDHeader+", X-Results-Truncated") // Let browser code read our own headers
+
+		if c.Request.Method == http.MethodOptions {
+			if maxAgeSec > 0 {
+				c.Header("Access-Control-Max-Age", strconv.Itoa(maxAgeSec))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
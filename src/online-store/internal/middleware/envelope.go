@@ -0,0 +1,17 @@
+// internal/middleware/envelope.go
+// This file switches list responses to the {"data": ..., "meta": ...} envelope
+
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// ListEnvelope makes list endpoints wrap their results in an envelope
+// instead of returning a bare JSON array (see handlers.respondList)
+// It's switched on with the list_envelope feature flag, so existing clients
+// keep getting arrays until they're ready for the new shape
+func ListEnvelope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("list_envelope", true)
+		c.Next()
+	}
+}
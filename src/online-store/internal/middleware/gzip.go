@@ -0,0 +1,155 @@
+// internal/middleware/gzip.go
+// This file contains middleware that compresses responses with gzip
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// alreadyCompressedTypes are content types that gzip can't shrink any further
+var alreadyCompressedTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+}
+
+// Gzip compresses responses for clients that send "Accept-Encoding: gzip"
+// Responses smaller than minSize bytes are sent as-is, because compressing
+// tiny bodies costs more CPU than it saves in bandwidth
+func Gzip(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The response depends on Accept-Encoding, so caches must key on it
+		c.Header("Vary", "Accept-Encoding")
+
+		if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") || c.Request.Method == "HEAD" {
+			c.Next()
+			return
+		}
+
+		// Swap in our writer, which holds back the first minSize bytes
+		// until it knows whether the response is big enough to compress
+		writer := &gzipResponseWriter{ResponseWriter: c.Writer, minSize: minSize}
+		c.Writer = writer
+		defer writer.finish()
+
+		c.Next()
+	}
+}
+
+// gzipResponseWriter buffers the start of a response and then either
+// compresses everything or passes it through unchanged
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minSize  int
+	buffer   bytes.Buffer // Body written before we decided what to do
+	decided  bool         // Have we picked compressed or plain yet?
+	gzWriter *gzip.Writer // Set once we decide to compress
+}
+
+// Write buffers data until we know whether to compress it
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		return w.writeOut(data)
+	}
+
+	w.buffer.Write(data)
+	if w.buffer.Len() >= w.minSize {
+		w.decide(true)
+		if err := w.flushBuffer(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// WriteString is used by some of gin's renderers, so route it through Write
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what we have so far; used by streaming responses like c.Stream
+// Streams are usually big, so an undecided stream gets compressed
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+		w.flushBuffer()
+	}
+	if w.gzWriter != nil {
+		w.gzWriter.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide picks between compressed and plain output and sets the headers to match
+func (w *gzipResponseWriter) decide(large bool) {
+	w.decided = true
+
+	if !large || !w.compressible() {
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length") // The compressed length is different
+	w.gzWriter = gzip.NewWriter(w.ResponseWriter)
+}
+
+// compressible reports whether this response is worth gzipping
+func (w *gzipResponseWriter) compressible() bool {
+	header := w.Header()
+
+	// Someone upstream already encoded the body
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+	for _, compressedType := range alreadyCompressedTypes {
+		if strings.HasPrefix(contentType, compressedType) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeOut sends data to the client, through gzip if we're compressing
+func (w *gzipResponseWriter) writeOut(data []byte) (int, error) {
+	if w.gzWriter != nil {
+		return w.gzWriter.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// flushBuffer sends out everything held back so far
+func (w *gzipResponseWriter) flushBuffer() error {
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	_, err := w.writeOut(w.buffer.Bytes())
+	w.buffer.Reset()
+	return err
+}
+
+// finish runs after the handler: small responses are sent plain,
+// and the gzip stream is closed so the client gets the final bytes
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	w.flushBuffer()
+
+	if w.gzWriter != nil {
+		w.gzWriter.Close()
+	}
+}
@@ -0,0 +1,84 @@
+// internal/middleware/gzip_test.go
+// Tests for the gzip response compression middleware
+
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipResponse serves body with contentType through Gzip(minSize)
+func gzipResponse(t *testing.T, minSize int, acceptEncoding, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := gin.New()
+	router.Use(Gzip(minSize))
+	router.GET("/", func(c *gin.Context) {
+		c.Data(http.StatusOK, contentType, []byte(body))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGzipCompressesLargeResponses(t *testing.T) {
+	body := strings.Repeat(`{"name":"Mug"},`, 200)
+	w := gzipResponse(t, 1024, "gzip, deflate", "application/json", body)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	unzipped, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read gzip body: %v", err)
+	}
+	if string(unzipped) != body {
+		t.Errorf("unzipped body differs from what the handler wrote")
+	}
+}
+
+func TestGzipLeavesResponsesPlain(t *testing.T) {
+	large := strings.Repeat("a", 2048)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+	}{
+		{"small", "gzip", "application/json", `{"ok":true}`},
+		{"client can't unzip", "", "application/json", large},
+		{"already compressed", "gzip", "image/png", large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := gzipResponse(t, 1024, tt.acceptEncoding, tt.contentType, tt.body)
+			if got := w.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("body was changed")
+			}
+		})
+	}
+}
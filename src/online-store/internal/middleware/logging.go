@@ -0,0 +1,37 @@
+// internal/middleware/logging.go
+// This file logs requests, leaving out most successful ones when traffic is high
+// The log line looks exactly like Gin's own request log
+
+package middleware
+
+import (
+	"math/rand"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sampler decides whether one successful request is logged
+type Sampler func() bool
+
+// PercentSampler logs about percent out of every 100 successful requests, picked at random
+// 100 (or more) logs all of them, 0 (or less) none
+func PercentSampler(percent int) Sampler {
+	return func() bool {
+		return rand.Intn(100) < percent
+	}
+}
+
+// RequestLogger logs requests like gin.Logger, but only the successful ones
+// sample picks; requests that failed (status 400 and up) are always logged,
+// since those are the ones worth reading when something goes wrong
+func RequestLogger(sample Sampler) gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Skip: func(c *gin.Context) bool {
+			if c.Writer.Status() >= http.StatusBadRequest {
+				return false
+			}
+			return !sample()
+		},
+	})
+}
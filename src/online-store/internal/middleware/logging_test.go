@@ -0,0 +1,105 @@
+// internal/middleware/logging_test.go
+// Tests for sampling the request log
+
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loggedRouter returns a router logging through RequestLogger(sample) into the returned buffer
+// /ok answers 200, /missing 404 and /broken 500
+func loggedRouter(t *testing.T, sample Sampler) (*gin.Engine, *bytes.Buffer) {
+	t.Helper()
+
+	// The logger writes to gin.DefaultWriter, as it was when the logger was made
+	var buf bytes.Buffer
+	defaultWriter := gin.DefaultWriter
+	gin.DefaultWriter = &buf
+	t.Cleanup(func() { gin.DefaultWriter = defaultWriter })
+
+	router := gin.New()
+	router.Use(RequestLogger(sample))
+	router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/broken", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+	return router, &buf
+}
+
+// everyNth is a sampler picking every nth request, and counting how often it was asked
+func everyNth(n int, calls *int) Sampler {
+	return func() bool {
+		*calls++
+		return *calls%n == 0
+	}
+}
+
+func TestRequestLoggerSamplesSuccesses(t *testing.T) {
+	calls := 0
+	router, buf := loggedRouter(t, everyNth(10, &calls))
+
+	for i := 0; i < 100; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	}
+
+	if got := strings.Count(buf.String(), "/ok"); got != 10 {
+		t.Errorf("%d of 100 successful requests logged, want 10", got)
+	}
+	if calls != 100 {
+		t.Errorf("sampler asked %d times, want 100", calls)
+	}
+}
+
+func TestRequestLoggerAlwaysLogsFailures(t *testing.T) {
+	calls := 0
+	router, buf := loggedRouter(t, func() bool { calls++; return false })
+
+	paths := []string{"/broken", "/missing", "/broken"}
+	for _, path := range paths {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := strings.Count(buf.String(), "\n"); got != len(paths) {
+		t.Errorf("%d failed requests logged, want %d:\n%s", got, len(paths), buf)
+	}
+	for _, want := range []string{"500", "404"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log doesn't show status %s:\n%s", want, buf)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("sampler asked %d times for failed requests, want 0", calls)
+	}
+}
+
+func TestPercentSampler(t *testing.T) {
+	tests := []struct {
+		percent  int
+		min, max int // Out of 10000
+	}{
+		{0, 0, 0},
+		{-5, 0, 0},
+		{100, 10000, 10000},
+		{150, 10000, 10000},
+		// Random, but this far off happens less than once in a billion runs
+		{10, 800, 1200},
+	}
+
+	for _, tt := range tests {
+		sample := PercentSampler(tt.percent)
+		picked := 0
+		for i := 0; i < 10000; i++ {
+			if sample() {
+				picked++
+			}
+		}
+		if picked < tt.min || picked > tt.max {
+			t.Errorf("PercentSampler(%d) picked %d of 10000, want %d to %d", tt.percent, picked, tt.min, tt.max)
+		}
+	}
+}
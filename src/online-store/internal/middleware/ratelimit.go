@@ -0,0 +1,71 @@
+// internal/middleware/ratelimit.go
+// This file contains a simple per-client rate limiter
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateWindow counts one client's requests in the current time window
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimit allows each client IP at most limit requests per window
+// Extra requests get 429 Too Many Requests with a Retry-After header
+// Counters live in memory, so each server instance counts separately
+// A limit of 0 or less turns rate limiting off
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	var mu sync.Mutex
+	windows := make(map[string]*rateWindow)
+	lastCleanup := time.Now()
+
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		key := c.ClientIP()
+
+		mu.Lock()
+		// Now and then, forget clients whose window is over, so the map doesn't grow forever
+		if now.Sub(lastCleanup) > window {
+			for ip, w := range windows {
+				if now.Sub(w.start) >= window {
+					delete(windows, ip)
+				}
+			}
+			lastCleanup = now
+		}
+
+		w, ok := windows[key]
+		if !ok || now.Sub(w.start) >= window {
+			w = &rateWindow{start: now}
+			windows[key] = w
+		}
+		w.count++
+		allowed := w.count <= limit
+		retryAfter := w.start.Add(window).Sub(now)
+		mu.Unlock()
+
+		if !allowed {
+			// Round up, so clients never retry a moment too early
+			seconds := int((retryAfter + time.Second - 1) / time.Second)
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
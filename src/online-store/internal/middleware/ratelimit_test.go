@@ -0,0 +1,77 @@
+// internal/middleware/ratelimit_test.go
+// Tests for the per-client rate limiter
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitedRouter serves "/" behind RateLimit
+func limitedRouter(limit int, window time.Duration) *gin.Engine {
+	router := gin.New()
+	router.GET("/", RateLimit(limit, window), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+// getFrom sends a request from the given client IP
+func getFrom(router *gin.Engine, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = ip + ":12345"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	router := limitedRouter(2, time.Minute)
+
+	for i := 1; i <= 2; i++ {
+		if w := getFrom(router, "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+
+	w := getFrom(router, "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request 3: status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+
+	// Other clients have their own budget
+	if w := getFrom(router, "10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("other client: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimitWindowResets(t *testing.T) {
+	router := limitedRouter(1, 20*time.Millisecond)
+
+	getFrom(router, "10.0.0.1")
+	if w := getFrom(router, "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if w := getFrom(router, "10.0.0.1"); w.Code != http.StatusOK {
+		t.Errorf("after the window: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimitOff(t *testing.T) {
+	router := limitedRouter(0, time.Minute)
+	for i := 0; i < 5; i++ {
+		if w := getFrom(router, "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+	}
+}
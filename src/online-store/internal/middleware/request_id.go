@@ -0,0 +1,54 @@
+// internal/middleware/request_id.go
+// This file gives every request an ID, so log lines about it can be matched up
+
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"online-store/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRequestIDHeader is where clients (or a proxy in front of us) may send
+// an ID, and where we send the ID back, unless another header is configured
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// validRequestID limits IDs we accept from clients, so they can't inject
+// strange characters into our logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID makes sure every request has an ID
+// An ID sent by the client in the header is kept, otherwise a random one is created
+// header lets the ID travel in the header a tracing stack already uses
+// (e.g. X-Correlation-ID); empty means DefaultRequestIDHeader
+// The ID is stored in the Gin context ("request_id"), in the request's
+// context.Context (see the requestid package) and in the same response header
+func RequestID(header string) gin.HandlerFunc {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	return func(c *gin.Context) {
+		id := c.GetHeader(header)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Header(header, id)
+
+		c.Next()
+	}
+}
+
+// newRequestID creates a random 32 character hex ID
+func newRequestID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
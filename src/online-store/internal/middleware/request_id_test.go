@@ -0,0 +1,77 @@
+// internal/middleware/request_id_test.go
+// Tests for giving every request an ID
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"online-store/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDs sends a request through RequestID and returns the ID the handler
+// saw in its context.Context, and the response
+func requestIDs(header, sentHeader, sentID string) (string, *httptest.ResponseRecorder) {
+	var seen string
+	router := gin.New()
+	router.GET("/", RequestID(header), func(c *gin.Context) {
+		seen = requestid.FromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if sentID != "" {
+		req.Header.Set(sentHeader, sentID)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return seen, w
+}
+
+func TestRequestIDKeepsClientID(t *testing.T) {
+	seen, w := requestIDs("", DefaultRequestIDHeader, "abc-123")
+	if seen != "abc-123" {
+		t.Errorf("context ID = %q, want abc-123", seen)
+	}
+	if got := w.Header().Get(DefaultRequestIDHeader); got != "abc-123" {
+		t.Errorf("response header = %q, want abc-123", got)
+	}
+}
+
+func TestRequestIDCreatesMissingOrInvalidID(t *testing.T) {
+	for _, sent := range []string{"", "bad id\nwith a newline"} {
+		seen, w := requestIDs("", DefaultRequestIDHeader, sent)
+		if len(seen) != 32 || seen == sent {
+			t.Errorf("sent %q: context ID = %q, want a new 32 character ID", sent, seen)
+		}
+		if got := w.Header().Get(DefaultRequestIDHeader); got != seen {
+			t.Errorf("sent %q: response header = %q, want %q", sent, got, seen)
+		}
+	}
+}
+
+func TestRequestIDCustomHeader(t *testing.T) {
+	seen, w := requestIDs("X-Correlation-ID", "X-Correlation-ID", "trace-42")
+	if seen != "trace-42" {
+		t.Errorf("context ID = %q, want trace-42", seen)
+	}
+	if got := w.Header().Get("X-Correlation-ID"); got != "trace-42" {
+		t.Errorf("X-Correlation-ID = %q, want trace-42", got)
+	}
+	if got := w.Header().Get(DefaultRequestIDHeader); got != "" {
+		t.Errorf("%s = %q, want it unset when another header is configured", DefaultRequestIDHeader, got)
+	}
+
+	// An ID in the default header is ignored then
+	seen, w = requestIDs("X-Correlation-ID", DefaultRequestIDHeader, "abc-123")
+	if seen == "abc-123" || len(seen) != 32 {
+		t.Errorf("context ID = %q, want a new 32 character ID", seen)
+	}
+	if got := w.Header().Get("X-Correlation-ID"); got != seen {
+		t.Errorf("X-Correlation-ID = %q, want %q", got, seen)
+	}
+}
@@ -0,0 +1,29 @@
+// internal/models/audit.go
+// AuditEntry records who changed what, for security reviews
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is one row of the audit log
+type AuditEntry struct {
+	ID        int             `json:"id" db:"id"`
+	UserID    *int            `json:"user_id" db:"user_id"` // nil when the system made the change (e.g. an MQTT handler)
+	Action    string          `json:"action" db:"action"`   // What happened: "create", "update", ...
+	Entity    string          `json:"entity" db:"entity"`   // What kind of thing changed: "product", "order"
+	EntityID  int             `json:"entity_id" db:"entity_id"`
+	Detail    json.RawMessage `json:"detail" db:"detail"` // Extra information, stored as JSON
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// AuditFilter narrows down which audit entries to list
+// Zero values mean "don't filter on this"
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	UserID   int
+	Limit    int
+}
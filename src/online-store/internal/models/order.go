@@ -3,39 +3,262 @@
 
 package models
 
-import "time"
+import (
+	"time"
+
+	"online-store/internal/money"
+)
+
+// OrderStatus is where an order is in its life: pending -> paid -> shipped -> delivered
+// A risk check can put a pending or paid order on hold until an admin releases it
+// Use the constants below rather than string literals, so a typo doesn't compile
+type OrderStatus string
+
+// Order statuses (the same values as the orders.status ENUM column)
+const (
+	OrderStatusPending   OrderStatus = "pending"   // Placed, waiting for payment
+	OrderStatusPaid      OrderStatus = "paid"      // Payment confirmed
+	OrderStatusShipped   OrderStatus = "shipped"   // Handed to the shipping provider
+	OrderStatusDelivered OrderStatus = "delivered" // Arrived at the customer
+	OrderStatusOnHold    OrderStatus = "on_hold"   // Paused after a risk flag; nothing happens until it is released
+)
+
+// OrderStatuses lists every order status, in the order of an order's life
+var OrderStatuses = []OrderStatus{
+	OrderStatusPending, OrderStatusPaid, OrderStatusShipped, OrderStatusDelivered, OrderStatusOnHold,
+}
+
+// Valid reports whether s is one of the order statuses above
+func (s OrderStatus) Valid() bool {
+	for _, status := range OrderStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
 
 // Order represents a customer's order
 type Order struct {
-	ID         int       `json:"id" db:"id"`
-	UserID     int       `json:"user_id" db:"user_id"`
-	ProductID  int       `json:"product_id" db:"product_id"`
-	Quantity   int       `json:"quantity" db:"quantity"`
-	TotalCents int       `json:"total_cents" db:"total_cents"`
-	Status     string    `json:"status" db:"status"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	ID         int         `json:"id" db:"id"`
+	UserID     int         `json:"user_id" db:"user_id"`
+	ProductID  int         `json:"product_id" db:"product_id"`
+	Quantity   int         `json:"quantity" db:"quantity"`
+	TotalCents int         `json:"total_cents" db:"total_cents"`
+	Status     OrderStatus `json:"status" db:"status"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+
+	TrackingToken     string `json:"-" db:"-"`                   // The tracking token itself - only known while the order is placed
+	TrackingTokenHash string `json:"-" db:"tracking_token_hash"` // Hash of the tracking token (orders placed before every order had one have none)
+	Note              string `json:"note,omitempty" db:"note"`   // Customer's note, e.g. delivery instructions
+
+	InvoiceNumber string `json:"invoice_number,omitempty" db:"invoice_number"` // e.g. INV-2024-000123, set when the order is created
 }
 
 // OrderRequest represents data needed to create an order
+// Request structs only hold fields a client may choose. The total, status and
+// dates are computed by the server, so they have no field here and a client
+// sending e.g. "total_cents" is simply ignored
+// Responses go out as OrderResponse, which is never bound from a request body,
+// so a computed field added to it can't be set by a client either
 type OrderRequest struct {
-	ProductID int `json:"product_id" binding:"required"`
-	Quantity  int `json:"quantity" binding:"required,min=1"`
+	ProductID int    `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+	Note      string `json:"note"` // Optional, e.g. "leave at the back door"
+}
+
+// GuestOrderRequest represents an order placed without logging in
+// Like OrderRequest, it has no field for anything the server computes
+type GuestOrderRequest struct {
+	Email     string `json:"email" binding:"required,email"`
+	ProductID int    `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+	Note      string `json:"note"`
+}
+
+// GuestOrderResponse is an order plus the token the guest uses to track it
+// The token is only ever shown here - we store just its hash
+type GuestOrderResponse struct {
+	OrderResponse
+	TrackingToken string `json:"tracking_token"`
+}
+
+// OrderTracking is what anyone holding a tracking token may see about an order
+// It deliberately contains no user data
+type OrderTracking struct {
+	OrderID     int         `json:"order_id,omitempty"` // Left out when order ID obfuscation is on (see OrderCode)
+	ProductName string      `json:"product_name"`
+	Quantity    int         `json:"quantity"`
+	Status      OrderStatus `json:"status"`
+	CreatedAt   time.Time   `json:"created_at"`
+
+	OrderCode string `json:"order_code,omitempty"`
+}
+
+// BulkStatusUpdate asks to move many orders to the same status at once
+type BulkStatusUpdate struct {
+	OrderIDs []int       `json:"order_ids" binding:"required,min=1,max=500"`
+	Status   OrderStatus `json:"status" binding:"required"`
+}
+
+// BulkStatusResult says whether one order of a bulk status update was changed
+type BulkStatusResult struct {
+	OrderID int    `json:"order_id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"` // Why it wasn't changed
+}
+
+// ShipmentUpdate is a shipping provider's news about an order, received over MQTT
+type ShipmentUpdate struct {
+	MessageID      string      `json:"message_id"` // Lets us ignore redeliveries
+	OrderID        int         `json:"order_id"`
+	Status         OrderStatus `json:"status"` // Usually "shipped" or "delivered"
+	TrackingNumber string      `json:"tracking_number"`
+}
+
+// RiskFlag is a fraud check's verdict on an order, received over MQTT
+type RiskFlag struct {
+	MessageID string  `json:"message_id"` // Lets us ignore redeliveries
+	OrderID   int     `json:"order_id"`
+	Score     float64 `json:"score"`  // 0 (fine) to 100 (certainly fraud)
+	Reason    string  `json:"reason"` // Optional explanation, e.g. "card country mismatch"
+}
+
+// OrderHeldEvent is published when a risky order is put on hold
+type OrderHeldEvent struct {
+	OrderID   int     `json:"order_id"`
+	Score     float64 `json:"score"`
+	Reason    string  `json:"reason,omitempty"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// OrderEdit is a customer's change to an order that hasn't been paid for yet
+// The total isn't a field - it's recomputed by the server
+type OrderEdit struct {
+	Quantity int `json:"quantity" binding:"required,min=1"`
+}
+
+// OrderStatusUpdate represents an admin's request to change an order's status
+type OrderStatusUpdate struct {
+	Status OrderStatus `json:"status" binding:"required"`
 }
 
 // OrderResponse includes product information with the order
+// It is only ever sent, never bound from a request body
 type OrderResponse struct {
-	ID          int       `json:"id"`
-	ProductID   int       `json:"product_id"`
-	ProductName string    `json:"product_name"`
-	Quantity    int       `json:"quantity"`
-	TotalCents  int       `json:"total_cents"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int         `json:"id,omitempty"` // Left out when customers get order codes instead (see Code)
+	ProductID   int         `json:"product_id"`
+	ProductName string      `json:"product_name"`
+	Quantity    int         `json:"quantity"`
+	TotalCents  int         `json:"total_cents"`
+	Status      OrderStatus `json:"status"`
+	Note        string      `json:"note,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+
+	InvoiceNumber  string `json:"invoice_number,omitempty"`  // Empty for orders placed before invoice numbers existed
+	TrackingNumber string `json:"tracking_number,omitempty"` // The shipping provider's parcel number, once shipped
+
+	Code string `json:"code,omitempty"` // Stands in for ID in URLs when order ID obfuscation is on
 }
 
-// TotalInDollars returns the total price in dollars
-func (o *Order) TotalInDollars() float64 {
-	return float64(o.TotalCents) / 100.0
+// ReorderResponse is the result of repeating a previous order
+// Order is null when none of the lines could be ordered again
+type ReorderResponse struct {
+	Order       *OrderResponse   `json:"order"`
+	FailedLines []ReorderFailure `json:"failed_lines"`
+}
+
+// ReorderFailure describes a line of the old order that couldn't be ordered again
+type ReorderFailure struct {
+	ProductID int    `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+}
+
+// CartValidationRequest is a shopping cart to check before checkout
+type CartValidationRequest struct {
+	Items []CartItem `json:"items" binding:"required,min=1,max=100,dive"` // Carts are small; the cap keeps the check cheap
+}
+
+// CartItem is one line of a shopping cart
+type CartItem struct {
+	ProductID int `json:"product_id" binding:"required"`
+	Quantity  int `json:"quantity" binding:"required,min=1"`
+}
+
+// CartLine is one checked line of a shopping cart
+type CartLine struct {
+	ProductID      int    `json:"product_id"`
+	ProductName    string `json:"product_name,omitempty"`
+	Quantity       int    `json:"quantity"`
+	UnitPriceCents int    `json:"unit_price_cents"` // Sale price if a sale is running
+	LineTotalCents int    `json:"line_total_cents"`
+	Available      bool   `json:"available"`
+	Reason         string `json:"reason,omitempty"` // Why the line can't be ordered
+}
+
+// CartValidation is the result of checking a shopping cart
+// Nothing is reserved, so stock may be gone by checkout
+type CartValidation struct {
+	Lines        []CartLine `json:"lines"`
+	TotalCents   int64      `json:"total_cents"` // Of the available lines only
+	AllAvailable bool       `json:"all_available"`
+}
+
+// OrderPageRequest asks for one page of the user's orders
+// Use Cursor (the next_cursor of the previous page) for stable paging;
+// Offset is kept for clients that jump to a page number
+type OrderPageRequest struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// OrderPage is one page of orders
+// NextCursor is empty on the last page
+type OrderPage struct {
+	Orders     []OrderResponse `json:"orders"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// UserOrderSummary is an admin's overview of one customer's orders
+type UserOrderSummary struct {
+	UserID          int        `json:"user_id"`
+	TotalOrders     int        `json:"total_orders"`      // Every order, whatever its status
+	TotalSpendCents int64      `json:"total_spend_cents"` // Only orders that were paid for
+	LastOrderAt     *time.Time `json:"last_order_at"`     // null if the user never ordered
+}
+
+// SalesBucket is the sales of one day, week or month
+type SalesBucket struct {
+	Start        string `json:"start"` // First day of the bucket (YYYY-MM-DD); weeks start on Monday
+	Orders       int    `json:"orders"`
+	RevenueCents int64  `json:"revenue_cents"`
+}
+
+// SalesMetrics is the sales report for a date range
+// Buckets without sales are included with zeros, so charts have no gaps
+type SalesMetrics struct {
+	From    string        `json:"from"` // First day included (YYYY-MM-DD)
+	To      string        `json:"to"`   // Last day included (YYYY-MM-DD)
+	GroupBy string        `json:"group_by"`
+	Buckets []SalesBucket `json:"buckets"`
+}
+
+// OrderExportRow is one line of the admin order export
+type OrderExportRow struct {
+	ID          int
+	UserEmail   string
+	ProductName string
+	Quantity    int
+	TotalCents  int
+	Status      string
+	CreatedAt   time.Time
+}
+
+// FormattedTotal returns the total as a decimal string in the given currency
+func (o *Order) FormattedTotal(currency string) string {
+	return money.Format(int64(o.TotalCents), currency)
 }
 
 // MQTT Message Types
@@ -48,6 +271,29 @@ type UserRegisteredEvent struct {
 	Timestamp int64  `json:"timestamp"`
 }
 
+// VerificationRequestedEvent is published when a user has to confirm their email
+// The notification service emails them a link containing Token
+// GuestUpgrade is set when confirming turns an earlier guest checkout into the
+// new account, so the email can say so (and to ignore it if they didn't register)
+type VerificationRequestedEvent struct {
+	UserID       int    `json:"user_id"`
+	Email        string `json:"email"`
+	Token        string `json:"token"`
+	GuestUpgrade bool   `json:"guest_upgrade,omitempty"`
+	Timestamp    int64  `json:"timestamp"`
+}
+
+// UserProfileUpdatedEvent is published when a user changes their profile
+// The notification service uses VerificationRequired to send a confirmation
+// email to the new address
+type UserProfileUpdatedEvent struct {
+	UserID               int    `json:"user_id"`
+	OldEmail             string `json:"old_email"`
+	NewEmail             string `json:"new_email"`
+	VerificationRequired bool   `json:"verification_required"`
+	Timestamp            int64  `json:"timestamp"`
+}
+
 // ProductCreatedEvent is published when a new product is created
 type ProductCreatedEvent struct {
 	ProductID int    `json:"product_id"`
@@ -63,6 +309,26 @@ type OrderCreatedEvent struct {
 	Quantity   int   `json:"quantity"`
 	TotalCents int   `json:"total_cents"`
 	Timestamp  int64 `json:"timestamp"`
+
+	// For a "track your order" link: GET /api/orders/track?token=...
+	TrackingToken string `json:"tracking_token,omitempty"`
+
+	// Only with the rich_order_events feature, so an email service needs no follow-up queries
+	ProductName string `json:"product_name,omitempty"`
+	UserEmail   string `json:"user_email,omitempty"`
+}
+
+// BackInStockEvent is published when a sold-out product can be bought again
+// A notification service uses it to tell customers who were waiting for it
+type BackInStockEvent struct {
+	ProductID    int    `json:"product_id"`
+	ProductName  string `json:"product_name"`
+	CurrentStock int    `json:"current_stock"`
+	Timestamp    int64  `json:"timestamp"`
+
+	// Set when the event is the notification for one customer on the product's waitlist
+	UserID int    `json:"user_id,omitempty"`
+	Email  string `json:"email,omitempty"`
 }
 
 // LowStockAlert is published when product stock is low
@@ -0,0 +1,21 @@
+// internal/models/order_test.go
+// Tests for the order helpers
+
+package models
+
+import "testing"
+
+func TestOrderStatusValid(t *testing.T) {
+	for _, status := range OrderStatuses {
+		if !status.Valid() {
+			t.Errorf("%q is not valid, want valid", status)
+		}
+	}
+
+	// Typos, other casing and statuses we don't have
+	for _, status := range []OrderStatus{"", "payed", "Paid", "PENDING", " paid", "cancelled", "lost"} {
+		if status.Valid() {
+			t.Errorf("%q is valid, want invalid", status)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// internal/models/outbox.go
+// OutboxMessage is an event waiting to be published
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxMessage is an event waiting to be published: either its publish failed
+// and will be retried, or it was saved together with the change it describes
+type OutboxMessage struct {
+	ID        int             `json:"id" db:"id"`
+	Topic     string          `json:"topic" db:"topic"`
+	Payload   json.RawMessage `json:"payload" db:"payload"` // The event, already encoded as JSON
+	Attempts  int             `json:"attempts" db:"attempts"`
+	LastError string          `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,15 @@
+// internal/models/payment.go
+// PaymentConfirmation represents a payment recorded by the payment service
+
+package models
+
+import "time"
+
+// PaymentConfirmation is a confirmed payment for an order
+// The payment service writes these to the payments table, in addition to
+// publishing payment/confirmed over MQTT
+type PaymentConfirmation struct {
+	ID          int       `json:"id" db:"id"`
+	OrderID     int       `json:"order_id" db:"order_id"`
+	ConfirmedAt time.Time `json:"confirmed_at" db:"confirmed_at"`
+}
@@ -3,27 +3,287 @@
 
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"online-store/internal/money"
+)
 
 // Product represents an item in our online store
 type Product struct {
 	ID            int       `json:"id" db:"id"`
+	SKU           string    `json:"sku,omitempty" db:"sku"` // Stock keeping unit - optional, but unique when set
 	Name          string    `json:"name" db:"name"`
 	Description   string    `json:"description" db:"description"`
-	PriceCents    int       `json:"price_cents" db:"price_cents"` // Price in cents (avoids floating point issues)
+	Category      string    `json:"category,omitempty" db:"category"` // Optional, e.g. "books"
+	PriceCents    int       `json:"price_cents" db:"price_cents"`     // Price in cents (avoids floating point issues)
 	StockQuantity int       `json:"stock_quantity" db:"stock_quantity"`
+	ReorderLevel  int       `json:"reorder_level" db:"reorder_level"`           // Stock below this counts as low
+	MaxPerOrder   *int      `json:"max_per_order,omitempty" db:"max_per_order"` // Most units one order may contain; nil = no limit
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+
+	// Optional sale: SalePriceCents applies until SaleEndsAt (or forever if SaleEndsAt is nil)
+	SalePriceCents *int       `json:"sale_price_cents,omitempty" db:"sale_price_cents"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at,omitempty" db:"sale_ends_at"`
+
+	// Drafts are only visible to admins until they're published
+	Status string `json:"status" db:"status"` // ProductStatusDraft or ProductStatusPublished
+
+	// Optional purchase window (e.g. a flash sale): the product can only be ordered
+	// from AvailableFrom until AvailableUntil; nil means no limit on that side
+	AvailableFrom  *time.Time `json:"available_from,omitempty" db:"available_from"`
+	AvailableUntil *time.Time `json:"available_until,omitempty" db:"available_until"`
+
+	// Computed by ApplySale, not stored: what a customer pays right now
+	EffectivePriceCents int  `json:"effective_price_cents"`
+	OnSale              bool `json:"on_sale"`
+}
+
+// ProductResponse is a product as the API sends it
+// It is only ever sent, never bound from a request body, so the fields the
+// server computes (effective price, sale flag, display price) can't be set by clients
+type ProductResponse struct {
+	ID             int        `json:"id"`
+	SKU            string     `json:"sku,omitempty"`
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Category       string     `json:"category,omitempty"`
+	PriceCents     int        `json:"price_cents"`
+	StockQuantity  int        `json:"stock_quantity"`
+	ReorderLevel   int        `json:"reorder_level"`
+	MaxPerOrder    *int       `json:"max_per_order,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	SalePriceCents *int       `json:"sale_price_cents,omitempty"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at,omitempty"`
+	Status         string     `json:"status"`
+	AvailableFrom  *time.Time `json:"available_from,omitempty"`
+	AvailableUntil *time.Time `json:"available_until,omitempty"`
+
+	EffectivePriceCents int  `json:"effective_price_cents"`
+	OnSale              bool `json:"on_sale"`
+
+	// Only set when the client asks for a display currency (?currency=EUR)
+	DisplayPrice *DisplayPrice `json:"display_price,omitempty"`
+}
+
+// DisplayPrice is a product's effective price converted into another currency
+// It is for showing only: orders are always charged in the store's own currency
+type DisplayPrice struct {
+	Currency  string `json:"currency"`  // ISO 4217 code, e.g. EUR
+	Amount    int64  `json:"amount"`    // In the currency's minor units, like price_cents
+	Formatted string `json:"formatted"` // e.g. "27.59 EUR"
+}
+
+// Product statuses (the same values as the products.status ENUM column)
+const (
+	ProductStatusDraft     = "draft"     // Being prepared; hidden from customers
+	ProductStatusPublished = "published" // In the catalog
+)
+
+// LowStockProduct is a product below its reorder level
+// Shortfall is how many units it is below the level
+type LowStockProduct struct {
+	Product
+	Shortfall int `json:"shortfall"`
+}
+
+// LowStockProductResponse is a LowStockProduct as the API sends it
+type LowStockProductResponse struct {
+	ProductResponse
+	Shortfall int `json:"shortfall"`
+}
+
+// TopSeller is a product and how much of it was sold in a period
+type TopSeller struct {
+	Product
+	UnitsSold    int64 `json:"units_sold"`
+	RevenueCents int64 `json:"revenue_cents"`
+}
+
+// TopSellerResponse is a TopSeller as the API sends it
+type TopSellerResponse struct {
+	ProductResponse
+	UnitsSold    int64 `json:"units_sold"`
+	RevenueCents int64 `json:"revenue_cents"`
+}
+
+// PriceChange is one row of a product's price history
+type PriceChange struct {
+	ID            int       `json:"id" db:"id"`
+	ProductID     int       `json:"product_id" db:"product_id"`
+	OldPriceCents int       `json:"old_price_cents" db:"old_price_cents"`
+	NewPriceCents int       `json:"new_price_cents" db:"new_price_cents"`
+	ChangedBy     *int      `json:"changed_by" db:"changed_by"` // User who changed it; nil for system changes
+	ChangedAt     time.Time `json:"changed_at" db:"changed_at"`
+}
+
+// CategoryCount is a product category and how many of its products are in stock
+type CategoryCount struct {
+	Name    string `json:"name"`
+	InStock int    `json:"in_stock"` // Products in the category with stock above 0
+}
+
+// InventoryValuation is what the stock on hand is worth at regular prices
+// (price_cents times stock_quantity, summed over all products, drafts included)
+type InventoryValuation struct {
+	TotalCents int64               `json:"total_cents"`
+	Units      int64               `json:"units"`      // Items in stock, over all products
+	Categories []CategoryValuation `json:"categories"` // null unless grouped by category
+}
+
+// CategoryValuation is the stock value of one product category
+type CategoryValuation struct {
+	Category   string `json:"category"` // Empty for products without a category
+	Products   int    `json:"products"` // Products of the category that are in stock
+	Units      int64  `json:"units"`
+	ValueCents int64  `json:"value_cents"`
+}
+
+// ProductEvent is something that happened to a product, kept for debugging
+// Most of them were also published over MQTT; Topic says where (empty if not published)
+type ProductEvent struct {
+	ID        int             `json:"id" db:"id"`
+	ProductID int             `json:"product_id" db:"product_id"`
+	Type      string          `json:"type" db:"event_type"` // One of the ProductEvent... constants
+	Topic     string          `json:"topic,omitempty" db:"topic"`
+	Payload   json.RawMessage `json:"payload" db:"payload"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// Product event types
+const (
+	ProductEventCreated      = "created"
+	ProductEventUpdated      = "updated"
+	ProductEventStockChanged = "stock_changed"
+	ProductEventPriceChanged = "price_changed"
+	ProductEventLowStock     = "low_stock"
+	ProductEventPublished    = "published"
+	ProductEventBackInStock  = "back_in_stock"
+)
+
+// ProductAvailability tells a frontend whether a quantity of a product can be ordered
+type ProductAvailability struct {
+	ProductID         int  `json:"product_id"`
+	StockQuantity     int  `json:"stock_quantity"`
+	RequestedQuantity int  `json:"requested_quantity"`
+	Available         bool `json:"available"` // true if stock covers the requested quantity
 }
 
 // ProductRequest represents data needed to create/update a product
+// Computed fields of Product (ID, created_at, effective_price_cents, on_sale)
+// are deliberately missing, so clients can't set them
 type ProductRequest struct {
+	SKU           string `json:"sku" binding:"omitempty,max=64"` // Optional; makes creation safe to retry
 	Name          string `json:"name" binding:"required"`
 	Description   string `json:"description"`
-	PriceCents    int    `json:"price_cents" binding:"required,min=1"`    // Must be at least 1 cent
-	StockQuantity int    `json:"stock_quantity" binding:"required,min=0"` // Can't have negative stock
+	Category      string `json:"category" binding:"omitempty,max=100"`     // Optional; empty means no category
+	PriceCents    int    `json:"price_cents" binding:"required,min=1"`     // Must be at least 1 cent
+	StockQuantity *int   `json:"stock_quantity" binding:"omitempty,min=0"` // Optional; nil means the configured default (new) or unchanged (update)
+	ReorderLevel  *int   `json:"reorder_level" binding:"omitempty,min=0"`  // Optional; nil keeps the current level (10 for new products)
+	MaxPerOrder   *int   `json:"max_per_order" binding:"omitempty,min=1"`  // Optional per-order limit, e.g. 1 for a promo; nil = no limit
+
+	SalePriceCents *int       `json:"sale_price_cents" binding:"omitempty,min=1"` // Optional sale price
+	SaleEndsAt     *time.Time `json:"sale_ends_at"`                               // When the sale ends (nil = until removed)
+
+	AvailableFrom  *time.Time `json:"available_from"`  // Can't be ordered before this (nil = no start)
+	AvailableUntil *time.Time `json:"available_until"` // Can't be ordered from this moment on (nil = no end)
+
+	Draft bool `json:"draft"` // Create the product as a hidden draft (publish it later); ignored by updates
+}
+
+// ProductCloneRequest optionally changes the name or SKU of a cloned product
+// Everything else is copied from the original
+type ProductCloneRequest struct {
+	Name string `json:"name" binding:"omitempty,max=255"` // Empty keeps the original's name
+	SKU  string `json:"sku" binding:"omitempty,max=64"`   // Empty generates one (see ProductService.CloneProduct)
+}
+
+// StockUpdate sets one product's stock, as sent by warehouse inventory syncs
+type StockUpdate struct {
+	ProductID int `json:"product_id"`
+	Stock     int `json:"stock"`
+}
+
+// WaitlistEntry is a customer waiting to hear when a product is back in stock
+type WaitlistEntry struct {
+	ProductID int       `json:"product_id"`
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StockChange is a product whose stock was just set, and what the stock was before
+type StockChange struct {
+	Product       Product
+	PreviousStock int
+}
+
+// ApplySale fills in EffectivePriceCents and OnSale for the given moment
+// A sale is active when a sale price is set and it hasn't ended yet
+func (p *Product) ApplySale(now time.Time) {
+	p.OnSale = p.SalePriceCents != nil && (p.SaleEndsAt == nil || now.Before(*p.SaleEndsAt))
+	if p.OnSale {
+		p.EffectivePriceCents = *p.SalePriceCents
+	} else {
+		p.EffectivePriceCents = p.PriceCents
+	}
+}
+
+// AvailableAt reports whether the product's purchase window is open at the given moment
+// The window includes AvailableFrom but not AvailableUntil
+func (p *Product) AvailableAt(now time.Time) bool {
+	if p.AvailableFrom != nil && now.Before(*p.AvailableFrom) {
+		return false
+	}
+	return p.AvailableUntil == nil || now.Before(*p.AvailableUntil)
+}
+
+// ToResponse converts a Product to ProductResponse
+// DisplayPrice is left empty; it depends on the request (see ProductService.SetDisplayPrice)
+func (p *Product) ToResponse() ProductResponse {
+	return ProductResponse{
+		ID:                  p.ID,
+		SKU:                 p.SKU,
+		Name:                p.Name,
+		Description:         p.Description,
+		Category:            p.Category,
+		PriceCents:          p.PriceCents,
+		StockQuantity:       p.StockQuantity,
+		ReorderLevel:        p.ReorderLevel,
+		MaxPerOrder:         p.MaxPerOrder,
+		CreatedAt:           p.CreatedAt,
+		SalePriceCents:      p.SalePriceCents,
+		SaleEndsAt:          p.SaleEndsAt,
+		Status:              p.Status,
+		AvailableFrom:       p.AvailableFrom,
+		AvailableUntil:      p.AvailableUntil,
+		EffectivePriceCents: p.EffectivePriceCents,
+		OnSale:              p.OnSale,
+	}
+}
+
+// ProductResponses converts products to ProductResponses, in the same order
+func ProductResponses(products []Product) []ProductResponse {
+	responses := make([]ProductResponse, len(products))
+	for i := range products {
+		responses[i] = products[i].ToResponse()
+	}
+	return responses
+}
+
+// ToResponse converts a LowStockProduct to LowStockProductResponse
+func (p *LowStockProduct) ToResponse() LowStockProductResponse {
+	return LowStockProductResponse{ProductResponse: p.Product.ToResponse(), Shortfall: p.Shortfall}
+}
+
+// ToResponse converts a TopSeller to TopSellerResponse
+func (t *TopSeller) ToResponse() TopSellerResponse {
+	return TopSellerResponse{ProductResponse: t.Product.ToResponse(), UnitsSold: t.UnitsSold, RevenueCents: t.RevenueCents}
 }
 
-// PriceInDollars returns the price in dollars (for display purposes)
-func (p *Product) PriceInDollars() float64 {
-	return float64(p.PriceCents) / 100.0
+// FormattedPrice returns the price as a decimal string in the given currency (for display purposes)
+// PriceCents holds the currency's smallest unit, so this is "29.99" for USD but "2999" for JPY
+func (p *Product) FormattedPrice(currency string) string {
+	return money.Format(int64(p.PriceCents), currency)
 }
@@ -0,0 +1,105 @@
+// internal/models/product_test.go
+// Tests for the product helpers
+
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestApplySale(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	salePrice := 700
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		salePrice  *int
+		saleEndsAt *time.Time
+		wantOnSale bool
+		wantPrice  int
+	}{
+		{"no sale", nil, nil, false, 900},
+		{"open-ended sale", &salePrice, nil, true, 700},
+		{"sale running", &salePrice, &future, true, 700},
+		{"sale over", &salePrice, &past, false, 900},
+		{"sale ends right now", &salePrice, &now, false, 900},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := Product{PriceCents: 900, SalePriceCents: tt.salePrice, SaleEndsAt: tt.saleEndsAt}
+			product.ApplySale(now)
+			if product.OnSale != tt.wantOnSale || product.EffectivePriceCents != tt.wantPrice {
+				t.Errorf("OnSale = %t, EffectivePriceCents = %d, want %t and %d",
+					product.OnSale, product.EffectivePriceCents, tt.wantOnSale, tt.wantPrice)
+			}
+		})
+	}
+}
+
+func TestAvailableAt(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		from  *time.Time
+		until *time.Time
+		want  bool
+	}{
+		{"no window", nil, nil, true},
+		{"not started yet", &future, nil, false},
+		{"started", &past, nil, true},
+		{"starts right now", &now, nil, true},
+		{"ended", nil, &past, false},
+		{"ends right now", nil, &now, false},
+		{"inside the window", &past, &future, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := Product{AvailableFrom: tt.from, AvailableUntil: tt.until}
+			if got := product.AvailableAt(now); got != tt.want {
+				t.Errorf("AvailableAt = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductToResponse(t *testing.T) {
+	salePrice := 700
+	product := Product{ID: 3, Name: "Mug", PriceCents: 900, SalePriceCents: &salePrice, Status: ProductStatusPublished}
+	product.ApplySale(time.Now())
+
+	response := product.ToResponse()
+	if response.ID != 3 || response.PriceCents != 900 || response.EffectivePriceCents != 700 || !response.OnSale {
+		t.Errorf("response = %+v, want product 3 at 900, on sale for 700", response)
+	}
+	if response.DisplayPrice != nil {
+		t.Errorf("DisplayPrice = %+v, want it left for the handler", response.DisplayPrice)
+	}
+}
+
+func TestProductRequestIgnoresComputedFields(t *testing.T) {
+	body := `{"name":"Mug","price_cents":900,"effective_price_cents":1,"on_sale":true,"display_price":{"amount":1}}`
+
+	// ProductRequest has no fields for them, so they can't leak into a product
+	var req ProductRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("encode request: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		t.Fatalf("decode fields: %v", err)
+	}
+	for _, field := range []string{"effective_price_cents", "on_sale", "display_price"} {
+		if _, ok := fields[field]; ok {
+			t.Errorf("request kept %s: %s", field, encoded)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// internal/models/session.go
+// Session represents a login that can be kept alive with a refresh token
+
+package models
+
+import "time"
+
+// Session is one refresh token issued to a user
+// Only the token's hash is stored, never the token itself
+type Session struct {
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"user_id" db:"user_id"`
+	UserAgent string     `json:"user_agent" db:"user_agent"` // Browser/app that logged in, to help users recognize the device
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"` // nil while the session is active
+}
+
+// TokenPair is what a client gets when logging in or refreshing
+type TokenPair struct {
+	AccessToken  string `json:"token"`         // Short-lived JWT sent with every request
+	RefreshToken string `json:"refresh_token"` // Long-lived token used to get a new access token
+}
+
+// RefreshRequest represents a request to exchange a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
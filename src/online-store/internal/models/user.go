@@ -8,12 +8,22 @@ import "time"
 // User represents a user in our system
 // In Go, we use structs to define data structures
 type User struct {
-	ID           int       `json:"id" db:"id"`                         // Database ID
-	Email        string    `json:"email" db:"email"`                   // User's email address
-	PasswordHash string    `json:"-" db:"password_hash"`               // Hashed password (json:"-" means don't include in JSON)
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`         // When the user was created
+	ID           int       `json:"id" db:"id"`                 // Database ID
+	Email        string    `json:"email" db:"email"`           // User's email address
+	PasswordHash string    `json:"-" db:"password_hash"`       // Hashed password (json:"-" means don't include in JSON)
+	Role         string    `json:"role" db:"role"`             // "customer" or "admin"
+	IsGuest      bool      `json:"-" db:"is_guest"`            // Created by guest checkout, has no password yet
+	CreatedAt    time.Time `json:"created_at" db:"created_at"` // When the user was created
+
+	EmailVerified bool `json:"-" db:"email_verified_at"` // Confirmed their email by following a verification link
 }
 
+// User roles
+const (
+	RoleCustomer = "customer" // Regular shoppers (the default)
+	RoleAdmin    = "admin"    // Staff who can manage orders
+)
+
 // UserRegistration represents the data needed to register a new user
 // We separate this from User because we don't want to expose password hashes
 type UserRegistration struct {
@@ -27,10 +37,37 @@ type UserLogin struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// EmailCheck is the query of an email availability check
+type EmailCheck struct {
+	Email string `form:"email" binding:"required,email"`
+}
+
+// EmailAvailability tells a signup form whether an email can still be registered
+type EmailAvailability struct {
+	Email     string `json:"email"` // The email as we compared it (normalized)
+	Available bool   `json:"available"`
+}
+
+// VerificationResend asks for a new email verification link
+type VerificationResend struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// EmailVerification confirms an email with the token from a verification link
+type EmailVerification struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ProfileUpdate represents the changes a user can make to their own account
+type ProfileUpdate struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
 // UserResponse is what we send back to the client (without sensitive data)
 type UserResponse struct {
 	ID        int       `json:"id"`
 	Email     string    `json:"email"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -39,7 +76,7 @@ func (u *User) ToResponse() UserResponse {
 	return UserResponse{
 		ID:        u.ID,
 		Email:     u.Email,
+		Role:      u.Role,
 		CreatedAt: u.CreatedAt,
 	}
 }
-
@@ -0,0 +1,71 @@
+// internal/money/convert.go
+// This file converts amounts into other currencies, for showing prices to
+// international customers - we still store and charge everything in one currency
+
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrUnknownCurrency is returned when converting into a currency we have no rate for
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// Rates converts amounts from our base currency into other currencies
+// Rates are exact fractions (math/big.Rat), so "0.92" really is 0.92 and
+// not the nearest float64 - conversions never pick up floating point errors
+type Rates struct {
+	base  string              // Currency our prices are in
+	rates map[string]*big.Rat // Units of each currency one unit of base is worth
+}
+
+// NewRates creates a converter from base into the currencies in rates
+// rates maps a currency code to how much one unit of base is worth in it,
+// e.g. {"EUR": 0.92} for a USD store; the base currency itself needs no rate
+func NewRates(base string, rates map[string]*big.Rat) *Rates {
+	normalized := make(map[string]*big.Rat, len(rates))
+	for currency, rate := range rates {
+		normalized[strings.ToUpper(currency)] = rate
+	}
+	return &Rates{base: strings.ToUpper(base), rates: normalized}
+}
+
+// Convert turns an amount in minor units of the base currency into minor
+// units of currency, rounding half away from zero
+// For example 2999 (29.99 USD) at EUR=0.92 is 2759 (27.59 EUR)
+// Returns ErrUnknownCurrency if there is no rate for currency
+func (r *Rates) Convert(amount int64, currency string) (int64, error) {
+	currency = strings.ToUpper(currency)
+	if currency == r.base {
+		return amount, nil
+	}
+	rate, ok := r.rates[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownCurrency, currency)
+	}
+
+	// Go through whole units: minor units of base -> base -> currency -> minor units of currency
+	value := new(big.Rat).SetInt64(amount)
+	value.Mul(value, rate)
+	value.Mul(value, new(big.Rat).SetInt(pow10(MinorUnits(currency))))
+	value.Quo(value, new(big.Rat).SetInt(pow10(MinorUnits(r.base))))
+
+	// Round to a whole number of minor units; QuoRem cuts toward zero
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if remainder.Abs(remainder).Lsh(remainder, 1).Cmp(value.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+	}
+
+	if !quotient.IsInt64() {
+		return 0, fmt.Errorf("amount %d is too large to convert to %s", amount, currency)
+	}
+	return quotient.Int64(), nil
+}
+
+// pow10 returns 10 to the power of n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
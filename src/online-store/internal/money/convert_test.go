@@ -0,0 +1,73 @@
+// internal/money/convert_test.go
+// Tests for converting amounts into other currencies
+
+package money
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// rat parses an exact decimal rate
+func rat(t *testing.T, value string) *big.Rat {
+	t.Helper()
+	rate, ok := new(big.Rat).SetString(value)
+	if !ok {
+		t.Fatalf("invalid rate %q", value)
+	}
+	return rate
+}
+
+func TestConvert(t *testing.T) {
+	rates := NewRates("usd", map[string]*big.Rat{
+		"eur": rat(t, "0.92"),
+		"JPY": rat(t, "151.3"),
+		"KWD": rat(t, "0.3075"),
+		"GBP": rat(t, "0.785"),
+	})
+
+	tests := []struct {
+		amount   int64
+		currency string
+		want     int64
+	}{
+		{2999, "EUR", 2759}, // 27.5908
+		{2999, "eur", 2759}, // Codes are case-insensitive
+		{2999, "USD", 2999}, // The base currency needs no rate
+		{2999, "JPY", 4537}, // 4537.487 yen, no minor units
+		{2999, "KWD", 9222}, // 9.2219 KWD, 3 decimals
+		{100, "GBP", 79},    // 78.5 rounds half away from zero
+		{-100, "GBP", -79},  // Also below zero
+		{0, "EUR", 0},
+		{10, "EUR", 9}, // 9.2
+	}
+	for _, tt := range tests {
+		got, err := rates.Convert(tt.amount, tt.currency)
+		if err != nil || got != tt.want {
+			t.Errorf("Convert(%d, %s) = %d, %v; want %d", tt.amount, tt.currency, got, err, tt.want)
+		}
+	}
+}
+
+func TestConvertIsExact(t *testing.T) {
+	// As a float64, 1.005 is 1.00499999..., so 100 * 1.005 would round down to 100
+	// The exact rate makes it 100.5, which rounds up
+	rates := NewRates("USD", map[string]*big.Rat{"CHF": rat(t, "1.005")})
+	for amount, want := range map[int64]int64{100: 101, 300: 302, 1000: 1005} {
+		if got, err := rates.Convert(amount, "CHF"); err != nil || got != want {
+			t.Errorf("Convert(%d) = %d, %v; want %d", amount, got, err, want)
+		}
+	}
+}
+
+func TestConvertRejected(t *testing.T) {
+	rates := NewRates("USD", map[string]*big.Rat{"EUR": rat(t, "0.92"), "XAU": rat(t, "1000000000000")})
+
+	if _, err := rates.Convert(100, "CHF"); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("unknown currency: err = %v, want ErrUnknownCurrency", err)
+	}
+	if _, err := rates.Convert(1<<62, "XAU"); err == nil {
+		t.Errorf("overflowing conversion: want an error")
+	}
+}
@@ -0,0 +1,61 @@
+// internal/money/money.go
+// This file formats money amounts for people to read
+
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// We store every amount as a whole number of the currency's smallest unit
+// ("minor unit") - cents for USD, but yen for JPY, which has no smaller coin
+// minorUnits says how many decimal places each currency has
+// Currencies not listed here use 2, which is right for most of them
+var minorUnits = map[string]int{
+	"JPY": 0, // Japanese yen
+	"KRW": 0, // South Korean won
+	"ISK": 0, // Icelandic krona
+	"CLP": 0, // Chilean peso
+	"VND": 0, // Vietnamese dong
+	"BHD": 3, // Bahraini dinar
+	"KWD": 3, // Kuwaiti dinar
+	"OMR": 3, // Omani rial
+	"TND": 3, // Tunisian dinar
+}
+
+// MinorUnits returns how many decimal places a currency has
+func MinorUnits(currency string) int {
+	if units, ok := minorUnits[strings.ToUpper(currency)]; ok {
+		return units
+	}
+	return 2
+}
+
+// Format turns an amount in minor units into a decimal string
+// For example Format(2999, "USD") is "29.99" and Format(2999, "JPY") is "2999"
+// It only uses integer math, so there are no floating point rounding errors
+func Format(amount int64, currency string) string {
+	units := MinorUnits(currency)
+	if units == 0 {
+		return fmt.Sprintf("%d", amount)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	// Split into the whole part and the fraction, e.g. 2999 -> 29 and 99
+	divisor := int64(1)
+	for i := 0; i < units; i++ {
+		divisor *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/divisor, units, amount%divisor)
+}
+
+// FormatWithCode is like Format but adds the currency code, e.g. "29.99 USD"
+func FormatWithCode(amount int64, currency string) string {
+	return Format(amount, currency) + " " + strings.ToUpper(currency)
+}
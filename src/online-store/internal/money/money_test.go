@@ -0,0 +1,42 @@
+// internal/money/money_test.go
+// Tests for formatting money amounts
+
+package money
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{2999, "USD", "29.99"},
+		{5, "USD", "0.05"},
+		{-1050, "EUR", "-10.50"},
+		{2999, "JPY", "2999"},
+		{2999, "jpy", "2999"},
+		{12345, "KWD", "12.345"},
+		{7, "BHD", "0.007"},
+		{100, "XYZ", "1.00"}, // Unknown currencies have 2 decimals
+	}
+	for _, tt := range tests {
+		if got := Format(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("Format(%d, %q) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestFormatWithCode(t *testing.T) {
+	if got := FormatWithCode(2999, "usd"); got != "29.99 USD" {
+		t.Errorf("FormatWithCode = %q, want %q", got, "29.99 USD")
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	for currency, want := range map[string]int{"USD": 2, "JPY": 0, "OMR": 3} {
+		if got := MinorUnits(currency); got != want {
+			t.Errorf("MinorUnits(%q) = %d, want %d", currency, got, want)
+		}
+	}
+}
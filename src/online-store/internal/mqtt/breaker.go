@@ -0,0 +1,115 @@
+// internal/mqtt/breaker.go
+// This file contains a circuit breaker for publishing
+// When the broker is overloaded, every publish waits for a timeout before it
+// fails - and our HTTP requests wait with it. After a few failures in a row the
+// breaker "opens" and publishes fail right away; after a cooldown one publish
+// is let through as a probe, and if it works, publishing goes back to normal
+
+package mqtt
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for publishes skipped because the breaker is open
+// The outbox saves such events and publishes them once the broker recovers
+var ErrCircuitOpen = errors.New("MQTT publishing paused after repeated failures")
+
+// Breaker configures the publish circuit breaker
+type Breaker struct {
+	Failures     int           // Failures in a row that open the breaker; 0 turns it off
+	Cooldown     time.Duration // How long it stays open before a probe publish is tried
+	DropWhenOpen bool          // Drop events while open instead of returning ErrCircuitOpen (which queues them in the outbox); never applies to Strict
+}
+
+// Breaker states, as shown in the health check
+const (
+	breakerClosed   = "closed"    // Publishing normally
+	breakerOpen     = "open"      // Failing fast until the cooldown is over
+	breakerHalfOpen = "half-open" // One probe publish is on its way
+)
+
+// circuitBreaker tracks publish failures and decides whether to try publishing
+type circuitBreaker struct {
+	settings Breaker
+	now      func() time.Time // time.Now, replaceable so the cooldown can be tested
+
+	mu          sync.Mutex
+	consecutive int       // Failures in a row
+	openedAt    time.Time // When the breaker last opened
+	probing     bool      // A probe publish is running (half-open)
+}
+
+// newCircuitBreaker creates a closed breaker
+func newCircuitBreaker(settings Breaker) *circuitBreaker {
+	return &circuitBreaker{settings: settings, now: time.Now}
+}
+
+// allow reports whether a publish may be tried now
+// While half-open only the probe is allowed; other publishes fail fast until it's done
+func (b *circuitBreaker) allow() bool {
+	if b.settings.Failures <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state() {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.settings.Cooldown {
+			return false
+		}
+		// The cooldown is over - this publish is the probe
+		b.probing = true
+		return true
+	default:
+		return false
+	}
+}
+
+// record notes how a publish that allow let through went
+// A success closes the breaker; enough failures in a row (or a failed probe) open it
+func (b *circuitBreaker) record(succeeded bool) {
+	if b.settings.Failures <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if succeeded {
+		b.consecutive = 0
+		return
+	}
+
+	b.consecutive++
+	if b.consecutive >= b.settings.Failures {
+		// Also restarts the cooldown after a failed probe
+		b.openedAt = b.now()
+	}
+}
+
+// State returns "closed", "open" or "half-open"
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state()
+}
+
+// state is State for callers that hold mu
+func (b *circuitBreaker) state() string {
+	switch {
+	case b.settings.Failures <= 0 || b.consecutive < b.settings.Failures:
+		return breakerClosed
+	case b.probing:
+		return breakerHalfOpen
+	default:
+		return breakerOpen
+	}
+}
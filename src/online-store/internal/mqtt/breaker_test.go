@@ -0,0 +1,159 @@
+// internal/mqtt/breaker_test.go
+// Tests for the publish circuit breaker
+
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newBrokenClient returns a Client whose broker rejects every publish,
+// with a breaker on a fake clock
+func newBrokenClient(breaker Breaker) (*Client, *fakePaho, *fakeClock) {
+	client, paho := newTestClient(0, breaker)
+	paho.publishErr = errors.New("broker overloaded")
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	client.breaker.now = clock.Now
+	return client, paho, clock
+}
+
+// attempts returns how many publishes reached the broker
+func (f *fakePaho) attempts() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.published) + f.rejected
+}
+
+func TestBreakerOpensAfterFailures(t *testing.T) {
+	client, paho, _ := newBrokenClient(Breaker{Failures: 3, Cooldown: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		if err := client.Publish("order/created", map[string]int{"id": i}); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("publish %d err = %v, want the broker's error", i+1, err)
+		}
+	}
+	if got := client.BreakerState(); got != breakerOpen {
+		t.Fatalf("state = %q, want open", got)
+	}
+
+	// While open, publishes fail right away without reaching the broker
+	if err := client.Publish("order/created", map[string]int{"id": 4}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("err = %v, want ErrCircuitOpen", err)
+	}
+	if got := paho.attempts(); got != 3 {
+		t.Errorf("broker saw %d publishes, want 3", got)
+	}
+	if stats := client.Stats()["order/created"]; stats.Attempted != 4 || stats.Failed != 4 {
+		t.Errorf("stats = %+v, want 4 attempts and 4 failures", stats)
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	client, paho, _ := newBrokenClient(Breaker{Failures: 2, Cooldown: time.Minute})
+
+	client.Publish("order/created", 1)
+	paho.publishErr = nil
+	client.Publish("order/created", 2)
+	paho.publishErr = errors.New("broker overloaded")
+	client.Publish("order/created", 3)
+
+	// Only one failure in a row, so still closed
+	if got := client.BreakerState(); got != breakerClosed {
+		t.Errorf("state = %q, want closed", got)
+	}
+}
+
+func TestBreakerRecovers(t *testing.T) {
+	client, paho, clock := newBrokenClient(Breaker{Failures: 1, Cooldown: time.Minute})
+	client.Publish("order/created", 1)
+
+	clock.Advance(59 * time.Second)
+	if err := client.Publish("order/created", 2); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err before the cooldown = %v, want ErrCircuitOpen", err)
+	}
+
+	// After the cooldown a probe goes out; it fails, so the cooldown starts again
+	clock.Advance(time.Second)
+	if err := client.Publish("order/created", 3); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("probe err = %v, want the broker's error", err)
+	}
+	if err := client.Publish("order/created", 4); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err after a failed probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// The next probe works and publishing goes back to normal
+	paho.publishErr = nil
+	clock.Advance(time.Minute)
+	if err := client.Publish("order/created", 5); err != nil {
+		t.Fatalf("probe err = %v, want nil", err)
+	}
+	if got := client.BreakerState(); got != breakerClosed {
+		t.Errorf("state = %q, want closed", got)
+	}
+	if err := client.Publish("order/created", 6); err != nil {
+		t.Errorf("err after recovery = %v, want nil", err)
+	}
+	if got := paho.messages(); got != 2 {
+		t.Errorf("published %d messages, want 2", got)
+	}
+}
+
+func TestBreakerHalfOpenAllowsOneProbe(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	b := newCircuitBreaker(Breaker{Failures: 1, Cooldown: time.Minute})
+	b.now = clock.Now
+
+	b.allow()
+	b.record(false)
+	clock.Advance(time.Minute)
+
+	if !b.allow() {
+		t.Fatal("probe not allowed after the cooldown")
+	}
+	if got := b.State(); got != breakerHalfOpen {
+		t.Errorf("state = %q, want half-open", got)
+	}
+	if b.allow() {
+		t.Error("a second publish was allowed while the probe runs")
+	}
+}
+
+func TestBreakerDropWhenOpen(t *testing.T) {
+	client, _, _ := newBrokenClient(Breaker{Failures: 1, Cooldown: time.Minute, DropWhenOpen: true})
+	client.Publish("order/created", 1)
+
+	if err := client.Publish("order/created", 2); err != nil {
+		t.Errorf("Publish err = %v, want nil (dropped)", err)
+	}
+
+	// The outbox must never lose events, so Strict still reports the open breaker
+	if err := client.Strict().Publish("order/created", 3); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Strict().Publish err = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestBreakerOff(t *testing.T) {
+	client, paho, _ := newBrokenClient(Breaker{})
+
+	for i := 0; i < 10; i++ {
+		if err := client.Publish("order/created", i); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("publish %d err = ErrCircuitOpen with the breaker off", i+1)
+		}
+	}
+	if got := paho.attempts(); got != 10 {
+		t.Errorf("broker saw %d publishes, want 10", got)
+	}
+	if got := client.BreakerState(); got != breakerClosed {
+		t.Errorf("state = %q, want closed", got)
+	}
+}
@@ -6,20 +6,70 @@ package mqtt
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 )
 
+// ErrNotConnected is returned when publishing while the broker is unreachable
+// The outbox saves such events and publishes them once we're connected again
+var ErrNotConnected = errors.New("not connected to the MQTT broker")
+
+// publishTimeout is how long we wait for the broker to confirm a publish
+const publishTimeout = 10 * time.Second
+
+// connectTimeout is how long a connection attempt may take, and how long we
+// wait at startup for an optional broker before going on without it
+const connectTimeout = 10 * time.Second
+
+// connectRetryInterval is how often we try to reach a broker that is down at startup
+const connectRetryInterval = 10 * time.Second
+
 // Client wraps the MQTT client with our custom methods
 type Client struct {
 	client MQTT.Client
+
+	// Our subscriptions, so they can be made again after every (re)connect
+	// With a clean session the broker forgets them when the connection drops
+	subsMu        sync.Mutex
+	subscriptions map[string]MQTT.MessageHandler
+
+	// Publish counters per topic, so we can see how reliable MQTT is
+	// The mutex protects the map because handlers publish from many goroutines
+	statsMu sync.Mutex
+	stats   map[string]*TopicStats
+
+	// Payloads at least this big are gzipped before publishing; 0 turns compression off
+	compressMinBytes int
+
+	breaker *circuitBreaker // Stops publishing for a while after repeated failures
+}
+
+// TopicStats counts publish outcomes for a single topic
+type TopicStats struct {
+	Attempted int64 `json:"attempted"`
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
 }
 
 // NewClient creates a new MQTT client and connects to the broker
-func NewClient(brokerURL string) (*Client, error) {
+// Payloads of compressMinBytes or more are gzipped (0 never compresses);
+// only turn this on if every subscriber can unzip them like we do
+// If required is false, an unreachable broker isn't an error: we log a
+// warning and keep trying in the background, and until then Publish
+// returns ErrNotConnected (the outbox keeps those events for later)
+// breaker says when to stop trying to publish to a failing broker
+func NewClient(brokerURL string, compressMinBytes int, required bool, breaker Breaker) (*Client, error) {
+	return newClient(brokerURL, compressMinBytes, required, breaker, connectTimeout)
+}
+
+// newClient is NewClient with the connect timeout as a parameter, so tests
+// don't have to wait ten seconds for a broker that isn't there
+func newClient(brokerURL string, compressMinBytes int, required bool, breaker Breaker, timeout time.Duration) (*Client, error) {
 	// Generate a random client ID
 	// Each MQTT client needs a unique ID
 	clientID := generateClientID()
@@ -30,9 +80,22 @@ func NewClient(brokerURL string) (*Client, error) {
 	opts.SetClientID(clientID)  // Our unique ID
 	opts.SetCleanSession(true)  // Start fresh each time
 	opts.SetAutoReconnect(true) // Reconnect if connection drops
-	opts.SetConnectTimeout(10 * time.Second)
+	opts.SetConnectTimeout(timeout)
 	opts.SetKeepAlive(30 * time.Second)
 
+	// Keep trying in the background if the broker is down at startup
+	if !required {
+		opts.SetConnectRetry(true)
+		opts.SetConnectRetryInterval(connectRetryInterval)
+	}
+
+	c := &Client{
+		subscriptions:    make(map[string]MQTT.MessageHandler),
+		stats:            make(map[string]*TopicStats),
+		compressMinBytes: compressMinBytes,
+		breaker:          newCircuitBreaker(breaker),
+	}
+
 	// Set up connection handlers
 	opts.SetConnectionLostHandler(func(client MQTT.Client, err error) {
 		log.Printf("MQTT connection lost: %v", err)
@@ -40,48 +103,228 @@ func NewClient(brokerURL string) (*Client, error) {
 
 	opts.SetOnConnectHandler(func(client MQTT.Client) {
 		log.Println("MQTT client connected")
+		c.resubscribe()
 	})
 
 	// Create the client
-	client := MQTT.NewClient(opts)
+	c.client = MQTT.NewClient(opts)
 
 	// Connect to the broker
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
+	token := c.client.Connect()
+	if required {
+		if token.Wait() && token.Error() != nil {
+			return nil, fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
+		}
+		return c, nil
 	}
 
-	return &Client{client: client}, nil
+	// With connect retry, the token only finishes once we're connected
+	if !token.WaitTimeout(opts.ConnectTimeout) {
+		log.Printf("WARNING: MQTT broker %s is unavailable, starting without it and retrying every %s", brokerURL, connectRetryInterval)
+	}
+	return c, nil
+}
+
+// Connected reports whether we're connected to the broker right now
+func (c *Client) Connected() bool {
+	return c.client.IsConnectionOpen()
+}
+
+// BreakerState returns the state of the publish circuit breaker:
+// "closed" (publishing normally), "open" (failing fast) or "half-open" (probing)
+func (c *Client) BreakerState() string {
+	return c.breaker.State()
 }
 
 // Publish sends a message to an MQTT topic
 // This is how we tell other parts of the system that something happened
 func (c *Client) Publish(topic string, payload interface{}) error {
+	return c.publish(topic, payload, c.breaker.settings.DropWhenOpen)
+}
+
+// Strict returns a publisher that never drops messages, for draining the outbox
+// The outbox deletes every event that published without an error, so an event
+// dropped while the breaker is open would be lost for good
+func (c *Client) Strict() *StrictPublisher {
+	return &StrictPublisher{client: c}
+}
+
+// StrictPublisher publishes through a Client, ignoring Breaker.DropWhenOpen
+type StrictPublisher struct {
+	client *Client
+}
+
+// Publish sends a message to an MQTT topic, returning ErrCircuitOpen while the breaker is open
+func (p *StrictPublisher) Publish(topic string, payload interface{}) error {
+	return p.client.publish(topic, payload, false)
+}
+
+// publish sends a message to an MQTT topic
+// With dropWhenOpen, messages are dropped (and nil returned) while the breaker is open
+func (c *Client) publish(topic string, payload interface{}, dropWhenOpen bool) error {
+	c.recordAttempt(topic)
+
+	// Fail right away instead of waiting for a connection that may take long to come back
+	if !c.Connected() {
+		c.recordResult(topic, false)
+		return ErrNotConnected
+	}
+
 	// Convert the payload to JSON
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
+		c.recordResult(topic, false)
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	// Big payloads (like inventory syncs) are sent gzipped to save bandwidth
+	message := jsonData
+	if c.compressMinBytes > 0 && len(jsonData) >= c.compressMinBytes {
+		message, err = compressPayload(jsonData)
+		if err != nil {
+			c.recordResult(topic, false)
+			return err
+		}
+	}
+
+	// After repeated failures, don't make the caller wait for yet another timeout
+	if !c.breaker.allow() {
+		c.recordResult(topic, false)
+		if dropWhenOpen {
+			log.Printf("Dropped message to topic %s: %v", topic, ErrCircuitOpen)
+			return nil
+		}
+		return ErrCircuitOpen
+	}
+
 	// Publish the message
 	// QoS 1 means "at least once delivery" - the message will be delivered at least once
 	// false means "not retained" - the broker won't save this message for future subscribers
-	token := c.client.Publish(topic, 1, false, jsonData)
+	token := c.client.Publish(topic, 1, false, message)
 
-	// Wait for the publish to complete
-	if token.Wait() && token.Error() != nil {
+	// Wait for the publish to complete, but not forever
+	if !token.WaitTimeout(publishTimeout) {
+		c.breaker.record(false)
+		c.recordResult(topic, false)
+		return fmt.Errorf("failed to publish message: no answer from the broker within %s", publishTimeout)
+	}
+	if token.Error() != nil {
+		c.breaker.record(false)
+		c.recordResult(topic, false)
 		return fmt.Errorf("failed to publish message: %w", token.Error())
 	}
 
+	c.breaker.record(true)
+	c.recordResult(topic, true)
 	log.Printf("Published message to topic %s: %s", topic, string(jsonData))
 	return nil
 }
 
+// Stats returns a snapshot of the publish counters, keyed by topic
+// The returned map is a copy, so callers can read it without locking
+func (c *Client) Stats() map[string]TopicStats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	snapshot := make(map[string]TopicStats, len(c.stats))
+	for topic, stats := range c.stats {
+		snapshot[topic] = *stats
+	}
+	return snapshot
+}
+
+// recordAttempt counts a publish attempt for a topic
+func (c *Client) recordAttempt(topic string) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	c.topicStats(topic).Attempted++
+}
+
+// recordResult counts whether a publish to a topic succeeded or failed
+func (c *Client) recordResult(topic string, succeeded bool) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	if succeeded {
+		c.topicStats(topic).Succeeded++
+	} else {
+		c.topicStats(topic).Failed++
+	}
+}
+
+// topicStats returns the counters for a topic, creating them if needed
+// Callers must hold statsMu
+func (c *Client) topicStats(topic string) *TopicStats {
+	stats, ok := c.stats[topic]
+	if !ok {
+		stats = &TopicStats{}
+		c.stats[topic] = stats
+	}
+	return stats
+}
+
 // Subscribe listens for messages on an MQTT topic
 // When a message arrives, it calls the provided handler function
+// The subscription is made again after every reconnect; while we're not
+// connected, it's only remembered and made once the connection is up
 func (c *Client) Subscribe(topic string, handler MQTT.MessageHandler) error {
+	c.subsMu.Lock()
+	c.subscriptions[topic] = handler
+	c.subsMu.Unlock()
+
+	if !c.Connected() {
+		log.Printf("Not connected to MQTT yet, will subscribe to %s once connected", topic)
+		return nil
+	}
+	return c.subscribe(topic, handler)
+}
+
+// UnsubscribeAll stops all our subscriptions, also after a reconnect
+// Call it on shutdown, so no new messages come in while we finish the running ones
+func (c *Client) UnsubscribeAll() {
+	c.subsMu.Lock()
+	topics := make([]string, 0, len(c.subscriptions))
+	for topic := range c.subscriptions {
+		topics = append(topics, topic)
+	}
+	c.subscriptions = make(map[string]MQTT.MessageHandler)
+	c.subsMu.Unlock()
+
+	if len(topics) == 0 || !c.Connected() {
+		return
+	}
+	if token := c.client.Unsubscribe(topics...); token.Wait() && token.Error() != nil {
+		log.Printf("Failed to unsubscribe: %v", token.Error())
+	}
+}
+
+// resubscribe makes all our subscriptions again (after a connect or reconnect)
+func (c *Client) resubscribe() {
+	c.subsMu.Lock()
+	subscriptions := make(map[string]MQTT.MessageHandler, len(c.subscriptions))
+	for topic, handler := range c.subscriptions {
+		subscriptions[topic] = handler
+	}
+	c.subsMu.Unlock()
+
+	// Subscribing waits for the broker, which must not block paho's connect
+	// callback - so it runs in its own goroutine
+	go func() {
+		for topic, handler := range subscriptions {
+			if err := c.subscribe(topic, handler); err != nil {
+				log.Printf("Failed to resubscribe: %v", err)
+			}
+		}
+	}()
+}
+
+// subscribe makes one subscription at the broker
+func (c *Client) subscribe(topic string, handler MQTT.MessageHandler) error {
 	// Subscribe to the topic
 	// QoS 1 means we want reliable delivery
-	token := c.client.Subscribe(topic, 1, handler)
+	// Compressed payloads are unzipped before the handler sees them
+	token := c.client.Subscribe(topic, 1, decompressing(handler))
 
 	// Wait for the subscription to complete
 	if token.Wait() && token.Error() != nil {
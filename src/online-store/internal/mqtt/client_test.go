@@ -0,0 +1,104 @@
+// internal/mqtt/client_test.go
+// Tests for publishing through Client
+
+package mqtt
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestPublishStats(t *testing.T) {
+	client, paho := newTestClient(0, Breaker{})
+
+	for i := 0; i < 2; i++ {
+		if err := client.Publish("order/created", map[string]int{"order_id": i}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	paho.publishErr = errors.New("broker overloaded")
+	if err := client.Publish("order/created", "x"); err == nil {
+		t.Fatal("Publish succeeded with a failing broker")
+	}
+
+	paho.publishErr = nil
+	paho.disconnected = true
+	if err := client.Publish("user/login", "x"); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("err = %v, want ErrNotConnected", err)
+	}
+
+	want := map[string]TopicStats{
+		"order/created": {Attempted: 3, Succeeded: 2, Failed: 1},
+		"user/login":    {Attempted: 1, Failed: 1},
+	}
+	if got := client.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestStatsIsACopy(t *testing.T) {
+	client, _ := newTestClient(0, Breaker{})
+	if err := client.Publish("order/created", "x"); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	stats := client.Stats()
+	stats["order/created"] = TopicStats{}
+	if got := client.Stats()["order/created"].Succeeded; got != 1 {
+		t.Errorf("Succeeded = %d after changing the snapshot, want 1", got)
+	}
+}
+
+// unreachableBroker returns the URL of a broker that refuses connections
+func unreachableBroker(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close() // Nothing listens there anymore
+	return "tcp://" + addr
+}
+
+func TestNewClientWithoutBrokerRequired(t *testing.T) {
+	broker := unreachableBroker(t)
+	if _, err := newClient(broker, 0, true, Breaker{}, 200*time.Millisecond); err == nil {
+		t.Fatal("NewClient succeeded without a broker, want an error when it's required")
+	}
+}
+
+func TestNewClientWithoutBrokerOptional(t *testing.T) {
+	start := time.Now()
+	client, err := newClient(unreachableBroker(t), 0, false, Breaker{}, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewClient: %v, want to start without the broker", err)
+	}
+	defer client.Disconnect(0)
+
+	// We only wait the connect timeout, not until the broker is back
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("NewClient took %s", elapsed)
+	}
+	if client.Connected() {
+		t.Error("Connected() = true without a broker")
+	}
+
+	// Publishing fails fast, so the outbox can keep the event
+	if err := client.Publish("order/created", "x"); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Publish: err = %v, want ErrNotConnected", err)
+	}
+	// Subscriptions are remembered for when we connect
+	if err := client.Subscribe("inventory/sync", func(MQTT.Client, MQTT.Message) {}); err != nil {
+		t.Errorf("Subscribe: %v, want it remembered for later", err)
+	}
+	if len(client.subscriptions) != 1 {
+		t.Errorf("%d remembered subscriptions, want 1", len(client.subscriptions))
+	}
+}
@@ -0,0 +1,87 @@
+// internal/mqtt/compress.go
+// This file gzips large MQTT payloads and unzips them again on arrival
+// MQTT 3.1.1 (what our client speaks) has no message properties, so we mark
+// compressed payloads by their content: gzip data always starts with the bytes
+// 0x1f 0x8b, and a JSON document never does
+
+package mqtt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// gzipMagic is how every gzip stream begins
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressPayload gzips a payload
+func compressPayload(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress payload: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress payload: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// isCompressed reports whether a payload was gzipped by compressPayload
+func isCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic)
+}
+
+// decompressPayload returns the original payload
+// Payloads that aren't compressed are returned unchanged
+func decompressPayload(data []byte) ([]byte, error) {
+	if !isCompressed(data) {
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	defer reader.Close()
+
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	return plain, nil
+}
+
+// decompressedMessage is an MQTT message whose payload was already unzipped
+// Embedding MQTT.Message keeps all other methods (Topic, Ack, ...) as they were
+type decompressedMessage struct {
+	MQTT.Message
+	payload []byte
+}
+
+// Payload returns the unzipped payload
+func (m *decompressedMessage) Payload() []byte {
+	return m.payload
+}
+
+// decompressing wraps a message handler so it always sees plain JSON
+func decompressing(handler MQTT.MessageHandler) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		if !isCompressed(msg.Payload()) {
+			handler(client, msg)
+			return
+		}
+
+		plain, err := decompressPayload(msg.Payload())
+		if err != nil {
+			log.Printf("Dropping message on %s: %v", msg.Topic(), err)
+			return
+		}
+		handler(client, &decompressedMessage{Message: msg, payload: plain})
+	}
+}
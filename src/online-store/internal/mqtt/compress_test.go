@@ -0,0 +1,95 @@
+// internal/mqtt/compress_test.go
+// Tests for gzipping large payloads and unzipping them on arrival
+
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"online-store/internal/models"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// largeSync is an inventory sync big enough to be worth compressing
+func largeSync() []models.StockUpdate {
+	updates := make([]models.StockUpdate, 500)
+	for i := range updates {
+		updates[i] = models.StockUpdate{ProductID: i + 1, Stock: i * 3}
+	}
+	return updates
+}
+
+func TestPublishCompressesLargePayloads(t *testing.T) {
+	client, paho := newTestClient(1024, Breaker{})
+	updates := largeSync()
+
+	if err := client.Publish("inventory/sync", updates); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	sent := paho.published[0].Payload
+	if !isCompressed(sent) {
+		t.Fatal("large payload wasn't compressed")
+	}
+
+	plain, _ := json.Marshal(updates)
+	if len(sent) >= len(plain) {
+		t.Errorf("compressed payload is %d bytes, the JSON only %d", len(sent), len(plain))
+	}
+
+	// Subscribers get the JSON back
+	var received []byte
+	handler := decompressing(func(_ MQTT.Client, msg MQTT.Message) {
+		received = msg.Payload()
+	})
+	handler(nil, &fakeMessage{topic: "inventory/sync", payload: sent})
+	if !bytes.Equal(received, plain) {
+		t.Errorf("handler got %q, want the original JSON", received)
+	}
+}
+
+func TestPublishLeavesSmallPayloads(t *testing.T) {
+	tests := []struct {
+		name             string
+		compressMinBytes int
+	}{
+		{"below the threshold", 1024},
+		{"compression off", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, paho := newTestClient(tt.compressMinBytes, Breaker{})
+			if err := client.Publish("orders/created", map[string]int{"order_id": 1}); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+			if got := string(paho.published[0].Payload); got != `{"order_id":1}` {
+				t.Errorf("payload = %q, want plain JSON", got)
+			}
+		})
+	}
+}
+
+func TestDecompressingPassesPlainMessages(t *testing.T) {
+	var received string
+	handler := decompressing(func(_ MQTT.Client, msg MQTT.Message) {
+		received = string(msg.Payload())
+	})
+	handler(nil, newMessage("orders/created", `{"order_id":1}`))
+	if received != `{"order_id":1}` {
+		t.Errorf("handler got %q, want the message unchanged", received)
+	}
+}
+
+func TestDecompressingDropsCorruptMessages(t *testing.T) {
+	called := false
+	handler := decompressing(func(MQTT.Client, MQTT.Message) { called = true })
+
+	// Starts like gzip, but isn't
+	handler(nil, &fakeMessage{topic: "inventory/sync", payload: []byte{0x1f, 0x8b, 0x00, 0x01}})
+	if called {
+		t.Error("handler called with a corrupt payload")
+	}
+}
@@ -0,0 +1,54 @@
+// internal/mqtt/deadletter.go
+// This file contains dead-lettering: parking messages we could not process
+
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"online-store/internal/services"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// deadLetterPrefix is put in front of a message's topic to get its dead letter topic,
+// e.g. a bad "shipping/update" ends up on "deadletter/shipping/update"
+const deadLetterPrefix = "deadletter/"
+
+// deadLetterMessage is what we publish for a message we gave up on
+type deadLetterMessage struct {
+	Topic   string `json:"topic"`   // Where the message originally came from
+	Payload string `json:"payload"` // The message exactly as we received it
+	Reason  string `json:"reason"`  // Why we couldn't process it
+}
+
+// deadLetter publishes a message we can't process to the dead letter topic,
+// where it can be inspected (and replayed once fixed) instead of being lost
+func deadLetter(client MQTT.Client, msg MQTT.Message, reason string) {
+	payload, err := json.Marshal(deadLetterMessage{
+		Topic:   msg.Topic(),
+		Payload: string(msg.Payload()),
+		Reason:  reason,
+	})
+	if err != nil {
+		log.Printf("Failed to encode dead letter for %s: %v", msg.Topic(), err)
+		return
+	}
+
+	token := client.Publish(deadLetterPrefix+msg.Topic(), 1, false, payload)
+	if token.Wait() && token.Error() != nil {
+		log.Printf("Failed to dead-letter message from %s: %v", msg.Topic(), token.Error())
+	}
+}
+
+// isPermanentFailure reports whether processing failed because of the message
+// itself, so trying the same message again can never work
+// Other errors (like the database being down) are worth a retry instead
+func isPermanentFailure(err error) bool {
+	var validationErr *services.ValidationError
+	return errors.As(err, &validationErr) ||
+		errors.Is(err, services.ErrInvalidStatusTransition) ||
+		errors.Is(err, services.ErrOrderNotFound)
+}
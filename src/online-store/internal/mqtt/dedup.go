@@ -0,0 +1,86 @@
+// internal/mqtt/dedup.go
+// This file remembers which MQTT messages we already processed
+// QoS 1 is "at least once", so the broker may deliver the same message twice
+
+package mqtt
+
+import (
+	"sync"
+	"time"
+)
+
+// How many message IDs we remember, and for how long
+// Redeliveries normally arrive within seconds, so these are generous
+const (
+	maxProcessedMessages = 10000
+	processedMessageTTL  = time.Hour
+)
+
+// processedMessages is a bounded set of message IDs with an expiry time
+// When the set is full, the oldest IDs are forgotten first
+type processedMessages struct {
+	mu      sync.Mutex
+	seen    map[string]time.Time // message ID -> when it was claimed
+	order   []string             // message IDs, oldest first
+	maxSize int
+	ttl     time.Duration
+	now     func() time.Time // replaceable clock
+}
+
+// newProcessedMessages creates an empty store
+func newProcessedMessages(maxSize int, ttl time.Duration) *processedMessages {
+	return &processedMessages{
+		seen:    make(map[string]time.Time),
+		maxSize: maxSize,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// claim marks a message ID as being processed
+// It returns false if the ID was already claimed, meaning the message is a duplicate
+// Claiming (instead of check-then-mark) stops two concurrent deliveries from both running
+func (p *processedMessages) claim(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	p.evict(now)
+
+	if _, ok := p.seen[id]; ok {
+		return false
+	}
+
+	p.seen[id] = now
+	p.order = append(p.order, id)
+	return true
+}
+
+// release forgets a message ID, so a redelivery is processed again
+// Handlers call this when processing failed
+func (p *processedMessages) release(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.seen, id)
+	for i, claimed := range p.order {
+		if claimed == id {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// evict drops expired IDs and, if the store is full, the oldest ones
+// Callers must hold mu
+func (p *processedMessages) evict(now time.Time) {
+	for len(p.order) > 0 {
+		oldest := p.order[0]
+		expired := now.Sub(p.seen[oldest]) >= p.ttl
+		if !expired && len(p.order) < p.maxSize {
+			return
+		}
+		delete(p.seen, oldest)
+		p.order = p.order[1:]
+	}
+}
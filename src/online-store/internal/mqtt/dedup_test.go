@@ -0,0 +1,90 @@
+// internal/mqtt/dedup_test.go
+// Tests for remembering processed message IDs
+
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProcessedMessagesClaim(t *testing.T) {
+	p := newProcessedMessages(10, time.Hour)
+
+	if !p.claim("a") {
+		t.Fatal("first claim of a failed")
+	}
+	if p.claim("a") {
+		t.Error("second claim of a succeeded")
+	}
+
+	// A failed message is released, so its redelivery runs again
+	p.release("a")
+	if !p.claim("a") {
+		t.Error("claim after release failed")
+	}
+}
+
+func TestProcessedMessagesExpire(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := newProcessedMessages(10, time.Minute)
+	p.now = func() time.Time { return now }
+
+	p.claim("a")
+	now = now.Add(time.Minute)
+	if !p.claim("a") {
+		t.Error("claim after the TTL failed")
+	}
+}
+
+func TestProcessedMessagesForgetOldestWhenFull(t *testing.T) {
+	p := newProcessedMessages(2, time.Hour)
+	p.claim("a")
+	p.claim("b")
+	p.claim("c")
+
+	if len(p.seen) > 2 {
+		t.Errorf("%d IDs kept, want at most 2", len(p.seen))
+	}
+	if _, ok := p.seen["a"]; ok {
+		t.Error("the oldest ID is still remembered")
+	}
+	if p.claim("c") {
+		t.Error("the newest ID was forgotten")
+	}
+}
+
+func TestHandlersSkipDuplicates(t *testing.T) {
+	h, products, orders := newTestHandlers()
+	payment := newMessage("payment/confirmed", `{"message_id": "m-1", "order_id": 7, "status": "paid"}`)
+
+	h.handlePaymentConfirmed(nil, payment)
+	h.handlePaymentConfirmed(nil, payment)
+	if len(orders.statuses) != 1 {
+		t.Errorf("payment applied %d times, want 1", len(orders.statuses))
+	}
+
+	// Messages without an ID can't be deduplicated
+	update := newMessage("inventory/update", `{"product_id": 1, "new_stock": 5}`)
+	h.handleInventoryUpdate(nil, update)
+	h.handleInventoryUpdate(nil, update)
+	if len(products.stock) != 2 {
+		t.Errorf("update without ID applied %d times, want 2", len(products.stock))
+	}
+}
+
+func TestHandlersRetryFailedMessages(t *testing.T) {
+	h, _, orders := newTestHandlers()
+	payment := newMessage("payment/confirmed", `{"message_id": "m-1", "order_id": 7, "status": "paid"}`)
+
+	orders.err = errors.New("database down")
+	h.handlePaymentConfirmed(nil, payment)
+
+	// The broker redelivers it, and this time it works
+	orders.err = nil
+	h.handlePaymentConfirmed(nil, payment)
+	if len(orders.statuses) != 1 {
+		t.Errorf("payment applied %d times, want 1", len(orders.statuses))
+	}
+}
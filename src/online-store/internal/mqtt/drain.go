@@ -0,0 +1,63 @@
+// internal/mqtt/drain.go
+// This file lets message handlers that are still running finish on shutdown
+// Paho runs handlers in their own goroutines, so without this a handler could
+// be cut off halfway through its database work when the app exits
+
+package mqtt
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// handlerTracker counts the message handlers that are running right now
+type handlerTracker struct {
+	mu       sync.Mutex // Protects draining, and makes Add and Wait never overlap
+	draining bool       // Set by Drain - no new handlers start after that
+	running  sync.WaitGroup
+}
+
+// track wraps a message handler so Drain can wait for it
+// Messages that arrive while draining are skipped, and so lost: paho acks a
+// message as soon as its handler returns, so the broker won't send it again
+// (missed payment confirmations are picked up by reconciliation on the next start)
+func (t *handlerTracker) track(handler MQTT.MessageHandler) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		t.mu.Lock()
+		if t.draining {
+			t.mu.Unlock()
+			log.Printf("Shutting down, skipping message on %s", msg.Topic())
+			return
+		}
+		t.running.Add(1)
+		t.mu.Unlock()
+
+		defer t.running.Done()
+		handler(client, msg)
+	}
+}
+
+// Drain stops new handlers from starting and waits until the running ones
+// are done, or timeout has passed
+// Returns false if some handlers were still running when it gave up
+func (t *handlerTracker) Drain(timeout time.Duration) bool {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
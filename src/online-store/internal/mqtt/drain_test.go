@@ -0,0 +1,106 @@
+// internal/mqtt/drain_test.go
+// Tests for letting running handlers finish on shutdown
+
+package mqtt
+
+import (
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// blockingHandler is a message handler that runs until release is closed
+type blockingHandler struct {
+	entered  chan struct{}
+	release  chan struct{}
+	finished int32
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{entered: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (h *blockingHandler) handle(client MQTT.Client, msg MQTT.Message) {
+	h.entered <- struct{}{}
+	<-h.release
+	atomic.AddInt32(&h.finished, 1)
+}
+
+func TestDrainWaitsForRunningHandler(t *testing.T) {
+	var tracker handlerTracker
+	h := newBlockingHandler()
+	go tracker.track(h.handle)(nil, newMessage("payment/confirmed", `{}`))
+	<-h.entered
+
+	drained := make(chan bool)
+	go func() { drained <- tracker.Drain(time.Second) }()
+
+	// Drain must not return while the handler is still working
+	select {
+	case <-drained:
+		t.Fatal("Drain returned while a handler was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(h.release)
+	if !<-drained {
+		t.Error("Drain = false, want true")
+	}
+	if atomic.LoadInt32(&h.finished) != 1 {
+		t.Error("handler didn't finish")
+	}
+}
+
+func TestDrainTimesOut(t *testing.T) {
+	var tracker handlerTracker
+	h := newBlockingHandler()
+	defer close(h.release)
+	go tracker.track(h.handle)(nil, newMessage("payment/confirmed", `{}`))
+	<-h.entered
+
+	if tracker.Drain(10 * time.Millisecond) {
+		t.Error("Drain = true with a handler still running, want false")
+	}
+}
+
+func TestDrainWithNothingRunning(t *testing.T) {
+	var tracker handlerTracker
+	if !tracker.Drain(time.Second) {
+		t.Error("Drain = false, want true")
+	}
+}
+
+func TestDrainSkipsNewMessages(t *testing.T) {
+	var tracker handlerTracker
+	var calls int32
+	handler := tracker.track(func(MQTT.Client, MQTT.Message) { atomic.AddInt32(&calls, 1) })
+
+	tracker.Drain(time.Second)
+	handler(nil, newMessage("payment/confirmed", `{}`))
+
+	if calls != 0 {
+		t.Errorf("handler ran %d times after Drain, want 0", calls)
+	}
+}
+
+func TestUnsubscribeAll(t *testing.T) {
+	client, paho := newTestClient(0, Breaker{})
+	client.Subscribe("payment/confirmed", func(MQTT.Client, MQTT.Message) {})
+	client.Subscribe("inventory/update", func(MQTT.Client, MQTT.Message) {})
+
+	client.UnsubscribeAll()
+
+	sort.Strings(paho.unsubscribed)
+	if len(paho.unsubscribed) != 2 || paho.unsubscribed[0] != "inventory/update" || paho.unsubscribed[1] != "payment/confirmed" {
+		t.Errorf("unsubscribed = %v, want inventory/update and payment/confirmed", paho.unsubscribed)
+	}
+
+	// A reconnect must not bring the subscriptions back
+	client.resubscribe()
+	if len(paho.subscribed) != 2 {
+		t.Errorf("subscribed = %v after resubscribe, want only the first 2", paho.subscribed)
+	}
+}
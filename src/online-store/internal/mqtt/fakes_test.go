@@ -0,0 +1,192 @@
+// internal/mqtt/fakes_test.go
+// A fake paho client, so Client can be tested without a broker
+
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	"online-store/internal/models"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeToken is a token that is already done
+type fakeToken struct {
+	err error
+}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Error() error                   { return t.err }
+
+func (t *fakeToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// fakePaho records publishes instead of sending them
+// Methods Client doesn't use aren't implemented and panic when called
+type fakePaho struct {
+	MQTT.Client
+
+	mu           sync.Mutex
+	disconnected bool  // IsConnectionOpen returns false
+	publishErr   error // Every publish fails with this when set
+	rejected     int   // Publishes failed with publishErr
+	published    []fakePublish
+	subscribed   []string // Topic filters, in the order they were subscribed
+	unsubscribed []string
+}
+
+// fakePublish is one message given to fakePaho
+type fakePublish struct {
+	Topic   string
+	Payload []byte
+}
+
+func (f *fakePaho) IsConnectionOpen() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.disconnected
+}
+
+func (f *fakePaho) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.publishErr != nil {
+		f.rejected++
+		return &fakeToken{err: f.publishErr}
+	}
+	f.published = append(f.published, fakePublish{Topic: topic, Payload: payload.([]byte)})
+	return &fakeToken{}
+}
+
+func (f *fakePaho) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) MQTT.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.subscribed = append(f.subscribed, topic)
+	return &fakeToken{}
+}
+
+func (f *fakePaho) Unsubscribe(topics ...string) MQTT.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.unsubscribed = append(f.unsubscribed, topics...)
+	return &fakeToken{}
+}
+
+// messages returns how many messages were published
+func (f *fakePaho) messages() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.published)
+}
+
+// newTestClient returns a Client publishing to a fakePaho
+func newTestClient(compressMinBytes int, breaker Breaker) (*Client, *fakePaho) {
+	paho := &fakePaho{}
+	return &Client{
+		client:           paho,
+		subscriptions:    make(map[string]MQTT.MessageHandler),
+		stats:            make(map[string]*TopicStats),
+		compressMinBytes: compressMinBytes,
+		breaker:          newCircuitBreaker(breaker),
+	}, paho
+}
+
+// fakeMessage is a message as paho hands it to our handlers
+type fakeMessage struct {
+	MQTT.Message
+	topic   string
+	payload []byte
+}
+
+func (m *fakeMessage) Topic() string   { return m.topic }
+func (m *fakeMessage) Payload() []byte { return m.payload }
+
+// newMessage returns a message on topic with a JSON payload
+func newMessage(topic, payload string) *fakeMessage {
+	return &fakeMessage{topic: topic, payload: []byte(payload)}
+}
+
+// fakeProductService records the stock changes the handlers make
+type fakeProductService struct {
+	mu        sync.Mutex
+	err       error // Returned by every change when set
+	stock     []models.StockUpdate
+	bulkCalls [][]models.StockUpdate
+}
+
+func (s *fakeProductService) UpdateStock(productID, newStock int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.stock = append(s.stock, models.StockUpdate{ProductID: productID, Stock: newStock})
+	return nil
+}
+
+func (s *fakeProductService) BulkUpdateStock(updates []models.StockUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.bulkCalls = append(s.bulkCalls, updates)
+	return nil
+}
+
+func (s *fakeProductService) GetProduct(id int) (*models.Product, error) {
+	return &models.Product{ID: id}, nil
+}
+
+// fakeOrderService records the order changes the handlers make
+type fakeOrderService struct {
+	mu        sync.Mutex
+	err       error // Returned by every change when set
+	statuses  []int // Orders UpdateOrderStatus was called for
+	shipments []models.ShipmentUpdate
+	flags     []models.RiskFlag
+}
+
+func (s *fakeOrderService) UpdateOrderStatus(actorID, orderID int, status models.OrderStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.statuses = append(s.statuses, orderID)
+	return nil
+}
+
+func (s *fakeOrderService) UpdateShipment(actorID int, update models.ShipmentUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.shipments = append(s.shipments, update)
+	return nil
+}
+
+func (s *fakeOrderService) FlagRisk(actorID int, flag models.RiskFlag) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return false, s.err
+	}
+	s.flags = append(s.flags, flag)
+	return true, nil
+}
@@ -6,6 +6,7 @@ package mqtt
 import (
 	"encoding/json"
 	"log"
+
 	"online-store/internal/models"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
@@ -15,39 +16,79 @@ import (
 type Handlers struct {
 	productService ProductService // Interface for product operations
 	orderService   OrderService   // Interface for order operations
+	processed      *processedMessages
+	shared         SharedSubscriptions // Which topics are load-balanced across our instances
+
+	handlerTracker // Running handlers, so shutdown can wait for them (see Drain)
 }
 
 // ProductService interface defines what product operations we need
 // Using interfaces makes testing easier and code more flexible
 type ProductService interface {
 	UpdateStock(productID, newStock int) error
+	BulkUpdateStock(updates []models.StockUpdate) error
 	GetProduct(id int) (*models.Product, error)
 }
 
 // OrderService interface defines what order operations we need
 type OrderService interface {
-	UpdateOrderStatus(orderID int, status string) error
+	UpdateOrderStatus(actorID, orderID int, status models.OrderStatus) error
+	UpdateShipment(actorID int, update models.ShipmentUpdate) error
+	FlagRisk(actorID int, flag models.RiskFlag) (bool, error)
 }
 
+// systemActor is the actor ID we pass for changes made by MQTT messages
+// rather than by a logged-in user (matches services.SystemActor)
+const systemActor = 0
+
 // NewHandlers creates a new MQTT handlers manager
-func NewHandlers(productService ProductService, orderService OrderService) *Handlers {
+// shared decides which topics are shared subscriptions (pass the zero value for none)
+func NewHandlers(productService ProductService, orderService OrderService, shared SharedSubscriptions) *Handlers {
 	return &Handlers{
 		productService: productService,
 		orderService:   orderService,
+		processed:      newProcessedMessages(maxProcessedMessages, processedMessageTTL),
+		shared:         shared,
+	}
+}
+
+// alreadyProcessed reports whether a message with this ID was handled before
+// Messages without an ID can't be deduplicated, so they are always processed
+// If it returns false, the caller must call h.processed.release(id) when it fails,
+// so the broker's redelivery gets another chance
+func (h *Handlers) alreadyProcessed(topic, messageID string) bool {
+	if messageID == "" {
+		return false
+	}
+	if !h.processed.claim(messageID) {
+		log.Printf("Skipping duplicate message %s on %s", messageID, topic)
+		return true
 	}
+	return false
 }
 
 // Subscribe sets up all our MQTT subscriptions
 // This is where we tell MQTT what topics we want to listen to
+// Every handler is tracked, so Drain can wait for it on shutdown
 func (h *Handlers) Subscribe(client *Client) {
+	// Topics configured as shared are subscribed as "$share/<group>/<topic>"
 	// Subscribe to inventory updates
-	client.Subscribe("inventory/update", h.handleInventoryUpdate)
+	client.Subscribe(h.shared.Filter("inventory/update"), h.track(h.handleInventoryUpdate))
+
+	// Subscribe to full inventory snapshots from warehouse systems
+	client.Subscribe(h.shared.Filter("inventory/sync"), h.track(h.handleInventorySync))
 
 	// Subscribe to payment confirmations
-	client.Subscribe("payment/confirmed", h.handlePaymentConfirmed)
+	client.Subscribe(h.shared.Filter("payment/confirmed"), h.track(h.handlePaymentConfirmed))
+
+	// Subscribe to tracking updates from shipping providers
+	client.Subscribe(h.shared.Filter("shipping/update"), h.track(h.handleShippingUpdate))
+
+	// Subscribe to risk scores from the fraud check
+	client.Subscribe(h.shared.Filter("risk/flag"), h.track(h.handleRiskFlag))
 
 	// Subscribe to stock alerts
-	client.Subscribe("inventory/low_stock", h.handleLowStockAlert)
+	client.Subscribe(h.shared.Filter("inventory/low_stock"), h.track(h.handleLowStockAlert))
 
 	log.Println("All MQTT subscriptions set up")
 }
@@ -58,8 +99,9 @@ func (h *Handlers) handleInventoryUpdate(client MQTT.Client, msg MQTT.Message) {
 
 	// Parse the message
 	var update struct {
-		ProductID int `json:"product_id"`
-		NewStock  int `json:"new_stock"`
+		MessageID string `json:"message_id"` // Lets us ignore redeliveries
+		ProductID int    `json:"product_id"`
+		NewStock  int    `json:"new_stock"`
 	}
 
 	if err := json.Unmarshal(msg.Payload(), &update); err != nil {
@@ -67,23 +109,49 @@ func (h *Handlers) handleInventoryUpdate(client MQTT.Client, msg MQTT.Message) {
 		return
 	}
 
+	if h.alreadyProcessed(msg.Topic(), update.MessageID) {
+		return
+	}
+
 	// Update the product stock
 	if err := h.productService.UpdateStock(update.ProductID, update.NewStock); err != nil {
 		log.Printf("Failed to update product stock: %v", err)
+		h.processed.release(update.MessageID)
 		return
 	}
 
 	log.Printf("Updated stock for product %d to %d", update.ProductID, update.NewStock)
 }
 
+// handleInventorySync processes full inventory snapshots
+// The payload is a JSON array like [{"product_id": 1, "stock": 20}, ...]
+// All updates are applied together - if one is invalid, none are applied
+func (h *Handlers) handleInventorySync(client MQTT.Client, msg MQTT.Message) {
+	log.Printf("Received inventory sync (%d bytes)", len(msg.Payload()))
+
+	var updates []models.StockUpdate
+	if err := json.Unmarshal(msg.Payload(), &updates); err != nil {
+		log.Printf("Failed to parse inventory sync: %v", err)
+		return
+	}
+
+	if err := h.productService.BulkUpdateStock(updates); err != nil {
+		log.Printf("Failed to apply inventory sync, nothing was changed: %v", err)
+		return
+	}
+
+	log.Printf("Applied inventory sync for %d products", len(updates))
+}
+
 // handlePaymentConfirmed processes payment confirmation messages
 func (h *Handlers) handlePaymentConfirmed(client MQTT.Client, msg MQTT.Message) {
 	log.Printf("Received payment confirmation: %s", string(msg.Payload()))
 
 	// Parse the message
 	var payment struct {
-		OrderID int    `json:"order_id"`
-		Status  string `json:"status"`
+		MessageID string `json:"message_id"` // Lets us ignore redeliveries
+		OrderID   int    `json:"order_id"`
+		Status    string `json:"status"`
 	}
 
 	if err := json.Unmarshal(msg.Payload(), &payment); err != nil {
@@ -91,15 +159,80 @@ func (h *Handlers) handlePaymentConfirmed(client MQTT.Client, msg MQTT.Message)
 		return
 	}
 
+	if h.alreadyProcessed(msg.Topic(), payment.MessageID) {
+		return
+	}
+
 	// Update the order status
-	if err := h.orderService.UpdateOrderStatus(payment.OrderID, "paid"); err != nil {
+	if err := h.orderService.UpdateOrderStatus(systemActor, payment.OrderID, models.OrderStatusPaid); err != nil {
 		log.Printf("Failed to update order status: %v", err)
+		h.processed.release(payment.MessageID)
 		return
 	}
 
 	log.Printf("Updated order %d status to paid", payment.OrderID)
 }
 
+// handleShippingUpdate processes tracking updates from shipping providers
+// Updates we can never apply (bad JSON, an impossible status change, an
+// unknown order) are dead-lettered, so someone can look at them later
+func (h *Handlers) handleShippingUpdate(client MQTT.Client, msg MQTT.Message) {
+	log.Printf("Received shipping update: %s", string(msg.Payload()))
+
+	var update models.ShipmentUpdate
+	if err := json.Unmarshal(msg.Payload(), &update); err != nil {
+		log.Printf("Failed to parse shipping update: %v", err)
+		deadLetter(client, msg, "invalid JSON: "+err.Error())
+		return
+	}
+
+	if h.alreadyProcessed(msg.Topic(), update.MessageID) {
+		return
+	}
+
+	if err := h.orderService.UpdateShipment(systemActor, update); err != nil {
+		log.Printf("Failed to apply shipping update for order %d: %v", update.OrderID, err)
+		h.processed.release(update.MessageID)
+		if isPermanentFailure(err) {
+			deadLetter(client, msg, err.Error())
+		}
+		return
+	}
+
+	log.Printf("Updated order %d to %s (tracking number %s)", update.OrderID, update.Status, update.TrackingNumber)
+}
+
+// handleRiskFlag puts orders the fraud check finds too risky on hold
+// Flags for orders that can't be held (unknown, or already shipped) are dead-lettered
+func (h *Handlers) handleRiskFlag(client MQTT.Client, msg MQTT.Message) {
+	log.Printf("Received risk flag: %s", string(msg.Payload()))
+
+	var flag models.RiskFlag
+	if err := json.Unmarshal(msg.Payload(), &flag); err != nil {
+		log.Printf("Failed to parse risk flag: %v", err)
+		deadLetter(client, msg, "invalid JSON: "+err.Error())
+		return
+	}
+
+	if h.alreadyProcessed(msg.Topic(), flag.MessageID) {
+		return
+	}
+
+	held, err := h.orderService.FlagRisk(systemActor, flag)
+	if err != nil {
+		log.Printf("Failed to apply risk flag for order %d: %v", flag.OrderID, err)
+		h.processed.release(flag.MessageID)
+		if isPermanentFailure(err) {
+			deadLetter(client, msg, err.Error())
+		}
+		return
+	}
+
+	if held {
+		log.Printf("Put order %d on hold (risk score %.1f)", flag.OrderID, flag.Score)
+	}
+}
+
 // handleLowStockAlert processes low stock alert messages
 func (h *Handlers) handleLowStockAlert(client MQTT.Client, msg MQTT.Message) {
 	log.Printf("Received low stock alert: %s", string(msg.Payload()))
@@ -0,0 +1,165 @@
+// internal/mqtt/handlers_test.go
+// Tests for the MQTT message handlers
+
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"online-store/internal/models"
+	"online-store/internal/services"
+)
+
+// newTestHandlers returns handlers on top of fake services
+func newTestHandlers() (*Handlers, *fakeProductService, *fakeOrderService) {
+	products, orders := &fakeProductService{}, &fakeOrderService{}
+	return NewHandlers(products, orders, SharedSubscriptions{}), products, orders
+}
+
+func TestHandleInventorySync(t *testing.T) {
+	h, products, _ := newTestHandlers()
+
+	h.handleInventorySync(nil, newMessage("inventory/sync", `[{"product_id": 1, "stock": 20}, {"product_id": 2, "stock": 0}]`))
+
+	want := [][]models.StockUpdate{{{ProductID: 1, Stock: 20}, {ProductID: 2, Stock: 0}}}
+	if !reflect.DeepEqual(products.bulkCalls, want) {
+		t.Errorf("BulkUpdateStock calls = %v, want %v", products.bulkCalls, want)
+	}
+}
+
+func TestHandleInventorySyncIgnoresInvalidJSON(t *testing.T) {
+	h, products, _ := newTestHandlers()
+
+	h.handleInventorySync(nil, newMessage("inventory/sync", `{"product_id": 1}`))
+
+	if len(products.bulkCalls) != 0 {
+		t.Errorf("BulkUpdateStock called for an invalid snapshot: %v", products.bulkCalls)
+	}
+}
+
+func TestHandleInventorySyncFailureChangesNothing(t *testing.T) {
+	h, products, _ := newTestHandlers()
+	products.err = errors.New("product not found: id 2")
+
+	// Must not panic or retry on its own; the service rolled everything back
+	h.handleInventorySync(nil, newMessage("inventory/sync", `[{"product_id": 2, "stock": 5}]`))
+	if len(products.bulkCalls) != 0 {
+		t.Errorf("BulkUpdateStock calls = %v, want none", products.bulkCalls)
+	}
+}
+
+func TestHandleShippingUpdate(t *testing.T) {
+	h, _, orders := newTestHandlers()
+	paho := &fakePaho{}
+
+	h.handleShippingUpdate(paho, newMessage("shipping/update", `{"order_id": 7, "status": "shipped", "tracking_number": "1Z999"}`))
+
+	want := []models.ShipmentUpdate{{OrderID: 7, Status: models.OrderStatusShipped, TrackingNumber: "1Z999"}}
+	if !reflect.DeepEqual(orders.shipments, want) {
+		t.Errorf("shipments = %+v, want %+v", orders.shipments, want)
+	}
+	if paho.messages() != 0 {
+		t.Errorf("published %v, want nothing dead-lettered", paho.published)
+	}
+}
+
+func TestHandleShippingUpdateDeadLetters(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		err     error
+	}{
+		{"invalid transition", `{"order_id": 7, "status": "delivered", "tracking_number": "1Z999"}`,
+			fmt.Errorf("%w: pending -> delivered", services.ErrInvalidStatusTransition)},
+		{"unknown order", `{"order_id": 7, "status": "shipped", "tracking_number": "1Z999"}`, services.ErrOrderNotFound},
+		{"invalid JSON", `{"order_id": "seven"}`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, orders := newTestHandlers()
+			orders.err = tt.err
+			paho := &fakePaho{}
+
+			h.handleShippingUpdate(paho, newMessage("shipping/update", tt.payload))
+
+			if paho.messages() != 1 || paho.published[0].Topic != "deadletter/shipping/update" {
+				t.Fatalf("published %v, want one dead letter", paho.published)
+			}
+			var letter deadLetterMessage
+			if err := json.Unmarshal(paho.published[0].Payload, &letter); err != nil {
+				t.Fatalf("decode dead letter: %v", err)
+			}
+			if letter.Topic != "shipping/update" || letter.Payload != tt.payload || letter.Reason == "" {
+				t.Errorf("dead letter = %+v, want the original message and a reason", letter)
+			}
+		})
+	}
+}
+
+func TestHandleShippingUpdateTemporaryFailure(t *testing.T) {
+	h, _, orders := newTestHandlers()
+	orders.err = errors.New("database is down")
+	paho := &fakePaho{}
+
+	h.handleShippingUpdate(paho, newMessage("shipping/update", `{"order_id": 7, "status": "shipped", "tracking_number": "1Z999"}`))
+
+	// Worth trying again later, so it isn't parked
+	if paho.messages() != 0 {
+		t.Errorf("published %v, want nothing dead-lettered", paho.published)
+	}
+}
+
+func TestHandleRiskFlag(t *testing.T) {
+	h, _, orders := newTestHandlers()
+	paho := &fakePaho{}
+
+	h.handleRiskFlag(paho, newMessage("risk/flag", `{"message_id": "r-1", "order_id": 7, "score": 91.5, "reason": "card country mismatch"}`))
+
+	want := []models.RiskFlag{{MessageID: "r-1", OrderID: 7, Score: 91.5, Reason: "card country mismatch"}}
+	if !reflect.DeepEqual(orders.flags, want) {
+		t.Errorf("flags = %+v, want %+v", orders.flags, want)
+	}
+
+	// A redelivery isn't applied twice
+	h.handleRiskFlag(paho, newMessage("risk/flag", `{"message_id": "r-1", "order_id": 7, "score": 91.5}`))
+	if len(orders.flags) != 1 {
+		t.Errorf("%d flags applied, want 1", len(orders.flags))
+	}
+	if paho.messages() != 0 {
+		t.Errorf("published %v, want nothing dead-lettered", paho.published)
+	}
+}
+
+func TestHandleRiskFlagFailures(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        string
+		err            error
+		wantDeadLetter bool
+	}{
+		{"invalid JSON", `{"order_id": "seven"}`, nil, true},
+		{"shipped order", `{"order_id": 7, "score": 95}`,
+			fmt.Errorf("%w: a shipped order can't be put on hold", services.ErrInvalidStatusTransition), true},
+		{"unknown order", `{"order_id": 7, "score": 95}`, services.ErrOrderNotFound, true},
+		{"database down", `{"order_id": 7, "score": 95}`, errors.New("database is down"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, orders := newTestHandlers()
+			orders.err = tt.err
+			paho := &fakePaho{}
+
+			h.handleRiskFlag(paho, newMessage("risk/flag", tt.payload))
+
+			deadLettered := paho.messages() == 1 && paho.published[0].Topic == "deadletter/risk/flag"
+			if deadLettered != tt.wantDeadLetter {
+				t.Errorf("published %v, want dead-lettered %t", paho.published, tt.wantDeadLetter)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// internal/mqtt/shared.go
+// This file builds topic filters for shared subscriptions
+// Normally every subscriber gets every message, so when we run several server
+// instances each one would process every payment confirmation. With a shared
+// subscription ("$share/<group>/<topic>") the broker hands each message to only
+// one member of the group instead
+
+package mqtt
+
+import "strings"
+
+// SharedSubscriptions says which topics are subscribed as a shared group
+// The zero value shares nothing, so every topic is a normal subscription
+type SharedSubscriptions struct {
+	Group  string          // Share group name; all our instances must use the same one
+	Topics map[string]bool // Topics to share
+}
+
+// NewSharedSubscriptions creates the settings for sharing topics in a group
+// If group is empty, shared subscriptions are turned off
+func NewSharedSubscriptions(group string, topics []string) SharedSubscriptions {
+	shared := SharedSubscriptions{Group: strings.TrimSpace(group), Topics: make(map[string]bool)}
+	for _, topic := range topics {
+		shared.Topics[topic] = true
+	}
+	return shared
+}
+
+// Filter returns the topic filter to subscribe to for a topic
+// e.g. "payment/confirmed" becomes "$share/store/payment/confirmed" when that
+// topic is shared in the "store" group, and stays "payment/confirmed" otherwise
+// Note: the broker must support shared subscriptions (Mosquitto 2, EMQX and
+// HiveMQ do, also for MQTT 3.1.1 clients like ours)
+func (s SharedSubscriptions) Filter(topic string) string {
+	if s.Group == "" || !s.Topics[topic] {
+		return topic
+	}
+	return "$share/" + s.Group + "/" + topic
+}
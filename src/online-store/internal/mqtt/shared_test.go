@@ -0,0 +1,47 @@
+// internal/mqtt/shared_test.go
+// Tests for shared subscription topic filters
+
+package mqtt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSharedSubscriptionsFilter(t *testing.T) {
+	shared := NewSharedSubscriptions(" store ", []string{"payment/confirmed"})
+
+	if got := shared.Filter("payment/confirmed"); got != "$share/store/payment/confirmed" {
+		t.Errorf("shared topic filter = %q, want $share/store/payment/confirmed", got)
+	}
+	if got := shared.Filter("inventory/low_stock"); got != "inventory/low_stock" {
+		t.Errorf("unshared topic filter = %q, want inventory/low_stock", got)
+	}
+
+	// Without a group nothing is shared
+	if got := NewSharedSubscriptions("", []string{"payment/confirmed"}).Filter("payment/confirmed"); got != "payment/confirmed" {
+		t.Errorf("filter without a group = %q, want payment/confirmed", got)
+	}
+	if got := (SharedSubscriptions{}).Filter("payment/confirmed"); got != "payment/confirmed" {
+		t.Errorf("zero value filter = %q, want payment/confirmed", got)
+	}
+}
+
+func TestHandlersSubscribeSharedTopics(t *testing.T) {
+	client, paho := newTestClient(0, Breaker{})
+	h := NewHandlers(&fakeProductService{}, &fakeOrderService{}, NewSharedSubscriptions("store", []string{"payment/confirmed", "inventory/sync"}))
+
+	h.Subscribe(client)
+
+	want := []string{
+		"inventory/update",
+		"$share/store/inventory/sync",
+		"$share/store/payment/confirmed",
+		"shipping/update",
+		"risk/flag",
+		"inventory/low_stock",
+	}
+	if !reflect.DeepEqual(paho.subscribed, want) {
+		t.Errorf("subscribed to %v, want %v", paho.subscribed, want)
+	}
+}
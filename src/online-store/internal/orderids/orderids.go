@@ -0,0 +1,124 @@
+// internal/orderids/orderids.go
+// This file turns order IDs into short codes that don't give away how many orders we have
+// With plain IDs, anyone can place two orders a week apart and subtract the IDs;
+// the codes look random, and only we (with the secret) can turn them back into IDs
+
+package orderids
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// ErrInvalid is returned for codes we didn't create - typos and tampered codes alike
+var ErrInvalid = errors.New("invalid order code")
+
+// alphabet are the characters a code is made of (base 62, safe in URLs)
+const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// codeLength fits the 48 bits of a code: a scrambled 32-bit ID plus a 16-bit check
+const codeLength = 9
+
+// rounds is how many times the ID bits are mixed (see scramble)
+const rounds = 4
+
+// Codec encodes and decodes order codes with a secret
+// Codes stay valid as long as the secret doesn't change
+type Codec struct {
+	secret []byte
+}
+
+// NewCodec creates a codec using secret
+func NewCodec(secret string) *Codec {
+	return &Codec{secret: []byte(secret)}
+}
+
+// Encode returns the code for an order ID
+// Order IDs are positive INT column values, so they always fit in 32 bits
+func (c *Codec) Encode(id int) string {
+	scrambled := c.scramble(uint32(id))
+	value := uint64(scrambled)<<16 | uint64(c.check(scrambled))
+
+	// Write the number in base 62, padded to a fixed length
+	code := make([]byte, codeLength)
+	for i := codeLength - 1; i >= 0; i-- {
+		code[i] = alphabet[value%62]
+		value /= 62
+	}
+	return string(code)
+}
+
+// Decode returns the order ID a code stands for
+// Codes we didn't create fail the check and return ErrInvalid
+func (c *Codec) Decode(code string) (int, error) {
+	if len(code) != codeLength {
+		return 0, ErrInvalid
+	}
+
+	var value uint64
+	for i := 0; i < len(code); i++ {
+		digit := strings.IndexByte(alphabet, code[i])
+		if digit < 0 {
+			return 0, ErrInvalid
+		}
+		value = value*62 + uint64(digit)
+	}
+	if value >= 1<<48 {
+		return 0, ErrInvalid
+	}
+
+	scrambled := uint32(value >> 16)
+	// hmac.Equal takes the same time however many bytes match, so the check can't be guessed byte by byte
+	if !hmac.Equal([]byte{byte(value >> 8), byte(value)}, c.checkBytes(scrambled)[:2]) {
+		return 0, ErrInvalid
+	}
+
+	id := c.unscramble(scrambled)
+	if id == 0 || id > 1<<31-1 {
+		return 0, ErrInvalid
+	}
+	return int(id), nil
+}
+
+// scramble mixes the bits of an ID so neighbouring IDs get unrelated codes
+// It's a small Feistel network: each round changes one half of the bits based
+// on the other half and the secret, which can always be undone in reverse order
+func (c *Codec) scramble(id uint32) uint32 {
+	left, right := uint16(id>>16), uint16(id)
+	for round := 0; round < rounds; round++ {
+		left, right = right, left^c.roundKey(round, right)
+	}
+	return uint32(left)<<16 | uint32(right)
+}
+
+// unscramble undoes scramble
+func (c *Codec) unscramble(scrambled uint32) uint32 {
+	left, right := uint16(scrambled>>16), uint16(scrambled)
+	for round := rounds - 1; round >= 0; round-- {
+		left, right = right^c.roundKey(round, left), left
+	}
+	return uint32(left)<<16 | uint32(right)
+}
+
+// roundKey is the secret-dependent value one Feistel round mixes in
+func (c *Codec) roundKey(round int, half uint16) uint16 {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte{'r', byte(round), byte(half >> 8), byte(half)})
+	return binary.BigEndian.Uint16(mac.Sum(nil))
+}
+
+// check is the 16-bit check stored next to the scrambled ID
+// Without the secret, changing a code and fixing up its check is a 1 in 65536 guess
+func (c *Codec) check(scrambled uint32) uint16 {
+	return binary.BigEndian.Uint16(c.checkBytes(scrambled))
+}
+
+// checkBytes is the HMAC the check is taken from
+func (c *Codec) checkBytes(scrambled uint32) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte{'c', byte(scrambled >> 24), byte(scrambled >> 16), byte(scrambled >> 8), byte(scrambled)})
+	return mac.Sum(nil)
+}
@@ -0,0 +1,104 @@
+// internal/orderids/orderids_test.go
+// Tests for turning order IDs into codes and back
+
+package orderids
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	codec := NewCodec("test-secret")
+
+	ids := []int{1, 2, 3, 42, 65535, 65536, 1 << 24, 1<<31 - 1}
+	for id := 100; id < 5000; id++ {
+		ids = append(ids, id)
+	}
+
+	seen := make(map[string]int, len(ids))
+	for _, id := range ids {
+		code := codec.Encode(id)
+		if len(code) != codeLength || strings.Trim(code, alphabet) != "" {
+			t.Fatalf("Encode(%d) = %q, want %d characters from the alphabet", id, code, codeLength)
+		}
+		if other, ok := seen[code]; ok {
+			t.Fatalf("IDs %d and %d both encode to %q", other, id, code)
+		}
+		seen[code] = id
+
+		got, err := codec.Decode(code)
+		if err != nil || got != id {
+			t.Fatalf("Decode(Encode(%d)) = %d, %v", id, got, err)
+		}
+	}
+}
+
+func TestCodesDontShowOrder(t *testing.T) {
+	codec := NewCodec("test-secret")
+
+	// Neighbouring IDs get codes that share no prefix worth mentioning
+	a, b := codec.Encode(1000), codec.Encode(1001)
+	if a[:4] == b[:4] {
+		t.Errorf("codes of 1000 and 1001 are %q and %q, want them unrelated", a, b)
+	}
+
+	// The same ID always gets the same code
+	if codec.Encode(1000) != a || NewCodec("test-secret").Encode(1000) != a {
+		t.Error("the same ID and secret gave different codes")
+	}
+}
+
+func TestDecodeRejectsTamperedCodes(t *testing.T) {
+	codec := NewCodec("test-secret")
+	code := codec.Encode(1234)
+
+	// Change every character to every other one; the check catches nearly all,
+	// so allow the rare (1 in 65536) lucky guess, which must then be another ID
+	tampered, accepted := 0, 0
+	for i := 0; i < len(code); i++ {
+		for _, c := range []byte(alphabet) {
+			if c == code[i] {
+				continue
+			}
+			changed := code[:i] + string(c) + code[i+1:]
+			tampered++
+			if id, err := codec.Decode(changed); err == nil {
+				accepted++
+				if id == 1234 {
+					t.Errorf("Decode(%q) = 1234, want a different code to never mean the same order", changed)
+				}
+			} else if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Decode(%q): err = %v, want ErrInvalid", changed, err)
+			}
+		}
+	}
+	if accepted > 1 {
+		t.Errorf("%d of %d tampered codes were accepted, want about none", accepted, tampered)
+	}
+
+	// Codes made with another secret don't decode
+	if _, err := NewCodec("other-secret").Decode(code); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Decode with another secret: err = %v, want ErrInvalid", err)
+	}
+}
+
+func TestDecodeRejectsGarbage(t *testing.T) {
+	codec := NewCodec("test-secret")
+	code := codec.Encode(1234)
+
+	for _, garbage := range []string{
+		"",
+		"1234",
+		code[:codeLength-1], // Too short
+		code + "0",          // Too long
+		"zzzzzzzzz",         // More than 48 bits
+		code[:4] + "-" + code[5:],
+		code[:4] + "é",
+	} {
+		if id, err := codec.Decode(garbage); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Decode(%q) = %d, %v; want ErrInvalid", garbage, id, err)
+		}
+	}
+}
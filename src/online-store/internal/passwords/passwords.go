@@ -0,0 +1,132 @@
+// internal/passwords/passwords.go
+// This file hashes and checks user passwords
+// New passwords use the configured algorithm, but stored hashes say which
+// algorithm made them, so switching algorithms never locks anyone out
+
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm is a password hashing algorithm
+type Algorithm string
+
+// Available algorithms
+const (
+	Bcrypt   Algorithm = "bcrypt"   // Hashes look like "$2a$10$..."
+	Argon2id Algorithm = "argon2id" // Hashes look like "$argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>"
+)
+
+// argon2id settings (the RFC 9106 "second recommended option" with 64 MiB of memory)
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024 // In KiB
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// ErrMismatch means the password doesn't match the hash
+var ErrMismatch = errors.New("password does not match")
+
+// ParseAlgorithm checks that an algorithm name (from config) is one we know
+func ParseAlgorithm(name string) (Algorithm, error) {
+	algorithm := Algorithm(strings.ToLower(strings.TrimSpace(name)))
+	switch algorithm {
+	case Bcrypt, Argon2id:
+		return algorithm, nil
+	}
+	return "", fmt.Errorf("unknown password hash algorithm %q (use bcrypt or argon2id)", name)
+}
+
+// Hash hashes a password with the algorithm, using a fresh random salt
+func (a Algorithm) Hash(password string) (string, error) {
+	if a == Argon2id {
+		return hashArgon2id(password)
+	}
+
+	// bcrypt is a secure way to store passwords - it's slow and uses salt
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify checks a password against a stored hash made by any of our algorithms
+// The algorithm is read from the hash itself, not from config
+// Returns ErrMismatch if the password is wrong
+func Verify(hash, password string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return verifyArgon2id(hash, password)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+	return err
+}
+
+// hashArgon2id hashes a password with argon2id in the usual "PHC string" format
+func hashArgon2id(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// verifyArgon2id checks a password against an argon2id hash
+// The settings are read from the hash, so hashes made with older settings still work
+func verifyArgon2id(hash, password string) error {
+	// "$argon2id$v=19$m=65536,t=1,p=4$salt$key" splits into
+	// "", "argon2id", "v=19", "m=65536,t=1,p=4", "salt", "key"
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return errors.New("unsupported argon2id version")
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return fmt.Errorf("malformed argon2id key: %w", err)
+	}
+
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(want)))
+
+	// Constant-time comparison, so the time taken doesn't hint at how close a guess was
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// internal/passwords/passwords_test.go
+// Tests for hashing and checking passwords
+
+package passwords
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	tests := []struct {
+		algorithm Algorithm
+		prefix    string
+	}{
+		{Bcrypt, "$2a$"},
+		{Argon2id, "$argon2id$v=19$m=65536,t=1,p=4$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			hash, err := tt.algorithm.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("hash = %q, want it to start with %q", hash, tt.prefix)
+			}
+
+			if err := Verify(hash, "correct horse"); err != nil {
+				t.Errorf("right password: %v", err)
+			}
+			if err := Verify(hash, "correct horsE"); !errors.Is(err, ErrMismatch) {
+				t.Errorf("wrong password: err = %v, want ErrMismatch", err)
+			}
+
+			// A fresh salt every time
+			again, _ := tt.algorithm.Hash("correct horse")
+			if again == hash {
+				t.Error("the same password hashed twice gave the same hash")
+			}
+		})
+	}
+}
+
+func TestVerifyArgon2idWithOtherSettings(t *testing.T) {
+	// Made with m=32768, t=2, p=1; the settings come from the hash, not our constants
+	hash := "$argon2id$v=19$m=32768,t=2,p=1$c29tZXNhbHRzb21lc2FsdA$" + argonKey(t, "correct horse", "somesaltsomesalt", 2, 32*1024, 1)
+	if err := Verify(hash, "correct horse"); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+// argonKey returns the encoded argon2id key of password, for hand-made hashes
+func argonKey(t *testing.T, password, salt string, time, memory uint32, threads uint8) string {
+	t.Helper()
+	key := argon2.IDKey([]byte(password), []byte(salt), time, memory, threads, argonKeyLen)
+	return base64.RawStdEncoding.EncodeToString(key)
+}
+
+func TestVerifyMalformedArgon2id(t *testing.T) {
+	for _, hash := range []string{
+		"$argon2id$v=19$m=65536,t=1,p=4$salt",
+		"$argon2id$v=18$m=65536,t=1,p=4$c2FsdA$a2V5",
+		"$argon2id$v=19$m=lots,t=1,p=4$c2FsdA$a2V5",
+		"$argon2id$v=19$m=65536,t=1,p=4$!!!$a2V5",
+	} {
+		if err := Verify(hash, "correct horse"); err == nil || errors.Is(err, ErrMismatch) {
+			t.Errorf("Verify(%q) = %v, want a malformed hash error", hash, err)
+		}
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := []struct {
+		name string
+		want Algorithm
+	}{
+		{"bcrypt", Bcrypt},
+		{" Argon2id ", Argon2id},
+		{"md5", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAlgorithm(tt.name)
+		if got != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// internal/passwords/strength.go
+// This file estimates how easy a password is to guess, in the spirit of zxcvbn
+// Length and character-class rules happily accept "Password123!", which is one
+// of the first things an attacker tries; here we look for the patterns people
+// actually use (common words, keyboard walks, abc/123 runs, repeated letters)
+// and only count the truly random-looking rest as strong
+
+package passwords
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Scores go from 0 (guessed almost at once) to MaxScore (very hard to guess)
+const MaxScore = 4
+
+// scoreBits are the estimated guessing bits needed for scores 1, 2, 3 and 4
+// They match zxcvbn's thresholds of 10^3, 10^6, 10^8 and 10^10 guesses
+var scoreBits = []float64{10, 20, 26.6, 33.2}
+
+// commonWords are passwords and words people use most, most common first
+// A word's position counts as how many guesses it takes to hit it
+var commonWords = []string{
+	"password", "123456", "qwerty", "letmein", "welcome", "admin", "login", "iloveyou",
+	"monkey", "dragon", "master", "sunshine", "princess", "football", "baseball", "shadow",
+	"superman", "batman", "trustno1", "hello", "freedom", "whatever", "secret", "summer",
+	"winter", "spring", "autumn", "love", "pass", "test", "guest", "user", "root",
+	"access", "charlie", "michael", "jordan", "hunter", "ranger", "buster", "soccer",
+	"hockey", "killer", "pepper", "ginger", "cheese", "computer", "internet", "starwars",
+	"pokemon", "mustang", "harley", "thomas", "jennifer", "jessica", "ashley", "daniel",
+	"andrew", "joshua", "matthew", "robert", "abc", "changeme", "default", "store",
+	"shop", "online", "money", "flower", "orange", "purple", "silver", "golden",
+	"london", "berlin", "paris", "family", "friend", "happy", "lucky", "angel",
+	"tiger", "lover", "banana", "apple", "chocolate", "cookie", "coffee", "matrix",
+	"zxcvbn", "asdf", "qazwsx", "passw0rd", "p@ssword", "god", "jesus", "blessed",
+}
+
+// keyboardRows are runs of neighbouring keys, for spotting walks like "qwerty" or "asdf"
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// leetReplacements undo the usual letter-for-symbol swaps ("p@ssw0rd" is still "password")
+var leetReplacements = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+
+// Score estimates how hard a password is to guess, from 0 to MaxScore
+// The password is read left to right; at each point the longest weak pattern
+// is taken, and whatever matches no pattern counts as random characters
+func Score(password string) int {
+	bits := entropyBits(password)
+	score := 0
+	for _, threshold := range scoreBits {
+		if bits >= threshold {
+			score++
+		}
+	}
+	return score
+}
+
+// entropyBits estimates log2 of the number of guesses needed for the password
+func entropyBits(password string) float64 {
+	runes := []rune(password)
+	lower := []rune(strings.ToLower(password))
+	charset := math.Log2(float64(charsetSize(password)))
+
+	bits := 0.0
+	for i := 0; i < len(runes); {
+		if length, guessBits := dictionaryMatch(runes, lower, i); length > 0 {
+			bits += guessBits
+			i += length
+			continue
+		}
+		if length := runLength(lower, i); length >= 3 {
+			// Where the run starts (about 5 bits) plus how long it is
+			bits += 5 + math.Log2(float64(length))
+			i += length
+			continue
+		}
+		if length := repeatLength(lower, i); length >= 3 {
+			bits += charset + math.Log2(float64(length))
+			i += length
+			continue
+		}
+		// Nothing recognisable: a random character from the password's character set
+		bits += charset
+		i++
+	}
+	return bits
+}
+
+// dictionaryMatch finds the longest common word starting at i
+// It returns how many characters matched and the bits it takes to guess them
+func dictionaryMatch(runes, lower []rune, i int) (int, float64) {
+	bestLength, bestBits := 0, 0.0
+	for rank, word := range commonWords {
+		wordLength := len([]rune(word))
+		if wordLength < 3 || i+wordLength > len(lower) || wordLength <= bestLength {
+			continue
+		}
+
+		candidate := string(lower[i : i+wordLength])
+		leet := false
+		if candidate != word {
+			if leetReplacements.Replace(candidate) != word {
+				continue
+			}
+			leet = true
+		}
+
+		bestLength = wordLength
+		bestBits = math.Log2(float64(rank + 2))
+		if leet {
+			bestBits++ // Swapping letters for symbols barely slows anyone down
+		}
+		if hasUpper(runes[i : i+wordLength]) {
+			bestBits++ // Neither does capitalising
+		}
+	}
+	return bestLength, bestBits
+}
+
+// runLength is how many characters from i form a sequence like "abcd", "4321" or "qwer"
+func runLength(lower []rune, i int) int {
+	length := 1
+	step := 0
+	for j := i + 1; j < len(lower); j++ {
+		diff := int(lower[j]) - int(lower[j-1])
+		if diff != 1 && diff != -1 {
+			diff = keyboardStep(lower[j-1], lower[j])
+		}
+		if diff == 0 || (step != 0 && diff != step) {
+			break
+		}
+		step = diff
+		length++
+	}
+	return length
+}
+
+// keyboardStep is 1 or -1 when b is the key right or left of a on a keyboard row, else 0
+// The result is offset by 2 so it can't be mistaken for an alphabet step
+func keyboardStep(a, b rune) int {
+	for _, row := range keyboardRows {
+		ai, bi := strings.IndexRune(row, a), strings.IndexRune(row, b)
+		if ai < 0 || bi < 0 {
+			continue
+		}
+		switch bi - ai {
+		case 1:
+			return 2
+		case -1:
+			return -2
+		}
+	}
+	return 0
+}
+
+// repeatLength is how many times the character at i repeats in a row ("aaaa" is 4)
+func repeatLength(lower []rune, i int) int {
+	length := 1
+	for j := i + 1; j < len(lower) && lower[j] == lower[i]; j++ {
+		length++
+	}
+	return length
+}
+
+// charsetSize is how many different characters an attacker has to try per
+// position, judging by which kinds of characters the password uses
+func charsetSize(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if other {
+		size += 33
+	}
+	if size == 0 {
+		size = 1
+	}
+	return size
+}
+
+// hasUpper reports whether any of the characters is upper case
+func hasUpper(runes []rune) bool {
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
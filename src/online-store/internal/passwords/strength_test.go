@@ -0,0 +1,44 @@
+// internal/passwords/strength_test.go
+// Tests for the password strength estimate
+
+package passwords
+
+import "testing"
+
+func TestScoreWeakPasswords(t *testing.T) {
+	// Common words, their leet spellings, keyboard walks, runs and repeats
+	weak := []string{"", "password123", "Password123!", "p@ssw0rd", "qwertyuiop", "aaaaaaaaaaaa", "abcdefgh123", "letmein2024"}
+
+	for _, password := range weak {
+		if got := Score(password); got > 2 {
+			t.Errorf("Score(%q) = %d, want at most 2", password, got)
+		}
+	}
+}
+
+func TestScoreStrongPasswords(t *testing.T) {
+	strong := []string{"correct horse battery staple", "purple-otter-sings-loudly", "xK9#mQ2$vL7!"}
+
+	for _, password := range strong {
+		if got := Score(password); got != MaxScore {
+			t.Errorf("Score(%q) = %d, want %d", password, got, MaxScore)
+		}
+	}
+}
+
+func TestScorePatternsCountLessThanRandom(t *testing.T) {
+	tests := []struct {
+		pattern, random string
+	}{
+		{"password", "pqwmzkro"},
+		{"abcdefgh", "ajqpxmbe"},
+		{"asdfghjk", "adjqgmzk"},
+		{"zzzzzzzz", "zqmxkwpj"},
+	}
+
+	for _, tt := range tests {
+		if entropyBits(tt.pattern) >= entropyBits(tt.random) {
+			t.Errorf("entropyBits(%q) = %.1f, want less than %q's %.1f", tt.pattern, entropyBits(tt.pattern), tt.random, entropyBits(tt.random))
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// internal/requestid/requestid.go
+// This file carries a request's ID in a context.Context
+// Code deep inside the app (like the database layer) can then say which
+// HTTP request it was working for, without knowing anything about Gin
+
+package requestid
+
+import "context"
+
+// contextKey is a private type, so no other package can clash with our key
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "" if there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,54 @@
+// internal/sanitize/sanitize.go
+// This file cleans up user-provided text before we store it
+// Text like product names ends up in web pages, so a name such as
+// "<script>...</script>" could run in other users' browsers (stored XSS)
+
+package sanitize
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Policy says what to do with HTML in user-provided text
+type Policy string
+
+// Available policies
+const (
+	PolicyEscape Policy = "escape" // Turn < > & ' " into HTML entities, so tags show up as text
+	PolicyStrip  Policy = "strip"  // Remove tags completely, keeping only the text between them
+	PolicyNone   Policy = "none"   // Store text as it was sent (only if every client escapes it)
+)
+
+// tagPattern matches anything that looks like an HTML tag, e.g. <b> or </script>
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// ParsePolicy checks that a policy name (from config) is one we know
+func ParsePolicy(name string) (Policy, error) {
+	policy := Policy(strings.ToLower(strings.TrimSpace(name)))
+	switch policy {
+	case PolicyEscape, PolicyStrip, PolicyNone:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown sanitize policy %q (use escape, strip or none)", name)
+}
+
+// Apply cleans text according to the policy
+// Applying it twice gives the same result as applying it once, so text that
+// was already cleaned (e.g. a product sent back unchanged in a PUT) isn't
+// escaped a second time
+func (p Policy) Apply(text string) string {
+	switch p {
+	case PolicyNone:
+		return text
+	case PolicyStrip:
+		// Unescape first, so "&lt;script&gt;" can't sneak a tag past us
+		text = tagPattern.ReplaceAllString(html.UnescapeString(text), "")
+		// Drop leftover brackets from broken tags like "<script"
+		return strings.NewReplacer("<", "", ">", "").Replace(text)
+	default:
+		return html.EscapeString(html.UnescapeString(text))
+	}
+}
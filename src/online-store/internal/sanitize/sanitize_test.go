@@ -0,0 +1,46 @@
+// internal/sanitize/sanitize_test.go
+// Tests for cleaning HTML out of user-provided text
+
+package sanitize
+
+import "testing"
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		text   string
+		want   string
+	}{
+		{PolicyEscape, `<script>alert("x")</script>`, `&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;`},
+		{PolicyEscape, "Tea & Biscuits", "Tea &amp; Biscuits"},
+		{PolicyStrip, "<b>Bold</b> mug", "Bold mug"},
+		{PolicyStrip, "&lt;script&gt;alert(1)&lt;/script&gt;", "alert(1)"},
+		{PolicyStrip, "<script", "script"},
+		{PolicyNone, "<b>Bold</b>", "<b>Bold</b>"},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Apply(tt.text); got != tt.want {
+			t.Errorf("%s.Apply(%q) = %q, want %q", tt.policy, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestApplyTwiceChangesNothing(t *testing.T) {
+	for _, policy := range []Policy{PolicyEscape, PolicyStrip, PolicyNone} {
+		once := policy.Apply(`Tea & <i>"Biscuits"</i>`)
+		if twice := policy.Apply(once); twice != once {
+			t.Errorf("%s: applying twice gave %q, once gave %q", policy, twice, once)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for name, want := range map[string]Policy{"escape": PolicyEscape, " Strip ": PolicyStrip, "NONE": PolicyNone} {
+		if got, err := ParsePolicy(name); err != nil || got != want {
+			t.Errorf("ParsePolicy(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParsePolicy("remove"); err == nil {
+		t.Error("ParsePolicy accepted an unknown policy")
+	}
+}
@@ -0,0 +1,74 @@
+// internal/services/archive.go
+// This file moves old orders out of the orders table, so it doesn't grow forever
+
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// archiveBatchSize is how many orders are moved per transaction
+// Small batches keep each transaction (and the rows it locks) short
+const archiveBatchSize = 500
+
+// OrderArchiver moves delivered orders older than the retention period to orders_archive
+// Orders that can still change (pending, paid, shipped, on hold) are never archived
+// Customers and reports still see archived orders: order lists, tracking links,
+// sales metrics, user summaries and data exports all read both tables
+type OrderArchiver struct {
+	orders    OrderRepository
+	retention time.Duration // Orders older than this are archived
+}
+
+// NewOrderArchiver creates an archiver for orders older than retentionDays
+func NewOrderArchiver(orders OrderRepository, retentionDays int) *OrderArchiver {
+	return &OrderArchiver{
+		orders:    orders,
+		retention: time.Duration(retentionDays) * 24 * time.Hour,
+	}
+}
+
+// Run archives old orders right away and then every interval, until ctx is cancelled
+// Start it in its own goroutine
+func (a *OrderArchiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.ArchiveOld(); err != nil {
+			log.Printf("Archiving old orders failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ArchiveOld moves every delivered order older than the retention period, a batch at a time
+// Returns how many orders were moved
+func (a *OrderArchiver) ArchiveOld() (int, error) {
+	cutoff := time.Now().Add(-a.retention)
+
+	archived := 0
+	for {
+		moved, err := a.orders.Archive(cutoff, archiveBatchSize)
+		archived += moved
+		if err != nil {
+			return archived, err
+		}
+		// A short batch means there's nothing older left
+		if moved < archiveBatchSize {
+			break
+		}
+	}
+
+	if archived > 0 {
+		log.Printf("Archived %d delivered orders older than %s", archived, cutoff.Format(dateLayout))
+	}
+	return archived, nil
+}
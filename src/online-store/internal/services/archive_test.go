@@ -0,0 +1,133 @@
+// internal/services/archive_test.go
+// Tests for archiving old orders
+
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"online-store/internal/models"
+)
+
+func TestArchiveOld(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	userID := s.addUser("ann@example.com")
+	old := s.placeOrder(t, userID, product.ID, 1)
+	recent := s.placeOrder(t, userID, product.ID, 2)
+	s.orders.setCreatedAt(old.ID, time.Now().AddDate(0, 0, -100))
+	s.orders.setCreatedAt(recent.ID, time.Now().AddDate(0, 0, -10))
+	s.orders.setStatus(old.ID, models.OrderStatusDelivered)
+	s.orders.setStatus(recent.ID, models.OrderStatusDelivered)
+
+	archived, err := NewOrderArchiver(s.orders, 90).ArchiveOld()
+	if err != nil {
+		t.Fatalf("ArchiveOld: %v", err)
+	}
+	if archived != 1 {
+		t.Errorf("archived = %d, want 1", archived)
+	}
+	if !s.orders.order(old.ID).archived || s.orders.order(recent.ID).archived {
+		t.Errorf("want only the order older than 90 days archived")
+	}
+
+	// Running again finds nothing new
+	if archived, err := NewOrderArchiver(s.orders, 90).ArchiveOld(); err != nil || archived != 0 {
+		t.Errorf("second run: archived = %d, err = %v, want 0 and no error", archived, err)
+	}
+}
+
+func TestArchiveOldInBatches(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 1000)
+	userID := s.addUser("ann@example.com")
+	total := archiveBatchSize + 3
+	for i := 0; i < total; i++ {
+		order := s.placeOrder(t, userID, product.ID, 1)
+		s.orders.setCreatedAt(order.ID, time.Now().AddDate(-1, 0, 0))
+		s.orders.setStatus(order.ID, models.OrderStatusDelivered)
+	}
+
+	archived, err := NewOrderArchiver(s.orders, 30).ArchiveOld()
+	if err != nil {
+		t.Fatalf("ArchiveOld: %v", err)
+	}
+	if archived != total {
+		t.Errorf("archived = %d, want %d (a full batch and the rest)", archived, total)
+	}
+}
+
+func TestArchiveOldKeepsUnfinishedOrders(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	userID := s.addUser("ann@example.com")
+
+	// Old, but each of them can still change: they must stay where
+	// status updates, holds and payments look for them
+	for _, status := range []models.OrderStatus{
+		models.OrderStatusPending, models.OrderStatusPaid, models.OrderStatusShipped, models.OrderStatusOnHold,
+	} {
+		order := s.placeOrder(t, userID, product.ID, 1)
+		s.orders.setCreatedAt(order.ID, time.Now().AddDate(-1, 0, 0))
+		s.orders.setStatus(order.ID, status)
+	}
+
+	archived, err := NewOrderArchiver(s.orders, 90).ArchiveOld()
+	if err != nil {
+		t.Fatalf("ArchiveOld: %v", err)
+	}
+	if archived != 0 {
+		t.Errorf("archived = %d, want 0: none of the orders is delivered", archived)
+	}
+}
+
+func TestArchivedOrdersStillCount(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	userID := s.addUser("ann@example.com")
+	old := s.placeOrder(t, userID, product.ID, 1)
+	recent := s.placeOrder(t, userID, product.ID, 2)
+	s.orders.setCreatedAt(old.ID, time.Now().AddDate(-1, 0, 0))
+	s.orders.setStatus(old.ID, models.OrderStatusDelivered)
+	if _, err := NewOrderArchiver(s.orders, 90).ArchiveOld(); err != nil {
+		t.Fatalf("ArchiveOld: %v", err)
+	}
+	if !s.orders.order(old.ID).archived {
+		t.Fatalf("the old delivered order wasn't archived")
+	}
+
+	// Still in the customer's order history...
+	orders, err := s.orderService.GetUserOrders(userID)
+	if err != nil {
+		t.Fatalf("GetUserOrders: %v", err)
+	}
+	if len(orders) != 2 || orders[0].ID != recent.ID || orders[1].ID != old.ID {
+		t.Errorf("orders = %+v, want the recent one, then the archived one", orders)
+	}
+	if order, err := s.orderService.GetOrder(old.ID, userID); err != nil || order.Status != models.OrderStatusDelivered {
+		t.Errorf("GetOrder of an archived order = %+v, %v, want it delivered", order, err)
+	}
+
+	// ...and in the summary and the data export
+	summary, err := s.orderService.GetUserSummary(userID)
+	if err != nil {
+		t.Fatalf("GetUserSummary: %v", err)
+	}
+	if summary.TotalOrders != 2 {
+		t.Errorf("summary.TotalOrders = %d, want 2", summary.TotalOrders)
+	}
+
+	var ids []int
+	err = s.orderService.StreamUserOrders(userID, func(order models.OrderResponse) error {
+		ids = append(ids, order.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamUserOrders: %v", err)
+	}
+	if want := []int{old.ID, recent.ID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("exported orders %v, want %v", ids, want)
+	}
+}
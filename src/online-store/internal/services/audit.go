@@ -0,0 +1,67 @@
+// internal/services/audit.go
+// This file contains the audit log business logic
+
+package services
+
+import (
+	"encoding/json"
+	"log"
+
+	"online-store/internal/models"
+)
+
+// SystemActor is the actor ID for changes nobody logged in made,
+// like MQTT handlers and background jobs
+const SystemActor = 0
+
+// Default and maximum number of audit entries returned at once
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditService records and lists who changed what
+type AuditService struct {
+	repo AuditRepository
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(repo AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record writes an audit entry for a change
+// detail can be anything that converts to JSON (the request, before/after values, ...)
+// Failures are logged rather than returned - the change itself already happened
+func (s *AuditService) Record(actorID int, action, entity string, entityID int, detail interface{}) {
+	detailJSON, err := json.Marshal(detail)
+	if err != nil {
+		log.Printf("Failed to encode audit detail for %s %s %d: %v", action, entity, entityID, err)
+		detailJSON = []byte("null")
+	}
+
+	entry := models.AuditEntry{
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+		Detail:   detailJSON,
+	}
+	if actorID != SystemActor {
+		entry.UserID = &actorID
+	}
+
+	if err := s.repo.Insert(entry); err != nil {
+		log.Printf("Failed to record audit entry for %s %s %d: %v", action, entity, entityID, err)
+	}
+}
+
+// List returns audit entries matching the filter, newest first
+func (s *AuditService) List(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+	return s.repo.List(filter)
+}
@@ -0,0 +1,100 @@
+// internal/services/audit_repository.go
+// This file contains the database access for the audit log
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"online-store/internal/database"
+	"online-store/internal/models"
+)
+
+// AuditRepository defines how audit entries are stored and read
+type AuditRepository interface {
+	Insert(entry models.AuditEntry) error
+	List(filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+// SQLAuditRepository is the MariaDB-backed AuditRepository
+type SQLAuditRepository struct {
+	db *database.DB
+}
+
+// NewSQLAuditRepository creates an audit repository using the given database
+func NewSQLAuditRepository(db *database.DB) *SQLAuditRepository {
+	return &SQLAuditRepository{db: db}
+}
+
+// Insert writes one audit entry
+func (r *SQLAuditRepository) Insert(entry models.AuditEntry) error {
+	_, err := r.db.Exec(
+		"INSERT INTO audit_log (user_id, action, entity, entity_id, detail) VALUES (?, ?, ?, ?, ?)",
+		entry.UserID, entry.Action, entry.Entity, entry.EntityID, string(entry.Detail),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// List returns audit entries matching the filter, newest first
+func (r *SQLAuditRepository) List(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	query := "SELECT id, user_id, action, entity, entity_id, detail, created_at FROM audit_log"
+
+	// Only add the filters that were asked for
+	var conditions []string
+	var args []interface{}
+	if filter.Entity != "" {
+		conditions = append(conditions, "entity = ?")
+		args = append(args, filter.Entity)
+	}
+	if filter.EntityID != 0 {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, filter.EntityID)
+	}
+	if filter.UserID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var userID sql.NullInt64
+		var detail string
+		err := rows.Scan(
+			&entry.ID,
+			&userID,
+			&entry.Action,
+			&entry.Entity,
+			&entry.EntityID,
+			&detail,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			entry.UserID = &id
+		}
+		entry.Detail = []byte(detail)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,112 @@
+// internal/services/audit_test.go
+// Tests for the audit log
+
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"online-store/internal/models"
+)
+
+func TestAuditRecord(t *testing.T) {
+	repo := &fakeAuditRepository{}
+	audit := NewAuditService(repo)
+
+	audit.Record(5, "update", "product", 3, map[string]int{"price_cents": 950})
+	audit.Record(SystemActor, "update_status", "order", 9, nil)
+
+	if len(repo.entries) != 2 {
+		t.Fatalf("%d entries recorded, want 2", len(repo.entries))
+	}
+
+	admin := repo.entries[0]
+	if admin.UserID == nil || *admin.UserID != 5 {
+		t.Errorf("UserID = %v, want 5", admin.UserID)
+	}
+	if admin.Action != "update" || admin.Entity != "product" || admin.EntityID != 3 {
+		t.Errorf("entry = %s %s %d, want update product 3", admin.Action, admin.Entity, admin.EntityID)
+	}
+	var detail map[string]int
+	if err := json.Unmarshal(admin.Detail, &detail); err != nil || detail["price_cents"] != 950 {
+		t.Errorf("Detail = %s, want the price change", admin.Detail)
+	}
+
+	// Changes nobody logged in made have no user
+	if system := repo.entries[1]; system.UserID != nil {
+		t.Errorf("UserID of a system change = %d, want nil", *system.UserID)
+	}
+}
+
+func TestAuditRecordUnencodableDetail(t *testing.T) {
+	repo := &fakeAuditRepository{}
+	NewAuditService(repo).Record(5, "update", "product", 3, func() {})
+
+	if len(repo.entries) != 1 || string(repo.entries[0].Detail) != "null" {
+		t.Errorf("entries = %+v, want one with a null detail", repo.entries)
+	}
+}
+
+// failingAuditRepository can't store anything
+type failingAuditRepository struct {
+	fakeAuditRepository
+}
+
+func (r *failingAuditRepository) Insert(entry models.AuditEntry) error {
+	return errors.New("disk full")
+}
+
+func TestAuditFailureDoesNotFailTheChange(t *testing.T) {
+	s := newTestStore(t)
+	s.orderService = NewOrderService(s.orders, s.products, s.users, s.publisher, s.relay, NewAuditService(&failingAuditRepository{}), s.cfg)
+	product := s.addProduct("Mug", 900, 5)
+
+	s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+}
+
+func TestAuditListLimit(t *testing.T) {
+	repo := &fakeAuditRepository{}
+	audit := NewAuditService(repo)
+	for i := 0; i < maxAuditLimit+5; i++ {
+		audit.Record(1, "update", "product", 1, nil)
+	}
+
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{0, defaultAuditLimit},
+		{3, 3},
+		{maxAuditLimit + 5, maxAuditLimit},
+	}
+	for _, tt := range tests {
+		entries, err := audit.List(models.AuditFilter{Limit: tt.limit})
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(entries) != tt.want {
+			t.Errorf("limit %d: got %d entries, want %d", tt.limit, len(entries), tt.want)
+		}
+	}
+}
+
+func TestProductChangesAreAudited(t *testing.T) {
+	s := newTestStore(t)
+	product, _, err := s.productService.CreateProduct(5, validProduct(), false)
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	if _, err := s.productService.PatchProduct(5, product.ID, map[string]interface{}{"price_cents": float64(950)}); err != nil {
+		t.Fatalf("PatchProduct: %v", err)
+	}
+
+	entries, err := s.audit.List(models.AuditFilter{Entity: "product", EntityID: product.ID, UserID: 5})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != "update" || entries[1].Action != "create" {
+		t.Errorf("entries = %+v, want update then create (newest first)", entries)
+	}
+}
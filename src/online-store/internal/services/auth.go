@@ -4,109 +4,349 @@
 package services
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
-	"github.com/golang-jwt/jwt/v5"
+	"online-store/internal/config"
+	"online-store/internal/jwtkeys"
 	"online-store/internal/models"
-	"online-store/internal/mqtt"
+	"online-store/internal/passwords"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
+// accessTokenTTL is how long an access token (JWT) stays valid
+const accessTokenTTL = 24 * time.Hour
+
+// maxUserAgentLength matches the refresh_tokens.user_agent column
+const maxUserAgentLength = 255
+
 // AuthService handles user authentication operations
 type AuthService struct {
-	db         *sql.DB      // Database connection
-	mqttClient *mqtt.Client // MQTT client for publishing events
+	users       UserRepository    // Where users are stored
+	sessions    SessionRepository // Where refresh-token sessions are stored
+	denylist    *TokenDenylist    // Users whose access tokens were revoked
+	publisher   Publisher         // Publishes events (our MQTT client)
+	jwtKeys     *jwtkeys.Keys     // Algorithm and key used to sign tokens
+	jwtIssuer   string            // Value of the "iss" claim in our tokens
+	jwtAudience string            // Value of the "aud" claim in our tokens
+	refreshTTL  time.Duration     // How long a refresh token stays valid
+	maxSessions int               // Most active sessions per user (0 = no limit)
+
+	hashing          passwords.Algorithm // How new passwords are hashed
+	minPasswordScore int                 // Weakest password accepted at registration (0 = any)
 }
 
 // NewAuthService creates a new authentication service
-func NewAuthService(db *sql.DB, mqttClient *mqtt.Client) *AuthService {
+func NewAuthService(users UserRepository, sessions SessionRepository, denylist *TokenDenylist, publisher Publisher, jwtKeys *jwtkeys.Keys, hashing passwords.Algorithm, cfg *config.Config) *AuthService {
 	return &AuthService{
-		db:         db,
-		mqttClient: mqttClient,
+		users:       users,
+		sessions:    sessions,
+		denylist:    denylist,
+		publisher:   publisher,
+		jwtKeys:     jwtKeys,
+		jwtIssuer:   cfg.JWTIssuer,
+		jwtAudience: cfg.JWTAudience,
+		refreshTTL:  time.Duration(cfg.RefreshTTL) * time.Hour,
+		maxSessions: cfg.MaxSessions,
+
+		hashing:          hashing,
+		minPasswordScore: cfg.MinPasswordScore,
 	}
 }
 
 // Register creates a new user account
+// If the email so far only checked out as a guest, the account isn't usable
+// right away: the password is kept aside and a verification link is emailed
+// (see registerGuest). Following the link turns the guest into the account,
+// guest orders included (see VerifyEmail). So the orders go to whoever
+// controls the mailbox, not to whoever registers the email first
 func (s *AuthService) Register(req models.UserRegistration) (*models.UserResponse, error) {
-	// Hash the password using bcrypt
-	// bcrypt is a secure way to store passwords - it's slow and uses salt
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	// Turn away passwords that are easy to guess, however long they are
+	if s.minPasswordScore > 0 && passwords.Score(req.Password) < s.minPasswordScore {
+		return nil, &ValidationError{Field: "password", Message: "is too easy to guess, try a longer passphrase"}
+	}
+
+	// Hash the password with the configured algorithm (bcrypt or argon2id)
+	// Both are slow on purpose and use a salt, so leaked hashes are hard to crack
+	hashedPassword, err := s.hashing.Hash(req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Insert the user into the database
-	result, err := s.db.Exec(
-		"INSERT INTO users (email, password_hash) VALUES (?, ?)",
-		req.Email, string(hashedPassword),
-	)
+	// If this email checked out as a guest before, the guest becomes the
+	// account once the email is confirmed. Otherwise insert a brand new user
+	userID, err := s.registerGuest(req.Email, hashedPassword)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, err
 	}
+	if userID == 0 {
+		userID, err = s.users.Create(req.Email, hashedPassword)
+		if err != nil {
+			return nil, err
+		}
 
-	// Get the ID of the newly created user
-	userID, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user ID: %w", err)
+		// Ask them to confirm their email - the account works before that, too
+		s.publishRegistered(userID, req.Email)
+		if err := s.requestVerification(userID, req.Email); err != nil {
+			fmt.Printf("Failed to request email verification: %v", err)
+		}
 	}
 
 	// Create user response
 	userResponse := &models.UserResponse{
-		ID:        int(userID),
+		ID:        userID,
 		Email:     req.Email,
+		Role:      models.RoleCustomer, // New users are always customers
 		CreatedAt: time.Now(),
 	}
 
-	// Publish MQTT event that a new user registered
-	// This allows other parts of the system to react (send welcome email, etc.)
+	return userResponse, nil
+}
+
+// publishRegistered publishes the MQTT event that a new user registered
+// This allows other parts of the system to react (send welcome email, etc.)
+func (s *AuthService) publishRegistered(userID int, email string) {
 	event := models.UserRegisteredEvent{
-		UserID:    int(userID),
-		Email:     req.Email,
+		UserID:    userID,
+		Email:     email,
 		Timestamp: time.Now().Unix(),
 	}
-	
-	if err := s.mqttClient.Publish("user/registered", event); err != nil {
+
+	if err := s.publisher.Publish("user/registered", event); err != nil {
 		// Don't fail the registration if MQTT publish fails
 		// Just log the error - the user was created successfully
 		fmt.Printf("Failed to publish user registered event: %v", err)
 	}
+}
 
-	return userResponse, nil
+// ResendVerification sends a new email verification link
+// Unknown emails, guests and verified users are silently skipped, so the
+// answer doesn't tell anyone which emails have an account
+func (s *AuthService) ResendVerification(email string) error {
+	user, err := s.users.GetByEmail(normalizeEmail(email))
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.IsGuest || user.EmailVerified {
+		return nil
+	}
+
+	return s.requestVerification(user.ID, user.Email)
+}
+
+// VerifyEmail confirms a user's email with the token from their verification link
+// For a guest who registered, this is when the guest becomes their account
+func (s *AuthService) VerifyEmail(token string) error {
+	tokenHash := hashToken(token)
+
+	userID, err := s.users.UpgradeGuest(tokenHash)
+	if errors.Is(err, ErrInvalidVerificationToken) {
+		// Not a registering guest's link - an account confirming its email
+		return s.users.VerifyEmail(tokenHash)
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	s.publishRegistered(user.ID, user.Email)
+	return nil
+}
+
+// requestVerification gives a user a new email verification token and has
+// the notification service email it to them
+// Links sent earlier stop working, so only the newest email counts
+func (s *AuthService) requestVerification(userID int, email string) error {
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetVerificationToken(userID, hashToken(token)); err != nil {
+		return err
+	}
+
+	return s.publishVerification(models.VerificationRequestedEvent{UserID: userID, Email: email, Token: token})
+}
+
+// publishVerification has the notification service email a verification link
+func (s *AuthService) publishVerification(event models.VerificationRequestedEvent) error {
+	event.Timestamp = time.Now().Unix()
+	if err := s.publisher.Publish("user/verification_requested", event); err != nil {
+		return fmt.Errorf("failed to publish verification request: %w", err)
+	}
+	return nil
+}
+
+// UpdateProfile changes the logged-in user's email
+// Other users' emails can't be taken. The access token keeps the old email
+// until it is refreshed, which reloads the user
+func (s *AuthService) UpdateProfile(userID int, req models.ProfileUpdate) (*models.UserResponse, error) {
+	user, err := s.users.GetByEmail(req.Email)
+	switch {
+	case err == nil && user.ID != userID:
+		return nil, ErrEmailTaken
+	case err != nil && !errors.Is(err, ErrUserNotFound):
+		return nil, err
+	}
+
+	user, err = s.users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing changed - no need to write or to verify the address again
+	if user.Email == req.Email {
+		response := user.ToResponse()
+		return &response, nil
+	}
+
+	oldEmail := user.Email
+	// The unique index still protects us if someone takes the email right now
+	if err := s.users.UpdateEmail(userID, req.Email); err != nil {
+		return nil, err
+	}
+	user.Email = req.Email
+
+	// The notification service picks this up and asks the user to confirm the new address
+	event := models.UserProfileUpdatedEvent{
+		UserID:               userID,
+		OldEmail:             oldEmail,
+		NewEmail:             req.Email,
+		VerificationRequired: true,
+		Timestamp:            time.Now().Unix(),
+	}
+
+	if err := s.publisher.Publish("user/profile_updated", event); err != nil {
+		fmt.Printf("Failed to publish user profile updated event: %v", err)
+	}
+
+	// UpdateEmail made the user unverified - send a link to the new address
+	if err := s.requestVerification(userID, req.Email); err != nil {
+		fmt.Printf("Failed to request email verification: %v", err)
+	}
+
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// CheckEmail reports whether an email can still be used to register
+// Guest checkouts don't count as taken, because registering upgrades them
+func (s *AuthService) CheckEmail(email string) (*models.EmailAvailability, error) {
+	email = normalizeEmail(email)
+
+	user, err := s.users.GetByEmail(email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	return &models.EmailAvailability{
+		Email:     email,
+		Available: err != nil || user.IsGuest,
+	}, nil
+}
+
+// CurrentRole returns the role a user has right now, whatever their token says
+// A user that no longer exists has no role ("")
+func (s *AuthService) CurrentRole(userID int) (string, error) {
+	user, err := s.users.GetByID(userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return user.Role, nil
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(req models.UserLogin) (string, *models.UserResponse, error) {
+// normalizeEmail trims spaces and lowercases an email, so " Ann@Example.com"
+// and "ann@example.com" are treated as the same address
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// registerGuest starts turning an existing guest user into an account
+// The password is stored next to a new verification token, and only becomes
+// the guest's password when the link emailed to the guest is followed
+// Registering again replaces both, so only the newest link works
+// It returns the guest's ID, or 0 if there's no guest with this email
+func (s *AuthService) registerGuest(email, passwordHash string) (int, error) {
+	user, err := s.users.GetByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !user.IsGuest {
+		// A real account already exists - let Create report the duplicate
+		return 0, nil
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return 0, err
+	}
+	err = s.users.SetGuestPassword(user.ID, passwordHash, hashToken(token))
+	if errors.Is(err, ErrUserNotFound) {
+		// Upgraded meanwhile - let Create report the duplicate
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Without the email the guest can't finish, but registering again sends a new one
+	event := models.VerificationRequestedEvent{UserID: user.ID, Email: user.Email, Token: token, GuestUpgrade: true}
+	if err := s.publishVerification(event); err != nil {
+		fmt.Printf("Failed to request email verification: %v", err)
+	}
+	return user.ID, nil
+}
+
+// Login authenticates a user and returns a JWT token plus a refresh token
+// userAgent (the client's User-Agent header) labels the session in the session list
+func (s *AuthService) Login(req models.UserLogin, userAgent string) (*models.TokenPair, *models.UserResponse, error) {
 	// Get user from database
-	var user models.User
-	err := s.db.QueryRow(
-		"SELECT id, email, password_hash, created_at FROM users WHERE email = ?",
-		req.Email,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt)
-	
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", nil, fmt.Errorf("invalid email or password")
+	user, err := s.users.GetByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, nil, fmt.Errorf("invalid email or password")
 		}
-		return "", nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, nil, err
 	}
 
 	// Check if password is correct
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	// The stored hash says which algorithm made it, so old bcrypt hashes
+	// keep working after switching to argon2id
+	err = passwords.Verify(user.PasswordHash, req.Password)
 	if err != nil {
-		return "", nil, fmt.Errorf("invalid email or password")
+		return nil, nil, fmt.Errorf("invalid email or password")
 	}
 
 	// Create JWT token
-	token, err := s.createJWTToken(user.ID, user.Email)
+	token, err := s.createJWTToken(user.ID, user.Email, user.Role)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to create token: %w", err)
+		return nil, nil, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	// Start a new session, so the client can refresh the token later
+	refreshToken, err := s.startSession(user.ID, userAgent)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Publish MQTT event that user logged in
 	event := struct {
-		UserID    int   `json:"user_id"`
+		UserID    int    `json:"user_id"`
 		Email     string `json:"email"`
 		Timestamp int64  `json:"timestamp"`
 	}{
@@ -114,28 +354,123 @@ func (s *AuthService) Login(req models.UserLogin) (string, *models.UserResponse,
 		Email:     user.Email,
 		Timestamp: time.Now().Unix(),
 	}
-	
-	if err := s.mqttClient.Publish("user/login", event); err != nil {
+
+	if err := s.publisher.Publish("user/login", event); err != nil {
 		fmt.Printf("Failed to publish user login event: %v", err)
 	}
 
 	userResponse := user.ToResponse()
-	return token, &userResponse, nil
+	return &models.TokenPair{AccessToken: token, RefreshToken: refreshToken}, &userResponse, nil
+}
+
+// Refresh exchanges a refresh token for a new access token
+// The refresh token is rotated: the old one is revoked and a new one returned,
+// so a stolen refresh token stops working once the real user refreshes
+func (s *AuthService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	session, err := s.sessions.GetActiveByHash(hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the user again, so the new token has their current email and role
+	user, err := s.users.GetByID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only one refresh can revoke the session; if another request with the
+	// same token got here first, this one is a replay and gets nothing
+	if err := s.sessions.Revoke(session.ID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	// The new session belongs to the same device as the old one
+	newRefreshToken, err := s.startSession(user.ID, session.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.createJWTToken(user.ID, user.Email, user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return &models.TokenPair{AccessToken: token, RefreshToken: newRefreshToken}, nil
+}
+
+// RevokeUserSessions logs a user out everywhere, e.g. when their account was compromised
+// All their refresh tokens are revoked, and access tokens they already have are
+// put on the denylist so they stop working right away instead of in up to 24 hours
+// Returns how many refresh tokens were revoked
+func (s *AuthService) RevokeUserSessions(userID int) (int64, error) {
+	if _, err := s.users.GetByID(userID); err != nil {
+		return 0, err
+	}
+
+	revoked, err := s.sessions.RevokeAllForUser(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	s.denylist.RevokeUser(userID)
+	return revoked, nil
+}
+
+// ListSessions returns the user's active sessions (logins that can still be refreshed)
+func (s *AuthService) ListSessions(userID int) ([]models.Session, error) {
+	return s.sessions.ListActive(userID)
+}
+
+// RevokeSession logs out one of the user's own sessions, e.g. a lost phone
+// Its refresh token stops working; an access token already issued to that
+// device stays valid until it expires
+func (s *AuthService) RevokeSession(userID, sessionID int) error {
+	return s.sessions.RevokeForUser(sessionID, userID)
+}
+
+// startSession stores a new refresh token for a user and returns it
+// If the user now has more sessions than allowed, the oldest ones are revoked
+func (s *AuthService) startSession(userID int, userAgent string) (string, error) {
+	refreshToken, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	// The column holds 255 characters, and some user agents are longer
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	if _, err := s.sessions.Create(userID, hashToken(refreshToken), userAgent, time.Now().Add(s.refreshTTL)); err != nil {
+		return "", err
+	}
+
+	if s.maxSessions > 0 {
+		if _, err := s.sessions.RevokeAllButNewest(userID, s.maxSessions); err != nil {
+			return "", err
+		}
+	}
+
+	return refreshToken, nil
 }
 
 // createJWTToken creates a JWT token for a user
-func (s *AuthService) createJWTToken(userID int, email string) (string, error) {
+func (s *AuthService) createJWTToken(userID int, email, role string) (string, error) {
 	// JWT claims - the data we put inside the token
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"email":   email,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(), // Token expires in 24 hours
+		"role":    role,
+		"iss":     s.jwtIssuer,                           // Who created the token
+		"aud":     s.jwtAudience,                         // Who the token is meant for
+		"iat":     time.Now().Unix(),                     // When it was issued (checked against the denylist)
+		"exp":     time.Now().Add(accessTokenTTL).Unix(), // Token expires in 24 hours
 	}
 
-	// Create the token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	
-	// Sign the token with our secret key
-	// In production, use a strong random secret key
-	return token.SignedString([]byte("your-super-secret-jwt-key-change-this-in-production"))
+	// Create the token and sign it with our key (see JWT_ALGORITHM)
+	// In production, use a strong random secret key (JWT_SECRET) or an RSA private key
+	return s.jwtKeys.Sign(claims)
 }
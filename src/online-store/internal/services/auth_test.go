@@ -0,0 +1,552 @@
+// internal/services/auth_test.go
+// Tests for registration, login and sessions
+
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"online-store/internal/config"
+	"online-store/internal/models"
+	"online-store/internal/passwords"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// register creates an account with a password that passes every strength check
+func register(t *testing.T, s *testStore, email string) *models.UserResponse {
+	t.Helper()
+	user, err := s.authService.Register(models.UserRegistration{Email: email, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	return user
+}
+
+const testPassword = "correct horse battery staple"
+
+// login logs in and returns the parsed access token
+func login(t *testing.T, s *testStore, email string) (*models.TokenPair, jwt.MapClaims) {
+	t.Helper()
+	tokens, _, err := s.authService.Login(models.UserLogin{Email: email, Password: testPassword}, "test-agent")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	token, err := jwt.Parse(tokens.AccessToken, s.jwtKeys.Verify)
+	if err != nil {
+		t.Fatalf("parse access token: %v", err)
+	}
+	return tokens, token.Claims.(jwt.MapClaims)
+}
+
+func TestLoginTokenHasConfiguredIssuerAndAudience(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) {
+		cfg.JWTIssuer = "shop-auth"
+		cfg.JWTAudience = "shop-api"
+	})
+	register(t, s, "ann@example.com")
+
+	_, claims := login(t, s, "ann@example.com")
+	if iss, _ := claims.GetIssuer(); iss != "shop-auth" {
+		t.Errorf("iss = %q, want %q", iss, "shop-auth")
+	}
+	if aud, _ := claims.GetAudience(); len(aud) != 1 || aud[0] != "shop-api" {
+		t.Errorf("aud = %v, want [shop-api]", aud)
+	}
+}
+
+func TestLoginRevokesSessionsOverTheLimit(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) { cfg.MaxSessions = 2 })
+	user := register(t, s, "ann@example.com")
+
+	first, _ := login(t, s, "ann@example.com")
+	login(t, s, "ann@example.com")
+	third, _ := login(t, s, "ann@example.com")
+
+	sessions, err := s.authService.ListSessions(user.ID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("%d active sessions, want 2", len(sessions))
+	}
+
+	// The oldest login was logged out, the newest one still works
+	if _, err := s.authService.Refresh(first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refreshing the oldest session: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := s.authService.Refresh(third.RefreshToken); err != nil {
+		t.Errorf("refreshing the newest session: %v", err)
+	}
+}
+
+func TestLoginWithoutSessionLimit(t *testing.T) {
+	s := newTestStore(t)
+	user := register(t, s, "ann@example.com")
+	for i := 0; i < 5; i++ {
+		login(t, s, "ann@example.com")
+	}
+
+	sessions, _ := s.authService.ListSessions(user.ID)
+	if len(sessions) != 5 {
+		t.Errorf("%d active sessions, want 5", len(sessions))
+	}
+}
+
+func TestUpdateProfilePublishesChange(t *testing.T) {
+	s := newTestStore(t)
+	user := register(t, s, "ann@example.com")
+
+	updated, err := s.authService.UpdateProfile(user.ID, models.ProfileUpdate{Email: "ann@example.org"})
+	if err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if updated.Email != "ann@example.org" {
+		t.Errorf("Email = %q, want ann@example.org", updated.Email)
+	}
+
+	events := s.publisher.published("user/profile_updated")
+	if len(events) != 1 {
+		t.Fatalf("published %d user/profile_updated events, want 1", len(events))
+	}
+	event := events[0].(models.UserProfileUpdatedEvent)
+	if event.UserID != user.ID || event.OldEmail != "ann@example.com" || event.NewEmail != "ann@example.org" || !event.VerificationRequired {
+		t.Errorf("event = %+v, want the old and new email with verification required", event)
+	}
+}
+
+func TestUpdateProfileSameEmailPublishesNothing(t *testing.T) {
+	s := newTestStore(t)
+	user := register(t, s, "ann@example.com")
+
+	if _, err := s.authService.UpdateProfile(user.ID, models.ProfileUpdate{Email: "ann@example.com"}); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if events := s.publisher.published("user/profile_updated"); len(events) != 0 {
+		t.Errorf("published %v for an unchanged profile", events)
+	}
+}
+
+func TestUpdateProfileTakenEmail(t *testing.T) {
+	s := newTestStore(t)
+	user := register(t, s, "ann@example.com")
+	s.addUser("bob@example.com")
+
+	_, err := s.authService.UpdateProfile(user.ID, models.ProfileUpdate{Email: "bob@example.com"})
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("err = %v, want ErrEmailTaken", err)
+	}
+	if events := s.publisher.published("user/profile_updated"); len(events) != 0 {
+		t.Errorf("published %v for a rejected change", events)
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	s := newTestStore(t)
+	ann := register(t, s, "ann@example.com")
+	bob := register(t, s, "bob@example.com")
+
+	annTokens, annClaims := login(t, s, "ann@example.com")
+	login(t, s, "ann@example.com")
+	bobTokens, bobClaims := login(t, s, "bob@example.com")
+
+	revoked, err := s.authService.RevokeUserSessions(ann.ID)
+	if err != nil {
+		t.Fatalf("RevokeUserSessions: %v", err)
+	}
+	if revoked != 2 {
+		t.Errorf("revoked %d sessions, want 2", revoked)
+	}
+
+	// Ann's refresh and access tokens stop working...
+	if _, err := s.authService.Refresh(annTokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refreshing Ann's session: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	annIssued, _ := annClaims.GetIssuedAt()
+	if !s.denylist.IsRevoked(ann.ID, annIssued.Time) {
+		t.Error("Ann's access token isn't on the denylist")
+	}
+
+	// ...Bob's keep working
+	bobIssued, _ := bobClaims.GetIssuedAt()
+	if s.denylist.IsRevoked(bob.ID, bobIssued.Time) {
+		t.Error("Bob's access token is on the denylist")
+	}
+	if _, err := s.authService.Refresh(bobTokens.RefreshToken); err != nil {
+		t.Errorf("refreshing Bob's session: %v", err)
+	}
+}
+
+func TestRevokeUserSessionsUnknownUser(t *testing.T) {
+	s := newTestStore(t)
+	if _, err := s.authService.RevokeUserSessions(42); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestCheckEmail(t *testing.T) {
+	s := newTestStore(t)
+	s.addUser("ann@example.com")
+	if _, err := s.users.CreateGuest("guest@example.com"); err != nil {
+		t.Fatalf("CreateGuest: %v", err)
+	}
+
+	tests := []struct {
+		email     string
+		want      string
+		available bool
+	}{
+		{"ann@example.com", "ann@example.com", false},
+		{"  Ann@Example.COM ", "ann@example.com", false},
+		{"bob@example.com", "bob@example.com", true},
+		{"guest@example.com", "guest@example.com", true}, // Registering upgrades the guest
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			availability, err := s.authService.CheckEmail(tt.email)
+			if err != nil {
+				t.Fatalf("CheckEmail: %v", err)
+			}
+			if availability.Email != tt.want || availability.Available != tt.available {
+				t.Errorf("CheckEmail = %+v, want {%s %v}", availability, tt.want, tt.available)
+			}
+		})
+	}
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	s := newTestStore(t)
+	ann := register(t, s, "ann@example.com")
+	bob := register(t, s, "bob@example.com")
+
+	loginFrom := func(email, userAgent string) *models.TokenPair {
+		t.Helper()
+		tokens, _, err := s.authService.Login(models.UserLogin{Email: email, Password: testPassword}, userAgent)
+		if err != nil {
+			t.Fatalf("Login: %v", err)
+		}
+		return tokens
+	}
+	laptop := loginFrom("ann@example.com", "Firefox on Linux")
+	phone := loginFrom("ann@example.com", "Shop app on Android")
+	loginFrom("bob@example.com", "Safari on macOS")
+
+	sessions, err := s.authService.ListSessions(ann.ID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("%d sessions, want Ann's 2", len(sessions))
+	}
+	var phoneSession models.Session
+	for _, session := range sessions {
+		if session.UserID != ann.ID || session.CreatedAt.IsZero() {
+			t.Errorf("session = %+v, want one of Ann's with its creation time", session)
+		}
+		if session.UserAgent == "Shop app on Android" {
+			phoneSession = session
+		}
+	}
+	if phoneSession.ID == 0 {
+		t.Fatalf("sessions = %+v, want one from the phone's user agent", sessions)
+	}
+
+	// Bob can't log out Ann's phone
+	if err := s.authService.RevokeSession(bob.ID, phoneSession.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking someone else's session: err = %v, want ErrSessionNotFound", err)
+	}
+
+	// Ann can; the laptop stays logged in
+	if err := s.authService.RevokeSession(ann.ID, phoneSession.ID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if _, err := s.authService.Refresh(phone.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refreshing the revoked session: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := s.authService.Refresh(laptop.RefreshToken); err != nil {
+		t.Errorf("refreshing the other session: %v", err)
+	}
+	if sessions, _ := s.authService.ListSessions(ann.ID); len(sessions) != 1 {
+		t.Errorf("%d sessions after revoking one, want 1", len(sessions))
+	}
+}
+
+// replayedSessions lets a second refresh with the same token win the race:
+// right after a session is looked up, it is revoked as if that refresh had run
+type replayedSessions struct {
+	*fakeSessionRepository
+}
+
+func (r replayedSessions) GetActiveByHash(tokenHash string) (*models.Session, error) {
+	session, err := r.fakeSessionRepository.GetActiveByHash(tokenHash)
+	if err == nil {
+		r.fakeSessionRepository.Revoke(session.ID)
+	}
+	return session, err
+}
+
+func TestRefreshLosingTheRaceIsRejected(t *testing.T) {
+	s := newTestStore(t)
+	register(t, s, "ann@example.com")
+	tokens, _ := login(t, s, "ann@example.com")
+
+	s.authService = NewAuthService(s.users, replayedSessions{s.sessions}, s.denylist, s.publisher, s.jwtKeys, passwords.Bcrypt, s.cfg)
+	if _, err := s.authService.Refresh(tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh: err = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// The losing refresh started no new session
+	if sessions := s.sessions.sessions; len(sessions) != 1 || sessions[0].active() {
+		t.Errorf("%d sessions, want just the revoked one", len(sessions))
+	}
+}
+
+func TestLoginTruncatesLongUserAgent(t *testing.T) {
+	s := newTestStore(t)
+	user := register(t, s, "ann@example.com")
+
+	userAgent := strings.Repeat("x", maxUserAgentLength+50)
+	if _, _, err := s.authService.Login(models.UserLogin{Email: "ann@example.com", Password: testPassword}, userAgent); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	sessions, _ := s.authService.ListSessions(user.ID)
+	if len(sessions) != 1 || len(sessions[0].UserAgent) != maxUserAgentLength {
+		t.Errorf("sessions = %+v, want one with the user agent cut to %d characters", sessions, maxUserAgentLength)
+	}
+}
+
+func TestRegisterUsesConfiguredHashAlgorithm(t *testing.T) {
+	s := newTestStore(t)
+	s.authService = NewAuthService(s.users, s.sessions, s.denylist, s.publisher, s.jwtKeys, passwords.Argon2id, s.cfg)
+
+	user := register(t, s, "ann@example.com")
+	stored, _ := s.users.GetByID(user.ID)
+	if !strings.HasPrefix(stored.PasswordHash, "$argon2id$") {
+		t.Errorf("hash = %q, want an argon2id hash", stored.PasswordHash)
+	}
+	login(t, s, "ann@example.com")
+}
+
+func TestLoginVerifiesEveryHashAlgorithm(t *testing.T) {
+	s := newTestStore(t)
+	s.authService = NewAuthService(s.users, s.sessions, s.denylist, s.publisher, s.jwtKeys, passwords.Argon2id, s.cfg)
+
+	// Accounts from before the switch keep their bcrypt hashes
+	for email, algorithm := range map[string]passwords.Algorithm{
+		"old@example.com": passwords.Bcrypt,
+		"new@example.com": passwords.Argon2id,
+	} {
+		hash, err := algorithm.Hash(testPassword)
+		if err != nil {
+			t.Fatalf("Hash: %v", err)
+		}
+		if _, err := s.users.Create(email, hash); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		login(t, s, email)
+		_, _, err = s.authService.Login(models.UserLogin{Email: email, Password: "wrong password"}, "test-agent")
+		if err == nil || err.Error() != "invalid email or password" {
+			t.Errorf("%s with a wrong password: err = %v, want invalid email or password", algorithm, err)
+		}
+	}
+}
+
+func TestRegisterMinPasswordScore(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) { cfg.MinPasswordScore = 3 })
+
+	_, err := s.authService.Register(models.UserRegistration{Email: "ann@example.com", Password: "password123"})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "password" {
+		t.Fatalf("err = %v, want a ValidationError for password", err)
+	}
+	if _, err := s.users.GetByEmail("ann@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("user was created for a weak password (err = %v)", err)
+	}
+
+	register(t, s, "ann@example.com")
+}
+
+func TestRegisterWithoutMinPasswordScore(t *testing.T) {
+	s := newTestStore(t)
+
+	if _, err := s.authService.Register(models.UserRegistration{Email: "ann@example.com", Password: "password123"}); err != nil {
+		t.Errorf("Register with the check off: %v", err)
+	}
+}
+
+func TestCurrentRole(t *testing.T) {
+	s := newTestStore(t)
+	userID := s.addUser("ann@example.com")
+
+	if role, err := s.authService.CurrentRole(userID); err != nil || role != models.RoleCustomer {
+		t.Errorf("CurrentRole = %q, %v, want customer", role, err)
+	}
+	s.users.setRole(userID, models.RoleAdmin)
+	if role, err := s.authService.CurrentRole(userID); err != nil || role != models.RoleAdmin {
+		t.Errorf("CurrentRole after promoting = %q, %v, want admin", role, err)
+	}
+
+	// A deleted user has no role left
+	if role, err := s.authService.CurrentRole(42); err != nil || role != "" {
+		t.Errorf("CurrentRole of an unknown user = %q, %v, want no role", role, err)
+	}
+}
+
+func TestRegisterClaimsGuestOrders(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	for i := 0; i < 2; i++ {
+		if _, err := s.orderService.CreateGuestOrder(models.GuestOrderRequest{Email: "guest@example.com", ProductID: product.ID, Quantity: 1}); err != nil {
+			t.Fatalf("CreateGuestOrder: %v", err)
+		}
+	}
+	// Someone else's guest order stays theirs
+	if _, err := s.orderService.CreateGuestOrder(models.GuestOrderRequest{Email: "other@example.com", ProductID: product.ID, Quantity: 1}); err != nil {
+		t.Fatalf("CreateGuestOrder: %v", err)
+	}
+
+	// Emails are case-insensitive, so this is the same person
+	register(t, s, "Guest@Example.com")
+
+	// Nothing is claimed until the email is confirmed
+	if _, _, err := s.authService.Login(models.UserLogin{Email: "guest@example.com", Password: testPassword}, "test-agent"); err == nil {
+		t.Fatalf("Login before verifying succeeded, want it to fail")
+	}
+	if got := len(s.publisher.published("user/registered")); got != 0 {
+		t.Errorf("%d user/registered events before verifying, want none", got)
+	}
+	tokens := verificationTokens(t, s)
+	if len(tokens) != 1 {
+		t.Fatalf("verification tokens = %v, want one", tokens)
+	}
+	if err := s.authService.VerifyEmail(tokens[0]); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+
+	_, user, err := s.authService.Login(models.UserLogin{Email: "guest@example.com", Password: testPassword}, "test-agent")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	orders, err := s.orderService.GetUserOrders(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserOrders: %v", err)
+	}
+	if len(orders) != 2 {
+		t.Errorf("user has %d orders after registering, want their 2 guest orders", len(orders))
+	}
+	if got := len(s.users.users); got != 2 {
+		t.Errorf("%d users, want 2 (the guest became the account)", got)
+	}
+	if guest, _ := s.users.GetByID(user.ID); guest == nil || guest.IsGuest || !guest.EmailVerified {
+		t.Errorf("user = %+v, want a full, verified account", guest)
+	}
+	if got := len(s.publisher.published("user/registered")); got != 1 {
+		t.Errorf("%d user/registered events, want 1", got)
+	}
+
+	// The link is used up
+	if err := s.authService.VerifyEmail(tokens[0]); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("second VerifyEmail: err = %v, want ErrInvalidVerificationToken", err)
+	}
+}
+
+func TestRegisterAsGuestOnlyNewestLinkCounts(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	if _, err := s.orderService.CreateGuestOrder(models.GuestOrderRequest{Email: "guest@example.com", ProductID: product.ID, Quantity: 1}); err != nil {
+		t.Fatalf("CreateGuestOrder: %v", err)
+	}
+
+	// Someone registers the guest's email with their own password, then the guest does
+	if _, err := s.authService.Register(models.UserRegistration{Email: "guest@example.com", Password: "someone-elses-password"}); err != nil {
+		t.Fatalf("first Register: %v", err)
+	}
+	register(t, s, "guest@example.com")
+	tokens := verificationTokens(t, s)
+	if len(tokens) != 2 {
+		t.Fatalf("verification tokens = %v, want one per registration", tokens)
+	}
+	for _, payload := range s.publisher.published("user/verification_requested") {
+		if event := payload.(models.VerificationRequestedEvent); !event.GuestUpgrade {
+			t.Errorf("event = %+v, want it marked as a guest upgrade", event)
+		}
+	}
+
+	// The first link no longer works, so it can't set the first password
+	if err := s.authService.VerifyEmail(tokens[0]); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("old token: err = %v, want ErrInvalidVerificationToken", err)
+	}
+	if err := s.authService.VerifyEmail(tokens[1]); err != nil {
+		t.Fatalf("new token: %v", err)
+	}
+	if _, _, err := s.authService.Login(models.UserLogin{Email: "guest@example.com", Password: "someone-elses-password"}, "test-agent"); err == nil {
+		t.Errorf("Login with the replaced password succeeded")
+	}
+	login(t, s, "guest@example.com")
+}
+
+// verificationTokens returns the tokens of every user/verification_requested event so far
+func verificationTokens(t *testing.T, s *testStore) []string {
+	t.Helper()
+	var tokens []string
+	for _, payload := range s.publisher.published("user/verification_requested") {
+		event, ok := payload.(models.VerificationRequestedEvent)
+		if !ok {
+			t.Fatalf("payload = %T, want models.VerificationRequestedEvent", payload)
+		}
+		tokens = append(tokens, event.Token)
+	}
+	return tokens
+}
+
+func TestResendVerification(t *testing.T) {
+	s := newTestStore(t)
+	register(t, s, "ann@example.com")
+
+	if err := s.authService.ResendVerification("  Ann@Example.com "); err != nil {
+		t.Fatalf("ResendVerification: %v", err)
+	}
+	tokens := verificationTokens(t, s)
+	if len(tokens) != 2 || tokens[0] == tokens[1] {
+		t.Fatalf("verification tokens = %v, want a new one after registering", tokens)
+	}
+
+	// Only the newest link works
+	if err := s.authService.VerifyEmail(tokens[0]); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("old token: err = %v, want ErrInvalidVerificationToken", err)
+	}
+	if err := s.authService.VerifyEmail(tokens[1]); err != nil {
+		t.Fatalf("new token: %v", err)
+	}
+
+	// Verified users get nothing more
+	if err := s.authService.ResendVerification("ann@example.com"); err != nil {
+		t.Fatalf("ResendVerification for a verified user: %v", err)
+	}
+	if got := len(verificationTokens(t, s)); got != 2 {
+		t.Errorf("%d verification requests after verifying, want still 2", got)
+	}
+}
+
+func TestResendVerificationIgnoresUnknownAndGuests(t *testing.T) {
+	s := newTestStore(t)
+	if _, err := s.users.CreateGuest("guest@example.com"); err != nil {
+		t.Fatalf("CreateGuest: %v", err)
+	}
+
+	// No error, so the answer doesn't tell who has an account
+	for _, email := range []string{"nobody@example.com", "guest@example.com"} {
+		if err := s.authService.ResendVerification(email); err != nil {
+			t.Errorf("ResendVerification(%q): %v", email, err)
+		}
+	}
+	if got := len(verificationTokens(t, s)); got != 0 {
+		t.Errorf("%d verification requests, want none", got)
+	}
+}
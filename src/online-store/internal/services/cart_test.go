@@ -0,0 +1,70 @@
+// internal/services/cart_test.go
+// Tests for checking a shopping cart before checkout
+
+package services
+
+import (
+	"testing"
+
+	"online-store/internal/config"
+	"online-store/internal/models"
+)
+
+func TestValidateCartMixed(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) { cfg.MaxOrderQty = 50 })
+	mug := s.addProduct("Mug", 900, 10)
+	lamp := s.addProduct("Lamp", 2499, 1)
+	draft := s.products.add(models.Product{Name: "Wok", PriceCents: 4500, StockQuantity: 5, Status: models.ProductStatusDraft})
+
+	validation, err := s.orderService.ValidateCart(models.CartValidationRequest{Items: []models.CartItem{
+		{ProductID: mug.ID, Quantity: 2},
+		{ProductID: lamp.ID, Quantity: 3}, // Only 1 left
+		{ProductID: 42, Quantity: 1},      // Unknown
+		{ProductID: draft.ID, Quantity: 1},
+		{ProductID: mug.ID, Quantity: 51}, // Above MaxOrderQty
+	}})
+	if err != nil {
+		t.Fatalf("ValidateCart: %v", err)
+	}
+
+	if len(validation.Lines) != 5 {
+		t.Fatalf("%d lines, want 5", len(validation.Lines))
+	}
+	first := validation.Lines[0]
+	if !first.Available || first.ProductName != "Mug" || first.UnitPriceCents != 900 || first.LineTotalCents != 1800 {
+		t.Errorf("line 1 = %+v, want 2 mugs for 1800", first)
+	}
+	for i, line := range validation.Lines[1:] {
+		if line.Available || line.Reason == "" || line.LineTotalCents != 0 {
+			t.Errorf("line %d = %+v, want unavailable with a reason", i+2, line)
+		}
+	}
+	if validation.TotalCents != 1800 || validation.AllAvailable {
+		t.Errorf("total = %d, all available = %t; want 1800 and false", validation.TotalCents, validation.AllAvailable)
+	}
+
+	// Nothing is reserved or ordered
+	if got := s.products.stock(mug.ID); got != 10 {
+		t.Errorf("mug stock = %d, want 10", got)
+	}
+	if len(s.orders.created) != 0 {
+		t.Errorf("orders were placed: %+v", s.orders.created)
+	}
+}
+
+func TestValidateCartAllAvailable(t *testing.T) {
+	s := newTestStore(t)
+	mug := s.addProduct("Mug", 900, 10)
+	lamp := s.addProduct("Lamp", 2499, 1)
+
+	validation, err := s.orderService.ValidateCart(models.CartValidationRequest{Items: []models.CartItem{
+		{ProductID: mug.ID, Quantity: 3},
+		{ProductID: lamp.ID, Quantity: 1},
+	}})
+	if err != nil {
+		t.Fatalf("ValidateCart: %v", err)
+	}
+	if !validation.AllAvailable || validation.TotalCents != 3*900+2499 {
+		t.Errorf("validation = %+v, want all available for %d", validation, 3*900+2499)
+	}
+}
@@ -0,0 +1,49 @@
+// internal/services/cursor.go
+// This file turns a position in an order list into an opaque cursor string and back
+
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orderCursor points at the last order of a page
+// Orders are sorted by (created_at, id), so this pair tells us exactly where to continue
+type orderCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// encodeOrderCursor turns a cursor into a URL-safe string
+// Clients should treat it as opaque and just send it back
+func encodeOrderCursor(cursor orderCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + strconv.Itoa(cursor.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeOrderCursor is the reverse of encodeOrderCursor
+func decodeOrderCursor(value string) (*orderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), ",")
+	if !found {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	cursor := orderCursor{}
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if cursor.ID, err = strconv.Atoi(id); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	return &cursor, nil
+}
@@ -0,0 +1,113 @@
+// internal/services/cursor_test.go
+// Tests for paging through a user's orders with cursors
+
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"online-store/internal/models"
+)
+
+func TestOrderCursorRoundTrip(t *testing.T) {
+	cursor := orderCursor{CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC), ID: 42}
+
+	decoded, err := decodeOrderCursor(encodeOrderCursor(cursor))
+	if err != nil {
+		t.Fatalf("decodeOrderCursor: %v", err)
+	}
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("decoded = %+v, want %+v", decoded, cursor)
+	}
+
+	for _, invalid := range []string{"not base64!", "bm8gY29tbWE", "eCwx"} {
+		if _, err := decodeOrderCursor(invalid); err == nil {
+			t.Errorf("decodeOrderCursor(%q) succeeded", invalid)
+		}
+	}
+}
+
+// placeBackdatedOrders places n orders, each a minute newer than the one before
+func placeBackdatedOrders(t *testing.T, s *testStore, userID, productID, n int) []int {
+	t.Helper()
+	start := time.Now().Add(-time.Hour)
+	var ids []int
+	for i := 0; i < n; i++ {
+		order := s.placeOrder(t, userID, productID, 1)
+		s.orders.setCreatedAt(order.ID, start.Add(time.Duration(i)*time.Minute))
+		ids = append(ids, order.ID)
+	}
+	return ids
+}
+
+// pageIDs returns the IDs of a page's orders
+func pageIDs(page *models.OrderPage) []int {
+	ids := []int{}
+	for _, order := range page.Orders {
+		ids = append(ids, order.ID)
+	}
+	return ids
+}
+
+func TestOrderPagesStayStableWhenOrdersArePlaced(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 100)
+	userID := s.addUser("ann@example.com")
+	ids := placeBackdatedOrders(t, s, userID, product.ID, 5)
+
+	first, err := s.orderService.GetUserOrdersPage(userID, models.OrderPageRequest{Limit: 2})
+	if err != nil {
+		t.Fatalf("first page: %v", err)
+	}
+	if got := pageIDs(first); len(got) != 2 || got[0] != ids[4] || got[1] != ids[3] || first.NextCursor == "" {
+		t.Fatalf("first page = %v (cursor %q), want the two newest orders and a cursor", got, first.NextCursor)
+	}
+
+	// A new order doesn't shift the next page
+	s.placeOrder(t, userID, product.ID, 1)
+
+	second, err := s.orderService.GetUserOrdersPage(userID, models.OrderPageRequest{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("second page: %v", err)
+	}
+	if got := pageIDs(second); len(got) != 2 || got[0] != ids[2] || got[1] != ids[1] {
+		t.Errorf("second page = %v, want %v", got, []int{ids[2], ids[1]})
+	}
+
+	last, err := s.orderService.GetUserOrdersPage(userID, models.OrderPageRequest{Limit: 2, Cursor: second.NextCursor})
+	if err != nil {
+		t.Fatalf("last page: %v", err)
+	}
+	if got := pageIDs(last); len(got) != 1 || got[0] != ids[0] || last.NextCursor != "" {
+		t.Errorf("last page = %v (cursor %q), want only the oldest order and no cursor", got, last.NextCursor)
+	}
+}
+
+func TestOrderPageRequestValidation(t *testing.T) {
+	s := newTestStore(t)
+
+	tests := []struct {
+		name  string
+		req   models.OrderPageRequest
+		field string
+	}{
+		{"bad cursor", models.OrderPageRequest{Cursor: "garbage"}, "cursor"},
+		{"cursor and offset", models.OrderPageRequest{Cursor: encodeOrderCursor(orderCursor{ID: 1}), Offset: 2}, "cursor"},
+		{"negative offset", models.OrderPageRequest{Offset: -1}, "offset"},
+	}
+	for _, tt := range tests {
+		_, err := s.orderService.GetUserOrdersPage(1, tt.req)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Field != tt.field {
+			t.Errorf("%s: err = %v, want a ValidationError for %q", tt.name, err, tt.field)
+		}
+	}
+
+	// No orders is an empty list, not null
+	page, err := s.orderService.GetUserOrdersPage(1, models.OrderPageRequest{})
+	if err != nil || page.Orders == nil || len(page.Orders) != 0 {
+		t.Errorf("page = %+v, err = %v, want an empty list", page, err)
+	}
+}
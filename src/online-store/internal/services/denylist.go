@@ -0,0 +1,61 @@
+// internal/services/denylist.go
+// This file keeps track of users whose access tokens were revoked
+// Access tokens (JWTs) can't be "deleted" - they stay valid until they expire -
+// so instead we remember "reject this user's tokens issued before time X"
+
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenDenylist remembers, per user, when their access tokens were revoked
+// It lives in memory, because entries only need to outlive the access tokens
+// they block (accessTokenTTL, plus the leeway the middleware gives expired
+// tokens). Note that revocations are lost on restart and aren't shared between instances
+type TokenDenylist struct {
+	mu        sync.Mutex
+	revokedAt map[int]time.Time // user ID -> tokens issued up to this moment are rejected
+	leeway    time.Duration     // How long after "exp" the middleware still accepts a token (JWT_LEEWAY_SEC)
+	now       func() time.Time  // replaceable clock
+}
+
+// NewTokenDenylist creates an empty denylist
+// leeway must be the clock skew leeway the auth middleware uses
+func NewTokenDenylist(leeway time.Duration) *TokenDenylist {
+	return &TokenDenylist{
+		revokedAt: make(map[int]time.Time),
+		leeway:    leeway,
+		now:       time.Now,
+	}
+}
+
+// RevokeUser rejects every access token the user was given until now
+// Tokens issued afterwards (when they log in again) work normally
+func (d *TokenDenylist) RevokeUser(userID int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+
+	// Forget entries whose tokens have all expired by now anyway
+	// An expired token still works for the leeway, so the entry has to as well
+	for id, revokedAt := range d.revokedAt {
+		if now.Sub(revokedAt) > accessTokenTTL+d.leeway {
+			delete(d.revokedAt, id)
+		}
+	}
+
+	// "iat" has whole-second precision, so a token from this same second counts as revoked
+	d.revokedAt[userID] = now.Truncate(time.Second)
+}
+
+// IsRevoked reports whether a token issued to the user at issuedAt was revoked
+func (d *TokenDenylist) IsRevoked(userID int, issuedAt time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	revokedAt, ok := d.revokedAt[userID]
+	return ok && !issuedAt.After(revokedAt)
+}
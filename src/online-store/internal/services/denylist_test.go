@@ -0,0 +1,33 @@
+// internal/services/denylist_test.go
+// Tests for the access token denylist
+
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDenylistKeepsEntriesForTheLeeway(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	d := NewTokenDenylist(30 * time.Second)
+	d.now = func() time.Time { return now }
+
+	issuedAt := now.Add(-time.Hour)
+	d.RevokeUser(1)
+
+	// The token expired 10 seconds ago, but the middleware still accepts it,
+	// so pruning (run by the next revocation) must not forget the entry yet
+	now = now.Add(accessTokenTTL + 10*time.Second)
+	d.RevokeUser(2)
+	if !d.IsRevoked(1, issuedAt) {
+		t.Error("the token works again within the leeway")
+	}
+
+	// Past the leeway the token is rejected anyway, and the entry can go
+	now = now.Add(30 * time.Second)
+	d.RevokeUser(2)
+	if d.IsRevoked(1, issuedAt) {
+		t.Error("the entry was kept after the token stopped working")
+	}
+}
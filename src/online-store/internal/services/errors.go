@@ -0,0 +1,70 @@
+// internal/services/errors.go
+// This file defines errors that callers of our services can check for
+
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors let handlers tell "this thing doesn't exist" apart from
+// real failures (like the database being down) using errors.Is
+var (
+	// ErrProductNotFound is returned when a product ID doesn't exist
+	ErrProductNotFound = errors.New("product not found")
+
+	// ErrOrderNotFound is returned when an order doesn't exist (or isn't yours)
+	ErrOrderNotFound = errors.New("order not found")
+
+	// ErrUserNotFound is returned when no user matches the lookup
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+	// ErrInvalidVerificationToken is returned for unknown or already used email verification tokens
+	ErrInvalidVerificationToken = errors.New("invalid or already used verification token")
+
+	// ErrSessionNotFound is returned when a session doesn't exist (or isn't yours)
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrAccountExists is returned when a guest checks out with a registered email
+	ErrAccountExists = errors.New("an account with this email already exists, please log in")
+
+	// ErrEmailTaken is returned when a user tries to change to another user's email
+	ErrEmailTaken = errors.New("this email is already in use")
+
+	// ErrInsufficientStock is returned when stock ran out while placing an order
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// ErrProductNotAvailable is returned when ordering a product outside its purchase window
+	ErrProductNotAvailable = errors.New("product can't be ordered right now")
+
+	// ErrDuplicateSKU is returned when another product already uses the SKU
+	ErrDuplicateSKU = errors.New("a product with this SKU already exists")
+
+	// ErrAlreadyOnWaitlist is returned when a user joins a product's waitlist twice
+	ErrAlreadyOnWaitlist = errors.New("you are already on the waitlist for this product")
+
+	// ErrProductInStock is returned when joining the waitlist of a product that can be ordered
+	ErrProductInStock = errors.New("product is in stock, it can be ordered right away")
+
+	// ErrOrderNotEditable is returned when changing an order that was already paid for
+	ErrOrderNotEditable = errors.New("only pending orders can be changed")
+
+	// ErrInvalidStatusTransition is returned when an order can't move to the requested status
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+)
+
+// ValidationError describes a request field that broke one of our business rules
+// Handlers can check for it with errors.As and tell the client which field is wrong
+type ValidationError struct {
+	Field   string // JSON name of the offending field
+	Message string // Human-readable explanation
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
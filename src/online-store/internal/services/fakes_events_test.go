@@ -0,0 +1,129 @@
+// internal/services/fakes_events_test.go
+// In-memory fakes of the audit log and the outbox
+
+package services
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"online-store/internal/models"
+)
+
+// fakeAuditRepository keeps audit entries in a slice, oldest first
+type fakeAuditRepository struct {
+	mu      sync.Mutex
+	entries []models.AuditEntry
+}
+
+func (r *fakeAuditRepository) Insert(entry models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.ID = len(r.entries) + 1
+	entry.CreatedAt = time.Now()
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *fakeAuditRepository) List(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []models.AuditEntry
+	for i := len(r.entries) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		entry := r.entries[i]
+		if filter.Entity != "" && entry.Entity != filter.Entity {
+			continue
+		}
+		if filter.EntityID != 0 && entry.EntityID != filter.EntityID {
+			continue
+		}
+		if filter.UserID != 0 && (entry.UserID == nil || *entry.UserID != filter.UserID) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// actions returns the actions recorded for an entity, oldest first
+func (r *fakeAuditRepository) actions(entity string, entityID int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var actions []string
+	for _, entry := range r.entries {
+		if entry.Entity == entity && entry.EntityID == entityID {
+			actions = append(actions, entry.Action)
+		}
+	}
+	return actions
+}
+
+// fakeOutboxRepository keeps waiting events in a slice, oldest first
+type fakeOutboxRepository struct {
+	mu       sync.Mutex
+	messages []models.OutboxMessage
+	nextID   int
+}
+
+func (r *fakeOutboxRepository) Enqueue(topic string, payload []byte, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	r.messages = append(r.messages, models.OutboxMessage{
+		ID:        r.nextID,
+		Topic:     topic,
+		Payload:   json.RawMessage(payload),
+		LastError: lastError,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (r *fakeOutboxRepository) ListPending(limit int) ([]models.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := append([]models.OutboxMessage(nil), r.messages...)
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+func (r *fakeOutboxRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, message := range r.messages {
+		if message.ID == id {
+			r.messages = append(r.messages[:i], r.messages[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *fakeOutboxRepository) RecordFailure(id int, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.messages {
+		if r.messages[i].ID == id {
+			r.messages[i].Attempts++
+			r.messages[i].LastError = lastError
+		}
+	}
+	return nil
+}
+
+// pending returns how many events are waiting
+func (r *fakeOutboxRepository) pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.messages)
+}
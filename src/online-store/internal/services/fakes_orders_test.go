@@ -0,0 +1,492 @@
+// internal/services/fakes_orders_test.go
+// In-memory fakes of the order and payment repositories
+
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"online-store/internal/models"
+)
+
+// fakeOrder is a stored order with the columns OrderResponse doesn't carry
+type fakeOrder struct {
+	models.Order
+	heldFrom       models.OrderStatus
+	trackingNumber string
+	archived       bool
+}
+
+// fakeOrderRepository keeps orders in a map
+// Like the SQL repository, Create takes the quantity out of the product's stock
+// and saves the order/created event in the outbox (here: the created list)
+type fakeOrderRepository struct {
+	mu       sync.Mutex
+	products *fakeProductRepository
+	users    *fakeUserRepository
+	orders   map[int]*fakeOrder
+	nextID   int
+	created  []models.OrderCreatedEvent
+}
+
+func newFakeOrderRepository(products *fakeProductRepository, users *fakeUserRepository) *fakeOrderRepository {
+	return &fakeOrderRepository{products: products, users: users, orders: make(map[int]*fakeOrder)}
+}
+
+// order returns a stored order, for checks the interface can't make
+func (r *fakeOrderRepository) order(id int) *fakeOrder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.orders[id]
+}
+
+// all returns every stored order
+func (r *fakeOrderRepository) all() []models.Order {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	orders := make([]models.Order, 0, len(r.orders))
+	for _, order := range r.orders {
+		orders = append(orders, order.Order)
+	}
+	return orders
+}
+
+// setCreatedAt backdates an order
+func (r *fakeOrderRepository) setCreatedAt(id int, createdAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[id].CreatedAt = createdAt
+}
+
+// setStatus changes an order's status without any checks
+func (r *fakeOrderRepository) setStatus(id int, status models.OrderStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[id].Status = status
+}
+
+// response turns a stored order into what customers see
+func (r *fakeOrderRepository) response(order *fakeOrder) models.OrderResponse {
+	name := ""
+	if product, err := r.products.GetByID(order.ProductID); err == nil {
+		name = product.Name
+	}
+	return models.OrderResponse{
+		ID:             order.ID,
+		ProductID:      order.ProductID,
+		ProductName:    name,
+		Quantity:       order.Quantity,
+		TotalCents:     order.TotalCents,
+		Status:         order.Status,
+		Note:           order.Note,
+		CreatedAt:      order.CreatedAt,
+		InvoiceNumber:  order.InvoiceNumber,
+		TrackingNumber: order.trackingNumber,
+	}
+}
+
+// userOrders returns a user's orders, archived ones included, sorted by (created_at, id)
+func (r *fakeOrderRepository) userOrders(userID int) []*fakeOrder {
+	var orders []*fakeOrder
+	for _, order := range r.orders {
+		if order.UserID == userID {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+		}
+		return orders[i].ID < orders[j].ID
+	})
+	return orders
+}
+
+func (r *fakeOrderRepository) Create(order *models.Order) (int, error) {
+	r.products.mu.Lock()
+	product, ok := r.products.products[order.ProductID]
+	if !ok || product.StockQuantity < order.Quantity {
+		r.products.mu.Unlock()
+		return 0, ErrInsufficientStock
+	}
+	product.StockQuantity -= order.Quantity
+	r.products.mu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	order.ID = r.nextID
+	order.InvoiceNumber = fmt.Sprintf("INV-%d-%06d", time.Now().Year(), order.ID)
+	stored := &fakeOrder{Order: *order}
+	stored.CreatedAt = time.Now()
+	r.orders[order.ID] = stored
+
+	r.created = append(r.created, models.OrderCreatedEvent{
+		OrderID:       order.ID,
+		UserID:        order.UserID,
+		ProductID:     order.ProductID,
+		Quantity:      order.Quantity,
+		TotalCents:    order.TotalCents,
+		TrackingToken: order.TrackingToken,
+	})
+	return order.ID, nil
+}
+
+func (r *fakeOrderRepository) GetByUser(userID int) ([]models.OrderResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	orders := r.userOrders(userID)
+	responses := make([]models.OrderResponse, 0, len(orders))
+	for i := len(orders) - 1; i >= 0; i-- {
+		responses = append(responses, r.response(orders[i]))
+	}
+	return responses, nil
+}
+
+func (r *fakeOrderRepository) ListByUser(userID, limit, offset int, after *orderCursor) ([]models.OrderResponse, error) {
+	all, err := r.GetByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var page []models.OrderResponse
+	for _, order := range all {
+		if after != nil {
+			// Newest first, so "after" the cursor means older than it
+			older := order.CreatedAt.Before(after.CreatedAt) ||
+				(order.CreatedAt.Equal(after.CreatedAt) && order.ID < after.ID)
+			if !older {
+				continue
+			}
+		}
+		page = append(page, order)
+	}
+
+	if offset >= len(page) {
+		return nil, nil
+	}
+	page = page[offset:]
+	if len(page) > limit {
+		page = page[:limit]
+	}
+	return page, nil
+}
+
+func (r *fakeOrderRepository) GetForUser(orderID, userID int) (*models.OrderResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok || order.UserID != userID {
+		return nil, ErrOrderNotFound
+	}
+	response := r.response(order)
+	return &response, nil
+}
+
+func (r *fakeOrderRepository) GetByTrackingTokenHash(tokenHash string) (*models.OrderTracking, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, order := range r.orders {
+		if order.TrackingTokenHash != "" && order.TrackingTokenHash == tokenHash {
+			response := r.response(order)
+			return &models.OrderTracking{
+				OrderID:     order.ID,
+				ProductName: response.ProductName,
+				Quantity:    order.Quantity,
+				Status:      order.Status,
+				CreatedAt:   order.CreatedAt,
+			}, nil
+		}
+	}
+	return nil, ErrOrderNotFound
+}
+
+func (r *fakeOrderRepository) GetStatus(orderID int) (models.OrderStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok || order.archived {
+		return "", ErrOrderNotFound
+	}
+	return order.Status, nil
+}
+
+// paid reports whether an order counts as paid for, like the paidOnly SQL condition
+func paid(status models.OrderStatus) bool {
+	return status == models.OrderStatusPaid || status == models.OrderStatusShipped || status == models.OrderStatusDelivered
+}
+
+func (r *fakeOrderRepository) SummaryForUser(userID int) (*models.UserOrderSummary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summary := &models.UserOrderSummary{UserID: userID}
+	for _, order := range r.userOrders(userID) {
+		summary.TotalOrders++
+		if paid(order.Status) {
+			summary.TotalSpendCents += int64(order.TotalCents)
+		}
+		createdAt := order.CreatedAt
+		summary.LastOrderAt = &createdAt
+	}
+	return summary, nil
+}
+
+func (r *fakeOrderRepository) UpdateStatus(orderID int, fromStatus, toStatus models.OrderStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok || order.Status != fromStatus {
+		return ErrInvalidStatusTransition
+	}
+	order.Status = toStatus
+	return nil
+}
+
+func (r *fakeOrderRepository) UpdateShipment(orderID int, fromStatus, toStatus models.OrderStatus, trackingNumber string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok || order.Status != fromStatus {
+		return ErrInvalidStatusTransition
+	}
+	order.Status = toStatus
+	order.trackingNumber = trackingNumber
+	return nil
+}
+
+func (r *fakeOrderRepository) Hold(orderID int, fromStatus models.OrderStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok || order.Status != fromStatus {
+		return ErrInvalidStatusTransition
+	}
+	order.heldFrom = fromStatus
+	order.Status = models.OrderStatusOnHold
+	return nil
+}
+
+func (r *fakeOrderRepository) Release(orderID int) (models.OrderStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok {
+		return "", ErrOrderNotFound
+	}
+	if order.Status != models.OrderStatusOnHold {
+		return "", fmt.Errorf("%w: order is %s, not on hold", ErrInvalidStatusTransition, order.Status)
+	}
+
+	restored := models.OrderStatusPending
+	if order.heldFrom != "" {
+		restored = order.heldFrom
+	}
+	order.Status, order.heldFrom = restored, ""
+	return restored, nil
+}
+
+func (r *fakeOrderRepository) PayHeld(orderID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok || order.Status != models.OrderStatusOnHold || order.heldFrom != models.OrderStatusPending {
+		return ErrInvalidStatusTransition
+	}
+	order.heldFrom = models.OrderStatusPaid
+	return nil
+}
+
+func (r *fakeOrderRepository) UpdateQuantity(orderID, userID, quantity, unitPriceCents int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok || order.UserID != userID {
+		return ErrOrderNotFound
+	}
+	if order.Status != models.OrderStatusPending {
+		return ErrOrderNotEditable
+	}
+
+	r.products.mu.Lock()
+	defer r.products.mu.Unlock()
+	product := r.products.products[order.ProductID]
+	if product.StockQuantity < quantity-order.Quantity {
+		return ErrInsufficientStock
+	}
+	total, err := editedTotal(order.TotalCents, order.Quantity, quantity, unitPriceCents)
+	if err != nil {
+		return err
+	}
+	product.StockQuantity -= quantity - order.Quantity
+	order.TotalCents = total
+	order.Quantity = quantity
+	return nil
+}
+
+func (r *fakeOrderRepository) UpdateStatuses(orderIDs []int, toStatus models.OrderStatus, canMove func(from models.OrderStatus) bool) ([]statusChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changes := make([]statusChange, 0, len(orderIDs))
+	for _, id := range orderIDs {
+		change := statusChange{orderID: id}
+		order, ok := r.orders[id]
+		switch {
+		case !ok:
+			change.err = ErrOrderNotFound
+		case !canMove(order.Status):
+			change.from = order.Status
+			change.err = fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, order.Status, toStatus)
+		default:
+			change.from = order.Status
+		}
+		changes = append(changes, change)
+	}
+	for _, change := range changes {
+		if change.err == nil {
+			r.orders[change.orderID].Status = toStatus
+		}
+	}
+	return changes, nil
+}
+
+func (r *fakeOrderRepository) Export(from, to time.Time, fn func(row models.OrderExportRow) error) error {
+	r.mu.Lock()
+	var rows []models.OrderExportRow
+	ids := make([]int, 0, len(r.orders))
+	for id := range r.orders {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		order := r.orders[id]
+		if (!from.IsZero() && order.CreatedAt.Before(from)) || (!to.IsZero() && !order.CreatedAt.Before(to)) {
+			continue
+		}
+		email := ""
+		if user, err := r.users.GetByID(order.UserID); err == nil {
+			email = user.Email
+		}
+		response := r.response(order)
+		rows = append(rows, models.OrderExportRow{
+			ID:          order.ID,
+			UserEmail:   email,
+			ProductName: response.ProductName,
+			Quantity:    order.Quantity,
+			TotalCents:  order.TotalCents,
+			Status:      string(order.Status),
+			CreatedAt:   order.CreatedAt,
+		})
+	}
+	r.mu.Unlock()
+
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *fakeOrderRepository) StreamByUser(userID int, fn func(order models.OrderResponse) error) error {
+	r.mu.Lock()
+	var responses []models.OrderResponse
+	for _, order := range r.userOrders(userID) {
+		responses = append(responses, r.response(order))
+	}
+	r.mu.Unlock()
+
+	for _, response := range responses {
+		if err := fn(response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *fakeOrderRepository) Archive(before time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int, 0, len(r.orders))
+	for id, order := range r.orders {
+		if !order.archived && order.Status == models.OrderStatusDelivered && order.CreatedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	for _, id := range ids {
+		r.orders[id].archived = true
+	}
+	return len(ids), nil
+}
+
+func (r *fakeOrderRepository) SalesByBucket(from, to time.Time, groupBy string) (map[string]models.SalesBucket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buckets := make(map[string]models.SalesBucket)
+	for _, order := range r.orders {
+		if !paid(order.Status) || order.CreatedAt.Before(from) || !order.CreatedAt.Before(to) {
+			continue
+		}
+		key := bucketStart(order.CreatedAt.UTC(), groupBy).Format(dateLayout)
+		bucket := buckets[key]
+		bucket.Start = key
+		bucket.Orders++
+		bucket.RevenueCents += int64(order.TotalCents)
+		buckets[key] = bucket
+	}
+	return buckets, nil
+}
+
+// fakePaymentRepository keeps confirmed payments and watermarks in memory
+type fakePaymentRepository struct {
+	confirmations []models.PaymentConfirmation
+	watermarks    map[string]time.Time
+}
+
+func newFakePaymentRepository() *fakePaymentRepository {
+	return &fakePaymentRepository{watermarks: make(map[string]time.Time)}
+}
+
+func (r *fakePaymentRepository) ConfirmedSince(since time.Time) ([]models.PaymentConfirmation, error) {
+	var confirmations []models.PaymentConfirmation
+	for _, confirmation := range r.confirmations {
+		if !confirmation.ConfirmedAt.Before(since) {
+			confirmations = append(confirmations, confirmation)
+		}
+	}
+	sort.SliceStable(confirmations, func(i, j int) bool {
+		return confirmations[i].ConfirmedAt.Before(confirmations[j].ConfirmedAt)
+	})
+	return confirmations, nil
+}
+
+func (r *fakePaymentRepository) GetWatermark(name string) (time.Time, error) {
+	return r.watermarks[name], nil
+}
+
+func (r *fakePaymentRepository) SetWatermark(name string, value time.Time) error {
+	r.watermarks[name] = value
+	return nil
+}
@@ -0,0 +1,539 @@
+// internal/services/fakes_products_test.go
+// In-memory fakes of the product, product event and waitlist repositories
+
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"online-store/internal/models"
+)
+
+// fakeProductRepository keeps products in a map
+type fakeProductRepository struct {
+	mu           sync.Mutex
+	products     map[int]*models.Product
+	nextID       int
+	nextSKU      int
+	priceChanges []models.PriceChange
+	orders       func() []models.Order // Every order, for GetRelated (set by newTestStore)
+
+	topSellers     []models.TopSeller // What GetTopSellers returns
+	topSellersArgs []interface{}      // What GetTopSellers was last called with
+}
+
+func newFakeProductRepository() *fakeProductRepository {
+	return &fakeProductRepository{products: make(map[int]*models.Product)}
+}
+
+// add stores a product as it is and returns a copy
+func (r *fakeProductRepository) add(product models.Product) *models.Product {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	product.ID = r.nextID
+	if product.Status == "" {
+		product.Status = models.ProductStatusPublished
+	}
+	if product.CreatedAt.IsZero() {
+		product.CreatedAt = time.Now()
+	}
+	r.products[product.ID] = &product
+	return r.copyOf(&product)
+}
+
+// stock returns a product's stock straight from the fake
+func (r *fakeProductRepository) stock(id int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.products[id].StockQuantity
+}
+
+// copyOf returns a copy of product with its sale applied, like scanProduct does
+func (r *fakeProductRepository) copyOf(product *models.Product) *models.Product {
+	result := *product
+	result.ApplySale(time.Now())
+	return &result
+}
+
+// sorted returns copies of the products matching keep, in ID order
+func (r *fakeProductRepository) sorted(keep func(p *models.Product) bool) []models.Product {
+	ids := make([]int, 0, len(r.products))
+	for id := range r.products {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var products []models.Product
+	for _, id := range ids {
+		if keep(r.products[id]) {
+			products = append(products, *r.copyOf(r.products[id]))
+		}
+	}
+	return products
+}
+
+func (r *fakeProductRepository) GetAll(limit int, includeDrafts, availableOnly bool) ([]models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	products := r.sorted(func(p *models.Product) bool {
+		if !includeDrafts && p.Status == models.ProductStatusDraft {
+			return false
+		}
+		return !availableOnly || p.AvailableAt(time.Now())
+	})
+	if limit > 0 && len(products) > limit {
+		products = products[:limit]
+	}
+	return products, nil
+}
+
+func (r *fakeProductRepository) Stream(fn func(product models.Product) error) error {
+	r.mu.Lock()
+	products := r.sorted(func(p *models.Product) bool { return true })
+	r.mu.Unlock()
+
+	for _, product := range products {
+		if err := fn(product); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *fakeProductRepository) GetOnSale() ([]models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sorted(func(p *models.Product) bool {
+		return p.Status == models.ProductStatusPublished && r.copyOf(p).OnSale
+	}), nil
+}
+
+func (r *fakeProductRepository) GetLowStock(mostShortFirst bool) ([]models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	products := r.sorted(func(p *models.Product) bool { return p.StockQuantity < p.ReorderLevel })
+	if mostShortFirst {
+		sort.SliceStable(products, func(i, j int) bool {
+			return products[i].ReorderLevel-products[i].StockQuantity > products[j].ReorderLevel-products[j].StockQuantity
+		})
+	}
+	return products, nil
+}
+
+func (r *fakeProductRepository) GetRelated(productID, limit int) ([]models.Product, error) {
+	// Orders have one product each, so "bought together" means "bought by the same user"
+	var orders []models.Order
+	if r.orders != nil {
+		orders = r.orders()
+	}
+	boughtThis := make(map[int]bool)
+	for _, order := range orders {
+		if order.ProductID == productID {
+			boughtThis[order.UserID] = true
+		}
+	}
+	buyers := make(map[int]map[int]bool) // Other product ID -> users who bought both
+	for _, order := range orders {
+		if order.ProductID != productID && boughtThis[order.UserID] {
+			if buyers[order.ProductID] == nil {
+				buyers[order.ProductID] = make(map[int]bool)
+			}
+			buyers[order.ProductID][order.UserID] = true
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	related := r.sorted(func(p *models.Product) bool {
+		return len(buyers[p.ID]) > 0 && p.StockQuantity > 0 && p.Status != models.ProductStatusDraft
+	})
+	sort.SliceStable(related, func(i, j int) bool {
+		return len(buyers[related[i].ID]) > len(buyers[related[j].ID])
+	})
+	if len(related) > limit {
+		related = related[:limit]
+	}
+	return related, nil
+}
+
+func (r *fakeProductRepository) GetTopSellers(from, to time.Time, byRevenue bool, limit int) ([]models.TopSeller, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.topSellersArgs = []interface{}{from, to, byRevenue, limit}
+	return r.topSellers, nil
+}
+
+func (r *fakeProductRepository) GetByID(id int) (*models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[id]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	return r.copyOf(product), nil
+}
+
+func (r *fakeProductRepository) GetBySKU(sku string) (*models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, product := range r.products {
+		if product.SKU != "" && product.SKU == sku {
+			return r.copyOf(product), nil
+		}
+	}
+	return nil, ErrProductNotFound
+}
+
+func (r *fakeProductRepository) CountInCategory(category string, excludeID int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, product := range r.products {
+		if product.Category == category && product.ID != excludeID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeProductRepository) ListCategories(hideEmpty bool) ([]models.CategoryCount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, product := range r.products {
+		if product.Category == "" || product.Status == models.ProductStatusDraft {
+			continue
+		}
+		if product.StockQuantity > 0 {
+			counts[product.Category]++
+		} else if _, ok := counts[product.Category]; !ok {
+			counts[product.Category] = 0
+		}
+	}
+
+	categories := []models.CategoryCount{}
+	for name, inStock := range counts {
+		if hideEmpty && inStock == 0 {
+			continue
+		}
+		categories = append(categories, models.CategoryCount{Name: name, InStock: inStock})
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories, nil
+}
+
+func (r *fakeProductRepository) ValueByCategory() ([]models.CategoryValuation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byName := make(map[string]*models.CategoryValuation)
+	for _, product := range r.products {
+		if product.StockQuantity <= 0 {
+			continue
+		}
+		valuation, ok := byName[product.Category]
+		if !ok {
+			valuation = &models.CategoryValuation{Category: product.Category}
+			byName[product.Category] = valuation
+		}
+		valuation.Products++
+		valuation.Units += int64(product.StockQuantity)
+		valuation.ValueCents += int64(product.PriceCents) * int64(product.StockQuantity)
+	}
+
+	categories := []models.CategoryValuation{}
+	for _, valuation := range byName {
+		categories = append(categories, *valuation)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Category < categories[j].Category })
+	return categories, nil
+}
+
+// skuTaken reports whether another product than id already uses sku
+func (r *fakeProductRepository) skuTaken(sku string, id int) bool {
+	for _, product := range r.products {
+		if sku != "" && product.SKU == sku && product.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *fakeProductRepository) Insert(req models.ProductRequest) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.skuTaken(req.SKU, 0) {
+		return 0, ErrDuplicateSKU
+	}
+
+	r.nextID++
+	product := &models.Product{
+		ID:             r.nextID,
+		SKU:            req.SKU,
+		Name:           req.Name,
+		Description:    req.Description,
+		Category:       req.Category,
+		PriceCents:     req.PriceCents,
+		ReorderLevel:   defaultReorderLevel,
+		MaxPerOrder:    req.MaxPerOrder,
+		SalePriceCents: req.SalePriceCents,
+		SaleEndsAt:     req.SaleEndsAt,
+		AvailableFrom:  req.AvailableFrom,
+		AvailableUntil: req.AvailableUntil,
+		Status:         models.ProductStatusPublished,
+		CreatedAt:      time.Now(),
+	}
+	if req.StockQuantity != nil {
+		product.StockQuantity = *req.StockQuantity
+	}
+	if req.ReorderLevel != nil {
+		product.ReorderLevel = *req.ReorderLevel
+	}
+	if req.Draft {
+		product.Status = models.ProductStatusDraft
+	}
+	r.products[product.ID] = product
+	return product.ID, nil
+}
+
+func (r *fakeProductRepository) Update(id int, req models.ProductRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[id]
+	if !ok {
+		return nil // UPDATE of a missing row changes nothing
+	}
+	if r.skuTaken(req.SKU, id) {
+		return ErrDuplicateSKU
+	}
+
+	product.SKU = req.SKU
+	product.Name = req.Name
+	product.Description = req.Description
+	product.Category = req.Category
+	product.PriceCents = req.PriceCents
+	if req.StockQuantity != nil {
+		product.StockQuantity = *req.StockQuantity
+	}
+	if req.ReorderLevel != nil {
+		product.ReorderLevel = *req.ReorderLevel
+	}
+	product.MaxPerOrder = req.MaxPerOrder
+	product.SalePriceCents = req.SalePriceCents
+	product.SaleEndsAt = req.SaleEndsAt
+	product.AvailableFrom = req.AvailableFrom
+	product.AvailableUntil = req.AvailableUntil
+	return nil
+}
+
+func (r *fakeProductRepository) Patch(id int, columns map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[id]
+	if !ok {
+		return nil
+	}
+	if sku, ok := columns["sku"].(string); ok && r.skuTaken(sku, id) {
+		return ErrDuplicateSKU
+	}
+
+	for name, value := range columns {
+		switch name {
+		case "sku":
+			product.SKU = value.(string)
+		case "name":
+			product.Name = value.(string)
+		case "description":
+			product.Description = value.(string)
+		case "category":
+			product.Category = value.(string)
+		case "price_cents":
+			product.PriceCents = value.(int)
+		case "stock_quantity":
+			product.StockQuantity = *value.(*int)
+		case "reorder_level":
+			product.ReorderLevel = *value.(*int)
+		case "max_per_order":
+			product.MaxPerOrder = value.(*int)
+		case "sale_price_cents":
+			product.SalePriceCents = value.(*int)
+		case "sale_ends_at":
+			product.SaleEndsAt = value.(*time.Time)
+		case "available_from":
+			product.AvailableFrom = value.(*time.Time)
+		case "available_until":
+			product.AvailableUntil = value.(*time.Time)
+		default:
+			return fmt.Errorf("fake: unknown column %q", name)
+		}
+	}
+	return nil
+}
+
+func (r *fakeProductRepository) Publish(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if product, ok := r.products[id]; ok {
+		product.Status = models.ProductStatusPublished
+	}
+	return nil
+}
+
+func (r *fakeProductRepository) NextSKUNumber() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextSKU++
+	return r.nextSKU, nil
+}
+
+func (r *fakeProductRepository) UpdateStock(productID, newStock int) (*models.StockChange, error) {
+	changes, err := r.BulkUpdateStock([]models.StockUpdate{{ProductID: productID, Stock: newStock}})
+	if err != nil {
+		return nil, err
+	}
+	return &changes[0], nil
+}
+
+func (r *fakeProductRepository) BulkUpdateStock(updates []models.StockUpdate) ([]models.StockChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// All or nothing, like the transaction
+	for _, update := range updates {
+		if _, ok := r.products[update.ProductID]; !ok {
+			return nil, fmt.Errorf("%w: id %d", ErrProductNotFound, update.ProductID)
+		}
+	}
+
+	var changes []models.StockChange
+	for _, update := range updates {
+		product := r.products[update.ProductID]
+		previous := product.StockQuantity
+		product.StockQuantity = update.Stock
+		changes = append(changes, models.StockChange{Product: *r.copyOf(product), PreviousStock: previous})
+	}
+	return changes, nil
+}
+
+func (r *fakeProductRepository) RecordPriceChange(change models.PriceChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	change.ID = len(r.priceChanges) + 1
+	change.ChangedAt = time.Now()
+	r.priceChanges = append(r.priceChanges, change)
+	return nil
+}
+
+func (r *fakeProductRepository) GetPriceHistory(productID int) ([]models.PriceChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	history := []models.PriceChange{}
+	for i := len(r.priceChanges) - 1; i >= 0; i-- {
+		if r.priceChanges[i].ProductID == productID {
+			history = append(history, r.priceChanges[i])
+		}
+	}
+	return history, nil
+}
+
+// fakeProductEventRepository keeps product events in a slice, oldest first
+type fakeProductEventRepository struct {
+	mu     sync.Mutex
+	events []models.ProductEvent
+}
+
+func (r *fakeProductEventRepository) Insert(event models.ProductEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event.ID = len(r.events) + 1
+	event.CreatedAt = time.Now()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *fakeProductEventRepository) ListForProduct(productID, limit int) ([]models.ProductEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []models.ProductEvent{}
+	for i := len(r.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if r.events[i].ProductID == productID {
+			events = append(events, r.events[i])
+		}
+	}
+	return events, nil
+}
+
+// types returns the event types recorded for a product, oldest first
+func (r *fakeProductEventRepository) types(productID int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var types []string
+	for _, event := range r.events {
+		if event.ProductID == productID {
+			types = append(types, event.Type)
+		}
+	}
+	return types
+}
+
+// fakeWaitlistRepository keeps each product's waitlist in join order
+type fakeWaitlistRepository struct {
+	mu      sync.Mutex
+	entries map[int][]models.WaitlistEntry
+	emails  map[int]string // User ID -> email, for the entries
+}
+
+func newFakeWaitlistRepository() *fakeWaitlistRepository {
+	return &fakeWaitlistRepository{entries: make(map[int][]models.WaitlistEntry), emails: make(map[int]string)}
+}
+
+func (r *fakeWaitlistRepository) Add(productID, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.entries[productID] {
+		if entry.UserID == userID {
+			return ErrAlreadyOnWaitlist
+		}
+	}
+	r.entries[productID] = append(r.entries[productID], models.WaitlistEntry{
+		ProductID: productID,
+		UserID:    userID,
+		Email:     r.emails[userID],
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (r *fakeWaitlistRepository) TakeAll(productID int) ([]models.WaitlistEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := r.entries[productID]
+	delete(r.entries, productID)
+	return entries, nil
+}
@@ -0,0 +1,209 @@
+// internal/services/fakes_test.go
+// The test store, and in-memory fakes of the publisher, so services can be
+// tested without MariaDB or an MQTT broker
+// The repository fakes are next to it, one file per area (fakes_*_test.go)
+// They follow the documented behavior of the SQL repositories (errors, ordering),
+// not every detail of the SQL; the SQL repositories themselves are tested on
+// sqlmock (newMockDB), which checks the exact statements they run
+
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"online-store/internal/config"
+	"online-store/internal/database"
+	"online-store/internal/jwtkeys"
+	"online-store/internal/models"
+	"online-store/internal/passwords"
+	"online-store/internal/sanitize"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// testStore is every service wired to fakes, like main wires them to the database
+type testStore struct {
+	cfg *config.Config
+
+	products  *fakeProductRepository
+	orders    *fakeOrderRepository
+	users     *fakeUserRepository
+	sessions  *fakeSessionRepository
+	audits    *fakeAuditRepository
+	events    *fakeProductEventRepository
+	waitlist  *fakeWaitlistRepository
+	outbox    *fakeOutboxRepository
+	payments  *fakePaymentRepository
+	publisher *fakePublisher
+	relay     *fakeNotifier
+	denylist  *TokenDenylist
+	jwtKeys   *jwtkeys.Keys
+
+	audit          *AuditService
+	productService *ProductService
+	orderService   *OrderService
+	authService    *AuthService
+}
+
+// testConfig returns the configuration the services are tested with: the
+// defaults of config.Load, without reading the environment
+func testConfig() *config.Config {
+	return &config.Config{
+		JWTIssuer:             "online-store",
+		JWTAudience:           "online-store-api",
+		Currency:              "USD",
+		MaxOrderQty:           1000,
+		RefreshTTL:            720,
+		MaxProductsListed:     500,
+		ListDescriptionLength: 200,
+		BackInStockMin:        1,
+		RiskHoldThreshold:     80,
+		Features:              map[string]bool{config.FeatureGuestCheckout: true},
+	}
+}
+
+// newTestStore wires up the services; configure (optional) changes the config first
+func newTestStore(t *testing.T, configure ...func(cfg *config.Config)) *testStore {
+	t.Helper()
+
+	cfg := testConfig()
+	for _, change := range configure {
+		change(cfg)
+	}
+
+	s := &testStore{
+		cfg:       cfg,
+		products:  newFakeProductRepository(),
+		users:     newFakeUserRepository(),
+		sessions:  &fakeSessionRepository{},
+		audits:    &fakeAuditRepository{},
+		events:    &fakeProductEventRepository{},
+		waitlist:  newFakeWaitlistRepository(),
+		outbox:    &fakeOutboxRepository{},
+		payments:  newFakePaymentRepository(),
+		publisher: &fakePublisher{},
+		relay:     &fakeNotifier{},
+		denylist:  NewTokenDenylist(time.Duration(cfg.JWTLeewaySec) * time.Second),
+		jwtKeys:   jwtkeys.NewHS256("test-secret"),
+	}
+	s.orders = newFakeOrderRepository(s.products, s.users)
+	s.products.orders = s.orders.all
+
+	s.audit = NewAuditService(s.audits)
+	s.productService = NewProductService(s.products, s.events, s.waitlist, s.publisher, s.audit, sanitize.PolicyEscape, cfg)
+	s.orderService = NewOrderService(s.orders, s.products, s.users, s.publisher, s.relay, s.audit, cfg)
+	s.authService = NewAuthService(s.users, s.sessions, s.denylist, s.publisher, s.jwtKeys, passwords.Bcrypt, cfg)
+	return s
+}
+
+// addProduct stores a published product with the given price and stock
+func (s *testStore) addProduct(name string, priceCents, stock int) *models.Product {
+	return s.products.add(models.Product{
+		Name:          name,
+		PriceCents:    priceCents,
+		StockQuantity: stock,
+		ReorderLevel:  defaultReorderLevel,
+		Status:        models.ProductStatusPublished,
+	})
+}
+
+// addUser stores a registered customer
+func (s *testStore) addUser(email string) int {
+	id, err := s.users.Create(email, "$2a$10$not-a-real-hash")
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// placeOrder creates an order as userID and fails the test if that doesn't work
+func (s *testStore) placeOrder(t *testing.T, userID, productID, quantity int) *models.OrderResponse {
+	t.Helper()
+	order, err := s.orderService.CreateOrder(userID, models.OrderRequest{ProductID: productID, Quantity: quantity})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	return order
+}
+
+// intPtr returns a pointer to n, for the optional fields of requests
+func intPtr(n int) *int {
+	return &n
+}
+
+// timePtr returns a pointer to t
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// publishedMessage is one event the fake publisher was given
+type publishedMessage struct {
+	Topic   string
+	Payload interface{}
+}
+
+// fakePublisher records what is published; set err to make publishing fail
+type fakePublisher struct {
+	mu       sync.Mutex
+	err      error
+	messages []publishedMessage
+}
+
+func (p *fakePublisher) Publish(topic string, payload interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, publishedMessage{Topic: topic, Payload: payload})
+	return nil
+}
+
+// fail makes every publish fail with err from now on (nil: succeed again)
+func (p *fakePublisher) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// published returns the payloads published to topic, oldest first
+func (p *fakePublisher) published(topic string) []interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var payloads []interface{}
+	for _, message := range p.messages {
+		if message.Topic == topic {
+			payloads = append(payloads, message.Payload)
+		}
+	}
+	return payloads
+}
+
+// fakeNotifier counts how often the outbox worker was woken up
+type fakeNotifier struct {
+	notified int
+}
+
+func (n *fakeNotifier) Notify() {
+	n.notified++
+}
+
+// newMockDB returns a database backed by sqlmock; unmet expectations fail the test
+func newMockDB(t *testing.T) (*database.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expectations: %v", err)
+		}
+		sqlDB.Close()
+	})
+	return &database.DB{DB: sqlDB}, mock
+}
@@ -0,0 +1,307 @@
+// internal/services/fakes_users_test.go
+// In-memory fakes of the user and session repositories
+
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"online-store/internal/models"
+)
+
+// fakeUserRepository keeps users in a map
+type fakeUserRepository struct {
+	mu                 sync.Mutex
+	users              map[int]*models.User
+	nextID             int
+	verificationTokens map[string]int // Token hash -> user ID
+	pendingPasswords   map[int]string // Guest user ID -> password hash waiting for verification
+}
+
+func newFakeUserRepository() *fakeUserRepository {
+	return &fakeUserRepository{
+		users:              make(map[int]*models.User),
+		verificationTokens: make(map[string]int),
+		pendingPasswords:   make(map[int]string),
+	}
+}
+
+// byEmail finds a user; the email column is case-insensitive like MariaDB's default collation
+func (r *fakeUserRepository) byEmail(email string) *models.User {
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return user
+		}
+	}
+	return nil
+}
+
+func (r *fakeUserRepository) insert(email, passwordHash string, guest bool) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.byEmail(email) != nil {
+		return 0, errors.New("failed to create user: duplicate email")
+	}
+	r.nextID++
+	r.users[r.nextID] = &models.User{
+		ID:           r.nextID,
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         models.RoleCustomer,
+		IsGuest:      guest,
+		CreatedAt:    time.Now(),
+	}
+	return r.nextID, nil
+}
+
+func (r *fakeUserRepository) Create(email, passwordHash string) (int, error) {
+	return r.insert(email, passwordHash, false)
+}
+
+func (r *fakeUserRepository) CreateGuest(email string) (int, error) {
+	return r.insert(email, "", true)
+}
+
+func (r *fakeUserRepository) SetGuestPassword(userID int, passwordHash, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok || !user.IsGuest {
+		return ErrUserNotFound
+	}
+	r.setToken(userID, tokenHash)
+	r.pendingPasswords[userID] = passwordHash
+	return nil
+}
+
+func (r *fakeUserRepository) UpgradeGuest(tokenHash string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userID, ok := r.verificationTokens[tokenHash]
+	if !ok {
+		return 0, ErrInvalidVerificationToken
+	}
+	passwordHash, pending := r.pendingPasswords[userID]
+	user := r.users[userID]
+	if !pending || !user.IsGuest {
+		return 0, ErrInvalidVerificationToken
+	}
+	delete(r.verificationTokens, tokenHash)
+	delete(r.pendingPasswords, userID)
+	user.PasswordHash = passwordHash
+	user.IsGuest = false
+	user.EmailVerified = true
+	return userID, nil
+}
+
+func (r *fakeUserRepository) UpdateEmail(userID int, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if other := r.byEmail(email); other != nil && other.ID != userID {
+		return ErrEmailTaken
+	}
+	user, ok := r.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Email = email
+	user.EmailVerified = false
+	return nil
+}
+
+func (r *fakeUserRepository) SetVerificationToken(userID int, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setToken(userID, tokenHash)
+	return nil
+}
+
+// setToken replaces a user's verification token, like the UNIQUE column does
+func (r *fakeUserRepository) setToken(userID int, tokenHash string) {
+	for hash, id := range r.verificationTokens {
+		if id == userID {
+			delete(r.verificationTokens, hash)
+		}
+	}
+	r.verificationTokens[tokenHash] = userID
+}
+
+func (r *fakeUserRepository) VerifyEmail(tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userID, ok := r.verificationTokens[tokenHash]
+	if !ok {
+		return ErrInvalidVerificationToken
+	}
+	delete(r.verificationTokens, tokenHash)
+	r.users[userID].EmailVerified = true
+	return nil
+}
+
+func (r *fakeUserRepository) GetByEmail(email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user := r.byEmail(email)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepository) GetByID(id int) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// setRole changes a user's role, like an admin editing the users table
+func (r *fakeUserRepository) setRole(id int, role string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[id].Role = role
+}
+
+// fakeSession is a stored session with its token hash
+type fakeSession struct {
+	models.Session
+	tokenHash string
+}
+
+// fakeSessionRepository keeps sessions in a slice, oldest first
+type fakeSessionRepository struct {
+	mu       sync.Mutex
+	sessions []*fakeSession
+}
+
+// active reports whether a session can still be used
+func (s *fakeSession) active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+func (r *fakeSessionRepository) Create(userID int, tokenHash, userAgent string, expiresAt time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session := &fakeSession{
+		Session: models.Session{
+			ID:        len(r.sessions) + 1,
+			UserID:    userID,
+			UserAgent: userAgent,
+			CreatedAt: time.Now(),
+			ExpiresAt: expiresAt,
+		},
+		tokenHash: tokenHash,
+	}
+	r.sessions = append(r.sessions, session)
+	return session.ID, nil
+}
+
+func (r *fakeSessionRepository) GetActiveByHash(tokenHash string) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, session := range r.sessions {
+		if session.tokenHash == tokenHash && session.active() {
+			copied := session.Session
+			return &copied, nil
+		}
+	}
+	return nil, ErrInvalidRefreshToken
+}
+
+func (r *fakeSessionRepository) ListActive(userID int) ([]models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []models.Session
+	for i := len(r.sessions) - 1; i >= 0; i-- {
+		if r.sessions[i].UserID == userID && r.sessions[i].active() {
+			sessions = append(sessions, r.sessions[i].Session)
+		}
+	}
+	return sessions, nil
+}
+
+// revoke ends a session
+func (s *fakeSession) revoke() {
+	now := time.Now()
+	s.RevokedAt = &now
+}
+
+func (r *fakeSessionRepository) RevokeForUser(sessionID, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, session := range r.sessions {
+		if session.ID == sessionID && session.UserID == userID && session.active() {
+			session.revoke()
+			return nil
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (r *fakeSessionRepository) Revoke(sessionID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, session := range r.sessions {
+		if session.ID == sessionID && session.RevokedAt == nil {
+			session.revoke()
+			return nil
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (r *fakeSessionRepository) RevokeAllButNewest(userID, keep int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var revoked int64
+	kept := 0
+	for i := len(r.sessions) - 1; i >= 0; i-- {
+		session := r.sessions[i]
+		if session.UserID != userID || !session.active() {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		session.revoke()
+		revoked++
+	}
+	return revoked, nil
+}
+
+func (r *fakeSessionRepository) RevokeAllForUser(userID int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var revoked int64
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.active() {
+			session.revoke()
+			revoked++
+		}
+	}
+	return revoked, nil
+}
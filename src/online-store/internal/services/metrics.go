@@ -0,0 +1,103 @@
+// internal/services/metrics.go
+// This file contains the sales report for admins
+
+package services
+
+import (
+	"time"
+
+	"online-store/internal/models"
+)
+
+// dateLayout is how we write dates in reports (YYYY-MM-DD)
+const dateLayout = "2006-01-02"
+
+// defaultSalesDays is the report range when no from date is given
+const defaultSalesDays = 30
+
+// maxSalesBuckets stops a huge range (like ten years by day) from building an enormous response
+const maxSalesBuckets = 1000
+
+// GetSalesMetrics reports revenue and order counts per day, week or month
+// from and to are days, both included; zero values mean "30 days ago" and "today"
+func (s *OrderService) GetSalesMetrics(from, to time.Time, groupBy string) (*models.SalesMetrics, error) {
+	if groupBy == "" {
+		groupBy = "day"
+	}
+	if _, ok := salesBucketColumns[groupBy]; !ok {
+		return nil, &ValidationError{Field: "group_by", Message: "must be day, week or month"}
+	}
+
+	if to.IsZero() {
+		to = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -(defaultSalesDays - 1))
+	}
+
+	// Only the days count; a time of day would add a bucket after the last day
+	from, to = bucketStart(from, "day"), bucketStart(to, "day")
+	if from.After(to) {
+		return nil, &ValidationError{Field: "from", Message: "must not be after to"}
+	}
+
+	// Start every bucket on its first day, and go up to midnight after the last day
+	start := bucketStart(from, groupBy)
+	end := to.AddDate(0, 0, 1)
+
+	// Fill in the buckets without sales too, so the report has no gaps
+	var starts []time.Time
+	for day := start; day.Before(end); day = nextBucket(day, groupBy) {
+		starts = append(starts, day)
+		if len(starts) > maxSalesBuckets {
+			return nil, &ValidationError{Field: "from", Message: "range has too many buckets, use a larger group_by"}
+		}
+	}
+
+	sales, err := s.orders.SalesByBucket(start, end, groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := &models.SalesMetrics{
+		From:    from.Format(dateLayout),
+		To:      to.Format(dateLayout),
+		GroupBy: groupBy,
+		Buckets: make([]models.SalesBucket, 0, len(starts)),
+	}
+	for _, day := range starts {
+		key := day.Format(dateLayout)
+		bucket, ok := sales[key]
+		if !ok {
+			bucket = models.SalesBucket{Start: key}
+		}
+		metrics.Buckets = append(metrics.Buckets, bucket)
+	}
+
+	return metrics, nil
+}
+
+// bucketStart returns the first day of the bucket t falls in
+// Weeks start on Monday, like MariaDB's WEEKDAY()
+func bucketStart(t time.Time, groupBy string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch groupBy {
+	case "week":
+		// Weekday() is 0 on Sunday; shift so Monday is 0
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// nextBucket returns the first day of the bucket after the one starting at start
+func nextBucket(start time.Time, groupBy string) time.Time {
+	switch groupBy {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
@@ -0,0 +1,149 @@
+// internal/services/metrics_test.go
+// Tests for the admin sales report
+
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"online-store/internal/models"
+)
+
+// day returns noon UTC on a day in March 2026 (March 2nd is a Monday)
+func day(d int) time.Time {
+	return time.Date(2026, time.March, d, 12, 0, 0, 0, time.UTC)
+}
+
+// seedSales places orders for 1000 cents per item on a few days of March 2026
+func seedSales(t *testing.T, s *testStore) {
+	t.Helper()
+
+	product := s.addProduct("Mug", 1000, 100)
+	userID := s.addUser("ann@example.com")
+
+	seed := []struct {
+		day      int
+		quantity int
+		status   models.OrderStatus
+	}{
+		{2, 2, models.OrderStatusPaid},
+		{2, 5, models.OrderStatusPending}, // Never paid, not a sale
+		{4, 1, models.OrderStatusShipped},
+		{9, 4, models.OrderStatusOnHold}, // Waiting on the risk check, not a sale
+		{10, 3, models.OrderStatusDelivered},
+	}
+	for _, order := range seed {
+		placed := s.placeOrder(t, userID, product.ID, order.quantity)
+		s.orders.setCreatedAt(placed.ID, day(order.day))
+		s.orders.setStatus(placed.ID, order.status)
+	}
+}
+
+func TestGetSalesMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    time.Time
+		to      time.Time
+		groupBy string
+		want    []models.SalesBucket
+	}{
+		{
+			name: "by day, with a day without sales",
+			from: day(2), to: day(4), groupBy: "day",
+			want: []models.SalesBucket{
+				{Start: "2026-03-02", Orders: 1, RevenueCents: 2000},
+				{Start: "2026-03-03"},
+				{Start: "2026-03-04", Orders: 1, RevenueCents: 1000},
+			},
+		},
+		{
+			name: "day is the default",
+			from: day(10), to: day(10),
+			want: []models.SalesBucket{{Start: "2026-03-10", Orders: 1, RevenueCents: 3000}},
+		},
+		{
+			name: "by week starting on Monday",
+			from: day(4), to: day(10), groupBy: "week",
+			want: []models.SalesBucket{
+				{Start: "2026-03-02", Orders: 2, RevenueCents: 3000},
+				{Start: "2026-03-09", Orders: 1, RevenueCents: 3000},
+			},
+		},
+		{
+			name: "by month",
+			from: day(3), to: day(31), groupBy: "month",
+			want: []models.SalesBucket{{Start: "2026-03-01", Orders: 3, RevenueCents: 6000}},
+		},
+		{
+			name: "range without sales",
+			from: day(20), to: day(21), groupBy: "day",
+			want: []models.SalesBucket{{Start: "2026-03-20"}, {Start: "2026-03-21"}},
+		},
+	}
+
+	s := newTestStore(t)
+	seedSales(t, s)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := s.orderService.GetSalesMetrics(tt.from, tt.to, tt.groupBy)
+			if err != nil {
+				t.Fatalf("GetSalesMetrics: %v", err)
+			}
+			if !reflect.DeepEqual(metrics.Buckets, tt.want) {
+				t.Errorf("buckets = %+v, want %+v", metrics.Buckets, tt.want)
+			}
+			if metrics.From != tt.from.Format(dateLayout) || metrics.To != tt.to.Format(dateLayout) {
+				t.Errorf("range = %s to %s, want %s to %s", metrics.From, metrics.To, tt.from.Format(dateLayout), tt.to.Format(dateLayout))
+			}
+		})
+	}
+}
+
+func TestGetSalesMetricsDefaultRange(t *testing.T) {
+	s := newTestStore(t)
+
+	metrics, err := s.orderService.GetSalesMetrics(time.Time{}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("GetSalesMetrics: %v", err)
+	}
+	if metrics.GroupBy != "day" || len(metrics.Buckets) != defaultSalesDays {
+		t.Errorf("got %d %s buckets, want %d day buckets", len(metrics.Buckets), metrics.GroupBy, defaultSalesDays)
+	}
+	if today := time.Now().UTC().Format(dateLayout); metrics.To != today {
+		t.Errorf("to = %s, want %s", metrics.To, today)
+	}
+}
+
+func TestGetSalesMetricsRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      time.Time
+		to        time.Time
+		groupBy   string
+		wantField string
+	}{
+		{"unknown grouping", day(1), day(2), "year", "group_by"},
+		{"from after to", day(3), day(2), "day", "from"},
+		{"too many buckets", day(1).AddDate(-10, 0, 0), day(1), "day", "from"},
+	}
+
+	s := newTestStore(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.orderService.GetSalesMetrics(tt.from, tt.to, tt.groupBy)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != tt.wantField {
+				t.Errorf("err = %v, want a validation error for %s", err, tt.wantField)
+			}
+		})
+	}
+
+	// Ten years fit by month
+	if _, err := s.orderService.GetSalesMetrics(day(1).AddDate(-10, 0, 0), day(1), "month"); err != nil {
+		t.Errorf("ten years by month: %v", err)
+	}
+}
@@ -0,0 +1,742 @@
+// internal/services/order_repository.go
+// This file contains the database access for orders
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"online-store/internal/database"
+	"online-store/internal/models"
+)
+
+// OrderRepository defines how the order service reads and writes orders
+type OrderRepository interface {
+	Create(order *models.Order) (int, error)
+	GetByUser(userID int) ([]models.OrderResponse, error)
+	ListByUser(userID, limit, offset int, after *orderCursor) ([]models.OrderResponse, error)
+	GetForUser(orderID, userID int) (*models.OrderResponse, error)
+	GetByTrackingTokenHash(tokenHash string) (*models.OrderTracking, error)
+	GetStatus(orderID int) (models.OrderStatus, error)
+	SummaryForUser(userID int) (*models.UserOrderSummary, error)
+	UpdateStatus(orderID int, fromStatus, toStatus models.OrderStatus) error
+	UpdateShipment(orderID int, fromStatus, toStatus models.OrderStatus, trackingNumber string) error
+	Hold(orderID int, fromStatus models.OrderStatus) error
+	Release(orderID int) (models.OrderStatus, error)
+	PayHeld(orderID int) error
+	UpdateQuantity(orderID, userID, quantity, unitPriceCents int) error
+	UpdateStatuses(orderIDs []int, toStatus models.OrderStatus, canMove func(from models.OrderStatus) bool) ([]statusChange, error)
+	Export(from, to time.Time, fn func(row models.OrderExportRow) error) error
+	StreamByUser(userID int, fn func(order models.OrderResponse) error) error
+	Archive(before time.Time, limit int) (int, error)
+	SalesByBucket(from, to time.Time, groupBy string) (map[string]models.SalesBucket, error)
+}
+
+// SQLOrderRepository is the MariaDB-backed OrderRepository
+type SQLOrderRepository struct {
+	db *database.DB
+
+	enrichEvents bool // Add the product name and user email to order/created
+}
+
+// NewSQLOrderRepository creates an order repository using the given database
+// With enrichEvents, order/created events also carry the product name and the
+// customer's email; without, they stay lean (IDs and totals only)
+func NewSQLOrderRepository(db *database.DB, enrichEvents bool) *SQLOrderRepository {
+	return &SQLOrderRepository{db: db, enrichEvents: enrichEvents}
+}
+
+// Create inserts the order and takes its quantity out of the product's stock
+// Both happen in one transaction, so we never sell stock we don't have
+// Returns ErrInsufficientStock if the stock ran out in the meantime
+// It also fills in order.InvoiceNumber, the next number of the current year
+func (r *SQLOrderRepository) Create(order *models.Order) (int, error) {
+	// Start a database transaction
+	// This ensures that if anything goes wrong, all changes are rolled back
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	// If something goes wrong, roll back the transaction
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Decrease stock only if there is enough of it
+	// Doing the check inside the UPDATE makes it safe against concurrent orders
+	result, err := tx.Exec(
+		"UPDATE products SET stock_quantity = stock_quantity - ? WHERE id = ? AND stock_quantity >= ?",
+		order.Quantity, order.ProductID, order.Quantity,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update stock: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		err = ErrInsufficientStock
+		return 0, err
+	}
+
+	// Number the invoice - in the same transaction, so a failed order doesn't use up a number
+	year := time.Now().Year()
+	sequence, err := nextInvoiceSequence(tx, year)
+	if err != nil {
+		return 0, err
+	}
+	order.InvoiceNumber = formatInvoiceNumber(year, sequence)
+
+	// Create the order
+	result, err = tx.Exec(
+		"INSERT INTO orders (user_id, product_id, quantity, total_cents, status, tracking_token_hash, note, invoice_number) VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?)",
+		order.UserID, order.ProductID, order.Quantity, order.TotalCents, order.Status, order.TrackingTokenHash, order.Note, order.InvoiceNumber,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	orderID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get order ID: %w", err)
+	}
+
+	// Save the "order created" event in the same transaction: it exists exactly
+	// when the order does, and the outbox worker publishes it after the commit
+	event := models.OrderCreatedEvent{
+		OrderID:    int(orderID),
+		UserID:     order.UserID,
+		ProductID:  order.ProductID,
+		Quantity:   order.Quantity,
+		TotalCents: order.TotalCents,
+		Timestamp:  time.Now().Unix(),
+
+		TrackingToken: order.TrackingToken,
+	}
+	if r.enrichEvents {
+		err = tx.QueryRow(
+			"SELECT p.name, u.email FROM products p, users u WHERE p.id = ? AND u.id = ?",
+			order.ProductID, order.UserID,
+		).Scan(&event.ProductName, &event.UserEmail)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get order event details: %w", err)
+		}
+	}
+	if err = enqueueInTx(tx, "order/created", event); err != nil {
+		return 0, err
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return int(orderID), nil
+}
+
+// paidOnly matches orders that were paid for, for spend and sales figures
+// Pending orders aren't paid yet, and held orders wait on a risk check, so
+// neither counts
+const paidOnly = "status IN ('paid', 'shipped', 'delivered')"
+
+// archivable matches orders nothing can happen to any more, the only ones Archive moves
+// Status updates, holds and payments only look at the orders table, so an
+// order that could still change has to stay there
+const archivable = "status = 'delivered'"
+
+// allOrders is every order, archived or not, for use in FROM
+// Reports, related products, a customer's order history and their data export use it, so
+// archiving never changes what anyone sees
+const allOrders = `(
+	SELECT id, user_id, product_id, quantity, total_cents, status, note, invoice_number, tracking_number, tracking_token_hash, created_at FROM orders
+	UNION ALL
+	SELECT id, user_id, product_id, quantity, total_cents, status, note, invoice_number, tracking_number, tracking_token_hash, created_at FROM orders_archive
+)`
+
+// orderListColumns are the columns queryOrders scans, in order
+const orderListColumns = "o.id, COALESCE(o.invoice_number, ''), o.product_id, p.name, o.quantity, o.total_cents, o.status, COALESCE(o.note, ''), COALESCE(o.tracking_number, ''), o.created_at"
+
+// GetByUser returns all orders for a specific user, newest first, archived ones included
+func (r *SQLOrderRepository) GetByUser(userID int) ([]models.OrderResponse, error) {
+	return r.queryOrders(`
+		SELECT `+orderListColumns+`
+		FROM `+allOrders+` o
+		JOIN products p ON o.product_id = p.id
+		WHERE o.user_id = ?
+		ORDER BY o.created_at DESC, o.id DESC
+	`, userID)
+}
+
+// ListByUser returns one page of a user's orders, newest first, archived ones included
+// With a cursor, the page starts right after the order the cursor points to;
+// otherwise it skips offset orders. Ties on created_at are broken by id, so
+// the order is always the same and cursor pages never overlap
+func (r *SQLOrderRepository) ListByUser(userID, limit, offset int, after *orderCursor) ([]models.OrderResponse, error) {
+	query := `
+		SELECT ` + orderListColumns + `
+		FROM ` + allOrders + ` o
+		JOIN products p ON o.product_id = p.id
+		WHERE o.user_id = ?`
+	args := []interface{}{userID}
+
+	if after != nil {
+		query += " AND (o.created_at < ? OR (o.created_at = ? AND o.id < ?))"
+		args = append(args, after.CreatedAt, after.CreatedAt, after.ID)
+	}
+
+	query += " ORDER BY o.created_at DESC, o.id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	return r.queryOrders(query, args...)
+}
+
+// queryOrders runs a query selecting orderListColumns and scans the results
+func (r *SQLOrderRepository) queryOrders(query string, args ...interface{}) ([]models.OrderResponse, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.OrderResponse
+
+	for rows.Next() {
+		order, err := scanOrderResponse(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+
+	return orders, rows.Err()
+}
+
+// StreamByUser calls fn for every order of a user, oldest first, archived ones included
+// Rows are handed over one at a time so a long order history never sits in memory
+// If fn returns an error, streaming stops and that error is returned
+func (r *SQLOrderRepository) StreamByUser(userID int, fn func(order models.OrderResponse) error) error {
+	rows, err := r.db.StreamQuery(`
+		SELECT `+orderListColumns+`
+		FROM `+allOrders+` o
+		JOIN products p ON o.product_id = p.id
+		WHERE o.user_id = ?
+		ORDER BY o.id
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		order, err := scanOrderResponse(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(*order); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// scanOrderResponse reads one row of orderListColumns
+func scanOrderResponse(row rowScanner) (*models.OrderResponse, error) {
+	var order models.OrderResponse
+	err := row.Scan(
+		&order.ID,
+		&order.InvoiceNumber,
+		&order.ProductID,
+		&order.ProductName,
+		&order.Quantity,
+		&order.TotalCents,
+		&order.Status,
+		&order.Note,
+		&order.TrackingNumber,
+		&order.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan order: %w", err)
+	}
+	return &order, nil
+}
+
+// GetForUser returns an order only if it belongs to the user, or ErrOrderNotFound
+// Archived orders are found too
+func (r *SQLOrderRepository) GetForUser(orderID, userID int) (*models.OrderResponse, error) {
+	var order models.OrderResponse
+	err := r.db.QueryRow(`
+		SELECT `+orderListColumns+`
+		FROM `+allOrders+` o
+		JOIN products p ON o.product_id = p.id
+		WHERE o.id = ? AND o.user_id = ?
+	`, orderID, userID).Scan(
+		&order.ID,
+		&order.InvoiceNumber,
+		&order.ProductID,
+		&order.ProductName,
+		&order.Quantity,
+		&order.TotalCents,
+		&order.Status,
+		&order.Note,
+		&order.TrackingNumber,
+		&order.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	return &order, nil
+}
+
+// GetByTrackingTokenHash returns the order a tracking token belongs to, or ErrOrderNotFound
+// Tracking links keep working after the order was archived
+func (r *SQLOrderRepository) GetByTrackingTokenHash(tokenHash string) (*models.OrderTracking, error) {
+	var tracking models.OrderTracking
+	err := r.db.QueryRow(`
+		SELECT o.id, p.name, o.quantity, o.status, o.created_at
+		FROM `+allOrders+` o
+		JOIN products p ON o.product_id = p.id
+		WHERE o.tracking_token_hash = ?
+	`, tokenHash).Scan(
+		&tracking.OrderID,
+		&tracking.ProductName,
+		&tracking.Quantity,
+		&tracking.Status,
+		&tracking.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	return &tracking, nil
+}
+
+// SummaryForUser totals up a user's orders in a single aggregate query
+// A user with no orders gets zeros and a nil LastOrderAt
+func (r *SQLOrderRepository) SummaryForUser(userID int) (*models.UserOrderSummary, error) {
+	summary := models.UserOrderSummary{UserID: userID}
+
+	// COUNT and COALESCE(SUM) give 0 for no rows; MAX gives NULL, which scans to nil
+	err := r.db.QueryRow(`
+		SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN `+paidOnly+` THEN total_cents ELSE 0 END), 0),
+			MAX(created_at)
+		FROM `+allOrders+` o
+		WHERE user_id = ?
+	`, userID).Scan(&summary.TotalOrders, &summary.TotalSpendCents, &summary.LastOrderAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize orders: %w", err)
+	}
+
+	return &summary, nil
+}
+
+// GetStatus returns the current status of an order, or ErrOrderNotFound
+func (r *SQLOrderRepository) GetStatus(orderID int) (models.OrderStatus, error) {
+	var status models.OrderStatus
+	err := r.db.QueryRow("SELECT status FROM orders WHERE id = ?", orderID).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrOrderNotFound
+		}
+		return "", fmt.Errorf("failed to get order status: %w", err)
+	}
+	return status, nil
+}
+
+// UpdateStatus moves an order from fromStatus to toStatus
+// If the order's status is no longer fromStatus (someone else changed it first),
+// nothing is updated and ErrInvalidStatusTransition is returned
+func (r *SQLOrderRepository) UpdateStatus(orderID int, fromStatus, toStatus models.OrderStatus) error {
+	result, err := r.db.Exec(
+		"UPDATE orders SET status = ? WHERE id = ? AND status = ?",
+		toStatus, orderID, fromStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	return checkStatusUpdated(result)
+}
+
+// UpdateShipment is UpdateStatus that also stores the shipping provider's tracking number
+func (r *SQLOrderRepository) UpdateShipment(orderID int, fromStatus, toStatus models.OrderStatus, trackingNumber string) error {
+	result, err := r.db.Exec(
+		"UPDATE orders SET status = ?, tracking_number = ? WHERE id = ? AND status = ?",
+		toStatus, trackingNumber, orderID, fromStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update order shipment: %w", err)
+	}
+
+	return checkStatusUpdated(result)
+}
+
+// statusChange is the outcome for one order of UpdateStatuses
+// err is nil if the order was moved, otherwise why it wasn't
+type statusChange struct {
+	orderID int
+	from    models.OrderStatus
+	err     error
+}
+
+// UpdateStatuses moves several orders to toStatus in one transaction
+// Orders that don't exist or that canMove refuses are skipped (with the reason
+// in their statusChange); the others are all changed together
+// An error is only returned if the database failed, and then nothing is changed
+func (r *SQLOrderRepository) UpdateStatuses(orderIDs []int, toStatus models.OrderStatus, canMove func(from models.OrderStatus) bool) ([]statusChange, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Rollback does nothing once the transaction is committed
+	defer tx.Rollback()
+
+	changes := make([]statusChange, 0, len(orderIDs))
+	for _, orderID := range orderIDs {
+		change := statusChange{orderID: orderID}
+
+		// Lock the row, so nobody changes the status between our check and the update
+		err := tx.QueryRow("SELECT status FROM orders WHERE id = ? FOR UPDATE", orderID).Scan(&change.from)
+		switch {
+		case err == sql.ErrNoRows:
+			change.err = ErrOrderNotFound
+		case err != nil:
+			return nil, fmt.Errorf("failed to get order status: %w", err)
+		case !canMove(change.from):
+			change.err = fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, change.from, toStatus)
+		default:
+			if _, err := tx.Exec("UPDATE orders SET status = ? WHERE id = ?", toStatus, orderID); err != nil {
+				return nil, fmt.Errorf("failed to update order status: %w", err)
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return changes, nil
+}
+
+// UpdateQuantity changes the quantity of one of a user's pending orders
+// The difference is taken out of (or put back into) stock, and added items
+// cost unitPriceCents each while the ones already ordered keep their price
+// (see editedTotal), so a price change in the meantime only applies to what's new
+// Returns ErrOrderNotFound, ErrOrderNotEditable or ErrInsufficientStock
+func (r *SQLOrderRepository) UpdateQuantity(orderID, userID, quantity, unitPriceCents int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Rollback does nothing once the transaction is committed
+	defer tx.Rollback()
+
+	// Lock the order, so a payment can't come in between our check and the update
+	var productID, oldQuantity, totalCents int
+	var status models.OrderStatus
+	err = tx.QueryRow(
+		"SELECT product_id, quantity, total_cents, status FROM orders WHERE id = ? AND user_id = ? FOR UPDATE",
+		orderID, userID,
+	).Scan(&productID, &oldQuantity, &totalCents, &status)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get order: %w", err)
+	}
+	if status != models.OrderStatusPending {
+		return ErrOrderNotEditable
+	}
+
+	newTotal, err := editedTotal(totalCents, oldQuantity, quantity, unitPriceCents)
+	if err != nil {
+		return err
+	}
+
+	// Take more items out of stock (only if there are enough), or put some back
+	delta := quantity - oldQuantity
+	result, err := tx.Exec(
+		"UPDATE products SET stock_quantity = stock_quantity - ? WHERE id = ? AND stock_quantity >= ?",
+		delta, productID, delta,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update stock: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 && delta > 0 {
+		return ErrInsufficientStock
+	}
+
+	if _, err := tx.Exec("UPDATE orders SET quantity = ?, total_cents = ? WHERE id = ?", quantity, newTotal, orderID); err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Hold puts an order that is in fromStatus on hold, remembering fromStatus for Release
+// Returns ErrInvalidStatusTransition if the order's status changed in the meantime
+// held_from is bound rather than copied from status: MariaDB applies the
+// assignments left to right, so it would see the new status, not the old one
+func (r *SQLOrderRepository) Hold(orderID int, fromStatus models.OrderStatus) error {
+	result, err := r.db.Exec(
+		"UPDATE orders SET held_from = ?, status = 'on_hold' WHERE id = ? AND status = ?",
+		fromStatus, orderID, fromStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to hold order: %w", err)
+	}
+
+	return checkStatusUpdated(result)
+}
+
+// Release takes an order off hold, back to the status it had before, and returns that status
+// Returns ErrOrderNotFound for unknown orders and ErrInvalidStatusTransition for orders not on hold
+func (r *SQLOrderRepository) Release(orderID int) (models.OrderStatus, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Rollback does nothing once the transaction is committed
+	defer tx.Rollback()
+
+	var status models.OrderStatus
+	var heldFrom sql.NullString
+	err = tx.QueryRow("SELECT status, held_from FROM orders WHERE id = ? FOR UPDATE", orderID).Scan(&status, &heldFrom)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrOrderNotFound
+		}
+		return "", fmt.Errorf("failed to get order status: %w", err)
+	}
+	if status != models.OrderStatusOnHold {
+		return "", fmt.Errorf("%w: order is %s, not on hold", ErrInvalidStatusTransition, status)
+	}
+
+	// held_from is always set by Hold; pending is the safe guess if someone set on_hold by hand
+	restored := models.OrderStatusPending
+	if heldFrom.Valid {
+		restored = models.OrderStatus(heldFrom.String)
+	}
+
+	if _, err := tx.Exec("UPDATE orders SET status = ?, held_from = NULL WHERE id = ?", restored, orderID); err != nil {
+		return "", fmt.Errorf("failed to release order: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return restored, nil
+}
+
+// PayHeld records that an order held while pending has been paid for
+// It stays on hold, but Release will now take it back to paid
+// Returns ErrInvalidStatusTransition if the order isn't on hold or was already paid
+func (r *SQLOrderRepository) PayHeld(orderID int) error {
+	result, err := r.db.Exec(
+		"UPDATE orders SET held_from = 'paid' WHERE id = ? AND status = 'on_hold' AND held_from = 'pending'",
+		orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record payment: %w", err)
+	}
+
+	return checkStatusUpdated(result)
+}
+
+// checkStatusUpdated turns "no row changed" into ErrInvalidStatusTransition
+// (the order's status was no longer the one we expected)
+func checkStatusUpdated(result sql.Result) error {
+	// Check if any rows were affected
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidStatusTransition
+	}
+
+	return nil
+}
+
+// salesBucketColumns turns created_at into the first day of its bucket, per group_by value
+// Only these fixed expressions ever end up in the SQL, never user input
+var salesBucketColumns = map[string]string{
+	"day":   "DATE(created_at)",
+	"week":  "DATE_SUB(DATE(created_at), INTERVAL WEEKDAY(created_at) DAY)", // WEEKDAY is 0 on Monday
+	"month": "CAST(DATE_FORMAT(created_at, '%Y-%m-01') AS DATE)",
+}
+
+// SalesByBucket totals paid orders created in [from, to) per day, week or month
+// The result is keyed by the bucket's first day (YYYY-MM-DD); buckets without sales are missing
+// Only paid orders count as sales, see paidOnly
+func (r *SQLOrderRepository) SalesByBucket(from, to time.Time, groupBy string) (map[string]models.SalesBucket, error) {
+	bucketColumn, ok := salesBucketColumns[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sales grouping %q", groupBy)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+bucketColumn+` AS bucket, COUNT(*), COALESCE(SUM(total_cents), 0)
+		FROM `+allOrders+` o
+		WHERE `+paidOnly+` AND created_at >= ? AND created_at < ?
+		GROUP BY bucket
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sales: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make(map[string]models.SalesBucket)
+	for rows.Next() {
+		var bucket models.SalesBucket
+		var start time.Time
+		if err := rows.Scan(&start, &bucket.Orders, &bucket.RevenueCents); err != nil {
+			return nil, fmt.Errorf("failed to scan sales: %w", err)
+		}
+		bucket.Start = start.Format(dateLayout)
+		buckets[bucket.Start] = bucket
+	}
+
+	return buckets, rows.Err()
+}
+
+// Archive moves up to limit delivered orders created before the given time from
+// orders to orders_archive, oldest first, and returns how many it moved
+// Orders that aren't finished yet stay in orders, however old they are
+// Copying and deleting happen in one transaction, so an order is never lost
+// or in both tables
+func (r *SQLOrderRepository) Archive(before time.Time, limit int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Rollback does nothing once the transaction is committed
+	defer tx.Rollback()
+
+	// Lock the orders we'll move, so nobody changes them halfway
+	rows, err := tx.Query("SELECT id FROM orders WHERE "+archivable+" AND created_at < ? ORDER BY id LIMIT ? FOR UPDATE", before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find orders to archive: %w", err)
+	}
+	var ids []interface{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan order ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to find orders to archive: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	_, err = tx.Exec(`
+		INSERT INTO orders_archive (id, user_id, product_id, quantity, total_cents, status, held_from,
+			tracking_token_hash, note, invoice_number, tracking_number, created_at)
+		SELECT id, user_id, product_id, quantity, total_cents, status, held_from,
+			tracking_token_hash, note, invoice_number, tracking_number, created_at
+		FROM orders WHERE id IN (`+placeholders+`)
+	`, ids...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy orders to the archive: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM orders WHERE id IN ("+placeholders+")", ids...); err != nil {
+		return 0, fmt.Errorf("failed to delete archived orders: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(ids), nil
+}
+
+// Export calls fn for every order created in [from, to), oldest first
+// Archived orders are included, like in the other reports
+// A zero from or to means "no limit" on that side
+// Rows are handed over one at a time so the whole result never sits in memory
+// If fn returns an error, the export stops and that error is returned
+func (r *SQLOrderRepository) Export(from, to time.Time, fn func(row models.OrderExportRow) error) error {
+	query := `
+		SELECT o.id, u.email, p.name, o.quantity, o.total_cents, o.status, o.created_at
+		FROM ` + allOrders + ` o
+		JOIN users u ON o.user_id = u.id
+		JOIN products p ON o.product_id = p.id`
+
+	// Only add the date filters that were asked for
+	var conditions []string
+	var args []interface{}
+	if !from.IsZero() {
+		conditions = append(conditions, "o.created_at >= ?")
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "o.created_at < ?")
+		args = append(args, to)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY o.id"
+
+	rows, err := r.db.StreamQuery(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to export orders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.OrderExportRow
+		err := rows.Scan(
+			&row.ID,
+			&row.UserEmail,
+			&row.ProductName,
+			&row.Quantity,
+			&row.TotalCents,
+			&row.Status,
+			&row.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan order: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,288 @@
+// internal/services/order_repository_test.go
+// Tests for the SQL order repository, on sqlmock
+// A failed step has to roll back everything before it, so the failure tests
+// expect a rollback and no commit
+
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"online-store/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// The statements Create and UpdateQuantity run, in order
+var (
+	takeStock       = regexp.QuoteMeta("UPDATE products SET stock_quantity = stock_quantity - ? WHERE id = ? AND stock_quantity >= ?")
+	advanceSequence = regexp.QuoteMeta("INSERT INTO sequences (name, last_value) VALUES (?, LAST_INSERT_ID(1)) ON DUPLICATE KEY UPDATE last_value = LAST_INSERT_ID(last_value + 1)")
+	readSequence    = regexp.QuoteMeta("SELECT LAST_INSERT_ID()")
+	insertOrder     = regexp.QuoteMeta("INSERT INTO orders (user_id, product_id, quantity, total_cents, status, tracking_token_hash, note, invoice_number) VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?)")
+	eventDetails    = regexp.QuoteMeta("SELECT p.name, u.email FROM products p, users u WHERE p.id = ? AND u.id = ?")
+	insertEvent     = regexp.QuoteMeta("INSERT INTO outbox (topic, payload) VALUES (?, ?)")
+	lockOrder       = regexp.QuoteMeta("SELECT product_id, quantity, total_cents, status FROM orders WHERE id = ? AND user_id = ? FOR UPDATE")
+	updateOrder     = regexp.QuoteMeta("UPDATE orders SET quantity = ?, total_cents = ? WHERE id = ?")
+)
+
+// payloadArg matches any outbox payload and keeps it, so the test can decode the event
+type payloadArg struct{ payload *string }
+
+func (a payloadArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*a.payload = s
+	return ok
+}
+
+// newOrder is 2 items of product 1 at 900 cents each for user 7
+func newOrder() *models.Order {
+	return &models.Order{UserID: 7, ProductID: 1, Quantity: 2, TotalCents: 1800, Status: models.OrderStatusPending}
+}
+
+// expectOrderInsert expects Create up to and including the order insert, which
+// gets ID 5 and the year's first invoice number
+func expectOrderInsert(mock sqlmock.Sqlmock) {
+	year := time.Now().Year()
+	mock.ExpectBegin()
+	mock.ExpectExec(takeStock).WithArgs(2, 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(advanceSequence).WithArgs(invoiceSequenceName(year)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(readSequence).WillReturnRows(sqlmock.NewRows([]string{"LAST_INSERT_ID()"}).AddRow(1))
+	mock.ExpectExec(insertOrder).WithArgs(7, 1, 2, 1800, models.OrderStatusPending, "", "", formatInvoiceNumber(year, 1)).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+}
+
+// expectOrderEvent expects the order/created event and the commit, and returns
+// where its payload ends up
+func expectOrderEvent(mock sqlmock.Sqlmock) *string {
+	var payload string
+	mock.ExpectExec(insertEvent).WithArgs("order/created", payloadArg{&payload}).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	return &payload
+}
+
+func TestCreateOrderSavesEventInSameTransaction(t *testing.T) {
+	db, mock := newMockDB(t)
+	expectOrderInsert(mock)
+	payload := expectOrderEvent(mock)
+
+	order := newOrder()
+	orderID, err := NewSQLOrderRepository(db, false).Create(order)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if orderID != 5 || order.InvoiceNumber != formatInvoiceNumber(time.Now().Year(), 1) {
+		t.Errorf("order %d with invoice %q, want order 5 with the year's first invoice", orderID, order.InvoiceNumber)
+	}
+
+	var event models.OrderCreatedEvent
+	if err := json.Unmarshal([]byte(*payload), &event); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if event.OrderID != orderID || event.UserID != 7 || event.Quantity != 2 || event.TotalCents != 1800 {
+		t.Errorf("event = %+v, want order %d of user 7", event, orderID)
+	}
+	// Without rich events, nothing more is looked up
+	if event.ProductName != "" || event.UserEmail != "" {
+		t.Errorf("event = %+v, want no product name or email", event)
+	}
+}
+
+func TestCreateOrderRichEvent(t *testing.T) {
+	db, mock := newMockDB(t)
+	expectOrderInsert(mock)
+	mock.ExpectQuery(eventDetails).WithArgs(1, 7).WillReturnRows(sqlmock.NewRows([]string{"name", "email"}).AddRow("Mug", "ann@example.com"))
+	payload := expectOrderEvent(mock)
+
+	orderID, err := NewSQLOrderRepository(db, true).Create(newOrder())
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var event models.OrderCreatedEvent
+	if err := json.Unmarshal([]byte(*payload), &event); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if event.OrderID != orderID || event.ProductName != "Mug" || event.UserEmail != "ann@example.com" {
+		t.Errorf("event = %+v, want order %d with the product name and email", event, orderID)
+	}
+}
+
+func TestCreateOrderLeanEventPayload(t *testing.T) {
+	db, mock := newMockDB(t)
+	expectOrderInsert(mock)
+	payload := expectOrderEvent(mock)
+
+	if _, err := NewSQLOrderRepository(db, false).Create(newOrder()); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// The lean payload leaves the fields out entirely, not just empty
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(*payload), &fields); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	for _, field := range []string{"product_name", "user_email"} {
+		if _, ok := fields[field]; ok {
+			t.Errorf("lean event has %s: %v", field, fields)
+		}
+	}
+}
+
+func TestCreateOrderRichEventLookupFails(t *testing.T) {
+	db, mock := newMockDB(t)
+	expectOrderInsert(mock)
+	mock.ExpectQuery(eventDetails).WithArgs(1, 7).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	if _, err := NewSQLOrderRepository(db, true).Create(newOrder()); err == nil {
+		t.Fatal("Create succeeded, want the lookup's error")
+	}
+}
+
+func TestCreateOrderFailsWithoutEvent(t *testing.T) {
+	year := time.Now().Year()
+
+	t.Run("out of stock", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(takeStock).WithArgs(2, 1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		if _, err := NewSQLOrderRepository(db, false).Create(newOrder()); !errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("err = %v, want ErrInsufficientStock", err)
+		}
+	})
+
+	t.Run("order insert fails", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(takeStock).WithArgs(2, 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(advanceSequence).WithArgs(invoiceSequenceName(year)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(readSequence).WillReturnRows(sqlmock.NewRows([]string{"LAST_INSERT_ID()"}).AddRow(1))
+		mock.ExpectExec(insertOrder).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		if _, err := NewSQLOrderRepository(db, false).Create(newOrder()); err == nil {
+			t.Error("Create succeeded, want the insert's error")
+		}
+	})
+
+	// The order is in, but without its event it is taken back along with the stock
+	t.Run("event insert fails", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		expectOrderInsert(mock)
+		mock.ExpectExec(insertEvent).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		if _, err := NewSQLOrderRepository(db, false).Create(newOrder()); err == nil {
+			t.Error("Create succeeded, want the event insert's error")
+		}
+	})
+}
+
+// orderRow is order 5 as UpdateQuantity locks it: product 1, at 900 cents each
+func orderRow(quantity int, status models.OrderStatus) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"product_id", "quantity", "total_cents", "status"}).
+		AddRow(1, quantity, 900*quantity, string(status))
+}
+
+func TestUpdateQuantity(t *testing.T) {
+	for _, step := range []struct{ from, to, unitPrice, wantTotal int }{
+		{2, 5, 0, 4500},           // Takes 3 more at the order's price
+		{2, 5, 1200, 1800 + 3600}, // Takes 3 more at today's price; the 2 ordered keep theirs
+		{5, 1, 0, 900},            // Puts 4 back
+	} {
+		db, mock := newMockDB(t)
+		delta := step.to - step.from
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockOrder).WithArgs(5, 7).WillReturnRows(orderRow(step.from, models.OrderStatusPending))
+		mock.ExpectExec(takeStock).WithArgs(delta, 1, delta).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(updateOrder).WithArgs(step.to, step.wantTotal, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := NewSQLOrderRepository(db, false).UpdateQuantity(5, 7, step.to, step.unitPrice); err != nil {
+			t.Errorf("UpdateQuantity from %d to %d: %v", step.from, step.to, err)
+		}
+	}
+}
+
+func TestUpdateQuantityRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{"more than in stock", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockOrder).WithArgs(5, 7).WillReturnRows(orderRow(2, models.OrderStatusPending))
+			mock.ExpectExec(takeStock).WithArgs(9, 1, 9).WillReturnResult(sqlmock.NewResult(0, 0))
+		}, ErrInsufficientStock},
+		{"paid", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockOrder).WithArgs(5, 7).WillReturnRows(orderRow(2, models.OrderStatusPaid))
+		}, ErrOrderNotEditable},
+		{"someone else's order", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockOrder).WithArgs(5, 7).WillReturnRows(sqlmock.NewRows([]string{"product_id", "quantity", "total_cents", "status"}))
+		}, ErrOrderNotFound},
+		{"order update fails after the stock changed", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockOrder).WithArgs(5, 7).WillReturnRows(orderRow(2, models.OrderStatusPending))
+			mock.ExpectExec(takeStock).WithArgs(9, 1, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(updateOrder).WillReturnError(errors.New("connection reset"))
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			tt.expect(mock)
+			// The whole change is rolled back
+			mock.ExpectRollback()
+
+			err := NewSQLOrderRepository(db, false).UpdateQuantity(5, 7, 11, 0)
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// The items already in the order plus the added ones, at today's price, must fit in total_cents
+func TestUpdateQuantityTotalTooLarge(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockOrder).WithArgs(5, 7).WillReturnRows(orderRow(2, models.OrderStatusPending))
+	mock.ExpectRollback()
+
+	var validationErr *ValidationError
+	err := NewSQLOrderRepository(db, false).UpdateQuantity(5, 7, 11, maxTotalCents/9)
+	if !errors.As(err, &validationErr) {
+		t.Errorf("err = %v, want a ValidationError", err)
+	}
+}
+
+func TestHold(t *testing.T) {
+	hold := regexp.QuoteMeta("UPDATE orders SET held_from = ?, status = 'on_hold' WHERE id = ? AND status = ?")
+
+	t.Run("held", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		// The status it had is bound, not read from the row being changed
+		mock.ExpectExec(hold).WithArgs(models.OrderStatusPaid, 5, models.OrderStatusPaid).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := NewSQLOrderRepository(db, false).Hold(5, models.OrderStatusPaid); err != nil {
+			t.Errorf("Hold: %v", err)
+		}
+	})
+
+	t.Run("status changed in the meantime", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectExec(hold).WithArgs(models.OrderStatusPending, 5, models.OrderStatusPending).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := NewSQLOrderRepository(db, false).Hold(5, models.OrderStatusPending); !errors.Is(err, ErrInvalidStatusTransition) {
+			t.Errorf("err = %v, want ErrInvalidStatusTransition", err)
+		}
+	})
+}
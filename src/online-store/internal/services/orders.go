@@ -4,131 +4,208 @@
 package services
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"online-store/internal/config"
 	"online-store/internal/models"
-	"online-store/internal/mqtt"
 )
 
+// maxTotalCents is the largest total the orders.total_cents INT column can hold
+const maxTotalCents = math.MaxInt32
+
+// maxOrderNoteLength is the longest note (in characters) a customer may attach to an order
+const maxOrderNoteLength = 1000
+
+// maxTrackingNumberLength matches the VARCHAR(100) tracking_number column
+const maxTrackingNumberLength = 100
+
+// Default and maximum number of orders per page
+const (
+	defaultOrderPageLimit = 20
+	maxOrderPageLimit     = 100
+)
+
+// orderStatusTransitions lists which statuses an order may move to from each status
+// Orders go pending -> paid -> shipped -> delivered, one step at a time
+// On-hold orders are missing on purpose: only ReleaseOrder takes them off hold
+// (a payment for one is recorded by UpdateOrderStatus without releasing it)
+var orderStatusTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPending: {models.OrderStatusPaid},
+	models.OrderStatusPaid:    {models.OrderStatusShipped},
+	models.OrderStatusShipped: {models.OrderStatusDelivered},
+}
+
 // OrderService handles order operations
 type OrderService struct {
-	db         *sql.DB
-	mqttClient *mqtt.Client
+	orders    OrderRepository
+	products  ProductRepository
+	users     UserRepository
+	publisher Publisher
+	relay     OutboxNotifier
+	audit     *AuditService
+
+	maxQuantity int // Most units a single order may contain
+
+	riskHoldThreshold float64 // Risk scores at least this high put an order on hold
 }
 
 // NewOrderService creates a new order service
-func NewOrderService(db *sql.DB, mqttClient *mqtt.Client) *OrderService {
+// relay is told when an order saved new events in the outbox, so they go out right away
+func NewOrderService(orders OrderRepository, products ProductRepository, users UserRepository, publisher Publisher, relay OutboxNotifier, audit *AuditService, cfg *config.Config) *OrderService {
 	return &OrderService{
-		db:         db,
-		mqttClient: mqttClient,
+		orders:      orders,
+		products:    products,
+		users:       users,
+		publisher:   publisher,
+		relay:       relay,
+		audit:       audit,
+		maxQuantity: cfg.MaxOrderQty,
+
+		riskHoldThreshold: float64(cfg.RiskHoldThreshold),
 	}
 }
 
 // CreateOrder creates a new order
+// Like guest orders, it gets a tracking token, which the notification service
+// puts in the confirmation email so the order can be tracked from a link
 func (s *OrderService) CreateOrder(userID int, req models.OrderRequest) (*models.OrderResponse, error) {
-	// Start a database transaction
-	// This ensures that if anything goes wrong, all changes are rolled back
-	tx, err := s.db.Begin()
+	return s.placeOrder(userID, req, "")
+}
+
+// CreateGuestOrder places an order for someone who isn't logged in
+// The order belongs to a lightweight guest user for the email; if they later
+// register with the same email and confirm it, the guest becomes their account
+// (see AuthService.Register)
+// The returned tracking token lets the guest look up the order status
+func (s *OrderService) CreateGuestOrder(req models.GuestOrderRequest) (*models.GuestOrderResponse, error) {
+	userID, err := s.guestUserID(req.Email)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start transaction: %w", err)
+		return nil, err
 	}
-	
-	// If something goes wrong, roll back the transaction
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
 
-	// Get the product to check stock and calculate price
-	var product models.Product
-	err = tx.QueryRow(
-		"SELECT id, name, price_cents, stock_quantity FROM products WHERE id = ?",
-		req.ProductID,
-	).Scan(&product.ID, &product.Name, &product.PriceCents, &product.StockQuantity)
-	
+	token, err := generateToken()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("product not found")
-		}
-		return nil, fmt.Errorf("failed to get product: %w", err)
+		return nil, err
 	}
 
-	// Check if we have enough stock
-	if product.StockQuantity < req.Quantity {
-		return nil, fmt.Errorf("insufficient stock: only %d items available", product.StockQuantity)
+	order, err := s.placeOrder(userID, models.OrderRequest{
+		ProductID: req.ProductID,
+		Quantity:  req.Quantity,
+		Note:      req.Note,
+	}, token)
+	if err != nil {
+		return nil, err
 	}
 
-	// Calculate total price
-	totalCents := product.PriceCents * req.Quantity
+	return &models.GuestOrderResponse{OrderResponse: *order, TrackingToken: token}, nil
+}
 
-	// Create the order
-	result, err := tx.Exec(
-		"INSERT INTO orders (user_id, product_id, quantity, total_cents, status) VALUES (?, ?, ?, ?, ?)",
-		userID, req.ProductID, req.Quantity, totalCents, "pending",
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create order: %w", err)
+// TrackOrder returns the status of the order a tracking token belongs to
+func (s *OrderService) TrackOrder(token string) (*models.OrderTracking, error) {
+	if token == "" {
+		return nil, ErrOrderNotFound
 	}
+	return s.orders.GetByTrackingTokenHash(hashToken(token))
+}
 
-	orderID, err := result.LastInsertId()
+// guestUserID finds or creates the guest user for an email
+// Registered accounts must log in instead, otherwise anyone could place
+// orders in someone else's name
+func (s *OrderService) guestUserID(email string) (int, error) {
+	user, err := s.users.GetByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		return s.users.CreateGuest(email)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order ID: %w", err)
+		return 0, err
 	}
+	if !user.IsGuest {
+		return 0, ErrAccountExists
+	}
+	return user.ID, nil
+}
 
-	// Update product stock
-	newStock := product.StockQuantity - req.Quantity
-	_, err = tx.Exec(
-		"UPDATE products SET stock_quantity = ? WHERE id = ?",
-		newStock, req.ProductID,
-	)
+// placeOrder does the work of creating an order for a user
+// Anyone holding trackingToken can look up the order's status (see TrackOrder);
+// if it's empty, a new token is made. Only its hash is stored, and the token
+// itself goes out with the "order created" event
+func (s *OrderService) placeOrder(userID int, req models.OrderRequest, trackingToken string) (*models.OrderResponse, error) {
+	req.Note = strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(req.Note) > maxOrderNoteLength {
+		return nil, &ValidationError{
+			Field:   "note",
+			Message: fmt.Sprintf("must be at most %d characters", maxOrderNoteLength),
+		}
+	}
+
+	product, totalCents, err := s.priceLine(req.ProductID, req.Quantity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update stock: %w", err)
+		return nil, err
 	}
 
-	// Commit the transaction
-	if err = tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	if trackingToken == "" {
+		if trackingToken, err = generateToken(); err != nil {
+			return nil, err
+		}
 	}
 
-	// Create order response
-	orderResponse := &models.OrderResponse{
-		ID:          int(orderID),
-		ProductID:   req.ProductID,
-		ProductName: product.Name,
-		Quantity:    req.Quantity,
-		TotalCents:  totalCents,
-		Status:      "pending",
-		CreatedAt:   time.Now(),
-	}
-
-	// Publish MQTT event that order was created
-	event := models.OrderCreatedEvent{
-		OrderID:    int(orderID),
+	// Create the order (this also takes the items out of stock, numbers the invoice
+	// and saves the "order created" event in the outbox)
+	order := &models.Order{
 		UserID:     userID,
 		ProductID:  req.ProductID,
 		Quantity:   req.Quantity,
 		TotalCents: totalCents,
-		Timestamp:  time.Now().Unix(),
+		Status:     models.OrderStatusPending,
+
+		TrackingToken:     trackingToken,
+		TrackingTokenHash: hashToken(trackingToken),
+		Note:              req.Note,
 	}
-	
-	if err := s.mqttClient.Publish("order/created", event); err != nil {
-		fmt.Printf("Failed to publish order created event: %v", err)
+	orderID, err := s.orders.Create(order)
+	if err != nil {
+		if errors.Is(err, ErrInsufficientStock) {
+			// Someone else bought the stock between our check and the insert
+			return nil, fmt.Errorf("%w: only %d items available", ErrInsufficientStock, product.StockQuantity)
+		}
+		return nil, err
 	}
+	newStock := product.StockQuantity - req.Quantity
+
+	s.audit.Record(userID, "create", "order", orderID, req)
+
+	// Create order response
+	orderResponse := &models.OrderResponse{
+		ID:            orderID,
+		InvoiceNumber: order.InvoiceNumber,
+		ProductID:     req.ProductID,
+		ProductName:   product.Name,
+		Quantity:      req.Quantity,
+		TotalCents:    totalCents,
+		Status:        models.OrderStatusPending,
+		Note:          req.Note,
+		CreatedAt:     time.Now(),
+	}
+
+	// Publish the "order created" event now instead of at the next outbox retry
+	s.relay.Notify()
 
 	// Check if stock is low after this order
-	if newStock < 10 {
+	if newStock < product.ReorderLevel {
 		alert := models.LowStockAlert{
 			ProductID:    req.ProductID,
 			ProductName:  product.Name,
 			CurrentStock: newStock,
-			ReorderLevel: 10,
+			ReorderLevel: product.ReorderLevel,
 			Timestamp:    time.Now().Unix(),
 		}
-		
-		if err := s.mqttClient.Publish("inventory/low_stock", alert); err != nil {
+
+		if err := s.publisher.Publish("inventory/low_stock", alert); err != nil {
 			fmt.Printf("Failed to publish low stock alert: %v", err)
 		}
 	}
@@ -138,104 +215,563 @@ func (s *OrderService) CreateOrder(userID int, req models.OrderRequest) (*models
 
 // GetUserOrders returns all orders for a specific user
 func (s *OrderService) GetUserOrders(userID int) ([]models.OrderResponse, error) {
-	rows, err := s.db.Query(`
-		SELECT o.id, o.product_id, p.name, o.quantity, o.total_cents, o.status, o.created_at
-		FROM orders o
-		JOIN products p ON o.product_id = p.id
-		WHERE o.user_id = ?
-		ORDER BY o.created_at DESC
-	`, userID)
-	
-	if err != nil {
-		return nil, fmt.Errorf("failed to get orders: %w", err)
-	}
-	defer rows.Close()
-
-	var orders []models.OrderResponse
-	
-	for rows.Next() {
-		var order models.OrderResponse
-		err := rows.Scan(
-			&order.ID,
-			&order.ProductID,
-			&order.ProductName,
-			&order.Quantity,
-			&order.TotalCents,
-			&order.Status,
-			&order.CreatedAt,
-		)
+	return s.orders.GetByUser(userID)
+}
+
+// GetUserOrdersPage returns one page of a user's orders, newest first
+// Cursor paging stays correct when new orders are placed between requests;
+// offset paging would then show some orders twice
+func (s *OrderService) GetUserOrdersPage(userID int, req models.OrderPageRequest) (*models.OrderPage, error) {
+	if req.Limit <= 0 {
+		req.Limit = defaultOrderPageLimit
+	}
+	if req.Limit > maxOrderPageLimit {
+		req.Limit = maxOrderPageLimit
+	}
+
+	var after *orderCursor
+	if req.Cursor != "" {
+		if req.Offset != 0 {
+			return nil, &ValidationError{Field: "cursor", Message: "can't be combined with offset"}
+		}
+		cursor, err := decodeOrderCursor(req.Cursor)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
+			return nil, &ValidationError{Field: "cursor", Message: "is not valid"}
+		}
+		after = cursor
+	}
+	if req.Offset < 0 {
+		return nil, &ValidationError{Field: "offset", Message: "must not be negative"}
+	}
+
+	// Ask for one extra order - if we get it, there is another page
+	orders, err := s.orders.ListByUser(userID, req.Limit+1, req.Offset, after)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.OrderPage{Orders: orders}
+	if len(orders) > req.Limit {
+		page.Orders = orders[:req.Limit]
+		last := page.Orders[req.Limit-1]
+		page.NextCursor = encodeOrderCursor(orderCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	if page.Orders == nil {
+		page.Orders = []models.OrderResponse{}
+	}
+
+	return page, nil
+}
+
+// GetUserSummary returns order totals for a user, or ErrUserNotFound
+func (s *OrderService) GetUserSummary(userID int) (*models.UserOrderSummary, error) {
+	// Check the user exists, so a typo in the ID isn't reported as "no orders"
+	if _, err := s.users.GetByID(userID); err != nil {
+		return nil, err
+	}
+	return s.orders.SummaryForUser(userID)
+}
+
+// ExportOrders calls fn for every order created in [from, to), oldest first
+// Zero times mean no limit; see OrderRepository.Export
+func (s *OrderService) ExportOrders(from, to time.Time, fn func(row models.OrderExportRow) error) error {
+	return s.orders.Export(from, to, fn)
+}
+
+// GetUserData returns a user's profile, for their data export
+func (s *OrderService) GetUserData(userID int) (*models.UserResponse, error) {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	profile := user.ToResponse()
+	return &profile, nil
+}
+
+// StreamUserOrders calls fn for every order of the user, oldest first
+// See OrderRepository.StreamByUser
+func (s *OrderService) StreamUserOrders(userID int, fn func(order models.OrderResponse) error) error {
+	return s.orders.StreamByUser(userID, fn)
+}
+
+// Reorder places a new order with the same items as one of the user's previous orders
+// Prices are taken from the current catalogue, not the old order
+// Lines that can't be ordered any more (deleted or out of stock) are reported in
+// FailedLines instead of failing the whole request
+func (s *OrderService) Reorder(userID, orderID int) (*models.ReorderResponse, error) {
+	// GetForUser only finds orders that belong to this user
+	previous, err := s.orders.GetForUser(orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.ReorderResponse{FailedLines: []models.ReorderFailure{}}
+
+	order, err := s.placeOrder(userID, models.OrderRequest{
+		ProductID: previous.ProductID,
+		Quantity:  previous.Quantity,
+		Note:      previous.Note, // Delivery instructions usually still apply
+	}, "")
+	if err != nil {
+		reason, ok := lineFailureReason(err)
+		if !ok {
+			return nil, err
 		}
-		orders = append(orders, order)
+		response.FailedLines = append(response.FailedLines, models.ReorderFailure{
+			ProductID: previous.ProductID,
+			Quantity:  previous.Quantity,
+			Reason:    reason,
+		})
+		return response, nil
 	}
 
-	return orders, nil
+	response.Order = order
+	return response, nil
+}
+
+// lineFailureReason turns the errors a single line can fail with into a
+// message for the client. Other errors (like a database failure) return false
+func lineFailureReason(err error) (string, bool) {
+	var validationErr *ValidationError
+	switch {
+	case errors.Is(err, ErrProductNotFound):
+		return "product is no longer available", true
+	case errors.Is(err, ErrInsufficientStock), errors.Is(err, ErrProductNotAvailable):
+		return err.Error(), true
+	case errors.As(err, &validationErr):
+		return validationErr.Error(), true
+	}
+	return "", false
 }
 
 // GetOrder returns a specific order (only if it belongs to the user)
 func (s *OrderService) GetOrder(orderID, userID int) (*models.OrderResponse, error) {
-	var order models.OrderResponse
-	err := s.db.QueryRow(`
-		SELECT o.id, o.product_id, p.name, o.quantity, o.total_cents, o.status, o.created_at
-		FROM orders o
-		JOIN products p ON o.product_id = p.id
-		WHERE o.id = ? AND o.user_id = ?
-	`, orderID, userID).Scan(
-		&order.ID,
-		&order.ProductID,
-		&order.ProductName,
-		&order.Quantity,
-		&order.TotalCents,
-		&order.Status,
-		&order.CreatedAt,
-	)
-	
+	return s.orders.GetForUser(orderID, userID)
+}
+
+// EditOrder changes the quantity of one of a user's orders while it's still pending
+// Stock and the total are adjusted in the same transaction (see UpdateQuantity)
+// Adding items is checked like placing the order anew (limits, drafts, purchase
+// window) and prices the added items at today's price, so an order can't be
+// grown after a flash sale or a sale price has ended. The items already in the
+// order keep the price they were bought at. Removing items is always possible
+func (s *OrderService) EditOrder(userID, orderID int, req models.OrderEdit) (*models.OrderResponse, error) {
+	order, err := s.orders.GetForUser(orderID, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("order not found")
+		return nil, err
+	}
+
+	var product *models.Product
+	unitPriceCents := 0 // Nothing added, nothing to price
+	if req.Quantity > order.Quantity {
+		if product, err = s.orderableProduct(order.ProductID, req.Quantity); err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("failed to get order: %w", err)
+		unitPriceCents = product.EffectivePriceCents
 	}
 
-	return &order, nil
+	if err := s.orders.UpdateQuantity(orderID, userID, req.Quantity, unitPriceCents); err != nil {
+		if errors.Is(err, ErrInsufficientStock) && product != nil {
+			return nil, fmt.Errorf("%w: only %d more items available", ErrInsufficientStock, product.StockQuantity)
+		}
+		return nil, err
+	}
+
+	s.audit.Record(userID, "update", "order", orderID, req)
+
+	return s.orders.GetForUser(orderID, userID)
 }
 
 // UpdateOrderStatus updates the status of an order
-// This method is called by MQTT handlers when payments are confirmed
-func (s *OrderService) UpdateOrderStatus(orderID int, status string) error {
-	result, err := s.db.Exec(
-		"UPDATE orders SET status = ? WHERE id = ?",
-		status, orderID,
-	)
+// This method is called by MQTT handlers when payments are confirmed,
+// and by admins moving orders along (shipping, delivery)
+// actorID is the admin making the change, or SystemActor for MQTT handlers
+// Returns ErrInvalidStatusTransition if the order can't move to that status
+// Paying for an order on hold doesn't take it off hold; the payment is kept
+// for when an admin releases it (see PayHeld)
+func (s *OrderService) UpdateOrderStatus(actorID, orderID int, status models.OrderStatus) error {
+	if !status.Valid() {
+		return unknownStatusError(status)
+	}
+
+	currentStatus, err := s.orders.GetStatus(orderID)
+	if err != nil {
+		return err
+	}
+
+	if currentStatus == models.OrderStatusOnHold && status == models.OrderStatusPaid {
+		return s.payHeldOrder(actorID, orderID)
+	}
+
+	if !canTransition(currentStatus, status) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, currentStatus, status)
+	}
+
+	if err := s.orders.UpdateStatus(orderID, currentStatus, status); err != nil {
+		return err
+	}
+
+	s.audit.Record(actorID, "update_status", "order", orderID, map[string]models.OrderStatus{
+		"from": currentStatus,
+		"to":   status,
+	})
+
+	s.publishStatusChanged(orderID, status)
+	return nil
+}
+
+// BulkUpdateOrderStatus moves many orders to the same status, e.g. when the
+// warehouse ships a whole batch. Orders that can't make the move are reported
+// as failed; all the others are changed together in one transaction
+// Results are in the order of the request, one per distinct order ID
+func (s *OrderService) BulkUpdateOrderStatus(actorID int, req models.BulkStatusUpdate) ([]models.BulkStatusResult, error) {
+	if !req.Status.Valid() {
+		return nil, unknownStatusError(req.Status)
+	}
+
+	// The same order twice would fail the second time (it has already moved)
+	seen := make(map[int]bool, len(req.OrderIDs))
+	var orderIDs []int
+	for _, id := range req.OrderIDs {
+		if !seen[id] {
+			seen[id] = true
+			orderIDs = append(orderIDs, id)
+		}
+	}
+
+	changes, err := s.orders.UpdateStatuses(orderIDs, req.Status, func(from models.OrderStatus) bool {
+		return canTransition(from, req.Status)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
+		return nil, err
 	}
 
-	// Check if any rows were affected
-	rowsAffected, err := result.RowsAffected()
+	results := make([]models.BulkStatusResult, 0, len(changes))
+	for _, change := range changes {
+		if change.err != nil {
+			results = append(results, models.BulkStatusResult{OrderID: change.orderID, Error: change.err.Error()})
+			continue
+		}
+
+		s.audit.Record(actorID, "update_status", "order", change.orderID, map[string]models.OrderStatus{
+			"from": change.from,
+			"to":   req.Status,
+		})
+		s.publishStatusChanged(change.orderID, req.Status)
+		results = append(results, models.BulkStatusResult{OrderID: change.orderID, Success: true})
+	}
+
+	return results, nil
+}
+
+// UpdateShipment applies a shipping provider's update: the new status and the
+// parcel's tracking number. The status must be a valid next step, like with
+// UpdateOrderStatus (so "shipped" is only accepted for paid orders)
+func (s *OrderService) UpdateShipment(actorID int, update models.ShipmentUpdate) error {
+	update.TrackingNumber = strings.TrimSpace(update.TrackingNumber)
+	if update.TrackingNumber == "" {
+		return &ValidationError{Field: "tracking_number", Message: "is required"}
+	}
+	if len(update.TrackingNumber) > maxTrackingNumberLength {
+		return &ValidationError{
+			Field:   "tracking_number",
+			Message: fmt.Sprintf("must be at most %d characters", maxTrackingNumberLength),
+		}
+	}
+
+	if !update.Status.Valid() {
+		return unknownStatusError(update.Status)
+	}
+
+	currentStatus, err := s.orders.GetStatus(update.OrderID)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return err
 	}
-	
-	if rowsAffected == 0 {
-		return fmt.Errorf("order not found")
+
+	if !canTransition(currentStatus, update.Status) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, currentStatus, update.Status)
 	}
 
+	if err := s.orders.UpdateShipment(update.OrderID, currentStatus, update.Status, update.TrackingNumber); err != nil {
+		return err
+	}
+
+	s.audit.Record(actorID, "update_shipment", "order", update.OrderID, map[string]string{
+		"from":            string(currentStatus),
+		"to":              string(update.Status),
+		"tracking_number": update.TrackingNumber,
+	})
+
+	s.publishStatusChanged(update.OrderID, update.Status)
+	return nil
+}
+
+// publishStatusChanged tells the rest of the system an order has a new status
+func (s *OrderService) publishStatusChanged(orderID int, status models.OrderStatus) {
 	// Publish MQTT event that order status changed
 	event := struct {
-		OrderID   int    `json:"order_id"`
-		Status    string `json:"status"`
-		Timestamp int64  `json:"timestamp"`
+		OrderID   int                `json:"order_id"`
+		Status    models.OrderStatus `json:"status"`
+		Timestamp int64              `json:"timestamp"`
 	}{
 		OrderID:   orderID,
 		Status:    status,
 		Timestamp: time.Now().Unix(),
 	}
-	
-	if err := s.mqttClient.Publish("order/status_changed", event); err != nil {
+
+	if err := s.publisher.Publish("order/status_changed", event); err != nil {
 		fmt.Printf("Failed to publish order status changed event: %v", err)
 	}
+}
 
+// holdableStatuses are the statuses a risky order can be held in - the ones
+// before it ships; once the parcel is gone, holding it would change nothing
+var holdableStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusPending: true,
+	models.OrderStatusPaid:    true,
+}
+
+// FlagRisk handles a fraud check's risk score for an order
+// Scores at or above the configured threshold put the order on hold (and publish
+// order/held); lower scores are ignored. Returns whether the order was held
+// An order already on hold stays held; shipped or delivered orders can't be held
+func (s *OrderService) FlagRisk(actorID int, flag models.RiskFlag) (bool, error) {
+	if flag.Score < s.riskHoldThreshold {
+		return false, nil
+	}
+
+	currentStatus, err := s.orders.GetStatus(flag.OrderID)
+	if err != nil {
+		return false, err
+	}
+	if currentStatus == models.OrderStatusOnHold {
+		return false, nil
+	}
+	if !holdableStatuses[currentStatus] {
+		return false, fmt.Errorf("%w: a %s order can't be put on hold", ErrInvalidStatusTransition, currentStatus)
+	}
+
+	if err := s.orders.Hold(flag.OrderID, currentStatus); err != nil {
+		return false, err
+	}
+
+	s.audit.Record(actorID, "hold", "order", flag.OrderID, map[string]interface{}{
+		"from":   currentStatus,
+		"score":  flag.Score,
+		"reason": flag.Reason,
+	})
+
+	event := models.OrderHeldEvent{
+		OrderID:   flag.OrderID,
+		Score:     flag.Score,
+		Reason:    flag.Reason,
+		Timestamp: time.Now().Unix(),
+	}
+	if err := s.publisher.Publish("order/held", event); err != nil {
+		fmt.Printf("Failed to publish order held event: %v", err)
+	}
+	return true, nil
+}
+
+// ReleaseOrder takes an order off hold, back to the status it had before
+// Returns the status the order is in now
+func (s *OrderService) ReleaseOrder(actorID, orderID int) (models.OrderStatus, error) {
+	status, err := s.orders.Release(orderID)
+	if err != nil {
+		return "", err
+	}
+
+	s.audit.Record(actorID, "release", "order", orderID, map[string]models.OrderStatus{
+		"from": models.OrderStatusOnHold,
+		"to":   status,
+	})
+
+	s.publishStatusChanged(orderID, status)
+	return status, nil
+}
+
+// payHeldOrder records the payment for an order that was held while pending
+// Its status doesn't change, so no order/status_changed event goes out
+// A second payment fails with ErrInvalidStatusTransition, like for a paid order
+func (s *OrderService) payHeldOrder(actorID, orderID int) error {
+	if err := s.orders.PayHeld(orderID); err != nil {
+		return err
+	}
+
+	s.audit.Record(actorID, "pay_held", "order", orderID, map[string]models.OrderStatus{
+		"from": models.OrderStatusPending,
+		"to":   models.OrderStatusPaid,
+	})
 	return nil
-}
\ No newline at end of file
+}
+
+// unknownStatusError is the ValidationError for a status that doesn't exist at all
+// (as opposed to a real status the order can't move to right now)
+func unknownStatusError(status models.OrderStatus) error {
+	return &ValidationError{
+		Field:   "status",
+		Message: fmt.Sprintf("unknown status %q (use %s)", status, joinStatuses(models.OrderStatuses)),
+	}
+}
+
+// joinStatuses lists statuses for a message, like "pending, paid, shipped"
+func joinStatuses(statuses []models.OrderStatus) string {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+	return strings.Join(names, ", ")
+}
+
+// canTransition reports whether an order may move from one status to another
+func canTransition(from, to models.OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// priceLine checks that quantity of a product can be ordered right now, and
+// returns the product and what the line costs
+// It fails with ErrProductNotFound, ErrProductNotAvailable, ErrInsufficientStock
+// or a ValidationError for problems with the line itself (see lineFailureReason)
+func (s *OrderService) priceLine(productID, quantity int) (*models.Product, int, error) {
+	product, err := s.orderableProduct(productID, quantity)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Check if we have enough stock
+	if product.StockQuantity < quantity {
+		return nil, 0, fmt.Errorf("%w: only %d items available", ErrInsufficientStock, product.StockQuantity)
+	}
+
+	// Calculate total price, using the sale price if a sale is running
+	// The total always comes from our own prices - never from the client
+	totalCents, err := lineTotal(product.EffectivePriceCents, quantity)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return product, totalCents, nil
+}
+
+// orderableProduct returns the product if an order may contain quantity of it
+// right now: within the order limits, published and inside its purchase window
+// Stock isn't checked, because an edited order already holds some of it
+func (s *OrderService) orderableProduct(productID, quantity int) (*models.Product, error) {
+	if quantity > s.maxQuantity {
+		return nil, &ValidationError{
+			Field:   "quantity",
+			Message: fmt.Sprintf("must be at most %d", s.maxQuantity),
+		}
+	}
+
+	// Get the product to check stock and calculate price (drafts can't be ordered yet)
+	product, err := hideDraft(s.products.GetByID(productID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Some products (like flash sales) can only be ordered during a time window
+	if !product.AvailableAt(time.Now()) {
+		return nil, fmt.Errorf("%w: %s", ErrProductNotAvailable, availabilityWindow(product))
+	}
+
+	// Some products (like promos) may only be bought a few at a time
+	if product.MaxPerOrder != nil && quantity > *product.MaxPerOrder {
+		return nil, &ValidationError{
+			Field:   "quantity",
+			Message: fmt.Sprintf("at most %d of this product per order", *product.MaxPerOrder),
+		}
+	}
+
+	return product, nil
+}
+
+// availabilityWindow describes a product's purchase window for error messages
+func availabilityWindow(product *models.Product) string {
+	switch {
+	case product.AvailableFrom != nil && product.AvailableUntil != nil:
+		return fmt.Sprintf("available from %s until %s",
+			product.AvailableFrom.Format(time.RFC3339), product.AvailableUntil.Format(time.RFC3339))
+	case product.AvailableFrom != nil:
+		return "available from " + product.AvailableFrom.Format(time.RFC3339)
+	default:
+		return "no longer available since " + product.AvailableUntil.Format(time.RFC3339)
+	}
+}
+
+// ValidateCart checks every line of a shopping cart the way placing an order
+// would, without placing it or holding any stock - so the answer may be out of
+// date by the time the customer checks out
+// Lines that couldn't be ordered say why; the total is that of the lines that can
+func (s *OrderService) ValidateCart(req models.CartValidationRequest) (*models.CartValidation, error) {
+	validation := &models.CartValidation{
+		Lines:        make([]models.CartLine, 0, len(req.Items)),
+		AllAvailable: true,
+	}
+
+	for _, item := range req.Items {
+		line := models.CartLine{ProductID: item.ProductID, Quantity: item.Quantity}
+
+		product, totalCents, err := s.priceLine(item.ProductID, item.Quantity)
+		if err != nil {
+			reason, ok := lineFailureReason(err)
+			if !ok {
+				return nil, err
+			}
+			line.Reason = reason
+			validation.AllAvailable = false
+			validation.Lines = append(validation.Lines, line)
+			continue
+		}
+
+		line.ProductName = product.Name
+		line.UnitPriceCents = product.EffectivePriceCents
+		line.LineTotalCents = totalCents
+		line.Available = true
+		validation.Lines = append(validation.Lines, line)
+
+		// Added up as int64, so a cart of many large lines can't overflow
+		validation.TotalCents += int64(totalCents)
+	}
+
+	return validation, nil
+}
+
+// lineTotal calculates price * quantity without integer overflow
+// The multiplication is done in int64 (which can't overflow for two int32-sized
+// values), then checked against what the total_cents column can store
+func lineTotal(priceCents, quantity int) (int, error) {
+	return checkedTotal(int64(priceCents) * int64(quantity))
+}
+
+// editedTotal is the new total of an order of oldQuantity items for oldTotal
+// that now has quantity items
+// Added items cost unitPriceCents each; the items already in the order keep
+// what they cost. Removed items (and added ones, with unitPriceCents 0) are
+// worth the order's average price per item
+func editedTotal(oldTotal, oldQuantity, quantity, unitPriceCents int) (int, error) {
+	if quantity > oldQuantity && unitPriceCents > 0 {
+		added, err := lineTotal(unitPriceCents, quantity-oldQuantity)
+		if err != nil {
+			return 0, err
+		}
+		return checkedTotal(int64(oldTotal) + int64(added))
+	}
+	return checkedTotal(int64(oldTotal) * int64(quantity) / int64(oldQuantity))
+}
+
+// checkedTotal returns total if the total_cents column can store it
+func checkedTotal(total int64) (int, error) {
+	if total > maxTotalCents {
+		return 0, &ValidationError{
+			Field:   "quantity",
+			Message: "order total is too large",
+		}
+	}
+	return int(total), nil
+}
@@ -0,0 +1,775 @@
+// internal/services/orders_test.go
+// Tests for placing and managing orders, on the in-memory fakes
+
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"online-store/internal/config"
+	"online-store/internal/models"
+)
+
+func TestCreateOrderWithFakeRepositories(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 12)
+	userID := s.addUser("ann@example.com")
+
+	order := s.placeOrder(t, userID, product.ID, 3)
+
+	if order.TotalCents != 2700 {
+		t.Errorf("TotalCents = %d, want 2700", order.TotalCents)
+	}
+	if order.Status != models.OrderStatusPending {
+		t.Errorf("Status = %q, want pending", order.Status)
+	}
+	if got := s.products.stock(product.ID); got != 9 {
+		t.Errorf("stock = %d, want 9", got)
+	}
+	if s.relay.notified != 1 {
+		t.Errorf("outbox worker notified %d times, want 1", s.relay.notified)
+	}
+	if got := s.audits.actions("order", order.ID); !reflect.DeepEqual(got, []string{"create"}) {
+		t.Errorf("audit actions = %v, want [create]", got)
+	}
+
+	// 9 left is below the reorder level of 10
+	alerts := s.publisher.published("inventory/low_stock")
+	if len(alerts) != 1 || alerts[0].(models.LowStockAlert).CurrentStock != 9 {
+		t.Errorf("low stock alerts = %v, want one with stock 9", alerts)
+	}
+}
+
+func TestCreateOrderInsufficientStock(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 2)
+	userID := s.addUser("ann@example.com")
+
+	_, err := s.orderService.CreateOrder(userID, models.OrderRequest{ProductID: product.ID, Quantity: 3})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("err = %v, want ErrInsufficientStock", err)
+	}
+	if got := s.products.stock(product.ID); got != 2 {
+		t.Errorf("stock = %d, want 2 (unchanged)", got)
+	}
+	if s.relay.notified != 0 {
+		t.Errorf("outbox worker notified for a failed order")
+	}
+}
+
+func TestCreateOrderUnknownProduct(t *testing.T) {
+	s := newTestStore(t)
+	userID := s.addUser("ann@example.com")
+
+	_, err := s.orderService.CreateOrder(userID, models.OrderRequest{ProductID: 42, Quantity: 1})
+	if !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("err = %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 50)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+
+	if err := s.orderService.UpdateOrderStatus(7, order.ID, models.OrderStatusPaid); err != nil {
+		t.Fatalf("pending -> paid: %v", err)
+	}
+	if got := s.orders.order(order.ID).Status; got != models.OrderStatusPaid {
+		t.Errorf("status = %q, want paid", got)
+	}
+	if got := s.audits.actions("order", order.ID); !reflect.DeepEqual(got, []string{"create", "update_status"}) {
+		t.Errorf("audit actions = %v, want [create update_status]", got)
+	}
+	if got := len(s.publisher.published("order/status_changed")); got != 1 {
+		t.Errorf("published %d order/status_changed events, want 1", got)
+	}
+
+	// Skipping a step isn't allowed
+	err := s.orderService.UpdateOrderStatus(7, order.ID, models.OrderStatusDelivered)
+	if !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("paid -> delivered: err = %v, want ErrInvalidStatusTransition", err)
+	}
+	// Neither is going back
+	err = s.orderService.UpdateOrderStatus(7, order.ID, models.OrderStatusPending)
+	if !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("paid -> pending: err = %v, want ErrInvalidStatusTransition", err)
+	}
+	if got := len(s.publisher.published("order/status_changed")); got != 1 {
+		t.Errorf("failed changes published events: %d, want 1", got)
+	}
+}
+
+func TestUpdateOrderStatusUnknown(t *testing.T) {
+	s := newTestStore(t)
+
+	err := s.orderService.UpdateOrderStatus(7, 1, "lost")
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "status" {
+		t.Fatalf("err = %v, want a ValidationError for status", err)
+	}
+
+	err = s.orderService.UpdateOrderStatus(7, 1, models.OrderStatusPaid)
+	if !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("err = %v, want ErrOrderNotFound", err)
+	}
+}
+
+func TestCreateOrderQuantityLimit(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) { cfg.MaxOrderQty = 10 })
+	product := s.addProduct("Mug", 900, 100)
+	userID := s.addUser("ann@example.com")
+
+	_, err := s.orderService.CreateOrder(userID, models.OrderRequest{ProductID: product.ID, Quantity: 11})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "quantity" {
+		t.Fatalf("err = %v, want a ValidationError for quantity", err)
+	}
+	if got := s.products.stock(product.ID); got != 100 {
+		t.Errorf("stock = %d, want 100 (unchanged)", got)
+	}
+
+	s.placeOrder(t, userID, product.ID, 10)
+}
+
+func TestOrderTotalTooLarge(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Yacht", maxPriceCents, 1000)
+
+	_, err := s.orderService.CreateOrder(s.addUser("ann@example.com"), models.OrderRequest{ProductID: product.ID, Quantity: 1000})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "quantity" {
+		t.Fatalf("err = %v, want a ValidationError for quantity", err)
+	}
+}
+
+func TestCreateGuestOrder(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+
+	order, err := s.orderService.CreateGuestOrder(models.GuestOrderRequest{Email: "guest@example.com", ProductID: product.ID, Quantity: 1})
+	if err != nil {
+		t.Fatalf("CreateGuestOrder: %v", err)
+	}
+	if order.TrackingToken == "" {
+		t.Error("no tracking token returned")
+	}
+
+	guest, err := s.users.GetByEmail("guest@example.com")
+	if err != nil {
+		t.Fatalf("guest user: %v", err)
+	}
+	if !guest.IsGuest || guest.PasswordHash != "" {
+		t.Errorf("guest user = %+v, want a guest without a password", guest)
+	}
+
+	// A second order from the same guest reuses the guest user
+	if _, err := s.orderService.CreateGuestOrder(models.GuestOrderRequest{Email: "guest@example.com", ProductID: product.ID, Quantity: 1}); err != nil {
+		t.Fatalf("second CreateGuestOrder: %v", err)
+	}
+	if len(s.users.users) != 1 {
+		t.Errorf("%d users, want 1", len(s.users.users))
+	}
+	orders, _ := s.orderService.GetUserOrders(guest.ID)
+	if len(orders) != 2 {
+		t.Errorf("guest has %d orders, want 2", len(orders))
+	}
+
+	// The token only finds this order
+	tracking, err := s.orderService.TrackOrder(order.TrackingToken)
+	if err != nil || tracking.OrderID != order.ID {
+		t.Errorf("TrackOrder = %+v, %v, want order %d", tracking, err, order.ID)
+	}
+}
+
+func TestTrackOrder(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 2)
+
+	// Registered users' orders get a token too; it goes out with the event
+	if len(s.orders.created) != 1 || s.orders.created[0].TrackingToken == "" {
+		t.Fatalf("created events = %+v, want one with a tracking token", s.orders.created)
+	}
+	token := s.orders.created[0].TrackingToken
+	if stored := s.orders.order(order.ID); stored.TrackingTokenHash == token || stored.TrackingTokenHash == "" {
+		t.Errorf("stored token hash = %q, want the hash of the token", stored.TrackingTokenHash)
+	}
+
+	tracking, err := s.orderService.TrackOrder(token)
+	if err != nil {
+		t.Fatalf("TrackOrder: %v", err)
+	}
+	if tracking.OrderID != order.ID || tracking.Status != models.OrderStatusPending || tracking.Quantity != 2 {
+		t.Errorf("tracking = %+v, want order %d, pending, quantity 2", tracking, order.ID)
+	}
+
+	for _, token := range []string{"", "not-a-token", s.orders.order(order.ID).TrackingTokenHash} {
+		if _, err := s.orderService.TrackOrder(token); !errors.Is(err, ErrOrderNotFound) {
+			t.Errorf("TrackOrder(%q) err = %v, want ErrOrderNotFound", token, err)
+		}
+	}
+}
+
+func TestCreateGuestOrderForRegisteredEmail(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	s.addUser("ann@example.com")
+
+	_, err := s.orderService.CreateGuestOrder(models.GuestOrderRequest{Email: "ann@example.com", ProductID: product.ID, Quantity: 1})
+	if !errors.Is(err, ErrAccountExists) {
+		t.Fatalf("err = %v, want ErrAccountExists", err)
+	}
+	if got := s.products.stock(product.ID); got != 10 {
+		t.Errorf("stock = %d, want 10 (unchanged)", got)
+	}
+}
+
+func TestGetUserSummary(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 50)
+	userID := s.addUser("ann@example.com")
+	paidOrder := s.placeOrder(t, userID, product.ID, 2)
+	s.placeOrder(t, userID, product.ID, 1) // Still pending, so not spent yet
+	if err := s.orderService.UpdateOrderStatus(SystemActor, paidOrder.ID, models.OrderStatusPaid); err != nil {
+		t.Fatalf("pay order: %v", err)
+	}
+
+	summary, err := s.orderService.GetUserSummary(userID)
+	if err != nil {
+		t.Fatalf("GetUserSummary: %v", err)
+	}
+	if summary.TotalOrders != 2 || summary.TotalSpendCents != 1800 || summary.LastOrderAt == nil {
+		t.Errorf("summary = %+v, want 2 orders, 1800 spent and a last order time", summary)
+	}
+}
+
+func TestGetUserSummaryUnknownUser(t *testing.T) {
+	s := newTestStore(t)
+	if _, err := s.orderService.GetUserSummary(42); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("err = %v, want ErrUserNotFound", err)
+	}
+
+	// A user without orders is no error
+	summary, err := s.orderService.GetUserSummary(s.addUser("ann@example.com"))
+	if err != nil || summary.TotalOrders != 0 || summary.LastOrderAt != nil {
+		t.Errorf("summary = %+v, err = %v, want an empty summary", summary, err)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 50)
+	userID := s.addUser("ann@example.com")
+	previous, err := s.orderService.CreateOrder(userID, models.OrderRequest{ProductID: product.ID, Quantity: 2, Note: "Leave at the door"})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	// Prices come from the catalog, not the old order
+	if _, err := s.productService.PatchProduct(1, product.ID, map[string]interface{}{"price_cents": float64(1000)}); err != nil {
+		t.Fatalf("PatchProduct: %v", err)
+	}
+
+	reorder, err := s.orderService.Reorder(userID, previous.ID)
+	if err != nil {
+		t.Fatalf("Reorder: %v", err)
+	}
+	if reorder.Order == nil || len(reorder.FailedLines) != 0 {
+		t.Fatalf("reorder = %+v, want a new order and no failed lines", reorder)
+	}
+	if reorder.Order.ID == previous.ID || reorder.Order.TotalCents != 2000 || reorder.Order.Note != "Leave at the door" {
+		t.Errorf("new order = %+v, want another order of 2 at 1000 with the old note", reorder.Order)
+	}
+}
+
+func TestReorderReportsLinesThatCantBeOrdered(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 3)
+	userID := s.addUser("ann@example.com")
+	previous := s.placeOrder(t, userID, product.ID, 2)
+
+	reorder, err := s.orderService.Reorder(userID, previous.ID)
+	if err != nil {
+		t.Fatalf("Reorder: %v", err)
+	}
+	if reorder.Order != nil || len(reorder.FailedLines) != 1 {
+		t.Fatalf("reorder = %+v, want no order and one failed line", reorder)
+	}
+	if line := reorder.FailedLines[0]; line.ProductID != product.ID || line.Quantity != 2 || !strings.Contains(line.Reason, "insufficient stock") {
+		t.Errorf("failed line = %+v, want the mug with an insufficient stock reason", line)
+	}
+}
+
+func TestReorderSomeoneElsesOrder(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 50)
+	previous := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+
+	_, err := s.orderService.Reorder(s.addUser("bob@example.com"), previous.ID)
+	if !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("err = %v, want ErrOrderNotFound", err)
+	}
+}
+
+func TestCreateOrderNote(t *testing.T) {
+	tests := []struct {
+		name string
+		note string
+		want string
+	}{
+		{"with note", "  Leave it at the back door ", "Leave it at the back door"},
+		{"without note", "", ""},
+		{"longest note", strings.Repeat("é", maxOrderNoteLength), strings.Repeat("é", maxOrderNoteLength)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			product := s.addProduct("Mug", 900, 12)
+			userID := s.addUser("ann@example.com")
+
+			order, err := s.orderService.CreateOrder(userID, models.OrderRequest{ProductID: product.ID, Quantity: 1, Note: tt.note})
+			if err != nil {
+				t.Fatalf("CreateOrder: %v", err)
+			}
+			if order.Note != tt.want {
+				t.Errorf("response Note = %q, want %q", order.Note, tt.want)
+			}
+			if got := s.orders.order(order.ID).Note; got != tt.want {
+				t.Errorf("stored Note = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateOrderNoteTooLong(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 12)
+	userID := s.addUser("ann@example.com")
+
+	note := strings.Repeat("a", maxOrderNoteLength+1)
+	_, err := s.orderService.CreateOrder(userID, models.OrderRequest{ProductID: product.ID, Quantity: 1, Note: note})
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "note" {
+		t.Fatalf("err = %v, want a ValidationError for note", err)
+	}
+	if len(s.orders.created) != 0 || s.products.stock(product.ID) != 12 {
+		t.Error("an order with a rejected note was created")
+	}
+}
+
+func TestCreateOrderMaxPerOrder(t *testing.T) {
+	s := newTestStore(t)
+	promo := s.products.add(models.Product{
+		Name:          "Promo mug",
+		PriceCents:    100,
+		StockQuantity: 50,
+		MaxPerOrder:   intPtr(1),
+		Status:        models.ProductStatusPublished,
+	})
+	regular := s.addProduct("Mug", 900, 50)
+	userID := s.addUser("ann@example.com")
+
+	_, err := s.orderService.CreateOrder(userID, models.OrderRequest{ProductID: promo.ID, Quantity: 2})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "quantity" {
+		t.Fatalf("over the limit: err = %v, want a ValidationError for quantity", err)
+	}
+	if got := s.products.stock(promo.ID); got != 50 {
+		t.Errorf("stock = %d, want 50 (unchanged)", got)
+	}
+
+	// Up to the limit is fine, and products without a limit aren't affected
+	s.placeOrder(t, userID, promo.ID, 1)
+	s.placeOrder(t, userID, regular.ID, 20)
+}
+
+func TestUpdateShipment(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 50)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+	s.orders.setStatus(order.ID, models.OrderStatusPaid)
+
+	update := models.ShipmentUpdate{OrderID: order.ID, Status: models.OrderStatusShipped, TrackingNumber: " 1Z999AA10123456784 "}
+	if err := s.orderService.UpdateShipment(SystemActor, update); err != nil {
+		t.Fatalf("UpdateShipment: %v", err)
+	}
+
+	stored := s.orders.order(order.ID)
+	if stored.Status != models.OrderStatusShipped || stored.trackingNumber != "1Z999AA10123456784" {
+		t.Errorf("order = %s with tracking number %q, want shipped with the trimmed number", stored.Status, stored.trackingNumber)
+	}
+	if got := len(s.publisher.published("order/status_changed")); got != 1 {
+		t.Errorf("published %d order/status_changed events, want 1", got)
+	}
+}
+
+func TestUpdateShipmentRejected(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 50)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+
+	tests := []struct {
+		name   string
+		update models.ShipmentUpdate
+		want   error
+	}{
+		{"not paid yet", models.ShipmentUpdate{OrderID: order.ID, Status: models.OrderStatusShipped, TrackingNumber: "1Z"}, ErrInvalidStatusTransition},
+		{"unknown order", models.ShipmentUpdate{OrderID: 42, Status: models.OrderStatusShipped, TrackingNumber: "1Z"}, ErrOrderNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.orderService.UpdateShipment(SystemActor, tt.update); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	invalid := []models.ShipmentUpdate{
+		{OrderID: order.ID, Status: models.OrderStatusShipped},
+		{OrderID: order.ID, Status: models.OrderStatusShipped, TrackingNumber: strings.Repeat("9", maxTrackingNumberLength+1)},
+		{OrderID: order.ID, Status: "lost", TrackingNumber: "1Z"},
+	}
+	for _, update := range invalid {
+		var validationErr *ValidationError
+		if err := s.orderService.UpdateShipment(SystemActor, update); !errors.As(err, &validationErr) {
+			t.Errorf("UpdateShipment(%+v): err = %v, want a ValidationError", update, err)
+		}
+	}
+
+	if got := s.orders.order(order.ID).Status; got != models.OrderStatusPending {
+		t.Errorf("status = %s, want pending (unchanged)", got)
+	}
+	if got := len(s.publisher.published("order/status_changed")); got != 0 {
+		t.Errorf("rejected updates published %d events", got)
+	}
+}
+
+func TestBulkUpdateOrderStatus(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 50)
+	userID := s.addUser("ann@example.com")
+	pending := s.placeOrder(t, userID, product.ID, 1)
+	paid := s.placeOrder(t, userID, product.ID, 1)
+	shipped := s.placeOrder(t, userID, product.ID, 1)
+	s.orders.setStatus(paid.ID, models.OrderStatusPaid)
+	s.orders.setStatus(shipped.ID, models.OrderStatusShipped)
+
+	// Only the paid order can be shipped; it's listed twice
+	results, err := s.orderService.BulkUpdateOrderStatus(7, models.BulkStatusUpdate{
+		OrderIDs: []int{pending.ID, paid.ID, shipped.ID, 99, paid.ID},
+		Status:   models.OrderStatusShipped,
+	})
+	if err != nil {
+		t.Fatalf("BulkUpdateOrderStatus: %v", err)
+	}
+
+	wantSuccess := []struct {
+		orderID int
+		success bool
+	}{{pending.ID, false}, {paid.ID, true}, {shipped.ID, false}, {99, false}}
+	if len(results) != len(wantSuccess) {
+		t.Fatalf("results = %+v, want one per distinct order", results)
+	}
+	for i, want := range wantSuccess {
+		result := results[i]
+		if result.OrderID != want.orderID || result.Success != want.success {
+			t.Errorf("result %d = %+v, want order %d with success %t", i, result, want.orderID, want.success)
+		}
+		if !result.Success && result.Error == "" {
+			t.Errorf("result %d failed without saying why", i)
+		}
+	}
+
+	wantStatuses := map[int]models.OrderStatus{
+		pending.ID: models.OrderStatusPending,
+		paid.ID:    models.OrderStatusShipped,
+		shipped.ID: models.OrderStatusShipped,
+	}
+	for id, want := range wantStatuses {
+		if got := s.orders.order(id).Status; got != want {
+			t.Errorf("order %d status = %q, want %q", id, got, want)
+		}
+	}
+
+	// Only the changed order is audited and announced
+	if got := s.audits.actions("order", paid.ID); !reflect.DeepEqual(got, []string{"create", "update_status"}) {
+		t.Errorf("audit actions of the shipped order = %v, want [create update_status]", got)
+	}
+	if got := s.audits.actions("order", pending.ID); !reflect.DeepEqual(got, []string{"create"}) {
+		t.Errorf("audit actions of the failed order = %v, want [create]", got)
+	}
+	if got := len(s.publisher.published("order/status_changed")); got != 1 {
+		t.Errorf("published %d order/status_changed events, want 1", got)
+	}
+}
+
+func TestBulkUpdateOrderStatusUnknownStatus(t *testing.T) {
+	s := newTestStore(t)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), s.addProduct("Mug", 900, 50).ID, 1)
+
+	_, err := s.orderService.BulkUpdateOrderStatus(7, models.BulkStatusUpdate{OrderIDs: []int{order.ID}, Status: "lost"})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "status" {
+		t.Errorf("err = %v, want a ValidationError for status", err)
+	}
+	if got := s.orders.order(order.ID).Status; got != models.OrderStatusPending {
+		t.Errorf("status = %q, want it unchanged", got)
+	}
+}
+
+func TestEditOrder(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	userID := s.addUser("ann@example.com")
+	order := s.placeOrder(t, userID, product.ID, 2) // 8 left
+
+	// More: the difference comes out of stock
+	edited, err := s.orderService.EditOrder(userID, order.ID, models.OrderEdit{Quantity: 5})
+	if err != nil {
+		t.Fatalf("EditOrder to 5: %v", err)
+	}
+	if edited.Quantity != 5 || edited.TotalCents != 4500 || s.products.stock(product.ID) != 5 {
+		t.Errorf("order = %d for %d cents, stock = %d; want 5 for 4500 and 5 left", edited.Quantity, edited.TotalCents, s.products.stock(product.ID))
+	}
+
+	// Less: the difference goes back into stock
+	edited, err = s.orderService.EditOrder(userID, order.ID, models.OrderEdit{Quantity: 1})
+	if err != nil {
+		t.Fatalf("EditOrder to 1: %v", err)
+	}
+	if edited.Quantity != 1 || edited.TotalCents != 900 || s.products.stock(product.ID) != 9 {
+		t.Errorf("order = %d for %d cents, stock = %d; want 1 for 900 and 9 left", edited.Quantity, edited.TotalCents, s.products.stock(product.ID))
+	}
+
+	// Up to everything in stock plus what the order already has
+	if _, err := s.orderService.EditOrder(userID, order.ID, models.OrderEdit{Quantity: 10}); err != nil {
+		t.Fatalf("EditOrder to 10: %v", err)
+	}
+	if got := s.products.stock(product.ID); got != 0 {
+		t.Errorf("stock = %d, want 0", got)
+	}
+
+	if got := s.audits.actions("order", order.ID); !reflect.DeepEqual(got, []string{"create", "update", "update", "update"}) {
+		t.Errorf("audit actions = %v, want create and three updates", got)
+	}
+}
+
+func TestEditOrderRejected(t *testing.T) {
+	maxPerOrder := 3
+	tests := []struct {
+		name     string
+		quantity int
+		status   models.OrderStatus
+		userID   int // 0 is the owner
+		wantErr  error
+		field    string // Instead of wantErr, a validation error for this field
+	}{
+		{name: "more than in stock", quantity: 12, wantErr: ErrInsufficientStock},
+		{name: "already paid", quantity: 2, status: models.OrderStatusPaid, wantErr: ErrOrderNotEditable},
+		{name: "shipped", quantity: 2, status: models.OrderStatusShipped, wantErr: ErrOrderNotEditable},
+		{name: "on hold", quantity: 2, status: models.OrderStatusOnHold, wantErr: ErrOrderNotEditable},
+		{name: "someone else's order", quantity: 2, userID: 99, wantErr: ErrOrderNotFound},
+		{name: "over the order limit", quantity: 1001, field: "quantity"},
+		{name: "over the product's limit", quantity: maxPerOrder + 1, field: "quantity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			product := models.Product{Name: "Mug", PriceCents: 900, StockQuantity: 11, Status: models.ProductStatusPublished}
+			if tt.name == "over the product's limit" {
+				product.MaxPerOrder = &maxPerOrder
+			}
+			product = *s.products.add(product)
+			userID := s.addUser("ann@example.com")
+			order := s.placeOrder(t, userID, product.ID, 2) // 9 left
+			if tt.status != "" {
+				s.orders.setStatus(order.ID, tt.status)
+			}
+			if tt.userID == 0 {
+				tt.userID = userID
+			}
+
+			_, err := s.orderService.EditOrder(tt.userID, order.ID, models.OrderEdit{Quantity: tt.quantity})
+			var validationErr *ValidationError
+			switch {
+			case tt.field != "":
+				if !errors.As(err, &validationErr) || validationErr.Field != tt.field {
+					t.Fatalf("err = %v, want a validation error for %s", err, tt.field)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			// Nothing changed
+			stored := s.orders.order(order.ID)
+			if stored.Quantity != 2 || stored.TotalCents != 1800 || s.products.stock(product.ID) != 9 {
+				t.Errorf("order = %d for %d cents, stock = %d; want it unchanged", stored.Quantity, stored.TotalCents, s.products.stock(product.ID))
+			}
+		})
+	}
+}
+
+func TestEditOrderAfterPurchaseWindow(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	userID := s.addUser("ann@example.com")
+	order := s.placeOrder(t, userID, product.ID, 3)
+
+	// The flash sale closes while the order is still pending
+	s.products.products[product.ID].AvailableUntil = timePtr(time.Now().Add(-time.Minute))
+
+	if _, err := s.orderService.EditOrder(userID, order.ID, models.OrderEdit{Quantity: 4}); !errors.Is(err, ErrProductNotAvailable) {
+		t.Fatalf("adding items: err = %v, want ErrProductNotAvailable", err)
+	}
+
+	// Taking items out is still fine
+	edited, err := s.orderService.EditOrder(userID, order.ID, models.OrderEdit{Quantity: 1})
+	if err != nil {
+		t.Fatalf("removing items: %v", err)
+	}
+	if edited.Quantity != 1 || edited.TotalCents != 900 {
+		t.Errorf("order = %d for %d cents, want 1 for 900", edited.Quantity, edited.TotalCents)
+	}
+}
+
+func TestEditOrderAfterSaleEnded(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	s.products.products[product.ID].SalePriceCents = intPtr(600)
+	userID := s.addUser("ann@example.com")
+	order := s.placeOrder(t, userID, product.ID, 3) // 1800 at the sale price
+
+	s.products.products[product.ID].SaleEndsAt = timePtr(time.Now().Add(-time.Minute))
+
+	// Fewer items keep the price the order was placed at...
+	edited, err := s.orderService.EditOrder(userID, order.ID, models.OrderEdit{Quantity: 2})
+	if err != nil {
+		t.Fatalf("removing items: %v", err)
+	}
+	if edited.TotalCents != 1200 {
+		t.Errorf("total after removing an item = %d, want 1200", edited.TotalCents)
+	}
+
+	// ...but added items are priced like a new order, without the sale
+	edited, err = s.orderService.EditOrder(userID, order.ID, models.OrderEdit{Quantity: 4})
+	if err != nil {
+		t.Fatalf("adding items: %v", err)
+	}
+	if edited.TotalCents != 3000 {
+		t.Errorf("total after adding items = %d, want 1200 for the two on sale and 1800 for two at the regular price", edited.TotalCents)
+	}
+}
+
+func TestEditOrderAfterPriceChange(t *testing.T) {
+	tests := []struct {
+		name      string
+		newPrice  int
+		wantTotal int
+	}{
+		{"price went up", 1200, 1800 + 1200},
+		{"price went down", 600, 1800 + 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			product := s.addProduct("Mug", 900, 10)
+			userID := s.addUser("ann@example.com")
+			order := s.placeOrder(t, userID, product.ID, 2) // 1800
+
+			s.products.products[product.ID].PriceCents = tt.newPrice
+
+			// Only the added item is at the new price; the two already ordered keep theirs
+			edited, err := s.orderService.EditOrder(userID, order.ID, models.OrderEdit{Quantity: 3})
+			if err != nil {
+				t.Fatalf("EditOrder: %v", err)
+			}
+			if edited.TotalCents != tt.wantTotal {
+				t.Errorf("total = %d, want %d", edited.TotalCents, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestUserDataExport(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	ann, bob := s.addUser("ann@example.com"), s.addUser("bob@example.com")
+	first := s.placeOrder(t, ann, product.ID, 1)
+	s.placeOrder(t, bob, product.ID, 1)
+	second := s.placeOrder(t, ann, product.ID, 2)
+
+	profile, err := s.orderService.GetUserData(ann)
+	if err != nil {
+		t.Fatalf("GetUserData: %v", err)
+	}
+	if profile.ID != ann || profile.Email != "ann@example.com" {
+		t.Errorf("profile = %+v, want ann's", profile)
+	}
+
+	var ids []int
+	err = s.orderService.StreamUserOrders(ann, func(order models.OrderResponse) error {
+		ids = append(ids, order.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamUserOrders: %v", err)
+	}
+	if want := []int{first.ID, second.ID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("streamed orders %v, want %v (oldest first, only ann's)", ids, want)
+	}
+
+	if _, err := s.orderService.GetUserData(42); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestCreateOrderOutsidePurchaseWindow(t *testing.T) {
+	s := newTestStore(t)
+	userID := s.addUser("ann@example.com")
+	upcoming := s.products.add(models.Product{Name: "Preorder", PriceCents: 500, StockQuantity: 5, Status: models.ProductStatusPublished,
+		AvailableFrom: timePtr(time.Now().Add(time.Hour))})
+	over := s.products.add(models.Product{Name: "Flash sale", PriceCents: 500, StockQuantity: 5, Status: models.ProductStatusPublished,
+		AvailableUntil: timePtr(time.Now().Add(-time.Hour))})
+	open := s.products.add(models.Product{Name: "Lamp", PriceCents: 500, StockQuantity: 5, Status: models.ProductStatusPublished,
+		AvailableFrom: timePtr(time.Now().Add(-time.Hour)), AvailableUntil: timePtr(time.Now().Add(time.Hour))})
+
+	for _, product := range []*models.Product{upcoming, over} {
+		_, err := s.orderService.CreateOrder(userID, models.OrderRequest{ProductID: product.ID, Quantity: 1})
+		if !errors.Is(err, ErrProductNotAvailable) {
+			t.Errorf("%s: err = %v, want ErrProductNotAvailable", product.Name, err)
+		}
+		if got := s.products.stock(product.ID); got != 5 {
+			t.Errorf("%s: stock = %d, want 5 (untouched)", product.Name, got)
+		}
+	}
+	s.placeOrder(t, userID, open.ID, 1)
+
+	// The cart says why too
+	validation, err := s.orderService.ValidateCart(models.CartValidationRequest{Items: []models.CartItem{{ProductID: over.ID, Quantity: 1}}})
+	if err != nil {
+		t.Fatalf("ValidateCart: %v", err)
+	}
+	if line := validation.Lines[0]; line.Available || !strings.Contains(line.Reason, "no longer available") {
+		t.Errorf("line = %+v, want unavailable because the window is over", line)
+	}
+}
+
+func TestLineTotal(t *testing.T) {
+	if total, err := lineTotal(333, 3); err != nil || total != 999 {
+		t.Errorf("lineTotal(333, 3) = %d, %v; want 999", total, err)
+	}
+
+	var validationErr *ValidationError
+	if _, err := lineTotal(maxTotalCents, 2); !errors.As(err, &validationErr) {
+		t.Errorf("lineTotal above the maximum: err = %v, want a ValidationError", err)
+	}
+}
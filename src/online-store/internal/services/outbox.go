@@ -0,0 +1,149 @@
+// internal/services/outbox.go
+// This file makes sure events reach MQTT even when the broker is briefly down
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// outboxBatchSize is how many waiting events the worker retries per round
+const outboxBatchSize = 100
+
+// OutboxPublisher is a Publisher that never loses an event
+// If publishing fails, the event is saved in the outbox table and
+// OutboxWorker keeps retrying it. Without this, a broker hiccup during
+// e.g. registration meant the welcome email was never sent
+type OutboxPublisher struct {
+	next   Publisher // The real publisher (our MQTT client)
+	outbox OutboxRepository
+}
+
+// NewOutboxPublisher wraps next, saving events it fails to publish in outbox
+func NewOutboxPublisher(next Publisher, outbox OutboxRepository) *OutboxPublisher {
+	return &OutboxPublisher{next: next, outbox: outbox}
+}
+
+// Publish publishes the event, or saves it for a later retry if that fails
+// An error is only returned if the event couldn't be saved either
+func (p *OutboxPublisher) Publish(topic string, payload interface{}) error {
+	publishErr := p.next.Publish(topic, payload)
+	if publishErr == nil {
+		return nil
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		// Can't be encoded, so a retry can't work either
+		return publishErr
+	}
+
+	if err := p.outbox.Enqueue(topic, payloadJSON, publishErr.Error()); err != nil {
+		return fmt.Errorf("%v (and saving it for a retry failed: %w)", publishErr, err)
+	}
+
+	log.Printf("Publishing to %s failed, saved in the outbox for a retry: %v", topic, publishErr)
+	return nil
+}
+
+// OutboxNotifier is told when new events were saved in the outbox
+// (OutboxWorker implements it)
+type OutboxNotifier interface {
+	Notify()
+}
+
+// OutboxWorker publishes the events waiting in the outbox
+// Besides failed publishes, that's events saved in the same transaction as
+// the change they describe (like "order created")
+type OutboxWorker struct {
+	publisher Publisher // The real publisher, not the OutboxPublisher (or failures would enqueue twice); it must never drop events
+	outbox    OutboxRepository
+	wake      chan struct{}
+}
+
+// NewOutboxWorker creates a worker that publishes outbox events with publisher
+func NewOutboxWorker(publisher Publisher, outbox OutboxRepository) *OutboxWorker {
+	return &OutboxWorker{
+		publisher: publisher,
+		outbox:    outbox,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify asks the worker to publish the outbox now instead of at the next retry
+// It never blocks: if a wake-up is already waiting, that one covers this event too
+func (w *OutboxWorker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes the outbox whenever Notify is called, and retries it every
+// interval, until ctx is cancelled
+// Start it in its own goroutine; an interval of 0 turns the retries off
+// (events are then only published when Notify is called)
+func (w *OutboxWorker) Run(ctx context.Context, interval time.Duration) {
+	// A nil channel never receives, so without retries only wake-ups are handled
+	var retry <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		retry = ticker.C
+	} else {
+		log.Println("Outbox retries are turned off")
+	}
+
+	// Publish whatever was left over from before a restart
+	w.Notify()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-retry:
+		}
+
+		if _, err := w.PublishPending(); err != nil {
+			log.Printf("Publishing the outbox failed: %v", err)
+		}
+	}
+}
+
+// PublishPending tries to publish every waiting event once, oldest first
+// It stops at the first failure - if the broker is still down, the rest would
+// fail too, and stopping keeps the events in order
+// Returns how many events were published
+func (w *OutboxWorker) PublishPending() (int, error) {
+	messages, err := w.outbox.ListPending(outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, message := range messages {
+		if err := w.publisher.Publish(message.Topic, message.Payload); err != nil {
+			if recordErr := w.outbox.RecordFailure(message.ID, err.Error()); recordErr != nil {
+				log.Printf("Failed to record outbox failure for message %d: %v", message.ID, recordErr)
+			}
+			return published, nil
+		}
+
+		// Published - if deleting fails, the event may go out twice, which
+		// is fine for our at-least-once MQTT consumers
+		if err := w.outbox.Delete(message.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	if published > 0 {
+		log.Printf("Published %d events from the outbox", published)
+	}
+	return published, nil
+}
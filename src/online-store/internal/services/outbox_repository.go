@@ -0,0 +1,104 @@
+// internal/services/outbox_repository.go
+// This file contains the database access for the outbox of unpublished events
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"online-store/internal/database"
+	"online-store/internal/models"
+)
+
+// OutboxRepository defines how unpublished events are stored
+type OutboxRepository interface {
+	Enqueue(topic string, payload []byte, lastError string) error
+	ListPending(limit int) ([]models.OutboxMessage, error)
+	Delete(id int) error
+	RecordFailure(id int, lastError string) error
+}
+
+// SQLOutboxRepository is the MariaDB-backed OutboxRepository
+type SQLOutboxRepository struct {
+	db *database.DB
+}
+
+// NewSQLOutboxRepository creates an outbox repository using the given database
+func NewSQLOutboxRepository(db *database.DB) *SQLOutboxRepository {
+	return &SQLOutboxRepository{db: db}
+}
+
+// Enqueue stores an event that still has to be published
+func (r *SQLOutboxRepository) Enqueue(topic string, payload []byte, lastError string) error {
+	_, err := r.db.Exec(
+		"INSERT INTO outbox (topic, payload, attempts, last_error) VALUES (?, ?, 1, ?)",
+		topic, string(payload), lastError,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue event: %w", err)
+	}
+	return nil
+}
+
+// enqueueInTx stores an event as part of a bigger transaction
+// The event is only saved if the transaction commits, and it can't get lost
+// if we crash right after the commit - the outbox worker publishes it later
+func enqueueInTx(tx *database.Tx, topic string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", topic, err)
+	}
+
+	if _, err := tx.Exec("INSERT INTO outbox (topic, payload) VALUES (?, ?)", topic, string(payloadJSON)); err != nil {
+		return fmt.Errorf("failed to enqueue event: %w", err)
+	}
+	return nil
+}
+
+// ListPending returns the oldest waiting events first, so they go out in order
+func (r *SQLOutboxRepository) ListPending(limit int) ([]models.OutboxMessage, error) {
+	rows, err := r.db.Query(`
+		SELECT id, topic, payload, attempts, COALESCE(last_error, ''), created_at
+		FROM outbox
+		ORDER BY id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var message models.OutboxMessage
+		var payload string
+		if err := rows.Scan(&message.ID, &message.Topic, &payload, &message.Attempts, &message.LastError, &message.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		message.Payload = []byte(payload)
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+// Delete removes an event once it has been published
+func (r *SQLOutboxRepository) Delete(id int) error {
+	if _, err := r.db.Exec("DELETE FROM outbox WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete outbox message: %w", err)
+	}
+	return nil
+}
+
+// RecordFailure notes another failed attempt to publish an event
+func (r *SQLOutboxRepository) RecordFailure(id int, lastError string) error {
+	_, err := r.db.Exec(
+		"UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE id = ?",
+		lastError, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update outbox message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// internal/services/outbox_test.go
+// Tests for saving events that failed to publish and retrying them
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"online-store/internal/models"
+	"online-store/internal/passwords"
+)
+
+func TestRegisterSavesFailedEventInOutbox(t *testing.T) {
+	s := newTestStore(t)
+	s.publisher.fail(errors.New("not connected to the MQTT broker"))
+	auth := NewAuthService(s.users, s.sessions, s.denylist, NewOutboxPublisher(s.publisher, s.outbox), s.jwtKeys, passwords.Bcrypt, s.cfg)
+
+	user, err := auth.Register(models.UserRegistration{Email: "ann@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	// The verification email's event failed too, and waits behind it
+	pending, _ := s.outbox.ListPending(10)
+	if len(pending) != 2 || pending[0].Topic != "user/registered" || pending[1].Topic != "user/verification_requested" {
+		t.Fatalf("outbox = %+v, want the user/registered and user/verification_requested events", pending)
+	}
+	if pending[0].LastError != "not connected to the MQTT broker" {
+		t.Errorf("LastError = %q, want the publish error", pending[0].LastError)
+	}
+	var event struct {
+		UserID int    `json:"user_id"`
+		Email  string `json:"email"`
+	}
+	if err := json.Unmarshal(pending[0].Payload, &event); err != nil || event.UserID != user.ID || event.Email != "ann@example.com" {
+		t.Errorf("saved payload = %s, want the registered user", pending[0].Payload)
+	}
+}
+
+func TestOutboxPublisherPassesThrough(t *testing.T) {
+	s := newTestStore(t)
+	publisher := NewOutboxPublisher(s.publisher, s.outbox)
+
+	if err := publisher.Publish("product/created", map[string]int{"product_id": 1}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := len(s.publisher.published("product/created")); got != 1 {
+		t.Errorf("published %d events, want 1", got)
+	}
+	if s.outbox.pending() != 0 {
+		t.Errorf("%d events in the outbox, want none", s.outbox.pending())
+	}
+}
+
+func TestOutboxWorkerPublishesPending(t *testing.T) {
+	s := newTestStore(t)
+	s.outbox.Enqueue("user/registered", []byte(`{"user_id":1}`), "broker down")
+	s.outbox.Enqueue("user/registered", []byte(`{"user_id":2}`), "broker down")
+	worker := NewOutboxWorker(s.publisher, s.outbox)
+
+	// Still down: the first event fails, and the second isn't tried out of order
+	s.publisher.fail(errors.New("broker down"))
+	if published, err := worker.PublishPending(); published != 0 || err != nil {
+		t.Fatalf("PublishPending = %d, %v; want 0, nil", published, err)
+	}
+	pending, _ := s.outbox.ListPending(10)
+	if len(pending) != 2 || pending[0].Attempts != 1 || pending[1].Attempts != 0 {
+		t.Errorf("outbox = %+v, want both events, the first with one failed attempt", pending)
+	}
+
+	// Back up: everything goes out, oldest first
+	s.publisher.fail(nil)
+	if published, err := worker.PublishPending(); published != 2 || err != nil {
+		t.Fatalf("PublishPending = %d, %v; want 2, nil", published, err)
+	}
+	events := s.publisher.published("user/registered")
+	if len(events) != 2 || string(events[0].(json.RawMessage)) != `{"user_id":1}` {
+		t.Errorf("published %v, want both events in order", events)
+	}
+	if s.outbox.pending() != 0 {
+		t.Errorf("%d events left in the outbox, want none", s.outbox.pending())
+	}
+}
+
+func TestOutboxWorkerRetriesUntilPublished(t *testing.T) {
+	s := newTestStore(t)
+	s.publisher.fail(errors.New("broker down"))
+	s.outbox.Enqueue("user/registered", []byte(`{"user_id":1}`), "broker down")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewOutboxWorker(s.publisher, s.outbox).Run(ctx, 5*time.Millisecond)
+
+	time.Sleep(20 * time.Millisecond)
+	s.publisher.fail(nil)
+
+	deadline := time.Now().Add(time.Second)
+	for s.outbox.pending() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the worker didn't publish the event once the broker was back")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := len(s.publisher.published("user/registered")); got != 1 {
+		t.Errorf("published %d events, want 1", got)
+	}
+}
+
+func TestCreateOrderWakesTheRelay(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+	if s.relay.notified != 1 {
+		t.Errorf("relay notified %d times, want 1", s.relay.notified)
+	}
+	// The event is saved with the order (see TestCreateOrderSavesEventInSameTransaction),
+	// not published by the service itself
+	if len(s.orders.created) != 1 || s.orders.created[0].OrderID != order.ID {
+		t.Errorf("saved events = %+v, want order %d's", s.orders.created, order.ID)
+	}
+	if got := len(s.publisher.published("order/created")); got != 0 {
+		t.Errorf("service published order/created %d times, want 0", got)
+	}
+
+	// A failed order wakes nobody
+	if _, err := s.orderService.CreateOrder(1, models.OrderRequest{ProductID: product.ID, Quantity: 50}); err == nil {
+		t.Fatal("ordering more than in stock worked")
+	}
+	if s.relay.notified != 1 {
+		t.Errorf("relay notified %d times after a failed order, want 1", s.relay.notified)
+	}
+}
+
+func TestOutboxWorkerPublishesOnce(t *testing.T) {
+	s := newTestStore(t)
+	s.outbox.Enqueue("order/created", []byte(`{"order_id":1}`), "")
+	worker := NewOutboxWorker(s.publisher, s.outbox)
+
+	for i := 0; i < 3; i++ {
+		if _, err := worker.PublishPending(); err != nil {
+			t.Fatalf("PublishPending: %v", err)
+		}
+	}
+	if got := len(s.publisher.published("order/created")); got != 1 {
+		t.Errorf("published %d times, want once", got)
+	}
+}
+
+func TestOutboxWorkerWakesOnNotify(t *testing.T) {
+	s := newTestStore(t)
+	worker := NewOutboxWorker(s.publisher, s.outbox)
+
+	// Notify never blocks, even with nobody running the worker
+	for i := 0; i < 3; i++ {
+		worker.Notify()
+	}
+
+	// Without retries, only Notify makes the worker publish
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Run(ctx, 0)
+
+	s.outbox.Enqueue("order/created", []byte(`{"order_id":1}`), "")
+	worker.Notify()
+
+	deadline := time.Now().Add(time.Second)
+	for s.outbox.pending() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the worker didn't publish the event after Notify")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := len(s.publisher.published("order/created")); got != 1 {
+		t.Errorf("published %d events, want 1", got)
+	}
+}
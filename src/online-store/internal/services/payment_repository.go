@@ -0,0 +1,85 @@
+// internal/services/payment_repository.go
+// This file contains the database access for payment reconciliation
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"online-store/internal/database"
+	"online-store/internal/models"
+)
+
+// PaymentRepository defines how we read confirmed payments and remember
+// how far we've reconciled them
+type PaymentRepository interface {
+	ConfirmedSince(since time.Time) ([]models.PaymentConfirmation, error)
+	GetWatermark(name string) (time.Time, error)
+	SetWatermark(name string, value time.Time) error
+}
+
+// SQLPaymentRepository is the MariaDB-backed PaymentRepository
+type SQLPaymentRepository struct {
+	db *database.DB
+}
+
+// NewSQLPaymentRepository creates a payment repository using the given database
+func NewSQLPaymentRepository(db *database.DB) *SQLPaymentRepository {
+	return &SQLPaymentRepository{db: db}
+}
+
+// ConfirmedSince returns payments confirmed at or after since, oldest first
+func (r *SQLPaymentRepository) ConfirmedSince(since time.Time) ([]models.PaymentConfirmation, error) {
+	rows, err := r.db.Query(`
+		SELECT id, order_id, confirmed_at
+		FROM payments
+		WHERE status = 'confirmed' AND confirmed_at >= ?
+		ORDER BY confirmed_at, id
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []models.PaymentConfirmation
+	for rows.Next() {
+		var payment models.PaymentConfirmation
+		if err := rows.Scan(&payment.ID, &payment.OrderID, &payment.ConfirmedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan payment: %w", err)
+		}
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+// GetWatermark returns the stored watermark, or the zero time if there is none yet
+func (r *SQLPaymentRepository) GetWatermark(name string) (time.Time, error) {
+	var value time.Time
+	err := r.db.QueryRow(
+		"SELECT last_reconciled_at FROM reconciliation_state WHERE name = ?",
+		name,
+	).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to get watermark: %w", err)
+	}
+	return value, nil
+}
+
+// SetWatermark stores (or replaces) a watermark
+func (r *SQLPaymentRepository) SetWatermark(name string, value time.Time) error {
+	_, err := r.db.Exec(
+		`INSERT INTO reconciliation_state (name, last_reconciled_at) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE last_reconciled_at = VALUES(last_reconciled_at)`,
+		name, value,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set watermark: %w", err)
+	}
+	return nil
+}
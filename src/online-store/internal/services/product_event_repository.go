@@ -0,0 +1,67 @@
+// internal/services/product_event_repository.go
+// This file contains the database access for product events
+
+package services
+
+import (
+	"fmt"
+
+	"online-store/internal/database"
+	"online-store/internal/models"
+)
+
+// ProductEventRepository defines how product events are stored and read
+type ProductEventRepository interface {
+	Insert(event models.ProductEvent) error
+	ListForProduct(productID, limit int) ([]models.ProductEvent, error)
+}
+
+// SQLProductEventRepository is the MariaDB-backed ProductEventRepository
+type SQLProductEventRepository struct {
+	db *database.DB
+}
+
+// NewSQLProductEventRepository creates a product event repository using the given database
+func NewSQLProductEventRepository(db *database.DB) *SQLProductEventRepository {
+	return &SQLProductEventRepository{db: db}
+}
+
+// Insert writes one product event
+func (r *SQLProductEventRepository) Insert(event models.ProductEvent) error {
+	_, err := r.db.Exec(
+		"INSERT INTO product_events (product_id, event_type, topic, payload) VALUES (?, ?, NULLIF(?, ''), ?)",
+		event.ProductID, event.Type, event.Topic, string(event.Payload),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write product event: %w", err)
+	}
+	return nil
+}
+
+// ListForProduct returns a product's most recent events, newest first
+func (r *SQLProductEventRepository) ListForProduct(productID, limit int) ([]models.ProductEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT id, product_id, event_type, COALESCE(topic, ''), COALESCE(payload, 'null'), created_at
+		FROM product_events
+		WHERE product_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, productID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.ProductEvent{}
+	for rows.Next() {
+		var event models.ProductEvent
+		var payload string
+		if err := rows.Scan(&event.ID, &event.ProductID, &event.Type, &event.Topic, &payload, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan product event: %w", err)
+		}
+		event.Payload = []byte(payload)
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
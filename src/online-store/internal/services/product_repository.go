@@ -0,0 +1,604 @@
+// internal/services/product_repository.go
+// This file contains the database access for products
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"online-store/internal/database"
+	"online-store/internal/models"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDuplicateEntry is the MySQL/MariaDB error number for a UNIQUE violation
+const mysqlDuplicateEntry = 1062
+
+// productColumns is the column list every product query selects
+// It must stay in the same order as the fields in scanProduct
+// sku is NULL for products created before SKUs existed, so we turn it into ""
+const productColumns = "id, COALESCE(sku, ''), name, description, COALESCE(category, ''), price_cents, stock_quantity, reorder_level, max_per_order, created_at, sale_price_cents, sale_ends_at, status, available_from, available_until"
+
+// publishedOnly is the condition for products customers may see (drafts are hidden)
+const publishedOnly = "status = 'published'"
+
+// availableNow is the condition for products whose purchase window is open right now
+const availableNow = "(available_from IS NULL OR available_from <= NOW()) AND (available_until IS NULL OR available_until > NOW())"
+
+// defaultReorderLevel is the reorder level of products created without one
+const defaultReorderLevel = 10
+
+// ProductRepository defines how the product service reads and writes products
+// Services depend on this interface instead of *sql.DB, so business logic
+// can be tested with a mock repository and no real database
+type ProductRepository interface {
+	GetAll(limit int, includeDrafts, availableOnly bool) ([]models.Product, error)
+	Stream(fn func(product models.Product) error) error
+	GetOnSale() ([]models.Product, error)
+	GetLowStock(mostShortFirst bool) ([]models.Product, error)
+	GetRelated(productID, limit int) ([]models.Product, error)
+	GetTopSellers(from, to time.Time, byRevenue bool, limit int) ([]models.TopSeller, error)
+	GetByID(id int) (*models.Product, error)
+	GetBySKU(sku string) (*models.Product, error)
+	CountInCategory(category string, excludeID int) (int, error)
+	ListCategories(hideEmpty bool) ([]models.CategoryCount, error)
+	ValueByCategory() ([]models.CategoryValuation, error)
+	Insert(req models.ProductRequest) (int, error)
+	Update(id int, req models.ProductRequest) error
+	Patch(id int, columns map[string]interface{}) error
+	Publish(id int) error
+	NextSKUNumber() (int, error)
+	UpdateStock(productID, newStock int) (*models.StockChange, error)
+	BulkUpdateStock(updates []models.StockUpdate) ([]models.StockChange, error)
+	RecordPriceChange(change models.PriceChange) error
+	GetPriceHistory(productID int) ([]models.PriceChange, error)
+}
+
+// SQLProductRepository is the MariaDB-backed ProductRepository
+type SQLProductRepository struct {
+	db *database.DB
+}
+
+// NewSQLProductRepository creates a product repository using the given database
+func NewSQLProductRepository(db *database.DB) *SQLProductRepository {
+	return &SQLProductRepository{db: db}
+}
+
+// rowScanner is what *sql.Row and *sql.Rows have in common
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProduct reads one product selected with productColumns
+// It also works out the product's current effective price
+func scanProduct(row rowScanner) (*models.Product, error) {
+	var product models.Product
+	err := row.Scan(
+		&product.ID,
+		&product.SKU,
+		&product.Name,
+		&product.Description,
+		&product.Category,
+		&product.PriceCents,
+		&product.StockQuantity,
+		&product.ReorderLevel,
+		&product.MaxPerOrder,
+		&product.CreatedAt,
+		&product.SalePriceCents,
+		&product.SaleEndsAt,
+		&product.Status,
+		&product.AvailableFrom,
+		&product.AvailableUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	product.ApplySale(time.Now())
+	return &product, nil
+}
+
+// GetAll returns all published products (and drafts too with includeDrafts), newest first
+// With availableOnly, products outside their purchase window are left out
+// A limit above 0 returns at most that many
+func (r *SQLProductRepository) GetAll(limit int, includeDrafts, availableOnly bool) ([]models.Product, error) {
+	conditions := []string{}
+	if !includeDrafts {
+		conditions = append(conditions, publishedOnly)
+	}
+	if availableOnly {
+		conditions = append(conditions, availableNow)
+	}
+
+	query := "SELECT " + productColumns + " FROM products"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC"
+
+	if limit > 0 {
+		return r.queryProducts(query+" LIMIT ?", limit)
+	}
+	return r.queryProducts(query)
+}
+
+// Stream calls fn for every published product, in ID order
+// Rows are handed over one at a time so the whole catalog never sits in memory
+// If fn returns an error, streaming stops and that error is returned
+func (r *SQLProductRepository) Stream(fn func(product models.Product) error) error {
+	rows, err := r.db.StreamQuery("SELECT " + productColumns + " FROM products WHERE " + publishedOnly + " ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("failed to get products: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan product: %w", err)
+		}
+		if err := fn(*product); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetOnSale returns published products with a sale running right now, newest first
+func (r *SQLProductRepository) GetOnSale() ([]models.Product, error) {
+	return r.queryProducts(`
+		SELECT ` + productColumns + ` FROM products
+		WHERE sale_price_cents IS NOT NULL AND (sale_ends_at IS NULL OR sale_ends_at > NOW())
+		AND ` + publishedOnly + `
+		ORDER BY created_at DESC
+	`)
+}
+
+// GetLowStock returns products whose stock is below their reorder level
+// They are sorted by how far below it they are, most short first unless
+// mostShortFirst is false
+func (r *SQLProductRepository) GetLowStock(mostShortFirst bool) ([]models.Product, error) {
+	direction := "DESC"
+	if !mostShortFirst {
+		direction = "ASC"
+	}
+	return r.queryProducts(`
+		SELECT ` + productColumns + ` FROM products
+		WHERE stock_quantity < reorder_level
+		ORDER BY reorder_level - stock_quantity ` + direction + `, id
+	`)
+}
+
+// GetRelated returns published, in-stock products bought by customers who also bought productID
+// The products bought by the most of those customers come first
+// (Orders have one product each, so "bought together" means "bought by the same user")
+// Archived orders count too, on both sides
+func (r *SQLProductRepository) GetRelated(productID, limit int) ([]models.Product, error) {
+	return r.queryProducts(`
+		SELECT `+productColumns+` FROM products
+		JOIN (
+			SELECT other.product_id, COUNT(DISTINCT other.user_id) AS buyers
+			FROM `+allOrders+` this
+			JOIN `+allOrders+` other ON other.user_id = this.user_id AND other.product_id <> this.product_id
+			WHERE this.product_id = ?
+			GROUP BY other.product_id
+		) AS co_purchases ON co_purchases.product_id = products.id
+		WHERE stock_quantity > 0 AND `+publishedOnly+`
+		ORDER BY co_purchases.buyers DESC, products.id
+		LIMIT ?
+	`, productID, limit)
+}
+
+// GetTopSellers returns the published products sold most in [from, to), best first
+// Products are ranked by units sold, or by revenue with byRevenue
+// Archived orders count too; only paid orders do, see paidOnly
+func (r *SQLProductRepository) GetTopSellers(from, to time.Time, byRevenue bool, limit int) ([]models.TopSeller, error) {
+	order := "sales.units DESC, sales.revenue DESC"
+	if byRevenue {
+		order = "sales.revenue DESC, sales.units DESC"
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+productColumns+`, sales.units, sales.revenue FROM products
+		JOIN (
+			SELECT product_id, SUM(quantity) AS units, SUM(total_cents) AS revenue
+			FROM `+allOrders+` o
+			WHERE `+paidOnly+` AND created_at >= ? AND created_at < ?
+			GROUP BY product_id
+		) AS sales ON sales.product_id = products.id
+		WHERE `+publishedOnly+`
+		ORDER BY `+order+`, products.id
+		LIMIT ?
+	`, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top sellers: %w", err)
+	}
+	defer rows.Close()
+
+	sellers := []models.TopSeller{}
+	for rows.Next() {
+		var seller models.TopSeller
+		err := rows.Scan(
+			&seller.ID,
+			&seller.SKU,
+			&seller.Name,
+			&seller.Description,
+			&seller.Category,
+			&seller.PriceCents,
+			&seller.StockQuantity,
+			&seller.ReorderLevel,
+			&seller.MaxPerOrder,
+			&seller.CreatedAt,
+			&seller.SalePriceCents,
+			&seller.SaleEndsAt,
+			&seller.Status,
+			&seller.AvailableFrom,
+			&seller.AvailableUntil,
+			&seller.UnitsSold,
+			&seller.RevenueCents,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan top seller: %w", err)
+		}
+		seller.ApplySale(time.Now())
+		sellers = append(sellers, seller)
+	}
+
+	return sellers, rows.Err()
+}
+
+// queryProducts runs a query selecting productColumns and returns every row
+func (r *SQLProductRepository) queryProducts(query string, args ...interface{}) ([]models.Product, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products: %w", err)
+	}
+	defer rows.Close() // Always close rows when done
+
+	var products []models.Product
+
+	// Iterate through all rows
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		products = append(products, *product)
+	}
+
+	return products, nil
+}
+
+// GetByID returns a single product, or ErrProductNotFound
+func (r *SQLProductRepository) GetByID(id int) (*models.Product, error) {
+	product, err := scanProduct(r.db.QueryRow("SELECT "+productColumns+" FROM products WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrProductNotFound
+		}
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return product, nil
+}
+
+// GetBySKU returns the product with the given SKU, or ErrProductNotFound
+func (r *SQLProductRepository) GetBySKU(sku string) (*models.Product, error) {
+	product, err := scanProduct(r.db.QueryRow("SELECT "+productColumns+" FROM products WHERE sku = ?", sku))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrProductNotFound
+		}
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return product, nil
+}
+
+// CountInCategory counts the products in a category, not counting excludeID
+// (pass 0 to count them all)
+func (r *SQLProductRepository) CountInCategory(category string, excludeID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM products WHERE category = ? AND id <> ?",
+		category, excludeID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count products in category: %w", err)
+	}
+	return count, nil
+}
+
+// ListCategories returns every category with how many of its products are in stock,
+// sorted by name. With hideEmpty, categories with nothing in stock are left out
+// Products without a category and drafts don't count towards any category
+func (r *SQLProductRepository) ListCategories(hideEmpty bool) ([]models.CategoryCount, error) {
+	query := `
+		SELECT category, COALESCE(SUM(stock_quantity > 0), 0) AS in_stock
+		FROM products
+		WHERE category IS NOT NULL AND ` + publishedOnly + `
+		GROUP BY category`
+	if hideEmpty {
+		query += " HAVING in_stock > 0"
+	}
+	query += " ORDER BY category"
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []models.CategoryCount{}
+	for rows.Next() {
+		var category models.CategoryCount
+		if err := rows.Scan(&category.Name, &category.InStock); err != nil {
+			return nil, fmt.Errorf("failed to scan category: %w", err)
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// ValueByCategory returns the stock value of each category, sorted by name
+// Only products in stock count; products without a category are grouped under ""
+// The sums are done as BIGINT, so a large inventory can't overflow them
+func (r *SQLProductRepository) ValueByCategory() ([]models.CategoryValuation, error) {
+	rows, err := r.db.Query(`
+		SELECT COALESCE(category, ''), COUNT(*), SUM(stock_quantity),
+			SUM(CAST(price_cents AS SIGNED) * stock_quantity)
+		FROM products
+		WHERE stock_quantity > 0
+		GROUP BY COALESCE(category, '')
+		ORDER BY COALESCE(category, '')
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory value: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []models.CategoryValuation{}
+	for rows.Next() {
+		var category models.CategoryValuation
+		if err := rows.Scan(&category.Category, &category.Products, &category.Units, &category.ValueCents); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory value: %w", err)
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// Insert stores a new product and returns its ID
+// Returns ErrDuplicateSKU if another product already has the SKU
+func (r *SQLProductRepository) Insert(req models.ProductRequest) (int, error) {
+	// NULLIF stores a missing SKU as NULL, so many products can have no SKU
+	result, err := r.db.Exec(
+		`INSERT INTO products (sku, name, description, category, price_cents, stock_quantity, reorder_level, max_per_order,
+		sale_price_cents, sale_ends_at, status, available_from, available_until)
+		VALUES (NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?, ?, COALESCE(?, ?), ?, ?, ?, IF(?, 'draft', 'published'), ?, ?)`,
+		req.SKU, req.Name, req.Description, req.Category, req.PriceCents, req.StockQuantity, req.ReorderLevel, defaultReorderLevel,
+		req.MaxPerOrder, req.SalePriceCents, req.SaleEndsAt, req.Draft, req.AvailableFrom, req.AvailableUntil,
+	)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return 0, ErrDuplicateSKU
+		}
+		return 0, fmt.Errorf("failed to create product: %w", err)
+	}
+
+	productID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get product ID: %w", err)
+	}
+
+	return int(productID), nil
+}
+
+// Update overwrites all editable fields of a product
+// Stock and reorder level are only changed when the request has them
+// Returns ErrDuplicateSKU if another product already has the SKU
+func (r *SQLProductRepository) Update(id int, req models.ProductRequest) error {
+	_, err := r.db.Exec(
+		`UPDATE products SET sku = NULLIF(?, ''), name = ?, description = ?, category = NULLIF(?, ''),
+		price_cents = ?, stock_quantity = COALESCE(?, stock_quantity), reorder_level = COALESCE(?, reorder_level),
+		max_per_order = ?, sale_price_cents = ?, sale_ends_at = ?, available_from = ?, available_until = ?
+		WHERE id = ?`,
+		req.SKU, req.Name, req.Description, req.Category, req.PriceCents, req.StockQuantity,
+		req.ReorderLevel, req.MaxPerOrder, req.SalePriceCents, req.SaleEndsAt, req.AvailableFrom, req.AvailableUntil, id,
+	)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return ErrDuplicateSKU
+		}
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+	return nil
+}
+
+// Patch updates only the given columns of a product
+// Column names must come from trusted code (never from a request) because they
+// are put into the SQL text; the values are passed as parameters as usual
+// An empty sku or category is stored as NULL, like in Insert
+// Returns ErrDuplicateSKU if another product already has the SKU
+func (r *SQLProductRepository) Patch(id int, columns map[string]interface{}) error {
+	// Sort the names so the same patch always produces the same SQL
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	assignments := make([]string, 0, len(names))
+	args := make([]interface{}, 0, len(names)+1)
+	for _, name := range names {
+		if name == "sku" || name == "category" {
+			assignments = append(assignments, name+" = NULLIF(?, '')")
+		} else {
+			assignments = append(assignments, name+" = ?")
+		}
+		args = append(args, columns[name])
+	}
+	args = append(args, id)
+
+	_, err := r.db.Exec("UPDATE products SET "+strings.Join(assignments, ", ")+" WHERE id = ?", args...)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return ErrDuplicateSKU
+		}
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+	return nil
+}
+
+// Publish puts a draft product into the catalog
+// Publishing a product that is already published changes nothing
+func (r *SQLProductRepository) Publish(id int) error {
+	if _, err := r.db.Exec("UPDATE products SET status = 'published' WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to publish product: %w", err)
+	}
+	return nil
+}
+
+// NextSKUNumber takes the next number for a generated SKU
+// Numbers are never handed out twice, even to products created at the same moment
+func (r *SQLProductRepository) NextSKUNumber() (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Rollback does nothing once the transaction is committed
+	defer tx.Rollback()
+
+	number, err := nextSequence(tx, skuSequenceName)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return number, nil
+}
+
+// UpdateStock sets the stock quantity for a product, returning the stock from before too
+// It is a bulk update of one product, so the row is locked between reading and writing
+func (r *SQLProductRepository) UpdateStock(productID, newStock int) (*models.StockChange, error) {
+	changes, err := r.BulkUpdateStock([]models.StockUpdate{{ProductID: productID, Stock: newStock}})
+	if err != nil {
+		return nil, err
+	}
+	return &changes[0], nil
+}
+
+// BulkUpdateStock applies many stock updates in a single transaction
+// Either every update is applied or none are: if any product ID doesn't exist,
+// everything is rolled back and an error wrapping ErrProductNotFound is returned
+// Returns the updated products with their stock from before, so callers can
+// check for low stock and for products that are back in stock
+func (r *SQLProductRepository) BulkUpdateStock(updates []models.StockUpdate) ([]models.StockChange, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Rollback does nothing once the transaction is committed
+	defer tx.Rollback()
+
+	var changes []models.StockChange
+	for _, update := range updates {
+		// Lock the row and check the product exists
+		// (RowsAffected can't tell us, it's 0 when the stock didn't change)
+		product, err := scanProduct(tx.QueryRow(
+			"SELECT "+productColumns+" FROM products WHERE id = ? FOR UPDATE",
+			update.ProductID,
+		))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("%w: id %d", ErrProductNotFound, update.ProductID)
+			}
+			return nil, fmt.Errorf("failed to get product: %w", err)
+		}
+
+		_, err = tx.Exec(
+			"UPDATE products SET stock_quantity = ? WHERE id = ?",
+			update.Stock, update.ProductID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update stock: %w", err)
+		}
+
+		// The row is locked, so nothing changed the stock since we read it
+		previousStock := product.StockQuantity
+		product.StockQuantity = update.Stock
+		changes = append(changes, models.StockChange{Product: *product, PreviousStock: previousStock})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return changes, nil
+}
+
+// RecordPriceChange adds a row to the product's price history
+func (r *SQLProductRepository) RecordPriceChange(change models.PriceChange) error {
+	_, err := r.db.Exec(
+		"INSERT INTO product_price_history (product_id, old_price_cents, new_price_cents, changed_by) VALUES (?, ?, ?, ?)",
+		change.ProductID, change.OldPriceCents, change.NewPriceCents, change.ChangedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record price change: %w", err)
+	}
+	return nil
+}
+
+// GetPriceHistory returns a product's price changes, newest first
+func (r *SQLProductRepository) GetPriceHistory(productID int) ([]models.PriceChange, error) {
+	rows, err := r.db.Query(`
+		SELECT id, product_id, old_price_cents, new_price_cents, changed_by, changed_at
+		FROM product_price_history
+		WHERE product_id = ?
+		ORDER BY changed_at DESC, id DESC
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []models.PriceChange{}
+	for rows.Next() {
+		var change models.PriceChange
+		var changedBy sql.NullInt64
+		err := rows.Scan(
+			&change.ID,
+			&change.ProductID,
+			&change.OldPriceCents,
+			&change.NewPriceCents,
+			&changedBy,
+			&change.ChangedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan price change: %w", err)
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			change.ChangedBy = &id
+		}
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
+
+// isDuplicateEntry reports whether err is a UNIQUE constraint violation
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
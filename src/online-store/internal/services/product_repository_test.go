@@ -0,0 +1,306 @@
+// internal/services/product_repository_test.go
+// Tests for the SQL product repository, on sqlmock
+// They check the SQL we send (whitespace doesn't matter) and how rows are read back
+
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"online-store/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+// productRowColumns are the columns selected by productColumns
+var productRowColumns = []string{
+	"id", "sku", "name", "description", "category", "price_cents", "stock_quantity", "reorder_level",
+	"max_per_order", "created_at", "sale_price_cents", "sale_ends_at", "status", "available_from", "available_until",
+}
+
+// productRow returns a published product as selected by productColumns
+func productRow(id int, name string, priceCents, stock int) []driver.Value {
+	return []driver.Value{
+		id, "", name, "", "", priceCents, stock, defaultReorderLevel,
+		nil, time.Now(), nil, nil, models.ProductStatusPublished, nil, nil,
+	}
+}
+
+func TestSQLGetTopSellers(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	columns := append(append([]string(nil), productRowColumns...), "units", "revenue")
+
+	tests := []struct {
+		name      string
+		byRevenue bool
+		order     string
+	}{
+		{"by units", false, "ORDER BY sales.units DESC, sales.revenue DESC, products.id"},
+		{"by revenue", true, "ORDER BY sales.revenue DESC, sales.units DESC, products.id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			// Archived orders count, only paid ones do, and drafts are left out
+			query := regexp.QuoteMeta("FROM orders UNION ALL SELECT") + ".*" + regexp.QuoteMeta("FROM orders_archive ) o WHERE "+paidOnly+" AND created_at >= ? AND created_at < ? GROUP BY product_id") +
+				".*" + regexp.QuoteMeta("WHERE "+publishedOnly+" "+tt.order+" LIMIT ?")
+			mock.ExpectQuery(query).WithArgs(from, to, 5).WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(append(productRow(2, "Lamp", 5000, 3), int64(4), int64(20000))...).
+				AddRow(append(productRow(1, "Mug", 900, 10), int64(12), int64(10800))...))
+
+			sellers, err := NewSQLProductRepository(db).GetTopSellers(from, to, tt.byRevenue, 5)
+			if err != nil {
+				t.Fatalf("GetTopSellers: %v", err)
+			}
+			if len(sellers) != 2 || sellers[0].ID != 2 || sellers[0].UnitsSold != 4 || sellers[0].RevenueCents != 20000 || sellers[1].Name != "Mug" {
+				t.Errorf("sellers = %+v, want the lamp (4 units, 20000 cents), then the mug", sellers)
+			}
+			if sellers[0].EffectivePriceCents != 5000 {
+				t.Errorf("effective price = %d, want 5000 (the sale is applied like for other products)", sellers[0].EffectivePriceCents)
+			}
+		})
+	}
+}
+
+func TestSQLGetTopSellersNoSales(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery("SELECT .* FROM products").WillReturnRows(sqlmock.NewRows(append(append([]string(nil), productRowColumns...), "units", "revenue")))
+
+	sellers, err := NewSQLProductRepository(db).GetTopSellers(time.Now(), time.Now(), false, 10)
+	if err != nil || sellers == nil || len(sellers) != 0 {
+		t.Errorf("GetTopSellers = %+v, %v, want an empty list (not null)", sellers, err)
+	}
+}
+
+func TestSQLGetRelated(t *testing.T) {
+	db, mock := newMockDB(t)
+	// Other products of the same buyers, ranked by how many of them bought each;
+	// sold-out products and drafts are left out. Archived orders count on both sides
+	query := regexp.QuoteMeta("SELECT other.product_id, COUNT(DISTINCT other.user_id) AS buyers FROM "+allOrders+" this "+
+		"JOIN "+allOrders+" other ON other.user_id = this.user_id AND other.product_id <> this.product_id WHERE this.product_id = ? GROUP BY other.product_id") +
+		".*" + regexp.QuoteMeta("WHERE stock_quantity > 0 AND "+publishedOnly+" ORDER BY co_purchases.buyers DESC, products.id LIMIT ?")
+	mock.ExpectQuery(query).WithArgs(1, 3).WillReturnRows(sqlmock.NewRows(productRowColumns).
+		AddRow(productRow(4, "Tea", 300, 20)...).
+		AddRow(productRow(2, "Lamp", 5000, 3)...))
+
+	related, err := NewSQLProductRepository(db).GetRelated(1, 3)
+	if err != nil {
+		t.Fatalf("GetRelated: %v", err)
+	}
+	if len(related) != 2 || related[0].ID != 4 || related[1].ID != 2 {
+		t.Errorf("related = %+v, want products 4 and 2, in the order the database ranked them", related)
+	}
+}
+
+func TestSQLGetRelatedFails(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery("FROM products").WillReturnError(errors.New("connection reset"))
+
+	if _, err := NewSQLProductRepository(db).GetRelated(1, 3); err == nil {
+		t.Errorf("GetRelated succeeded on a broken database")
+	}
+}
+
+func TestSQLListCategories(t *testing.T) {
+	// Only published products with a category count
+	grouped := "SELECT category, COALESCE(SUM(stock_quantity > 0), 0) AS in_stock FROM products " +
+		"WHERE category IS NOT NULL AND status = 'published' GROUP BY category"
+	tests := []struct {
+		name      string
+		hideEmpty bool
+		query     string
+	}{
+		{"all", false, grouped + " ORDER BY category"},
+		{"hide empty", true, grouped + " HAVING in_stock > 0 ORDER BY category"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectQuery("^" + regexp.QuoteMeta(tt.query) + "$").WillReturnRows(sqlmock.NewRows([]string{"category", "in_stock"}).
+				AddRow("books", 2).
+				AddRow("mugs", 1))
+
+			categories, err := NewSQLProductRepository(db).ListCategories(tt.hideEmpty)
+			if err != nil {
+				t.Fatalf("ListCategories: %v", err)
+			}
+			want := []models.CategoryCount{{Name: "books", InStock: 2}, {Name: "mugs", InStock: 1}}
+			if !reflect.DeepEqual(categories, want) {
+				t.Errorf("categories = %+v, want %+v", categories, want)
+			}
+		})
+	}
+}
+
+func TestSQLListCategoriesEmpty(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery("FROM products").WillReturnRows(sqlmock.NewRows([]string{"category", "in_stock"}))
+
+	categories, err := NewSQLProductRepository(db).ListCategories(true)
+	if err != nil || categories == nil || len(categories) != 0 {
+		t.Errorf("ListCategories = %+v, %v, want an empty list (not null)", categories, err)
+	}
+}
+
+func TestSQLValueByCategory(t *testing.T) {
+	db, mock := newMockDB(t)
+	// Sums are BIGINT, products without a category form their own group
+	query := regexp.QuoteMeta("SELECT COALESCE(category, ''), COUNT(*), SUM(stock_quantity), SUM(CAST(price_cents AS SIGNED) * stock_quantity) " +
+		"FROM products WHERE stock_quantity > 0 GROUP BY COALESCE(category, '') ORDER BY COALESCE(category, '')")
+	// More than fits in an int32, as a big inventory can be
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"category", "products", "units", "value"}).
+		AddRow("", 1, int64(5), int64(4500)).
+		AddRow("books", 2, int64(3000000), int64(6000000000)))
+
+	categories, err := NewSQLProductRepository(db).ValueByCategory()
+	if err != nil {
+		t.Fatalf("ValueByCategory: %v", err)
+	}
+	want := []models.CategoryValuation{
+		{Category: "", Products: 1, Units: 5, ValueCents: 4500},
+		{Category: "books", Products: 2, Units: 3000000, ValueCents: 6000000000},
+	}
+	if !reflect.DeepEqual(categories, want) {
+		t.Errorf("categories = %+v, want %+v", categories, want)
+	}
+}
+
+func TestSQLValueByCategoryEmpty(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery("FROM products").WillReturnRows(sqlmock.NewRows([]string{"category", "products", "units", "value"}))
+
+	categories, err := NewSQLProductRepository(db).ValueByCategory()
+	if err != nil || categories == nil || len(categories) != 0 {
+		t.Errorf("ValueByCategory = %+v, %v, want an empty list (not null)", categories, err)
+	}
+}
+
+func TestSQLGetLowStock(t *testing.T) {
+	tests := []struct {
+		name           string
+		mostShortFirst bool
+		order          string
+	}{
+		{"most short first", true, "ORDER BY reorder_level - stock_quantity DESC, id"},
+		{"closest first", false, "ORDER BY reorder_level - stock_quantity ASC, id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			// Drafts count too: they need stock before they're published
+			query := regexp.QuoteMeta("FROM products WHERE stock_quantity < reorder_level " + tt.order)
+			mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows(productRowColumns).
+				AddRow(productRow(3, "Wok", 4500, 1)...).
+				AddRow(productRow(1, "Mug", 900, 8)...))
+
+			products, err := NewSQLProductRepository(db).GetLowStock(tt.mostShortFirst)
+			if err != nil {
+				t.Fatalf("GetLowStock: %v", err)
+			}
+			if len(products) != 2 || products[0].ID != 3 || products[0].StockQuantity != 1 || products[0].ReorderLevel != defaultReorderLevel {
+				t.Errorf("products = %+v, want the wok (1 of %d) first", products, defaultReorderLevel)
+			}
+		})
+	}
+}
+
+func TestSQLPatch(t *testing.T) {
+	db, mock := newMockDB(t)
+	// Only the given columns, in name order; empty sku and category become NULL
+	query := "^" + regexp.QuoteMeta("UPDATE products SET category = NULLIF(?, ''), price_cents = ?, sale_ends_at = ?, sku = NULLIF(?, ''), stock_quantity = ? WHERE id = ?") + "$"
+	mock.ExpectExec(query).WithArgs("books", 1999, nil, "", 4, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := NewSQLProductRepository(db).Patch(3, map[string]interface{}{
+		"stock_quantity": intPtr(4),
+		"sku":            "",
+		"price_cents":    1999,
+		"category":       "books",
+		"sale_ends_at":   (*time.Time)(nil),
+	})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+}
+
+func TestSQLPatchDuplicateSKU(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE products SET sku = NULLIF(?, '') WHERE id = ?")).
+		WithArgs("MUG-1", 3).
+		WillReturnError(&mysql.MySQLError{Number: mysqlDuplicateEntry, Message: "Duplicate entry 'MUG-1' for key 'sku'"})
+
+	if err := NewSQLProductRepository(db).Patch(3, map[string]interface{}{"sku": "MUG-1"}); !errors.Is(err, ErrDuplicateSKU) {
+		t.Errorf("err = %v, want ErrDuplicateSKU", err)
+	}
+}
+
+func TestSQLBulkUpdateStock(t *testing.T) {
+	db, mock := newMockDB(t)
+	lock := regexp.QuoteMeta("FROM products WHERE id = ? FOR UPDATE")
+	update := regexp.QuoteMeta("UPDATE products SET stock_quantity = ? WHERE id = ?")
+
+	// Each row is locked before it is written, all in one transaction
+	mock.ExpectBegin()
+	mock.ExpectQuery(lock).WithArgs(1).WillReturnRows(sqlmock.NewRows(productRowColumns).AddRow(productRow(1, "Mug", 900, 2)...))
+	mock.ExpectExec(update).WithArgs(40, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Setting the stock it already has changes no row, but isn't an error
+	mock.ExpectQuery(lock).WithArgs(2).WillReturnRows(sqlmock.NewRows(productRowColumns).AddRow(productRow(2, "Lamp", 5000, 7)...))
+	mock.ExpectExec(update).WithArgs(7, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	changes, err := NewSQLProductRepository(db).BulkUpdateStock([]models.StockUpdate{
+		{ProductID: 1, Stock: 40},
+		{ProductID: 2, Stock: 7},
+	})
+	if err != nil {
+		t.Fatalf("BulkUpdateStock: %v", err)
+	}
+	if len(changes) != 2 ||
+		changes[0].Product.ID != 1 || changes[0].PreviousStock != 2 || changes[0].Product.StockQuantity != 40 ||
+		changes[1].Product.ID != 2 || changes[1].PreviousStock != 7 || changes[1].Product.StockQuantity != 7 {
+		t.Errorf("changes = %+v, want mug 2 -> 40 and lamp 7 -> 7", changes)
+	}
+}
+
+func TestSQLBulkUpdateStockUnknownProduct(t *testing.T) {
+	db, mock := newMockDB(t)
+	lock := regexp.QuoteMeta("FROM products WHERE id = ? FOR UPDATE")
+
+	// The first update is written, but rolled back with the rest
+	mock.ExpectBegin()
+	mock.ExpectQuery(lock).WithArgs(1).WillReturnRows(sqlmock.NewRows(productRowColumns).AddRow(productRow(1, "Mug", 900, 2)...))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE products SET stock_quantity = ? WHERE id = ?")).WithArgs(40, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(lock).WithArgs(99).WillReturnRows(sqlmock.NewRows(productRowColumns))
+	mock.ExpectRollback()
+
+	_, err := NewSQLProductRepository(db).BulkUpdateStock([]models.StockUpdate{
+		{ProductID: 1, Stock: 40},
+		{ProductID: 99, Stock: 5},
+	})
+	if !errors.Is(err, ErrProductNotFound) || !strings.Contains(err.Error(), "id 99") {
+		t.Errorf("err = %v, want ErrProductNotFound for id 99", err)
+	}
+}
+
+func TestSQLBulkUpdateStockWriteFails(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE").WithArgs(1).WillReturnRows(sqlmock.NewRows(productRowColumns).AddRow(productRow(1, "Mug", 900, 2)...))
+	mock.ExpectExec("UPDATE products SET stock_quantity").WillReturnError(errors.New("lock wait timeout exceeded"))
+	mock.ExpectRollback()
+
+	if _, err := NewSQLProductRepository(db).BulkUpdateStock([]models.StockUpdate{{ProductID: 1, Stock: 40}}); err == nil {
+		t.Errorf("BulkUpdateStock succeeded although the write failed")
+	}
+}
@@ -4,105 +4,424 @@
 package services
 
 import (
-	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"online-store/internal/models"
-	"online-store/internal/mqtt"
+	"log"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"online-store/internal/config"
+	"online-store/internal/models"
+	"online-store/internal/money"
+	"online-store/internal/sanitize"
+)
+
+// Limits for product data that binding tags can't express
+const (
+	maxProductNameLength = 255         // Matches the VARCHAR(255) name column
+	maxPriceCents        = 100_000_000 // $1,000,000 - anything above is almost certainly a typo
+	maxSKULength         = 64          // Matches the VARCHAR(64) sku column
+
+	defaultRelatedLimit = 5  // Recommendations returned when no limit is given
+	maxRelatedLimit     = 20 // Most recommendations returned at once
+
+	defaultEventLimit = 50  // Product events returned when no limit is given
+	maxEventLimit     = 500 // Most product events returned at once
+
+	defaultTopSellerLimit = 10  // Top sellers returned when no limit is given
+	maxTopSellerLimit     = 100 // Most top sellers returned at once
 )
 
 // ProductService handles product operations
 type ProductService struct {
-	db         *sql.DB
-	mqttClient *mqtt.Client
+	repo      ProductRepository
+	events    ProductEventRepository // What happened to each product, for debugging
+	waitlist  WaitlistRepository     // Customers waiting for sold-out products
+	publisher Publisher
+	audit     *AuditService
+	sanitizer sanitize.Policy // How HTML in names and descriptions is neutralized
+
+	maxPerCategory int // Most products a category may hold; 0 means no limit
+	defaultStock   int // Stock of new products created without a stock_quantity
+
+	maxListed int // Most products GetProducts returns; 0 means no limit
+
+	listDescriptionLength int // Descriptions in GetProducts are cut to this many characters; 0 means full text
+
+	backInStockMin int // Stock a product must get back to for inventory/back_in_stock
+
+	skuPrefix string // Products created without a SKU get <prefix><number>; empty leaves them without
+
+	rates *money.Rates // Converts prices into display currencies
 }
 
 // NewProductService creates a new product service
-func NewProductService(db *sql.DB, mqttClient *mqtt.Client) *ProductService {
+func NewProductService(repo ProductRepository, events ProductEventRepository, waitlist WaitlistRepository, publisher Publisher, audit *AuditService, sanitizer sanitize.Policy, cfg *config.Config) *ProductService {
 	return &ProductService{
-		db:         db,
-		mqttClient: mqttClient,
+		repo:      repo,
+		events:    events,
+		waitlist:  waitlist,
+		publisher: publisher,
+		audit:     audit,
+		sanitizer: sanitizer,
+
+		maxPerCategory: cfg.MaxPerCategory,
+		defaultStock:   cfg.DefaultStock,
+
+		maxListed: cfg.MaxProductsListed,
+
+		listDescriptionLength: cfg.ListDescriptionLength,
+
+		backInStockMin: cfg.BackInStockMin,
+
+		skuPrefix: cfg.SKUPrefix,
+
+		rates: money.NewRates(cfg.Currency, cfg.CurrencyRates),
 	}
 }
 
-// GetProducts returns all products
-func (s *ProductService) GetProducts() ([]models.Product, error) {
-	rows, err := s.db.Query(
-		"SELECT id, name, description, price_cents, stock_quantity, created_at FROM products ORDER BY created_at DESC",
-	)
+// GetProducts returns all published products, up to the configured maximum
+// With includeDrafts (for admins), draft products are included too
+// With availableOnly, only products that can be ordered right now are listed
+// (products outside their purchase window are left out)
+// truncated is true when there were more products than that - a safety net
+// so a huge catalog can't use up all our memory (or the client's)
+// Long descriptions are shortened too; GetProduct has the full text
+func (s *ProductService) GetProducts(includeDrafts, availableOnly bool) (products []models.Product, truncated bool, err error) {
+	if s.maxListed <= 0 {
+		products, err = s.repo.GetAll(0, includeDrafts, availableOnly)
+	} else {
+		// Ask for one more than we return, so we know whether anything was cut off
+		products, err = s.repo.GetAll(s.maxListed+1, includeDrafts, availableOnly)
+		if len(products) > s.maxListed {
+			log.Printf("Product list truncated to %d products - the catalog has more", s.maxListed)
+			products, truncated = products[:s.maxListed], true
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get products: %w", err)
+		return nil, false, err
+	}
+
+	for i := range products {
+		products[i].Description = shortenText(products[i].Description, s.listDescriptionLength)
 	}
-	defer rows.Close() // Always close rows when done
+	return products, truncated, nil
+}
+
+// shortenText cuts text to at most maxChars characters, ending in "…" when cut
+// It counts characters (runes), not bytes, so it never splits a multi-byte letter
+// maxChars of 0 or less returns the text unchanged
+func shortenText(text string, maxChars int) string {
+	if maxChars <= 0 || utf8.RuneCountInString(text) <= maxChars {
+		return text
+	}
+
+	runes := []rune(text)
+	return strings.TrimRight(string(runes[:maxChars-1]), " ") + "…"
+}
 
-	var products []models.Product
+// StreamProducts calls fn for every product in ID order, without loading them all at once
+// Descriptions are complete - this is for data pipelines, not listings
+func (s *ProductService) StreamProducts(fn func(product models.Product) error) error {
+	return s.repo.Stream(fn)
+}
 
-	// Iterate through all rows
-	for rows.Next() {
-		var product models.Product
-		err := rows.Scan(
-			&product.ID,
-			&product.Name,
-			&product.Description,
-			&product.PriceCents,
-			&product.StockQuantity,
-			&product.CreatedAt,
-		)
+// SetDisplayPrice fills in DisplayPrice of each product response: what it costs right now
+// (its effective price), converted into currency with the configured rates
+// An empty currency does nothing; one without a rate returns money.ErrUnknownCurrency
+// Only the response changes - prices are still stored and charged in our own currency
+func (s *ProductService) SetDisplayPrice(currency string, products ...*models.ProductResponse) error {
+	if currency == "" {
+		return nil
+	}
+	currency = strings.ToUpper(currency)
+
+	for _, product := range products {
+		amount, err := s.rates.Convert(int64(product.EffectivePriceCents), currency)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan product: %w", err)
+			return err
+		}
+		product.DisplayPrice = &models.DisplayPrice{
+			Currency:  currency,
+			Amount:    amount,
+			Formatted: money.FormatWithCode(amount, currency),
 		}
-		products = append(products, product)
 	}
+	return nil
+}
 
-	return products, nil
+// GetProductsOnSale returns products with a sale running right now
+func (s *ProductService) GetProductsOnSale() ([]models.Product, error) {
+	return s.repo.GetOnSale()
 }
 
 // GetProduct returns a single product by ID
+// Drafts count as not found, like everywhere customers look
 func (s *ProductService) GetProduct(id int) (*models.Product, error) {
-	var product models.Product
-	err := s.db.QueryRow(
-		"SELECT id, name, description, price_cents, stock_quantity, created_at FROM products WHERE id = ?",
-		id,
-	).Scan(
-		&product.ID,
-		&product.Name,
-		&product.Description,
-		&product.PriceCents,
-		&product.StockQuantity,
-		&product.CreatedAt,
-	)
+	return hideDraft(s.repo.GetByID(id))
+}
 
+// PublishProduct puts a draft product into the catalog
+// actorID is the admin publishing it, for the audit log
+func (s *ProductService) PublishProduct(actorID, id int) (*models.Product, error) {
+	product, err := s.repo.GetByID(id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("product not found")
-		}
-		return nil, fmt.Errorf("failed to get product: %w", err)
+		return nil, err
+	}
+	if product.Status == models.ProductStatusPublished {
+		return product, nil
+	}
+
+	if err := s.repo.Publish(id); err != nil {
+		return nil, err
 	}
+	product.Status = models.ProductStatusPublished
+
+	s.audit.Record(actorID, "publish", "product", id, nil)
 
-	return &product, nil
+	// Same payload as product/created - for customers, the product is new now
+	event := models.ProductCreatedEvent{
+		ProductID: product.ID,
+		Name:      product.Name,
+		Timestamp: time.Now().Unix(),
+	}
+
+	if err := s.publisher.Publish("product/published", event); err != nil {
+		fmt.Printf("Failed to publish product published event: %v", err)
+	}
+	s.recordEvent(product.ID, models.ProductEventPublished, "product/published", event)
+
+	return product, nil
 }
 
-// CreateProduct creates a new product
-func (s *ProductService) CreateProduct(req models.ProductRequest) (*models.Product, error) {
-	result, err := s.db.Exec(
-		"INSERT INTO products (name, description, price_cents, stock_quantity) VALUES (?, ?, ?, ?)",
-		req.Name, req.Description, req.PriceCents, req.StockQuantity,
-	)
+// hideDraft turns a draft product into ErrProductNotFound
+// Use it around repository lookups whose result customers see
+func hideDraft(product *models.Product, err error) (*models.Product, error) {
 	if err != nil {
-		return nil, fmt.Errorf("failed to create product: %w", err)
+		return nil, err
+	}
+	if product.Status == models.ProductStatusDraft {
+		return nil, ErrProductNotFound
 	}
+	return product, nil
+}
 
-	productID, err := result.LastInsertId()
+// GetCategories lists the product categories with their in-stock product counts
+// hideEmpty leaves out categories where everything is sold out
+func (s *ProductService) GetCategories(hideEmpty bool) ([]models.CategoryCount, error) {
+	return s.repo.ListCategories(hideEmpty)
+}
+
+// GetProductBySKU returns the product with a SKU, for barcode scanners and tills
+// Returns ErrProductNotFound for an unknown (or empty) SKU
+func (s *ProductService) GetProductBySKU(sku string) (*models.Product, error) {
+	sku = strings.TrimSpace(sku)
+	if sku == "" {
+		return nil, ErrProductNotFound
+	}
+	return hideDraft(s.repo.GetBySKU(sku))
+}
+
+// GetLowStockProducts returns products below their reorder level, for
+// inventory managers deciding what to restock
+// By default the products furthest below their level come first
+func (s *ProductService) GetLowStockProducts(mostShortFirst bool) ([]models.LowStockProduct, error) {
+	products, err := s.repo.GetLowStock(mostShortFirst)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get product ID: %w", err)
+		return nil, err
 	}
 
-	// Get the created product
-	product, err := s.GetProduct(int(productID))
+	lowStock := make([]models.LowStockProduct, 0, len(products))
+	for _, product := range products {
+		lowStock = append(lowStock, models.LowStockProduct{
+			Product:   product,
+			Shortfall: product.ReorderLevel - product.StockQuantity,
+		})
+	}
+	return lowStock, nil
+}
+
+// GetInventoryValuation adds up what the stock on hand is worth
+// byCategory also breaks the total down per category
+// An empty inventory is worth 0, with no categories
+func (s *ProductService) GetInventoryValuation(byCategory bool) (*models.InventoryValuation, error) {
+	categories, err := s.repo.ValueByCategory()
 	if err != nil {
 		return nil, err
 	}
 
+	valuation := &models.InventoryValuation{}
+	for _, category := range categories {
+		valuation.TotalCents += category.ValueCents
+		valuation.Units += category.Units
+	}
+	if byCategory {
+		valuation.Categories = categories
+	}
+	return valuation, nil
+}
+
+// GetProductEvents returns a product's most recent events, newest first
+// Returns ErrProductNotFound for an unknown product
+func (s *ProductService) GetProductEvents(id, limit int) ([]models.ProductEvent, error) {
+	if limit <= 0 {
+		limit = defaultEventLimit
+	}
+	if limit > maxEventLimit {
+		limit = maxEventLimit
+	}
+
+	if _, err := s.repo.GetByID(id); err != nil {
+		return nil, err
+	}
+	return s.events.ListForProduct(id, limit)
+}
+
+// GetRelatedProducts recommends products often bought by customers who bought this one
+// Sold-out products and the product itself are left out
+func (s *ProductService) GetRelatedProducts(id, limit int) ([]models.Product, error) {
+	if limit <= 0 {
+		limit = defaultRelatedLimit
+	}
+	if limit > maxRelatedLimit {
+		limit = maxRelatedLimit
+	}
+
+	// Check the product exists, so an unknown ID is a 404 and not an empty list
+	if _, err := s.repo.GetByID(id); err != nil {
+		return nil, err
+	}
+
+	related, err := s.repo.GetRelated(id, limit)
+	if err != nil {
+		return nil, err
+	}
+	if related == nil {
+		related = []models.Product{}
+	}
+	return related, nil
+}
+
+// GetTopSellers returns the best-selling products between two days (both included)
+// sortBy is "units" (the default) or "revenue"; zero dates mean "30 days ago" and "today",
+// like the sales report
+func (s *ProductService) GetTopSellers(from, to time.Time, sortBy string, limit int) ([]models.TopSeller, error) {
+	if sortBy == "" {
+		sortBy = "units"
+	}
+	if sortBy != "units" && sortBy != "revenue" {
+		return nil, &ValidationError{Field: "sort", Message: "must be units or revenue"}
+	}
+
+	if limit <= 0 {
+		limit = defaultTopSellerLimit
+	}
+	if limit > maxTopSellerLimit {
+		limit = maxTopSellerLimit
+	}
+
+	if to.IsZero() {
+		to = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -(defaultSalesDays - 1))
+	}
+	if from.After(to) {
+		return nil, &ValidationError{Field: "from", Message: "must not be after to"}
+	}
+
+	// Go up to midnight after the last day, so the whole day counts
+	return s.repo.GetTopSellers(from, to.AddDate(0, 0, 1), sortBy == "revenue", limit)
+}
+
+// GetPriceHistory returns the price changes of a product, newest first
+func (s *ProductService) GetPriceHistory(id int) ([]models.PriceChange, error) {
+	// Check the product exists, so an unknown ID is a 404 and not an empty list
+	if _, err := s.repo.GetByID(id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPriceHistory(id)
+}
+
+// GetAvailability reports whether quantity units of a product are in stock
+// It's a quick read for "Add to cart" buttons - nothing is reserved
+func (s *ProductService) GetAvailability(id, quantity int) (*models.ProductAvailability, error) {
+	if quantity < 1 {
+		return nil, &ValidationError{Field: "quantity", Message: "must be at least 1"}
+	}
+
+	product, err := hideDraft(s.repo.GetByID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ProductAvailability{
+		ProductID:         product.ID,
+		StockQuantity:     product.StockQuantity,
+		RequestedQuantity: quantity,
+		Available:         product.StockQuantity >= quantity,
+	}, nil
+}
+
+// CreateProduct creates a new product
+// If the request has a SKU that's already taken:
+//   - with upsert=false it returns ErrDuplicateSKU
+//   - with upsert=true it updates the existing product instead
+//
+// This makes creating a product with a SKU safe to retry
+// The returned bool is true if a new product was created
+// actorID is the user making the change, for the audit log
+func (s *ProductService) CreateProduct(actorID int, req models.ProductRequest, upsert bool) (*models.Product, bool, error) {
+	s.sanitizeText(&req)
+	if err := validateProductRequest(&req); err != nil {
+		return nil, false, err
+	}
+
+	if upsert && req.SKU != "" {
+		existing, err := s.repo.GetBySKU(req.SKU)
+		if err == nil {
+			product, err := s.UpdateProduct(actorID, existing.ID, req)
+			return product, false, err
+		}
+		if !errors.Is(err, ErrProductNotFound) {
+			return nil, false, err
+		}
+	}
+
+	if err := s.checkCategoryCap(req.Category, 0); err != nil {
+		return nil, false, err
+	}
+
+	// "stock_quantity": 0 means no stock; leaving it out means "use the default"
+	if req.StockQuantity == nil {
+		stock := s.defaultStock
+		req.StockQuantity = &stock
+	}
+
+	// With a SKU prefix configured, products created without a SKU get one
+	if req.SKU == "" && s.skuPrefix != "" {
+		number, err := s.repo.NextSKUNumber()
+		if err != nil {
+			return nil, false, err
+		}
+		req.SKU = fmt.Sprintf("%s%06d", s.skuPrefix, number)
+	}
+
+	productID, err := s.repo.Insert(req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Get the created product
+	product, err := s.repo.GetByID(productID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.audit.Record(actorID, "create", "product", product.ID, req)
+
 	// Publish MQTT event
 	event := models.ProductCreatedEvent{
 		ProductID: product.ID,
@@ -110,29 +429,181 @@ func (s *ProductService) CreateProduct(req models.ProductRequest) (*models.Produ
 		Timestamp: time.Now().Unix(),
 	}
 
-	if err := s.mqttClient.Publish("product/created", event); err != nil {
+	if err := s.publisher.Publish("product/created", event); err != nil {
 		fmt.Printf("Failed to publish product created event: %v", err)
 	}
+	s.recordEvent(product.ID, models.ProductEventCreated, "product/created", event)
 
-	return product, nil
+	return product, true, nil
+}
+
+// CloneProduct copies a product into a new draft, e.g. to create a variant of it
+// The name and SKU can be changed on the way; everything else is copied, except
+// stock (the clone starts with none - the units belong to the original) and the
+// sales history. Without a new SKU, the clone gets a generated one: the usual
+// <prefix><number> with SKU_PREFIX set, otherwise <original SKU>-<number>
+func (s *ProductService) CloneProduct(actorID, id int, clone models.ProductCloneRequest) (*models.Product, error) {
+	original, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	noStock := 0
+	req := models.ProductRequest{
+		SKU:            clone.SKU,
+		Name:           original.Name,
+		Description:    original.Description,
+		Category:       original.Category,
+		PriceCents:     original.PriceCents,
+		StockQuantity:  &noStock,
+		ReorderLevel:   &original.ReorderLevel,
+		MaxPerOrder:    original.MaxPerOrder,
+		SalePriceCents: original.SalePriceCents,
+		SaleEndsAt:     original.SaleEndsAt,
+		AvailableFrom:  original.AvailableFrom,
+		AvailableUntil: original.AvailableUntil,
+		Draft:          true,
+	}
+	if clone.Name != "" {
+		req.Name = clone.Name
+	}
+
+	// SKUs are unique, so the original's can't be copied as it is
+	// (CreateProduct generates one itself when a prefix is configured)
+	if req.SKU == "" && s.skuPrefix == "" && original.SKU != "" {
+		number, err := s.repo.NextSKUNumber()
+		if err != nil {
+			return nil, err
+		}
+		suffix := fmt.Sprintf("-%d", number)
+		req.SKU = shortenSKU(original.SKU, maxSKULength-len(suffix)) + suffix
+	}
+
+	product, _, err := s.CreateProduct(actorID, req, false)
+	return product, err
+}
+
+// shortenSKU cuts a SKU to at most maxBytes bytes (SKUs are plain ASCII codes)
+func shortenSKU(sku string, maxBytes int) string {
+	if len(sku) <= maxBytes {
+		return sku
+	}
+	return sku[:maxBytes]
 }
 
 // UpdateProduct updates an existing product
-func (s *ProductService) UpdateProduct(id int, req models.ProductRequest) (*models.Product, error) {
-	_, err := s.db.Exec(
-		"UPDATE products SET name = ?, description = ?, price_cents = ?, stock_quantity = ? WHERE id = ?",
-		req.Name, req.Description, req.PriceCents, req.StockQuantity, id,
-	)
+// actorID is the user making the change, for the audit log
+func (s *ProductService) UpdateProduct(actorID, id int, req models.ProductRequest) (*models.Product, error) {
+	s.sanitizeText(&req)
+	if err := validateProductRequest(&req); err != nil {
+		return nil, err
+	}
+
+	// Remember how the product looked before, so the audit log shows what changed
+	before, err := s.repo.GetByID(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update product: %w", err)
+		return nil, err
+	}
+
+	// Moving into a category counts against that category's cap
+	if req.Category != before.Category {
+		if err := s.checkCategoryCap(req.Category, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.Update(id, req); err != nil {
+		return nil, err
+	}
+
+	return s.afterUpdate(actorID, before)
+}
+
+// PatchProduct updates only the fields present in the map (from a JSON PATCH body)
+// Allowed keys are listed in patchableProductFields; any other key is rejected
+// The result must still pass the same validation as a full update
+func (s *ProductService) PatchProduct(actorID, id int, fields map[string]interface{}) (*models.Product, error) {
+	if len(fields) == 0 {
+		return nil, &ValidationError{Field: "body", Message: "no fields to update"}
+	}
+
+	before, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the changes on top of the current product, so cross-field rules
+	// (like sale price < price) are checked against the final result
+	req := models.ProductRequest{
+		SKU:            before.SKU,
+		Name:           before.Name,
+		Description:    before.Description,
+		Category:       before.Category,
+		PriceCents:     before.PriceCents,
+		StockQuantity:  &before.StockQuantity,
+		ReorderLevel:   &before.ReorderLevel,
+		MaxPerOrder:    before.MaxPerOrder,
+		SalePriceCents: before.SalePriceCents,
+		SaleEndsAt:     before.SaleEndsAt,
+		AvailableFrom:  before.AvailableFrom,
+		AvailableUntil: before.AvailableUntil,
+	}
+	for field, value := range fields {
+		if err := applyProductPatch(&req, field, value); err != nil {
+			return nil, err
+		}
+	}
+
+	s.sanitizeText(&req)
+	if err := validateProductRequest(&req); err != nil {
+		return nil, err
+	}
+
+	if req.Category != before.Category {
+		if err := s.checkCategoryCap(req.Category, id); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the provided columns are written
+	if err := s.repo.Patch(id, patchColumns(req, fields)); err != nil {
+		return nil, err
 	}
 
+	return s.afterUpdate(actorID, before)
+}
+
+// afterUpdate reloads a changed product, records it in the audit log and
+// tells the rest of the system about it
+func (s *ProductService) afterUpdate(actorID int, before *models.Product) (*models.Product, error) {
 	// Get the updated product
-	product, err := s.GetProduct(id)
+	product, err := s.repo.GetByID(before.ID)
 	if err != nil {
 		return nil, err
 	}
 
+	s.audit.Record(actorID, "update", "product", product.ID, map[string]interface{}{
+		"before": before,
+		"after":  product,
+	})
+
+	// Only real price changes go into the price history
+	if product.PriceCents != before.PriceCents {
+		change := models.PriceChange{
+			ProductID:     product.ID,
+			OldPriceCents: before.PriceCents,
+			NewPriceCents: product.PriceCents,
+		}
+		if actorID != SystemActor {
+			change.ChangedBy = &actorID
+		}
+		// The product is already updated, so a failure here is only logged
+		if err := s.repo.RecordPriceChange(change); err != nil {
+			log.Printf("Failed to record price change of product %d: %v", product.ID, err)
+		}
+		s.recordEvent(product.ID, models.ProductEventPriceChanged, "", change)
+	}
+
 	// Publish MQTT event
 	event := struct {
 		ProductID int    `json:"product_id"`
@@ -144,9 +615,13 @@ func (s *ProductService) UpdateProduct(id int, req models.ProductRequest) (*mode
 		Timestamp: time.Now().Unix(),
 	}
 
-	if err := s.mqttClient.Publish("product/updated", event); err != nil {
+	if err := s.publisher.Publish("product/updated", event); err != nil {
 		fmt.Printf("Failed to publish product updated event: %v", err)
 	}
+	s.recordEvent(product.ID, models.ProductEventUpdated, "product/updated", event)
+
+	// An admin restocking a sold-out product is a restock like any other
+	s.checkBackInStock(product, before.StockQuantity)
 
 	return product, nil
 }
@@ -154,34 +629,354 @@ func (s *ProductService) UpdateProduct(id int, req models.ProductRequest) (*mode
 // UpdateStock updates the stock quantity for a product
 // This method is called by MQTT handlers
 func (s *ProductService) UpdateStock(productID, newStock int) error {
-	_, err := s.db.Exec(
-		"UPDATE products SET stock_quantity = ? WHERE id = ?",
-		newStock, productID,
-	)
+	change, err := s.repo.UpdateStock(productID, newStock)
 	if err != nil {
-		return fmt.Errorf("failed to update stock: %w", err)
+		return err
 	}
 
-	// Check if stock is low (less than 10 items)
-	if newStock < 10 {
-		product, err := s.GetProduct(productID)
-		if err != nil {
-			return err
+	s.audit.Record(SystemActor, "update_stock", "product", productID, map[string]int{"stock_quantity": newStock})
+	s.recordEvent(productID, models.ProductEventStockChanged, "", map[string]int{"stock_quantity": newStock})
+
+	// Check if stock is now below the product's reorder level
+	product := &change.Product
+	if product.StockQuantity < product.ReorderLevel {
+		s.publishLowStockAlert(product)
+	}
+	s.checkBackInStock(product, change.PreviousStock)
+
+	return nil
+}
+
+// BulkUpdateStock applies a whole inventory snapshot in one transaction
+// This method is called by MQTT handlers when a warehouse syncs its inventory
+// If any product ID is invalid, nothing is changed
+func (s *ProductService) BulkUpdateStock(updates []models.StockUpdate) error {
+	for _, update := range updates {
+		if update.Stock < 0 {
+			return &ValidationError{
+				Field:   "stock",
+				Message: fmt.Sprintf("must not be negative (product %d)", update.ProductID),
+			}
 		}
+	}
+
+	changes, err := s.repo.BulkUpdateStock(updates)
+	if err != nil {
+		return err
+	}
+
+	for i := range changes {
+		product := &changes[i].Product
+		s.audit.Record(SystemActor, "update_stock", "product", product.ID, map[string]int{"stock_quantity": product.StockQuantity})
+		s.recordEvent(product.ID, models.ProductEventStockChanged, "", map[string]int{"stock_quantity": product.StockQuantity})
 
-		// Send low stock alert
-		alert := models.LowStockAlert{
-			ProductID:    productID,
-			ProductName:  product.Name,
-			CurrentStock: newStock,
-			ReorderLevel: 10,
-			Timestamp:    time.Now().Unix(),
+		if product.StockQuantity < product.ReorderLevel {
+			s.publishLowStockAlert(product)
 		}
+		s.checkBackInStock(product, changes[i].PreviousStock)
+	}
+
+	return nil
+}
+
+// publishLowStockAlert tells the rest of the system a product is running out
+func (s *ProductService) publishLowStockAlert(product *models.Product) {
+	alert := models.LowStockAlert{
+		ProductID:    product.ID,
+		ProductName:  product.Name,
+		CurrentStock: product.StockQuantity,
+		ReorderLevel: product.ReorderLevel,
+		Timestamp:    time.Now().Unix(),
+	}
+
+	if err := s.publisher.Publish("inventory/low_stock", alert); err != nil {
+		fmt.Printf("Failed to publish low stock alert: %v", err)
+	}
+	s.recordEvent(product.ID, models.ProductEventLowStock, "inventory/low_stock", alert)
+}
+
+// checkBackInStock publishes inventory/back_in_stock when a restock brings a
+// product's stock from below the back-in-stock threshold to at least it
+// With the default threshold of 1 that is exactly "from 0 to anything more";
+// a higher threshold waits until there's enough stock to be worth announcing
+func (s *ProductService) checkBackInStock(product *models.Product, previousStock int) {
+	if previousStock >= s.backInStockMin || product.StockQuantity < s.backInStockMin {
+		return
+	}
+
+	event := models.BackInStockEvent{
+		ProductID:    product.ID,
+		ProductName:  product.Name,
+		CurrentStock: product.StockQuantity,
+		Timestamp:    time.Now().Unix(),
+	}
 
-		if err := s.mqttClient.Publish("inventory/low_stock", alert); err != nil {
-			fmt.Printf("Failed to publish low stock alert: %v", err)
+	if err := s.publisher.Publish("inventory/back_in_stock", event); err != nil {
+		fmt.Printf("Failed to publish back in stock event: %v", err)
+	}
+	s.recordEvent(product.ID, models.ProductEventBackInStock, "inventory/back_in_stock", event)
+
+	s.notifyWaitlist(event)
+}
+
+// JoinWaitlist puts a customer on a sold-out product's waitlist
+// They get an inventory/back_in_stock notification of their own when it's restocked
+// Returns ErrProductInStock if the product can be ordered already
+func (s *ProductService) JoinWaitlist(userID, productID int) error {
+	product, err := hideDraft(s.repo.GetByID(productID))
+	if err != nil {
+		return err
+	}
+	if product.StockQuantity >= s.backInStockMin {
+		return ErrProductInStock
+	}
+
+	return s.waitlist.Add(productID, userID)
+}
+
+// notifyWaitlist publishes a back-in-stock event for each customer waiting for the
+// product, then clears its waitlist - each customer is told once per join
+func (s *ProductService) notifyWaitlist(event models.BackInStockEvent) {
+	entries, err := s.waitlist.TakeAll(event.ProductID)
+	if err != nil {
+		log.Printf("Failed to get waitlist of product %d: %v", event.ProductID, err)
+		return
+	}
+
+	for _, entry := range entries {
+		notification := event
+		notification.UserID = entry.UserID
+		notification.Email = entry.Email
+		if err := s.publisher.Publish("inventory/back_in_stock", notification); err != nil {
+			fmt.Printf("Failed to publish back in stock notification: %v", err)
 		}
 	}
+}
 
+// recordEvent keeps an event in the product's history
+// topic is where the event was published over MQTT ("" if it wasn't)
+// Like the audit log, failures are only logged - the change already happened
+func (s *ProductService) recordEvent(productID int, eventType, topic string, payload interface{}) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode %s event of product %d: %v", eventType, productID, err)
+		payloadJSON = []byte("null")
+	}
+
+	event := models.ProductEvent{
+		ProductID: productID,
+		Type:      eventType,
+		Topic:     topic,
+		Payload:   payloadJSON,
+	}
+	if err := s.events.Insert(event); err != nil {
+		log.Printf("Failed to record %s event of product %d: %v", eventType, productID, err)
+	}
+}
+
+// checkCategoryCap returns a ValidationError if the category is already full
+// productID is the product being saved (0 for a new one), so it isn't counted twice
+// Two products created at the same moment could both squeeze in - the cap is a
+// guard against runaway growth, not an exact limit
+func (s *ProductService) checkCategoryCap(category string, productID int) error {
+	if category == "" || s.maxPerCategory <= 0 {
+		return nil
+	}
+
+	count, err := s.repo.CountInCategory(category, productID)
+	if err != nil {
+		return err
+	}
+	if count >= s.maxPerCategory {
+		return &ValidationError{
+			Field:   "category",
+			Message: fmt.Sprintf("already has the maximum of %d products", s.maxPerCategory),
+		}
+	}
 	return nil
 }
+
+// sanitizeText neutralizes HTML in the free-text fields of a product
+// It runs before validation, so length limits apply to what we actually store
+func (s *ProductService) sanitizeText(req *models.ProductRequest) {
+	req.Name = s.sanitizer.Apply(req.Name)
+	req.Description = s.sanitizer.Apply(req.Description)
+}
+
+// validateProductRequest checks the rules binding tags can't express
+// It also trims whitespace around the name, so we store a clean value
+// Returns a *ValidationError describing the first problem found
+func validateProductRequest(req *models.ProductRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Category = strings.TrimSpace(req.Category)
+	if req.Name == "" {
+		return &ValidationError{Field: "name", Message: "must not be blank"}
+	}
+
+	// Count characters, not bytes, because the column limit is in characters
+	if utf8.RuneCountInString(req.Name) > maxProductNameLength {
+		return &ValidationError{
+			Field:   "name",
+			Message: fmt.Sprintf("must be at most %d characters", maxProductNameLength),
+		}
+	}
+
+	// PUT and POST check this when binding too, but PATCH bodies aren't bound to a struct
+	if utf8.RuneCountInString(req.SKU) > maxSKULength {
+		return &ValidationError{
+			Field:   "sku",
+			Message: fmt.Sprintf("must be at most %d characters", maxSKULength),
+		}
+	}
+
+	if req.PriceCents > maxPriceCents {
+		return &ValidationError{
+			Field:   "price_cents",
+			Message: fmt.Sprintf("must be at most %d", maxPriceCents),
+		}
+	}
+
+	// A "sale" that costs more than the normal price would be misleading
+	if req.SalePriceCents != nil && *req.SalePriceCents >= req.PriceCents {
+		return &ValidationError{Field: "sale_price_cents", Message: "must be lower than price_cents"}
+	}
+
+	// An empty window would make the product impossible to order
+	if req.AvailableFrom != nil && req.AvailableUntil != nil && !req.AvailableUntil.After(*req.AvailableFrom) {
+		return &ValidationError{Field: "available_until", Message: "must be after available_from"}
+	}
+
+	return nil
+}
+
+// patchableProductFields are the JSON keys PatchProduct accepts
+// They are also the column names, which is what makes the dynamic SET clause safe:
+// only these fixed names ever end up in the SQL, never user input
+var patchableProductFields = map[string]bool{
+	"sku":              true,
+	"name":             true,
+	"description":      true,
+	"category":         true,
+	"price_cents":      true,
+	"stock_quantity":   true,
+	"reorder_level":    true,
+	"max_per_order":    true,
+	"sale_price_cents": true,
+	"sale_ends_at":     true,
+	"available_from":   true,
+	"available_until":  true,
+}
+
+// applyProductPatch copies one PATCH field into req, checking its type
+// JSON numbers arrive as float64, so whole numbers are converted to int
+func applyProductPatch(req *models.ProductRequest, field string, value interface{}) error {
+	if !patchableProductFields[field] {
+		return &ValidationError{Field: field, Message: "unknown or read-only field"}
+	}
+
+	var ok bool
+	switch field {
+	case "sku":
+		req.SKU, ok = value.(string)
+	case "name":
+		req.Name, ok = value.(string)
+	case "description":
+		req.Description, ok = value.(string)
+	case "category":
+		req.Category, ok = value.(string)
+	case "price_cents":
+		req.PriceCents, ok = wholeNumber(value)
+		ok = ok && req.PriceCents >= 1
+	case "stock_quantity":
+		var stock int
+		stock, ok = wholeNumber(value)
+		ok = ok && stock >= 0
+		req.StockQuantity = &stock
+	case "reorder_level":
+		var level int
+		level, ok = wholeNumber(value)
+		ok = ok && level >= 0
+		req.ReorderLevel = &level
+	case "max_per_order":
+		// null removes the limit
+		if value == nil {
+			req.MaxPerOrder, ok = nil, true
+			break
+		}
+		var limit int
+		limit, ok = wholeNumber(value)
+		ok = ok && limit >= 1
+		req.MaxPerOrder = &limit
+	case "sale_price_cents":
+		// null removes the sale price
+		if value == nil {
+			req.SalePriceCents, ok = nil, true
+			break
+		}
+		var price int
+		price, ok = wholeNumber(value)
+		ok = ok && price >= 1
+		req.SalePriceCents = &price
+	case "sale_ends_at":
+		req.SaleEndsAt, ok = optionalTime(value)
+	case "available_from":
+		req.AvailableFrom, ok = optionalTime(value)
+	case "available_until":
+		req.AvailableUntil, ok = optionalTime(value)
+	}
+
+	if !ok {
+		return &ValidationError{Field: field, Message: "invalid value"}
+	}
+	return nil
+}
+
+// patchColumns picks the (validated) values of the patched fields out of req
+func patchColumns(req models.ProductRequest, fields map[string]interface{}) map[string]interface{} {
+	values := map[string]interface{}{
+		"sku":              req.SKU,
+		"name":             req.Name,
+		"description":      req.Description,
+		"category":         req.Category,
+		"price_cents":      req.PriceCents,
+		"stock_quantity":   req.StockQuantity,
+		"reorder_level":    req.ReorderLevel,
+		"max_per_order":    req.MaxPerOrder,
+		"sale_price_cents": req.SalePriceCents,
+		"sale_ends_at":     req.SaleEndsAt,
+		"available_from":   req.AvailableFrom,
+		"available_until":  req.AvailableUntil,
+	}
+
+	columns := make(map[string]interface{}, len(fields))
+	for field := range fields {
+		columns[field] = values[field]
+	}
+	return columns
+}
+
+// optionalTime converts a decoded JSON RFC 3339 string to a time
+// null is valid too and means "no time" (nil)
+func optionalTime(value interface{}) (*time.Time, bool) {
+	if value == nil {
+		return nil, true
+	}
+	text, ok := value.(string)
+	if !ok {
+		return nil, false
+	}
+	parsed, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return nil, false
+	}
+	return &parsed, true
+}
+
+// wholeNumber converts a decoded JSON number to an int, rejecting fractions
+func wholeNumber(value interface{}) (int, bool) {
+	number, ok := value.(float64)
+	if !ok || number != float64(int(number)) {
+		return 0, false
+	}
+	return int(number), true
+}
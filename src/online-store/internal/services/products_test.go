@@ -0,0 +1,1170 @@
+// internal/services/products_test.go
+// Tests for managing the catalog, on the in-memory fakes
+
+package services
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"online-store/internal/config"
+	"online-store/internal/models"
+	"online-store/internal/money"
+)
+
+// validProduct returns a request that passes every check
+func validProduct() models.ProductRequest {
+	return models.ProductRequest{Name: "Mug", PriceCents: 900, StockQuantity: intPtr(5)}
+}
+
+func TestValidateProductRequest(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		change func(req *models.ProductRequest)
+		field  string // Empty when the request is valid
+	}{
+		{"valid", func(req *models.ProductRequest) {}, ""},
+		{"blank name", func(req *models.ProductRequest) { req.Name = "   " }, "name"},
+		{"name too long", func(req *models.ProductRequest) { req.Name = strings.Repeat("a", maxProductNameLength+1) }, "name"},
+		{"long name in characters, not bytes", func(req *models.ProductRequest) { req.Name = strings.Repeat("ä", maxProductNameLength) }, ""},
+		{"price too high", func(req *models.ProductRequest) { req.PriceCents = maxPriceCents + 1 }, "price_cents"},
+		{"sale price not lower", func(req *models.ProductRequest) { req.SalePriceCents = intPtr(900) }, "sale_price_cents"},
+		{"sale price lower", func(req *models.ProductRequest) { req.SalePriceCents = intPtr(899) }, ""},
+		{"empty window", func(req *models.ProductRequest) {
+			req.AvailableFrom, req.AvailableUntil = timePtr(now), timePtr(now)
+		}, "available_until"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validProduct()
+			tt.change(&req)
+
+			err := validateProductRequest(&req)
+			var validationErr *ValidationError
+			switch {
+			case tt.field == "" && err != nil:
+				t.Errorf("err = %v, want nil", err)
+			case tt.field != "" && (!errors.As(err, &validationErr) || validationErr.Field != tt.field):
+				t.Errorf("err = %v, want a ValidationError for %q", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestCreateProductRejectsInvalidRequest(t *testing.T) {
+	s := newTestStore(t)
+	req := validProduct()
+	req.SalePriceCents = intPtr(1000)
+
+	_, _, err := s.productService.CreateProduct(1, req, false)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("err = %v, want a ValidationError", err)
+	}
+	if len(s.products.products) != 0 {
+		t.Errorf("an invalid product was stored")
+	}
+	if len(s.publisher.published("product/created")) != 0 {
+		t.Errorf("product/created was published for an invalid product")
+	}
+}
+
+func TestCreateProductWithTakenSKU(t *testing.T) {
+	s := newTestStore(t)
+	req := validProduct()
+	req.SKU = "MUG-1"
+
+	_, created, err := s.productService.CreateProduct(1, req, false)
+	if err != nil || !created {
+		t.Fatalf("first create: created = %t, err = %v", created, err)
+	}
+
+	_, _, err = s.productService.CreateProduct(1, req, false)
+	if !errors.Is(err, ErrDuplicateSKU) {
+		t.Fatalf("second create: err = %v, want ErrDuplicateSKU", err)
+	}
+	if len(s.products.products) != 1 {
+		t.Errorf("%d products stored, want 1", len(s.products.products))
+	}
+}
+
+func TestCreateProductUpsertIsSafeToRetry(t *testing.T) {
+	s := newTestStore(t)
+	req := validProduct()
+	req.SKU = "MUG-1"
+
+	first, _, err := s.productService.CreateProduct(1, req, true)
+	if err != nil {
+		t.Fatalf("first create: %v", err)
+	}
+
+	// The retry carries a changed price, which wins
+	req.PriceCents = 950
+	second, created, err := s.productService.CreateProduct(1, req, true)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if created {
+		t.Errorf("retry created a new product")
+	}
+	if second.ID != first.ID || second.PriceCents != 950 {
+		t.Errorf("retry returned product %d at %d cents, want %d at 950", second.ID, second.PriceCents, first.ID)
+	}
+	if len(s.products.products) != 1 {
+		t.Errorf("%d products stored, want 1", len(s.products.products))
+	}
+	if got := len(s.publisher.published("product/created")); got != 1 {
+		t.Errorf("product/created published %d times, want 1", got)
+	}
+}
+
+func TestBulkUpdateStockIsAllOrNothing(t *testing.T) {
+	s := newTestStore(t)
+	mug := s.addProduct("Mug", 900, 5)
+
+	err := s.productService.BulkUpdateStock([]models.StockUpdate{{ProductID: mug.ID, Stock: 50}, {ProductID: 99, Stock: 1}})
+	if !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("err = %v, want ErrProductNotFound", err)
+	}
+	if got := s.products.stock(mug.ID); got != 5 {
+		t.Errorf("stock = %d, want 5 (unchanged)", got)
+	}
+
+	err = s.productService.BulkUpdateStock([]models.StockUpdate{{ProductID: mug.ID, Stock: -1}})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("negative stock: err = %v, want a ValidationError", err)
+	}
+}
+
+func TestBulkUpdateStock(t *testing.T) {
+	s := newTestStore(t)
+	mug := s.addProduct("Mug", 900, 5)
+	tea := s.addProduct("Tea", 450, 40)
+
+	err := s.productService.BulkUpdateStock([]models.StockUpdate{{ProductID: mug.ID, Stock: 50}, {ProductID: tea.ID, Stock: 3}})
+	if err != nil {
+		t.Fatalf("BulkUpdateStock: %v", err)
+	}
+	if s.products.stock(mug.ID) != 50 || s.products.stock(tea.ID) != 3 {
+		t.Errorf("stock = %d and %d, want 50 and 3", s.products.stock(mug.ID), s.products.stock(tea.ID))
+	}
+
+	alerts := s.publisher.published("inventory/low_stock")
+	if len(alerts) != 1 || alerts[0].(models.LowStockAlert).ProductID != tea.ID {
+		t.Errorf("low stock alerts = %v, want one for the tea", alerts)
+	}
+}
+
+func TestProductsOnSale(t *testing.T) {
+	s := newTestStore(t)
+	s.addProduct("Mug", 900, 5)
+	tea := s.products.add(models.Product{Name: "Tea", PriceCents: 450, SalePriceCents: intPtr(300), StockQuantity: 5})
+	s.products.add(models.Product{Name: "Old deal", PriceCents: 450, SalePriceCents: intPtr(300), SaleEndsAt: timePtr(time.Now().Add(-time.Hour))})
+
+	products, err := s.productService.GetProductsOnSale()
+	if err != nil {
+		t.Fatalf("GetProductsOnSale: %v", err)
+	}
+	if len(products) != 1 || products[0].ID != tea.ID || products[0].EffectivePriceCents != 300 {
+		t.Errorf("on sale = %+v, want only the tea at 300", products)
+	}
+}
+
+func TestOrdersUseTheSalePrice(t *testing.T) {
+	s := newTestStore(t)
+	tea := s.products.add(models.Product{Name: "Tea", PriceCents: 450, SalePriceCents: intPtr(300), StockQuantity: 50, ReorderLevel: 10})
+
+	order := s.placeOrder(t, s.addUser("ann@example.com"), tea.ID, 2)
+	if order.TotalCents != 600 {
+		t.Errorf("TotalCents = %d, want 600", order.TotalCents)
+	}
+}
+
+func TestPatchProductChangesOnlyGivenFields(t *testing.T) {
+	s := newTestStore(t)
+	product := s.products.add(models.Product{Name: "Mug", Description: "Blue", PriceCents: 900, StockQuantity: 5, ReorderLevel: 2, MaxPerOrder: intPtr(3)})
+
+	patched, err := s.productService.PatchProduct(1, product.ID, map[string]interface{}{
+		"price_cents":   float64(950),
+		"max_per_order": nil, // null removes the limit
+	})
+	if err != nil {
+		t.Fatalf("PatchProduct: %v", err)
+	}
+	if patched.PriceCents != 950 || patched.MaxPerOrder != nil {
+		t.Errorf("patched = %+v, want price 950 and no limit", patched)
+	}
+	if patched.Name != "Mug" || patched.Description != "Blue" || patched.StockQuantity != 5 {
+		t.Errorf("fields that weren't sent changed: %+v", patched)
+	}
+}
+
+func TestPatchProductRejectsBadFields(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 5)
+
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		field  string
+	}{
+		{"empty body", map[string]interface{}{}, "body"},
+		{"read-only field", map[string]interface{}{"id": float64(7)}, "id"},
+		{"unknown field", map[string]interface{}{"colour": "blue"}, "colour"},
+		{"wrong type", map[string]interface{}{"price_cents": "950"}, "price_cents"},
+		{"fraction", map[string]interface{}{"stock_quantity": 1.5}, "stock_quantity"},
+		{"negative stock", map[string]interface{}{"stock_quantity": float64(-1)}, "stock_quantity"},
+		{"bad time", map[string]interface{}{"sale_ends_at": "tomorrow"}, "sale_ends_at"},
+		{"sku too long", map[string]interface{}{"sku": strings.Repeat("S", maxSKULength+1)}, "sku"},
+		// Checked against the product as it would be after the patch
+		{"sale price above price", map[string]interface{}{"sale_price_cents": float64(1000)}, "sale_price_cents"},
+		{"blank name", map[string]interface{}{"name": " "}, "name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.productService.PatchProduct(1, product.ID, tt.fields)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != tt.field {
+				t.Errorf("err = %v, want a ValidationError for %q", err, tt.field)
+			}
+		})
+	}
+
+	if got, _ := s.products.GetByID(product.ID); got.PriceCents != 900 || got.Name != "Mug" {
+		t.Errorf("a rejected patch changed the product: %+v", got)
+	}
+}
+
+func TestPatchProductUnknown(t *testing.T) {
+	s := newTestStore(t)
+	_, err := s.productService.PatchProduct(1, 42, map[string]interface{}{"name": "Mug"})
+	if !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("err = %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestProductUpdatesAnnounceRestocks(t *testing.T) {
+	s := newTestStore(t)
+	patched := s.addProduct("Mug", 900, 0)
+	updated := s.addProduct("Tea", 450, 0)
+
+	if _, err := s.productService.PatchProduct(1, patched.ID, map[string]interface{}{"stock_quantity": float64(20)}); err != nil {
+		t.Fatalf("PatchProduct: %v", err)
+	}
+	req := models.ProductRequest{Name: "Tea", PriceCents: 450, StockQuantity: intPtr(20)}
+	if _, err := s.productService.UpdateProduct(1, updated.ID, req); err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+
+	events := s.publisher.published("inventory/back_in_stock")
+	if len(events) != 2 {
+		t.Fatalf("published %d back-in-stock events, want 2", len(events))
+	}
+	for i, id := range []int{patched.ID, updated.ID} {
+		if got := events[i].(models.BackInStockEvent).ProductID; got != id {
+			t.Errorf("event %d is for product %d, want %d", i, got, id)
+		}
+	}
+}
+
+// backInStock returns the products inventory/back_in_stock was published for
+// (leaving out the notifications for customers on the waitlist)
+func backInStock(s *testStore) []int {
+	var ids []int
+	for _, event := range s.publisher.published("inventory/back_in_stock") {
+		if event, ok := event.(models.BackInStockEvent); ok && event.UserID == 0 {
+			ids = append(ids, event.ProductID)
+		}
+	}
+	return ids
+}
+
+func TestUpdateStockAnnouncesRestocks(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 0)
+
+	steps := []struct {
+		stock int
+		want  []int
+	}{
+		{5, []int{product.ID}},             // 0 -> 5: back in stock
+		{10, []int{product.ID}},            // 5 -> 10: it never was gone
+		{0, []int{product.ID}},             // Sold out again
+		{2, []int{product.ID, product.ID}}, // Back again
+	}
+	for _, step := range steps {
+		if err := s.productService.UpdateStock(product.ID, step.stock); err != nil {
+			t.Fatalf("UpdateStock(%d): %v", step.stock, err)
+		}
+		if got := backInStock(s); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("after stock %d: back in stock events for %v, want %v", step.stock, got, step.want)
+		}
+	}
+
+	event := s.publisher.published("inventory/back_in_stock")[0].(models.BackInStockEvent)
+	if event.ProductName != "Mug" || event.CurrentStock != 5 {
+		t.Errorf("event = %+v, want the mug with 5 in stock", event)
+	}
+	recorded := 0
+	for _, eventType := range s.events.types(product.ID) {
+		if eventType == models.ProductEventBackInStock {
+			recorded++
+		}
+	}
+	if recorded != 2 {
+		t.Errorf("%d back_in_stock product events, want 2", recorded)
+	}
+}
+
+func TestBulkUpdateStockAnnouncesRestocks(t *testing.T) {
+	s := newTestStore(t)
+	soldOut := s.addProduct("Mug", 900, 0)
+	inStock := s.addProduct("Tea", 450, 3)
+
+	err := s.productService.BulkUpdateStock([]models.StockUpdate{{ProductID: soldOut.ID, Stock: 4}, {ProductID: inStock.ID, Stock: 8}})
+	if err != nil {
+		t.Fatalf("BulkUpdateStock: %v", err)
+	}
+	if got := backInStock(s); !reflect.DeepEqual(got, []int{soldOut.ID}) {
+		t.Errorf("back in stock events for %v, want only %d", got, soldOut.ID)
+	}
+}
+
+func TestBackInStockThreshold(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) { cfg.BackInStockMin = 5 })
+	product := s.addProduct("Mug", 900, 0)
+
+	// 3 is still too few to announce; reaching 5 is worth it
+	s.productService.UpdateStock(product.ID, 3)
+	if got := backInStock(s); len(got) != 0 {
+		t.Fatalf("back in stock events for %v at stock 3, want none", got)
+	}
+	s.productService.UpdateStock(product.ID, 6)
+	if got := backInStock(s); !reflect.DeepEqual(got, []int{product.ID}) {
+		t.Errorf("back in stock events for %v at stock 6, want %d", got, product.ID)
+	}
+}
+
+func TestGetAvailability(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 3)
+
+	for quantity, want := range map[int]bool{1: true, 3: true, 4: false} {
+		availability, err := s.productService.GetAvailability(product.ID, quantity)
+		if err != nil {
+			t.Fatalf("GetAvailability(%d): %v", quantity, err)
+		}
+		if availability.Available != want || availability.StockQuantity != 3 {
+			t.Errorf("quantity %d: %+v, want available = %t", quantity, availability, want)
+		}
+	}
+	if got := s.products.stock(product.ID); got != 3 {
+		t.Errorf("stock = %d, want 3 (nothing reserved)", got)
+	}
+
+	var validationErr *ValidationError
+	if _, err := s.productService.GetAvailability(product.ID, 0); !errors.As(err, &validationErr) {
+		t.Errorf("quantity 0: err = %v, want a ValidationError", err)
+	}
+
+	draft := s.products.add(models.Product{Name: "Secret", PriceCents: 100, StockQuantity: 5, Status: models.ProductStatusDraft})
+	if _, err := s.productService.GetAvailability(draft.ID, 1); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("draft: err = %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestCreateProductSanitizesText(t *testing.T) {
+	s := newTestStore(t)
+	req := validProduct()
+	req.Name = "<b>Mug</b>"
+	req.Description = `<script>alert("x")</script>`
+
+	product, _, err := s.productService.CreateProduct(1, req, false)
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	if product.Name != "&lt;b&gt;Mug&lt;/b&gt;" || product.Description != "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;" {
+		t.Errorf("stored name %q and description %q, want them escaped", product.Name, product.Description)
+	}
+}
+
+func TestGetLowStockProducts(t *testing.T) {
+	s := newTestStore(t)
+	s.addProduct("Plenty", 100, 50)
+	slightly := s.addProduct("Slightly short", 100, 8) // Reorder level 10
+	badly := s.addProduct("Badly short", 100, 1)
+
+	lowStock, err := s.productService.GetLowStockProducts(true)
+	if err != nil {
+		t.Fatalf("GetLowStockProducts: %v", err)
+	}
+	if len(lowStock) != 2 {
+		t.Fatalf("%d low-stock products, want 2", len(lowStock))
+	}
+	if lowStock[0].ID != badly.ID || lowStock[0].Shortfall != 9 || lowStock[1].ID != slightly.ID || lowStock[1].Shortfall != 2 {
+		t.Errorf("low stock = %+v, want the badly short product (9) before the slightly short one (2)", lowStock)
+	}
+
+	// Nothing low is an empty list, not null
+	s = newTestStore(t)
+	if lowStock, err := s.productService.GetLowStockProducts(true); err != nil || lowStock == nil || len(lowStock) != 0 {
+		t.Errorf("low stock = %v, err = %v, want an empty list", lowStock, err)
+	}
+}
+
+func TestCategoryCap(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) { cfg.MaxPerCategory = 2 })
+	create := func(name, category string) (*models.Product, error) {
+		req := validProduct()
+		req.Name, req.Category = name, category
+		product, _, err := s.productService.CreateProduct(1, req, false)
+		return product, err
+	}
+
+	first, err := create("Mug", "kitchen")
+	if err != nil {
+		t.Fatalf("first product: %v", err)
+	}
+	if _, err := create("Pan", "kitchen"); err != nil {
+		t.Fatalf("second product: %v", err)
+	}
+
+	var validationErr *ValidationError
+	if _, err := create("Pot", "kitchen"); !errors.As(err, &validationErr) || validationErr.Field != "category" {
+		t.Fatalf("third product: err = %v, want a ValidationError for category", err)
+	}
+
+	// Products without a category and other categories aren't affected
+	if _, err := create("Pot", ""); err != nil {
+		t.Errorf("product without category: %v", err)
+	}
+	other, err := create("Tea", "food")
+	if err != nil {
+		t.Fatalf("other category: %v", err)
+	}
+
+	// Updating a product in a full category doesn't count it twice...
+	req := validProduct()
+	req.Category, req.PriceCents = "kitchen", 950
+	if _, err := s.productService.UpdateProduct(1, first.ID, req); err != nil {
+		t.Errorf("updating a product in its full category: %v", err)
+	}
+	// ...but moving another product into it does
+	if _, err := s.productService.PatchProduct(1, other.ID, map[string]interface{}{"category": "kitchen"}); !errors.As(err, &validationErr) {
+		t.Errorf("moving into a full category: err = %v, want a ValidationError", err)
+	}
+}
+
+func TestPriceHistory(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 20)
+
+	req := validProduct()
+	req.PriceCents = 1100
+	if _, err := s.productService.UpdateProduct(7, product.ID, req); err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	// Changes that leave the price alone aren't recorded
+	if _, err := s.productService.UpdateProduct(7, product.ID, req); err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	if _, err := s.productService.PatchProduct(7, product.ID, map[string]interface{}{"name": "Big mug"}); err != nil {
+		t.Fatalf("PatchProduct: %v", err)
+	}
+	if _, err := s.productService.PatchProduct(SystemActor, product.ID, map[string]interface{}{"price_cents": float64(1000)}); err != nil {
+		t.Fatalf("PatchProduct: %v", err)
+	}
+
+	history, err := s.productService.GetPriceHistory(product.ID)
+	if err != nil {
+		t.Fatalf("GetPriceHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("%d price changes, want 2: %+v", len(history), history)
+	}
+
+	// Newest first; system changes have no user
+	if history[0].OldPriceCents != 1100 || history[0].NewPriceCents != 1000 || history[0].ChangedBy != nil {
+		t.Errorf("newest change = %+v, want 1100 -> 1000 by nobody", history[0])
+	}
+	if history[1].OldPriceCents != 900 || history[1].NewPriceCents != 1100 || history[1].ChangedBy == nil || *history[1].ChangedBy != 7 {
+		t.Errorf("oldest change = %+v, want 900 -> 1100 by user 7", history[1])
+	}
+}
+
+func TestPriceHistoryUnknownProduct(t *testing.T) {
+	s := newTestStore(t)
+	if _, err := s.productService.GetPriceHistory(42); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("err = %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestCreateProductDefaultStock(t *testing.T) {
+	tests := []struct {
+		name  string
+		stock *int
+		want  int
+	}{
+		{"omitted", nil, 25},
+		{"explicit zero", intPtr(0), 0},
+		{"explicit", intPtr(7), 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t, func(cfg *config.Config) { cfg.DefaultStock = 25 })
+			req := validProduct()
+			req.StockQuantity = tt.stock
+
+			product, _, err := s.productService.CreateProduct(1, req, false)
+			if err != nil {
+				t.Fatalf("CreateProduct: %v", err)
+			}
+			if product.StockQuantity != tt.want {
+				t.Errorf("StockQuantity = %d, want %d", product.StockQuantity, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRelatedProducts(t *testing.T) {
+	s := newTestStore(t)
+	mug := s.addProduct("Mug", 900, 50)
+	tea := s.addProduct("Tea", 500, 50)
+	spoon := s.addProduct("Spoon", 200, 50)
+	saucer := s.addProduct("Saucer", 300, 50)
+	kettle := s.addProduct("Kettle", 3000, 50)
+	lid := s.addProduct("Lid", 100, 1)
+
+	ann := s.addUser("ann@example.com")
+	bob := s.addUser("bob@example.com")
+	cid := s.addUser("cid@example.com")
+	dan := s.addUser("dan@example.com")
+
+	// Tea was bought by three mug buyers, the spoon by two, the saucer by one
+	// (twice); the kettle only by someone who never bought a mug
+	for _, purchase := range []struct{ user, product int }{
+		{ann, mug.ID}, {ann, tea.ID}, {ann, spoon.ID}, {ann, lid.ID},
+		{bob, mug.ID}, {bob, tea.ID}, {bob, spoon.ID}, {bob, mug.ID},
+		{cid, mug.ID}, {cid, tea.ID}, {cid, saucer.ID}, {cid, saucer.ID},
+		{dan, kettle.ID}, {dan, tea.ID},
+	} {
+		s.placeOrder(t, purchase.user, purchase.product, 1)
+	}
+	// The lid is sold out now (Ann bought the last one)
+
+	related, err := s.productService.GetRelatedProducts(mug.ID, 0)
+	if err != nil {
+		t.Fatalf("GetRelatedProducts: %v", err)
+	}
+	var names []string
+	for _, product := range related {
+		names = append(names, product.Name)
+	}
+	if want := []string{"Tea", "Spoon", "Saucer"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("related = %v, want %v (most buyers first, no mug, kettle or sold-out lid)", names, want)
+	}
+
+	// The limit is applied after ordering
+	related, _ = s.productService.GetRelatedProducts(mug.ID, 1)
+	if len(related) != 1 || related[0].ID != tea.ID {
+		t.Errorf("related with limit 1 = %+v, want only Tea", related)
+	}
+}
+
+func TestGetRelatedProductsNoOrders(t *testing.T) {
+	s := newTestStore(t)
+	mug := s.addProduct("Mug", 900, 50)
+
+	related, err := s.productService.GetRelatedProducts(mug.ID, 0)
+	if err != nil || related == nil || len(related) != 0 {
+		t.Errorf("related = %v, err = %v, want an empty list", related, err)
+	}
+	if _, err := s.productService.GetRelatedProducts(42, 0); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("unknown product: err = %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestGetProductsCap(t *testing.T) {
+	tests := []struct {
+		name      string
+		max       int
+		products  int
+		want      int
+		truncated bool
+	}{
+		{"more than the cap", 3, 5, 3, true},
+		{"exactly the cap", 3, 3, 3, false},
+		{"below the cap", 3, 2, 2, false},
+		{"no cap", 0, 5, 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t, func(cfg *config.Config) { cfg.MaxProductsListed = tt.max })
+			for i := 0; i < tt.products; i++ {
+				s.addProduct("Mug", 900, 10)
+			}
+
+			products, truncated, err := s.productService.GetProducts(false, false)
+			if err != nil {
+				t.Fatalf("GetProducts: %v", err)
+			}
+			if len(products) != tt.want || truncated != tt.truncated {
+				t.Errorf("got %d products, truncated %v; want %d, %v", len(products), truncated, tt.want, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestProductEventsAreRecorded(t *testing.T) {
+	s := newTestStore(t)
+
+	product, _, err := s.productService.CreateProduct(1, validProduct(), false)
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	if got := s.events.types(product.ID); !reflect.DeepEqual(got, []string{models.ProductEventCreated}) {
+		t.Fatalf("events after creating = %v, want [created]", got)
+	}
+
+	// A new name is an update; a new price is a price change too
+	req := validProduct()
+	req.Name = "Big mug"
+	if _, err := s.productService.UpdateProduct(1, product.ID, req); err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	req.PriceCents = 1200
+	if _, err := s.productService.UpdateProduct(1, product.ID, req); err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	if err := s.productService.UpdateStock(product.ID, 30); err != nil {
+		t.Fatalf("UpdateStock: %v", err)
+	}
+
+	want := []string{
+		models.ProductEventCreated,
+		models.ProductEventUpdated,
+		models.ProductEventPriceChanged, models.ProductEventUpdated,
+		models.ProductEventStockChanged,
+	}
+	if got := s.events.types(product.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	// The endpoint lists them newest first, with the payload sent
+	events, err := s.productService.GetProductEvents(product.ID, 2)
+	if err != nil {
+		t.Fatalf("GetProductEvents: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != models.ProductEventStockChanged || string(events[0].Payload) != `{"stock_quantity":30}` {
+		t.Errorf("events = %+v, want the stock change first and only 2", events)
+	}
+	if _, err := s.productService.GetProductEvents(42, 0); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("unknown product: err = %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestDraftProducts(t *testing.T) {
+	s := newTestStore(t)
+	s.addProduct("Mug", 900, 10)
+	req := validProduct()
+	req.Name = "Lamp"
+	req.Draft = true
+
+	draft, _, err := s.productService.CreateProduct(1, req, false)
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	if draft.Status != models.ProductStatusDraft {
+		t.Fatalf("status = %q, want draft", draft.Status)
+	}
+
+	// Customers don't see it anywhere yet
+	public, _, err := s.productService.GetProducts(false, false)
+	if err != nil || len(public) != 1 || public[0].Name != "Mug" {
+		t.Errorf("public list = %+v, %v, want only the mug", public, err)
+	}
+	if _, err := s.productService.GetProduct(draft.ID); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("GetProduct err = %v, want ErrProductNotFound", err)
+	}
+	if _, err := s.orderService.CreateOrder(s.addUser("ann@example.com"), models.OrderRequest{ProductID: draft.ID, Quantity: 1}); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("CreateOrder err = %v, want ErrProductNotFound", err)
+	}
+
+	// Admins do
+	all, _, err := s.productService.GetProducts(true, false)
+	if err != nil || len(all) != 2 {
+		t.Errorf("admin list = %+v, %v, want both products", all, err)
+	}
+}
+
+func TestPublishProduct(t *testing.T) {
+	s := newTestStore(t)
+	draft := s.products.add(models.Product{Name: "Lamp", PriceCents: 2499, StockQuantity: 5, Status: models.ProductStatusDraft})
+
+	product, err := s.productService.PublishProduct(1, draft.ID)
+	if err != nil {
+		t.Fatalf("PublishProduct: %v", err)
+	}
+	if product.Status != models.ProductStatusPublished {
+		t.Errorf("status = %q, want published", product.Status)
+	}
+	if _, err := s.productService.GetProduct(draft.ID); err != nil {
+		t.Errorf("GetProduct after publishing: %v", err)
+	}
+	if got := s.publisher.published("product/published"); len(got) != 1 {
+		t.Errorf("%d product/published events, want 1", len(got))
+	}
+	if got := s.audits.actions("product", draft.ID); !reflect.DeepEqual(got, []string{"publish"}) {
+		t.Errorf("audit actions = %v, want [publish]", got)
+	}
+
+	// Publishing again changes nothing and announces nothing
+	if _, err := s.productService.PublishProduct(1, draft.ID); err != nil {
+		t.Fatalf("second PublishProduct: %v", err)
+	}
+	if got := s.publisher.published("product/published"); len(got) != 1 {
+		t.Errorf("%d product/published events after publishing twice, want 1", len(got))
+	}
+
+	if _, err := s.productService.PublishProduct(1, 42); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("unknown product: err = %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestGetInventoryValuation(t *testing.T) {
+	s := newTestStore(t)
+	for _, product := range []models.Product{
+		{Name: "Mug", Category: "kitchen", PriceCents: 900, StockQuantity: 10},
+		{Name: "Wok", Category: "kitchen", PriceCents: 4500, StockQuantity: 2, Status: models.ProductStatusDraft},
+		{Name: "Lamp", Category: "living", PriceCents: 2499, StockQuantity: 4},
+		{Name: "Sofa", Category: "living", PriceCents: 99900, StockQuantity: 0}, // Sold out, worth nothing
+		{Name: "Sticker", PriceCents: 150, StockQuantity: 100},
+	} {
+		s.products.add(product)
+	}
+
+	valuation, err := s.productService.GetInventoryValuation(true)
+	if err != nil {
+		t.Fatalf("GetInventoryValuation: %v", err)
+	}
+	want := &models.InventoryValuation{
+		TotalCents: 9000 + 9000 + 9996 + 15000,
+		Units:      10 + 2 + 4 + 100,
+		Categories: []models.CategoryValuation{
+			{Category: "", Products: 1, Units: 100, ValueCents: 15000},
+			{Category: "kitchen", Products: 2, Units: 12, ValueCents: 18000},
+			{Category: "living", Products: 1, Units: 4, ValueCents: 9996},
+		},
+	}
+	if !reflect.DeepEqual(valuation, want) {
+		t.Errorf("valuation = %+v, want %+v", valuation, want)
+	}
+
+	// Without grouping, only the totals
+	total, err := s.productService.GetInventoryValuation(false)
+	if err != nil {
+		t.Fatalf("GetInventoryValuation: %v", err)
+	}
+	if total.TotalCents != want.TotalCents || total.Units != want.Units || total.Categories != nil {
+		t.Errorf("ungrouped valuation = %+v, want the totals without categories", total)
+	}
+}
+
+func TestGetInventoryValuationEmpty(t *testing.T) {
+	s := newTestStore(t)
+
+	valuation, err := s.productService.GetInventoryValuation(true)
+	if err != nil {
+		t.Fatalf("GetInventoryValuation: %v", err)
+	}
+	if valuation.TotalCents != 0 || valuation.Units != 0 || len(valuation.Categories) != 0 {
+		t.Errorf("valuation = %+v, want all zero", valuation)
+	}
+}
+
+func TestCreateProductGeneratesSKU(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) { cfg.SKUPrefix = "MUG-" })
+
+	var skus []string
+	for i := 0; i < 2; i++ {
+		product, _, err := s.productService.CreateProduct(1, validProduct(), false)
+		if err != nil {
+			t.Fatalf("CreateProduct: %v", err)
+		}
+		skus = append(skus, product.SKU)
+	}
+	if want := []string{"MUG-000001", "MUG-000002"}; !reflect.DeepEqual(skus, want) {
+		t.Errorf("generated SKUs = %v, want %v", skus, want)
+	}
+
+	// A SKU given in the request is kept, and uses up no number
+	req := validProduct()
+	req.SKU = "OWN-1"
+	product, _, err := s.productService.CreateProduct(1, req, false)
+	if err != nil || product.SKU != "OWN-1" {
+		t.Errorf("CreateProduct with a SKU = %+v, %v, want SKU OWN-1", product, err)
+	}
+	if next, _ := s.products.NextSKUNumber(); next != 3 {
+		t.Errorf("next SKU number = %d, want 3", next)
+	}
+}
+
+func TestCreateProductWithoutSKUPrefix(t *testing.T) {
+	s := newTestStore(t)
+
+	product, _, err := s.productService.CreateProduct(1, validProduct(), false)
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	if product.SKU != "" {
+		t.Errorf("SKU = %q, want none without a prefix", product.SKU)
+	}
+}
+
+func TestShortenText(t *testing.T) {
+	tests := []struct {
+		text     string
+		maxChars int
+		want     string
+	}{
+		{"A sturdy mug", 20, "A sturdy mug"},
+		{"A sturdy mug", 12, "A sturdy mug"},
+		{"A sturdy mug for tea", 10, "A sturdy…"}, // No space before the ellipsis
+		{"Čaj in kava", 5, "Čaj…"},                // Counts characters, not bytes
+		{"A sturdy mug", 0, "A sturdy mug"},       // 0 turns shortening off
+	}
+
+	for _, tt := range tests {
+		if got := shortenText(tt.text, tt.maxChars); got != tt.want {
+			t.Errorf("shortenText(%q, %d) = %q, want %q", tt.text, tt.maxChars, got, tt.want)
+		}
+	}
+}
+
+func TestListShortensDescriptions(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) { cfg.ListDescriptionLength = 10 })
+	description := "Hand-made stoneware mug that keeps tea warm for longer"
+	product := s.products.add(models.Product{Name: "Mug", PriceCents: 900, StockQuantity: 5, Description: description})
+
+	products, _, err := s.productService.GetProducts(false, false)
+	if err != nil {
+		t.Fatalf("GetProducts: %v", err)
+	}
+	if got := products[0].Description; got != "Hand-made…" {
+		t.Errorf("list description = %q, want it cut to 10 characters", got)
+	}
+
+	// The product page has the full text
+	full, err := s.productService.GetProduct(product.ID)
+	if err != nil {
+		t.Fatalf("GetProduct: %v", err)
+	}
+	if full.Description != description {
+		t.Errorf("detail description = %q, want the full text", full.Description)
+	}
+}
+
+func TestGetCategories(t *testing.T) {
+	s := newTestStore(t)
+	for _, product := range []models.Product{
+		{Name: "Mug", Category: "kitchen", StockQuantity: 5},
+		{Name: "Pan", Category: "kitchen", StockQuantity: 1},
+		{Name: "Pot", Category: "kitchen", StockQuantity: 0},                                    // Sold out
+		{Name: "Wok", Category: "kitchen", StockQuantity: 9, Status: models.ProductStatusDraft}, // Not in the shop yet
+		{Name: "Tea", Category: "food", StockQuantity: 0},
+		{Name: "Gift card", StockQuantity: 100}, // No category
+	} {
+		s.products.add(product)
+	}
+
+	categories, err := s.productService.GetCategories(false)
+	if err != nil {
+		t.Fatalf("GetCategories: %v", err)
+	}
+	want := []models.CategoryCount{{Name: "food", InStock: 0}, {Name: "kitchen", InStock: 2}}
+	if !reflect.DeepEqual(categories, want) {
+		t.Errorf("categories = %+v, want %+v", categories, want)
+	}
+
+	categories, _ = s.productService.GetCategories(true)
+	if want := want[1:]; !reflect.DeepEqual(categories, want) {
+		t.Errorf("categories without empty ones = %+v, want %+v", categories, want)
+	}
+}
+
+func TestGetProductBySKU(t *testing.T) {
+	s := newTestStore(t)
+	mug := s.products.add(models.Product{Name: "Mug", SKU: "MUG-1", PriceCents: 900, Status: models.ProductStatusPublished})
+	s.products.add(models.Product{Name: "Secret mug", SKU: "MUG-2", PriceCents: 900, Status: models.ProductStatusDraft})
+	s.addProduct("Tea", 450, 10) // No SKU
+
+	for _, sku := range []string{"MUG-1", " MUG-1\n"} {
+		product, err := s.productService.GetProductBySKU(sku)
+		if err != nil || product.ID != mug.ID {
+			t.Errorf("GetProductBySKU(%q) = %+v, %v, want the mug", sku, product, err)
+		}
+	}
+
+	// Drafts aren't for sale yet, and products without a SKU can't be found by an empty one
+	for _, sku := range []string{"MUG-3", "mug-1x", "MUG-2", "", "  "} {
+		if _, err := s.productService.GetProductBySKU(sku); !errors.Is(err, ErrProductNotFound) {
+			t.Errorf("GetProductBySKU(%q): err = %v, want ErrProductNotFound", sku, err)
+		}
+	}
+}
+
+func TestGetProductsAvailableOnly(t *testing.T) {
+	s := newTestStore(t)
+	s.addProduct("Mug", 900, 5)
+	s.products.add(models.Product{Name: "Flash sale", PriceCents: 500, Status: models.ProductStatusPublished,
+		AvailableUntil: timePtr(time.Now().Add(-time.Hour))})
+	s.products.add(models.Product{Name: "Preorder", PriceCents: 500, Status: models.ProductStatusPublished,
+		AvailableFrom: timePtr(time.Now().Add(time.Hour))})
+
+	all, _, err := s.productService.GetProducts(false, false)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("all products: %d, err = %v, want 3", len(all), err)
+	}
+	available, _, err := s.productService.GetProducts(false, true)
+	if err != nil {
+		t.Fatalf("GetProducts: %v", err)
+	}
+	if len(available) != 1 || available[0].Name != "Mug" {
+		t.Errorf("available = %+v, want only the mug", available)
+	}
+}
+
+func TestPatchProductPurchaseWindow(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 5)
+
+	patched, err := s.productService.PatchProduct(1, product.ID, map[string]interface{}{
+		"available_from":  "2024-03-01T09:00:00Z",
+		"available_until": "2024-03-02T09:00:00Z",
+	})
+	if err != nil {
+		t.Fatalf("PatchProduct: %v", err)
+	}
+	if patched.AvailableFrom == nil || patched.AvailableUntil == nil || patched.AvailableUntil.Sub(*patched.AvailableFrom) != 24*time.Hour {
+		t.Errorf("window = %v - %v, want one day", patched.AvailableFrom, patched.AvailableUntil)
+	}
+
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+	}{
+		{"ends before it starts", map[string]interface{}{"available_until": "2024-02-28T09:00:00Z"}},
+		{"ends when it starts", map[string]interface{}{"available_until": "2024-03-01T09:00:00Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.productService.PatchProduct(1, product.ID, tt.fields)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != "available_until" {
+				t.Errorf("err = %v, want a ValidationError for available_until", err)
+			}
+		})
+	}
+
+	// null removes a side of the window
+	patched, err = s.productService.PatchProduct(1, product.ID, map[string]interface{}{"available_until": nil})
+	if err != nil || patched.AvailableUntil != nil || patched.AvailableFrom == nil {
+		t.Errorf("patched = %+v, err = %v, want only the end removed", patched, err)
+	}
+}
+
+func TestGetTopSellers(t *testing.T) {
+	s := newTestStore(t)
+	s.products.topSellers = []models.TopSeller{{Product: models.Product{ID: 1, Name: "Mug"}, UnitsSold: 12, RevenueCents: 10800}}
+	day := func(date string) time.Time {
+		parsed, err := time.Parse(dateLayout, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	sellers, err := s.productService.GetTopSellers(day("2024-03-01"), day("2024-03-07"), "revenue", 5)
+	if err != nil {
+		t.Fatalf("GetTopSellers: %v", err)
+	}
+	if len(sellers) != 1 || sellers[0].UnitsSold != 12 {
+		t.Errorf("sellers = %+v, want the repository's", sellers)
+	}
+	// The last day is included, so the repository gets midnight after it
+	want := []interface{}{day("2024-03-01"), day("2024-03-08"), true, 5}
+	if !reflect.DeepEqual(s.products.topSellersArgs, want) {
+		t.Errorf("repository called with %v, want %v", s.products.topSellersArgs, want)
+	}
+
+	// Defaults: by units, the last 30 days, the top 10
+	if _, err := s.productService.GetTopSellers(time.Time{}, time.Time{}, "", 0); err != nil {
+		t.Fatalf("GetTopSellers: %v", err)
+	}
+	args := s.products.topSellersArgs
+	from, to := args[0].(time.Time), args[1].(time.Time)
+	if days := int(to.Sub(from).Hours() / 24); days != defaultSalesDays || args[2] != false || args[3] != defaultTopSellerLimit {
+		t.Errorf("defaults = %d days, by revenue %v, limit %v; want %d days, by units, limit %d",
+			days, args[2], args[3], defaultSalesDays, defaultTopSellerLimit)
+	}
+
+	// Too large a limit is capped
+	if _, err := s.productService.GetTopSellers(time.Time{}, time.Time{}, "units", 1000); err != nil {
+		t.Fatalf("GetTopSellers: %v", err)
+	}
+	if got := s.products.topSellersArgs[3]; got != maxTopSellerLimit {
+		t.Errorf("limit = %v, want %d", got, maxTopSellerLimit)
+	}
+}
+
+func TestGetTopSellersRejected(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		sortBy   string
+		field    string
+	}{
+		{"unknown sort", time.Time{}, time.Time{}, "price", "sort"},
+		{"from after to", now, now.AddDate(0, 0, -1), "", "from"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.productService.GetTopSellers(tt.from, tt.to, tt.sortBy, 0)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != tt.field {
+				t.Errorf("err = %v, want a ValidationError for %q", err, tt.field)
+			}
+		})
+	}
+	if s.products.topSellersArgs != nil {
+		t.Errorf("rejected requests reached the repository")
+	}
+}
+
+func TestSetDisplayPrice(t *testing.T) {
+	s := newTestStore(t, func(cfg *config.Config) {
+		cfg.CurrencyRates = map[string]*big.Rat{"EUR": big.NewRat(92, 100)}
+	})
+	mug := s.addProduct("Mug", 2999, 5).ToResponse()
+	lamp := s.products.add(models.Product{Name: "Lamp", PriceCents: 5000, SalePriceCents: intPtr(4000), Status: models.ProductStatusPublished}).ToResponse()
+
+	if err := s.productService.SetDisplayPrice("eur", &mug, &lamp); err != nil {
+		t.Fatalf("SetDisplayPrice: %v", err)
+	}
+	want := models.DisplayPrice{Currency: "EUR", Amount: 2759, Formatted: "27.59 EUR"}
+	if mug.DisplayPrice == nil || *mug.DisplayPrice != want {
+		t.Errorf("mug display price = %+v, want %+v", mug.DisplayPrice, want)
+	}
+	// A product on sale is shown at its sale price
+	if lamp.DisplayPrice == nil || lamp.DisplayPrice.Amount != 3680 {
+		t.Errorf("lamp display price = %+v, want 3680 EUR cents", lamp.DisplayPrice)
+	}
+	if mug.PriceCents != 2999 {
+		t.Errorf("price_cents = %d, want 2999 (unchanged)", mug.PriceCents)
+	}
+
+	// No currency asked for: nothing to show
+	plain := s.addProduct("Wok", 4500, 5).ToResponse()
+	if err := s.productService.SetDisplayPrice("", &plain); err != nil || plain.DisplayPrice != nil {
+		t.Errorf("display price = %+v, err = %v, want none", plain.DisplayPrice, err)
+	}
+
+	if err := s.productService.SetDisplayPrice("CHF", &plain); !errors.Is(err, money.ErrUnknownCurrency) {
+		t.Errorf("err = %v, want money.ErrUnknownCurrency", err)
+	}
+}
+
+func TestCloneProduct(t *testing.T) {
+	s := newTestStore(t)
+	original := s.products.add(models.Product{
+		SKU: "MUG-BLUE", Name: "Blue mug", Description: "Holds tea", Category: "Kitchen",
+		PriceCents: 900, StockQuantity: 12, ReorderLevel: 3, MaxPerOrder: intPtr(4),
+		SalePriceCents: intPtr(700), Status: models.ProductStatusPublished,
+	})
+
+	clone, err := s.productService.CloneProduct(1, original.ID, models.ProductCloneRequest{Name: "Red mug"})
+	if err != nil {
+		t.Fatalf("CloneProduct: %v", err)
+	}
+	if clone.ID == original.ID || clone.Name != "Red mug" || clone.Status != models.ProductStatusDraft {
+		t.Errorf("clone = %+v, want a new draft called Red mug", clone)
+	}
+	if clone.Description != "Holds tea" || clone.Category != "Kitchen" || clone.PriceCents != 900 ||
+		clone.ReorderLevel != 3 || *clone.MaxPerOrder != 4 || *clone.SalePriceCents != 700 {
+		t.Errorf("clone = %+v, want the original's other fields", clone)
+	}
+	// The stock belongs to the original; the SKU can't be shared
+	if clone.StockQuantity != 0 || clone.SKU != "MUG-BLUE-1" {
+		t.Errorf("clone stock %d, SKU %q; want 0 and MUG-BLUE-1", clone.StockQuantity, clone.SKU)
+	}
+	if got := s.products.stock(original.ID); got != 12 {
+		t.Errorf("original stock = %d, want 12", got)
+	}
+	if got := s.audits.actions("product", clone.ID); !reflect.DeepEqual(got, []string{"create"}) {
+		t.Errorf("audit actions = %v, want [create]", got)
+	}
+
+	// Without a new name, the clone keeps the original's
+	again, err := s.productService.CloneProduct(1, original.ID, models.ProductCloneRequest{})
+	if err != nil || again.Name != "Blue mug" || again.SKU != "MUG-BLUE-2" {
+		t.Errorf("second clone = %+v, err = %v, want Blue mug with SKU MUG-BLUE-2", again, err)
+	}
+}
+
+func TestCloneProductSKU(t *testing.T) {
+	long := strings.Repeat("S", maxSKULength)
+
+	tests := []struct {
+		name      string
+		prefix    string
+		sku       string // The original's
+		requested string
+		want      string
+	}{
+		{"requested SKU", "", "MUG", "CUP-1", "CUP-1"},
+		{"with a SKU prefix", "P-", "MUG", "", "P-000001"},
+		{"original without SKU", "", "", "", ""},
+		{"long SKU is shortened", "", long, "", long[:maxSKULength-2] + "-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t, func(cfg *config.Config) { cfg.SKUPrefix = tt.prefix })
+			original := s.products.add(models.Product{SKU: tt.sku, Name: "Mug", PriceCents: 900})
+
+			clone, err := s.productService.CloneProduct(1, original.ID, models.ProductCloneRequest{SKU: tt.requested})
+			if err != nil {
+				t.Fatalf("CloneProduct: %v", err)
+			}
+			if clone.SKU != tt.want {
+				t.Errorf("SKU = %q, want %q", clone.SKU, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloneProductRejected(t *testing.T) {
+	s := newTestStore(t)
+	original := s.products.add(models.Product{SKU: "MUG", Name: "Mug", PriceCents: 900})
+
+	if _, err := s.productService.CloneProduct(1, 42, models.ProductCloneRequest{}); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("unknown product: err = %v, want ErrProductNotFound", err)
+	}
+	if _, err := s.productService.CloneProduct(1, original.ID, models.ProductCloneRequest{SKU: "MUG"}); !errors.Is(err, ErrDuplicateSKU) {
+		t.Errorf("taken SKU: err = %v, want ErrDuplicateSKU", err)
+	}
+	if len(s.products.products) != 1 {
+		t.Errorf("%d products stored, want only the original", len(s.products.products))
+	}
+}
@@ -0,0 +1,11 @@
+// internal/services/publisher.go
+// This file defines how services send events to the rest of the system
+
+package services
+
+// Publisher is anything that can publish an event to a topic
+// Our *mqtt.Client satisfies it, and tests can swap in a fake that just
+// records what was published
+type Publisher interface {
+	Publish(topic string, payload interface{}) error
+}
@@ -0,0 +1,72 @@
+// internal/services/reconciliation.go
+// This file catches up on payments we missed while the server was down
+
+package services
+
+import (
+	"errors"
+	"log"
+
+	"online-store/internal/models"
+)
+
+// paymentsWatermark is the reconciliation_state row for payment confirmations
+const paymentsWatermark = "payments"
+
+// ReconciliationService applies payment confirmations we never got over MQTT
+// If the server is down, payment/confirmed messages are lost and orders stay
+// pending forever. On startup we read the payments table instead, starting
+// from where the last run stopped (the "watermark")
+type ReconciliationService struct {
+	payments PaymentRepository
+	orders   *OrderService
+}
+
+// NewReconciliationService creates a new reconciliation service
+func NewReconciliationService(payments PaymentRepository, orders *OrderService) *ReconciliationService {
+	return &ReconciliationService{
+		payments: payments,
+		orders:   orders,
+	}
+}
+
+// ReconcilePayments marks orders paid for every confirmation newer than the watermark
+// Orders that are already paid (because MQTT did deliver the message) are skipped,
+// so running this again never applies a payment twice
+// Returns how many orders were moved to paid
+func (s *ReconciliationService) ReconcilePayments() (int, error) {
+	watermark, err := s.payments.GetWatermark(paymentsWatermark)
+	if err != nil {
+		return 0, err
+	}
+
+	// >= rather than > so confirmations sharing the watermark's timestamp
+	// aren't missed; the status check below makes re-reading them harmless
+	confirmations, err := s.payments.ConfirmedSince(watermark)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, confirmation := range confirmations {
+		err := s.orders.UpdateOrderStatus(SystemActor, confirmation.OrderID, models.OrderStatusPaid)
+		switch {
+		case err == nil:
+			applied++
+		case errors.Is(err, ErrInvalidStatusTransition):
+			// Already paid (or further along) - nothing to do
+		case errors.Is(err, ErrOrderNotFound):
+			log.Printf("Payment %d refers to unknown order %d, skipping", confirmation.ID, confirmation.OrderID)
+		default:
+			// Stop here and keep the watermark, so the next run retries from this payment
+			return applied, err
+		}
+
+		watermark = confirmation.ConfirmedAt
+		if err := s.payments.SetWatermark(paymentsWatermark, watermark); err != nil {
+			return applied, err
+		}
+	}
+
+	return applied, nil
+}
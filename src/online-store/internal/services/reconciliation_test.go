@@ -0,0 +1,68 @@
+// internal/services/reconciliation_test.go
+// Tests for catching up on missed payment confirmations
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"online-store/internal/models"
+)
+
+func TestReconcilePayments(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 50)
+	userID := s.addUser("ann@example.com")
+	missed := s.placeOrder(t, userID, product.ID, 1)
+	delivered := s.placeOrder(t, userID, product.ID, 1)
+	if err := s.orderService.UpdateOrderStatus(SystemActor, delivered.ID, models.OrderStatusPaid); err != nil {
+		t.Fatalf("pay order: %v", err)
+	}
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.payments.confirmations = []models.PaymentConfirmation{
+		{ID: 1, OrderID: missed.ID, ConfirmedAt: start},
+		{ID: 2, OrderID: delivered.ID, ConfirmedAt: start.Add(time.Minute)}, // MQTT got this one through
+		{ID: 3, OrderID: 999, ConfirmedAt: start.Add(2 * time.Minute)},      // Unknown order
+	}
+	reconciliation := NewReconciliationService(s.payments, s.orderService)
+
+	applied, err := reconciliation.ReconcilePayments()
+	if err != nil {
+		t.Fatalf("ReconcilePayments: %v", err)
+	}
+	if applied != 1 {
+		t.Errorf("applied = %d, want 1", applied)
+	}
+	if got := s.orders.order(missed.ID).Status; got != models.OrderStatusPaid {
+		t.Errorf("missed order is %q, want paid", got)
+	}
+	if got := s.payments.watermarks[paymentsWatermark]; !got.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("watermark = %v, want the last confirmation", got)
+	}
+
+	// Running again applies nothing twice
+	applied, err = reconciliation.ReconcilePayments()
+	if err != nil || applied != 0 {
+		t.Errorf("second run: applied = %d, err = %v, want 0 and nil", applied, err)
+	}
+}
+
+func TestReconcilePaymentsStartsAtWatermark(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 50)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.payments.confirmations = []models.PaymentConfirmation{{ID: 1, OrderID: order.ID, ConfirmedAt: start}}
+	s.payments.watermarks[paymentsWatermark] = start.Add(time.Second)
+
+	applied, err := NewReconciliationService(s.payments, s.orderService).ReconcilePayments()
+	if err != nil || applied != 0 {
+		t.Fatalf("applied = %d, err = %v, want 0 and nil", applied, err)
+	}
+	if got := s.orders.order(order.ID).Status; got != models.OrderStatusPending {
+		t.Errorf("order is %q, want pending (its payment is before the watermark)", got)
+	}
+}
@@ -0,0 +1,139 @@
+// internal/services/risk_test.go
+// Tests for putting risky orders on hold and releasing them
+
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"online-store/internal/models"
+)
+
+func TestFlagRiskHoldsOrder(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+
+	held, err := s.orderService.FlagRisk(SystemActor, models.RiskFlag{OrderID: order.ID, Score: 92, Reason: "card country mismatch"})
+	if err != nil || !held {
+		t.Fatalf("FlagRisk = %t, %v, want the order held", held, err)
+	}
+	stored := s.orders.order(order.ID)
+	if stored.Status != models.OrderStatusOnHold || stored.heldFrom != models.OrderStatusPending {
+		t.Errorf("order = %s held from %q, want on_hold from pending", stored.Status, stored.heldFrom)
+	}
+	if got := s.audits.actions("order", order.ID); !reflect.DeepEqual(got, []string{"create", "hold"}) {
+		t.Errorf("audit actions = %v, want [create hold]", got)
+	}
+	events := s.publisher.published("order/held")
+	if len(events) != 1 || events[0].(models.OrderHeldEvent).Reason != "card country mismatch" {
+		t.Errorf("order/held events = %+v, want one with the reason", events)
+	}
+
+	// A second flag for a held order changes nothing
+	held, err = s.orderService.FlagRisk(SystemActor, models.RiskFlag{OrderID: order.ID, Score: 99})
+	if err != nil || held {
+		t.Errorf("second flag = %t, %v, want not held again and no error", held, err)
+	}
+	if got := len(s.publisher.published("order/held")); got != 1 {
+		t.Errorf("published %d order/held events, want 1", got)
+	}
+}
+
+func TestFlagRiskBelowThreshold(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+
+	held, err := s.orderService.FlagRisk(SystemActor, models.RiskFlag{OrderID: order.ID, Score: float64(s.cfg.RiskHoldThreshold) - 0.5})
+	if err != nil || held {
+		t.Errorf("FlagRisk = %t, %v, want the order left alone", held, err)
+	}
+	if got := s.orders.order(order.ID).Status; got != models.OrderStatusPending {
+		t.Errorf("status = %s, want pending", got)
+	}
+}
+
+func TestFlagRiskRejected(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+	s.orders.setStatus(order.ID, models.OrderStatusShipped)
+
+	// Too late to stop a shipped order
+	if _, err := s.orderService.FlagRisk(SystemActor, models.RiskFlag{OrderID: order.ID, Score: 95}); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("shipped order: err = %v, want ErrInvalidStatusTransition", err)
+	}
+	if _, err := s.orderService.FlagRisk(SystemActor, models.RiskFlag{OrderID: 42, Score: 95}); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("unknown order: err = %v, want ErrOrderNotFound", err)
+	}
+	if got := len(s.publisher.published("order/held")); got != 0 {
+		t.Errorf("published %d order/held events, want 0", got)
+	}
+}
+
+func TestReleaseOrder(t *testing.T) {
+	for _, from := range []models.OrderStatus{models.OrderStatusPending, models.OrderStatusPaid} {
+		t.Run(string(from), func(t *testing.T) {
+			s := newTestStore(t)
+			product := s.addProduct("Mug", 900, 10)
+			order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+			s.orders.setStatus(order.ID, from)
+			if _, err := s.orderService.FlagRisk(SystemActor, models.RiskFlag{OrderID: order.ID, Score: 95}); err != nil {
+				t.Fatalf("FlagRisk: %v", err)
+			}
+
+			status, err := s.orderService.ReleaseOrder(1, order.ID)
+			if err != nil || status != from {
+				t.Fatalf("ReleaseOrder = %s, %v, want back to %s", status, err, from)
+			}
+			if got := s.orders.order(order.ID).Status; got != from {
+				t.Errorf("status = %s, want %s", got, from)
+			}
+			if got := len(s.publisher.published("order/status_changed")); got != 1 {
+				t.Errorf("published %d order/status_changed events, want 1", got)
+			}
+
+			// It isn't on hold anymore
+			if _, err := s.orderService.ReleaseOrder(1, order.ID); !errors.Is(err, ErrInvalidStatusTransition) {
+				t.Errorf("second release: err = %v, want ErrInvalidStatusTransition", err)
+			}
+		})
+	}
+}
+
+func TestPaymentWhileOnHold(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 10)
+	order := s.placeOrder(t, s.addUser("ann@example.com"), product.ID, 1)
+	if _, err := s.orderService.FlagRisk(SystemActor, models.RiskFlag{OrderID: order.ID, Score: 95}); err != nil {
+		t.Fatalf("FlagRisk: %v", err)
+	}
+
+	// The payment is kept, but the order stays on hold until it is released
+	if err := s.orderService.UpdateOrderStatus(SystemActor, order.ID, models.OrderStatusPaid); err != nil {
+		t.Fatalf("pay held order: %v", err)
+	}
+	if got := s.orders.order(order.ID).Status; got != models.OrderStatusOnHold {
+		t.Errorf("status = %s, want on_hold", got)
+	}
+	if got := len(s.publisher.published("order/status_changed")); got != 0 {
+		t.Errorf("published %d order/status_changed events, want 0", got)
+	}
+	if err := s.orderService.UpdateOrderStatus(SystemActor, order.ID, models.OrderStatusPaid); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("second payment: err = %v, want ErrInvalidStatusTransition", err)
+	}
+
+	if status, err := s.orderService.ReleaseOrder(1, order.ID); err != nil || status != models.OrderStatusPaid {
+		t.Errorf("ReleaseOrder = %s, %v, want paid", status, err)
+	}
+}
+
+func TestReleaseOrderUnknown(t *testing.T) {
+	s := newTestStore(t)
+	if _, err := s.orderService.ReleaseOrder(1, 42); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("err = %v, want ErrOrderNotFound", err)
+	}
+}
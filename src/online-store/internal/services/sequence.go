@@ -0,0 +1,60 @@
+// internal/services/sequence.go
+// Counters for numbers we hand out ourselves: invoice numbers and generated SKUs
+// Every counter is a row of the sequences table, so two requests at the same
+// moment can never get the same number (unlike SELECT MAX(...) + 1)
+
+package services
+
+import (
+	"fmt"
+
+	"online-store/internal/database"
+)
+
+// formatInvoiceNumber turns a year and that year's sequence number into
+// an invoice number like INV-2024-000123
+// Unlike the order ID, it doesn't reveal how many orders we had in total,
+// and accountants expect invoice numbers to start over every year
+func formatInvoiceNumber(year, sequence int) string {
+	return fmt.Sprintf("INV-%04d-%06d", year, sequence)
+}
+
+// invoiceSequenceName is the name of the counter for a year's invoice numbers
+func invoiceSequenceName(year int) string {
+	return fmt.Sprintf("invoice-%d", year)
+}
+
+// skuSequenceName is the counter generated SKUs are numbered with
+const skuSequenceName = "sku"
+
+// nextInvoiceSequence takes the next invoice number of the year, inside tx
+// The counter's row stays locked until tx ends, so invoice numbers are handed
+// out in order, and a rolled back order gives its number back (no gaps)
+func nextInvoiceSequence(tx *database.Tx, year int) (int, error) {
+	sequence, err := nextSequence(tx, invoiceSequenceName(year))
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate invoice number: %w", err)
+	}
+	return sequence, nil
+}
+
+// nextSequence adds one to the named counter inside tx and returns the new value
+// A counter that doesn't exist yet starts at 1
+// LAST_INSERT_ID(expr) remembers the value for this connection only, so we read
+// back exactly the number our upsert wrote - never one another request just took
+func nextSequence(tx *database.Tx, name string) (int, error) {
+	_, err := tx.Exec(
+		`INSERT INTO sequences (name, last_value) VALUES (?, LAST_INSERT_ID(1))
+		ON DUPLICATE KEY UPDATE last_value = LAST_INSERT_ID(last_value + 1)`,
+		name,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to advance sequence %s: %w", name, err)
+	}
+
+	var value int
+	if err := tx.QueryRow("SELECT LAST_INSERT_ID()").Scan(&value); err != nil {
+		return 0, fmt.Errorf("failed to read sequence %s: %w", name, err)
+	}
+	return value, nil
+}
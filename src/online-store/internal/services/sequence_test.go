@@ -0,0 +1,78 @@
+// internal/services/sequence_test.go
+// Tests for invoice numbers and the counters behind them, on sqlmock
+// Numbers are unique because of the upsert and LAST_INSERT_ID(expr), so the
+// tests check those exact statements run in the caller's transaction
+
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFormatInvoiceNumber(t *testing.T) {
+	tests := []struct {
+		year, sequence int
+		want           string
+	}{
+		{2024, 123, "INV-2024-000123"},
+		{2025, 1, "INV-2025-000001"},
+		{2024, 999999, "INV-2024-999999"},
+		{2024, 1234567, "INV-2024-1234567"}, // Still unique past a million
+	}
+
+	for _, tt := range tests {
+		if got := formatInvoiceNumber(tt.year, tt.sequence); got != tt.want {
+			t.Errorf("formatInvoiceNumber(%d, %d) = %q, want %q", tt.year, tt.sequence, got, tt.want)
+		}
+	}
+}
+
+func TestNextInvoiceSequence(t *testing.T) {
+	db, mock := newMockDB(t)
+	// Each year has its own counter
+	mock.ExpectBegin()
+	mock.ExpectExec(advanceSequence).WithArgs("invoice-2025").WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectQuery(readSequence).WillReturnRows(sqlmock.NewRows([]string{"LAST_INSERT_ID()"}).AddRow(4))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	sequence, err := nextInvoiceSequence(tx, 2025)
+	if err != nil || sequence != 4 {
+		t.Errorf("nextInvoiceSequence = %d, %v; want 4", sequence, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+}
+
+func TestNextSKUNumber(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(advanceSequence).WithArgs(skuSequenceName).WillReturnResult(sqlmock.NewResult(12, 1))
+	mock.ExpectQuery(readSequence).WillReturnRows(sqlmock.NewRows([]string{"LAST_INSERT_ID()"}).AddRow(12))
+	mock.ExpectCommit()
+
+	number, err := NewSQLProductRepository(db).NextSKUNumber()
+	if err != nil || number != 12 {
+		t.Errorf("NextSKUNumber = %d, %v; want 12", number, err)
+	}
+}
+
+// A number we couldn't read back is given back with the rolled back upsert
+func TestNextSKUNumberReadFails(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(advanceSequence).WithArgs(skuSequenceName).WillReturnResult(sqlmock.NewResult(12, 1))
+	mock.ExpectQuery(readSequence).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	if _, err := NewSQLProductRepository(db).NextSKUNumber(); err == nil {
+		t.Error("NextSKUNumber succeeded, want the read's error")
+	}
+}
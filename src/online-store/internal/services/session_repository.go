@@ -0,0 +1,178 @@
+// internal/services/session_repository.go
+// This file contains the database access for refresh-token sessions
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"online-store/internal/database"
+	"online-store/internal/models"
+)
+
+// SessionRepository defines how refresh-token sessions are stored
+type SessionRepository interface {
+	Create(userID int, tokenHash, userAgent string, expiresAt time.Time) (int, error)
+	GetActiveByHash(tokenHash string) (*models.Session, error)
+	ListActive(userID int) ([]models.Session, error)
+	Revoke(sessionID int) error
+	RevokeForUser(sessionID, userID int) error
+	RevokeAllButNewest(userID, keep int) (int64, error)
+	RevokeAllForUser(userID int) (int64, error)
+}
+
+// SQLSessionRepository is the MariaDB-backed SessionRepository
+type SQLSessionRepository struct {
+	db *database.DB
+}
+
+// NewSQLSessionRepository creates a session repository using the given database
+func NewSQLSessionRepository(db *database.DB) *SQLSessionRepository {
+	return &SQLSessionRepository{db: db}
+}
+
+// Create stores a new session and returns its ID
+func (r *SQLSessionRepository) Create(userID int, tokenHash, userAgent string, expiresAt time.Time) (int, error) {
+	result, err := r.db.Exec(
+		"INSERT INTO refresh_tokens (user_id, token_hash, user_agent, expires_at) VALUES (?, ?, NULLIF(?, ''), ?)",
+		userID, tokenHash, userAgent, expiresAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	sessionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get session ID: %w", err)
+	}
+
+	return int(sessionID), nil
+}
+
+// GetActiveByHash returns the session for a refresh token hash
+// Revoked and expired sessions count as missing: ErrInvalidRefreshToken
+func (r *SQLSessionRepository) GetActiveByHash(tokenHash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.QueryRow(`
+		SELECT id, user_id, COALESCE(user_agent, ''), created_at, expires_at
+		FROM refresh_tokens
+		WHERE token_hash = ? AND revoked_at IS NULL AND expires_at > NOW()
+	`, tokenHash).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.CreatedAt, &session.ExpiresAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// ListActive returns a user's sessions that are neither revoked nor expired, newest first
+func (r *SQLSessionRepository) ListActive(userID int) ([]models.Session, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, COALESCE(user_agent, ''), created_at, expires_at
+		FROM refresh_tokens
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY id DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.CreatedAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeForUser ends one of a user's active sessions
+// Returns ErrSessionNotFound if it doesn't exist, belongs to someone else or already ended
+func (r *SQLSessionRepository) RevokeForUser(sessionID, userID int) error {
+	result, err := r.db.Exec(
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		sessionID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// Revoke ends a single session
+// Returns ErrSessionNotFound if it already ended, e.g. because a concurrent
+// refresh with the same token revoked it first
+func (r *SQLSessionRepository) Revoke(sessionID int) error {
+	result, err := r.db.Exec(
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL",
+		sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAllButNewest revokes a user's active sessions except the newest keep ones
+// Returns how many sessions were revoked
+func (r *SQLSessionRepository) RevokeAllButNewest(userID, keep int) (int64, error) {
+	// MariaDB doesn't allow LIMIT directly inside IN (...),
+	// so the newest sessions are picked in a derived table
+	result, err := r.db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = ? AND revoked_at IS NULL
+		AND id NOT IN (
+			SELECT id FROM (
+				SELECT id FROM refresh_tokens
+				WHERE user_id = ? AND revoked_at IS NULL
+				ORDER BY id DESC
+				LIMIT ?
+			) AS newest
+		)
+	`, userID, userID, keep)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke old sessions: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// RevokeAllForUser revokes every active session of a user
+// Returns how many sessions were revoked
+func (r *SQLSessionRepository) RevokeAllForUser(userID int) (int64, error) {
+	result, err := r.db.Exec(
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return result.RowsAffected()
+}
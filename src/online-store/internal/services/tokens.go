@@ -0,0 +1,28 @@
+// internal/services/tokens.go
+// This file contains helpers for random secret tokens (tracking links, etc.)
+
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// generateToken creates a random, unguessable token to hand to a client
+func generateToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// hashToken returns the SHA-256 hash of a token
+// We only store hashes, so a leaked database doesn't leak usable tokens
+// (tokens are long and random, so a fast hash is fine - unlike passwords)
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
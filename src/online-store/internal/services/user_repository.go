@@ -0,0 +1,229 @@
+// internal/services/user_repository.go
+// This file contains the database access for users
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"online-store/internal/database"
+	"online-store/internal/models"
+)
+
+// UserRepository defines how the auth service reads and writes users
+type UserRepository interface {
+	Create(email, passwordHash string) (int, error)
+	CreateGuest(email string) (int, error)
+	SetGuestPassword(userID int, passwordHash, tokenHash string) error
+	UpgradeGuest(tokenHash string) (int, error)
+	UpdateEmail(userID int, email string) error
+	SetVerificationToken(userID int, tokenHash string) error
+	VerifyEmail(tokenHash string) error
+	GetByEmail(email string) (*models.User, error)
+	GetByID(id int) (*models.User, error)
+}
+
+// SQLUserRepository is the MariaDB-backed UserRepository
+type SQLUserRepository struct {
+	db *database.DB
+}
+
+// NewSQLUserRepository creates a user repository using the given database
+func NewSQLUserRepository(db *database.DB) *SQLUserRepository {
+	return &SQLUserRepository{db: db}
+}
+
+// Create inserts a new user and returns their ID
+func (r *SQLUserRepository) Create(email, passwordHash string) (int, error) {
+	result, err := r.db.Exec(
+		"INSERT INTO users (email, password_hash) VALUES (?, ?)",
+		email, passwordHash,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	// Get the ID of the newly created user
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user ID: %w", err)
+	}
+
+	return int(userID), nil
+}
+
+// CreateGuest inserts a passwordless guest user and returns their ID
+// Guests can't log in (an empty hash never matches), but can own orders
+func (r *SQLUserRepository) CreateGuest(email string) (int, error) {
+	result, err := r.db.Exec(
+		"INSERT INTO users (email, password_hash, is_guest) VALUES (?, '', TRUE)",
+		email,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create guest user: %w", err)
+	}
+
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user ID: %w", err)
+	}
+
+	return int(userID), nil
+}
+
+// SetGuestPassword stores the password a guest registered with, until they
+// confirm their email with the verification token (see UpgradeGuest)
+// Password and token are replaced together, so a link only ever sets the
+// password it was sent for. Returns ErrUserNotFound if the user is no longer a guest
+func (r *SQLUserRepository) SetGuestPassword(userID int, passwordHash, tokenHash string) error {
+	result, err := r.db.Exec(
+		"UPDATE users SET pending_password_hash = ?, verification_token_hash = ? WHERE id = ? AND is_guest = TRUE",
+		passwordHash, tokenHash, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store guest password: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to store guest password: %w", err)
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpgradeGuest turns the guest a verification token belongs to into a full
+// account with the password stored by SetGuestPassword, and returns its ID
+// The user keeps their ID, so their guest orders stay attached to them
+// The token is used up; a token that doesn't belong to a registering guest
+// returns ErrInvalidVerificationToken
+func (r *SQLUserRepository) UpgradeGuest(tokenHash string) (int, error) {
+	var userID int
+	err := r.db.QueryRow(
+		"SELECT id FROM users WHERE verification_token_hash = ? AND is_guest = TRUE AND pending_password_hash IS NOT NULL",
+		tokenHash,
+	).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidVerificationToken
+		}
+		return 0, fmt.Errorf("failed to upgrade guest user: %w", err)
+	}
+
+	// The token in the WHERE makes this a no-op if a concurrent request used
+	// the token or registered again (replacing it) since we looked it up
+	result, err := r.db.Exec(`
+		UPDATE users
+		SET password_hash = pending_password_hash, pending_password_hash = NULL, is_guest = FALSE,
+			email_verified_at = NOW(), verification_token_hash = NULL
+		WHERE id = ? AND verification_token_hash = ? AND is_guest = TRUE`,
+		userID, tokenHash,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upgrade guest user: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to upgrade guest user: %w", err)
+	}
+	if rows == 0 {
+		return 0, ErrInvalidVerificationToken
+	}
+	return userID, nil
+}
+
+// UpdateEmail changes a user's email
+// The new address hasn't been verified yet, so the user counts as unverified again
+// Returns ErrEmailTaken if another user already has it (the column is UNIQUE)
+func (r *SQLUserRepository) UpdateEmail(userID int, email string) error {
+	result, err := r.db.Exec(
+		"UPDATE users SET email = ?, email_verified_at = NULL, verification_token_hash = NULL WHERE id = ?",
+		email, userID,
+	)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SetVerificationToken stores the hash of a user's new email verification token
+// It replaces any earlier token, so only the newest verification link works
+func (r *SQLUserRepository) SetVerificationToken(userID int, tokenHash string) error {
+	_, err := r.db.Exec("UPDATE users SET verification_token_hash = ? WHERE id = ?", tokenHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to store verification token: %w", err)
+	}
+	return nil
+}
+
+// VerifyEmail marks the email of the user a verification token belongs to as verified
+// The token is used up; unknown tokens return ErrInvalidVerificationToken
+func (r *SQLUserRepository) VerifyEmail(tokenHash string) error {
+	result, err := r.db.Exec(
+		"UPDATE users SET email_verified_at = NOW(), verification_token_hash = NULL WHERE verification_token_hash = ?",
+		tokenHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	if rows == 0 {
+		return ErrInvalidVerificationToken
+	}
+	return nil
+}
+
+// GetByEmail looks up a user by email, or returns ErrUserNotFound
+func (r *SQLUserRepository) GetByEmail(email string) (*models.User, error) {
+	var user models.User
+	err := r.db.QueryRow(
+		"SELECT id, email, password_hash, role, is_guest, created_at, email_verified_at IS NOT NULL FROM users WHERE email = ?",
+		email,
+	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.IsGuest, &user.CreatedAt, &user.EmailVerified)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetByID looks up a user by ID, or returns ErrUserNotFound
+func (r *SQLUserRepository) GetByID(id int) (*models.User, error) {
+	var user models.User
+	err := r.db.QueryRow(
+		"SELECT id, email, password_hash, role, is_guest, created_at, email_verified_at IS NOT NULL FROM users WHERE id = ?",
+		id,
+	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.IsGuest, &user.CreatedAt, &user.EmailVerified)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
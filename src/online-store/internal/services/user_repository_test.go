@@ -0,0 +1,66 @@
+// internal/services/user_repository_test.go
+// Tests for the SQL user repository, on sqlmock
+
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetGuestPassword(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSQLUserRepository(db)
+	query := regexp.QuoteMeta("UPDATE users SET pending_password_hash = ?, verification_token_hash = ? WHERE id = ? AND is_guest = TRUE")
+
+	mock.ExpectExec(query).WithArgs("hash", "token-hash", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.SetGuestPassword(7, "hash", "token-hash"); err != nil {
+		t.Fatalf("SetGuestPassword: %v", err)
+	}
+
+	// No row: the user isn't a guest (any more)
+	mock.ExpectExec(query).WithArgs("hash", "token-hash", 7).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := repo.SetGuestPassword(7, "hash", "token-hash"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUpgradeGuest(t *testing.T) {
+	selectGuest := regexp.QuoteMeta("SELECT id FROM users WHERE verification_token_hash = ? AND is_guest = TRUE AND pending_password_hash IS NOT NULL")
+	upgrade := `UPDATE users\s+SET password_hash = pending_password_hash, pending_password_hash = NULL, is_guest = FALSE,` +
+		`\s+email_verified_at = NOW\(\), verification_token_hash = NULL\s+WHERE id = \? AND verification_token_hash = \? AND is_guest = TRUE`
+
+	t.Run("upgraded", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectQuery(selectGuest).WithArgs("token-hash").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(upgrade).WithArgs(7, "token-hash").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		userID, err := NewSQLUserRepository(db).UpgradeGuest("token-hash")
+		if err != nil || userID != 7 {
+			t.Errorf("UpgradeGuest = %d, %v, want user 7", userID, err)
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectQuery(selectGuest).WithArgs("token-hash").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		if _, err := NewSQLUserRepository(db).UpgradeGuest("token-hash"); !errors.Is(err, ErrInvalidVerificationToken) {
+			t.Errorf("err = %v, want ErrInvalidVerificationToken", err)
+		}
+	})
+
+	// Someone used the token, or registered again, between the lookup and the update
+	t.Run("lost a race", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectQuery(selectGuest).WithArgs("token-hash").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(upgrade).WithArgs(7, "token-hash").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if _, err := NewSQLUserRepository(db).UpgradeGuest("token-hash"); !errors.Is(err, ErrInvalidVerificationToken) {
+			t.Errorf("err = %v, want ErrInvalidVerificationToken", err)
+		}
+	})
+}
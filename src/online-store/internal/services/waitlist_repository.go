@@ -0,0 +1,88 @@
+// internal/services/waitlist_repository.go
+// This file contains the database access for product waitlists
+
+package services
+
+import (
+	"fmt"
+
+	"online-store/internal/database"
+	"online-store/internal/models"
+)
+
+// WaitlistRepository defines how product waitlists are stored
+type WaitlistRepository interface {
+	Add(productID, userID int) error
+	TakeAll(productID int) ([]models.WaitlistEntry, error)
+}
+
+// SQLWaitlistRepository is the MariaDB-backed WaitlistRepository
+type SQLWaitlistRepository struct {
+	db *database.DB
+}
+
+// NewSQLWaitlistRepository creates a waitlist repository using the given database
+func NewSQLWaitlistRepository(db *database.DB) *SQLWaitlistRepository {
+	return &SQLWaitlistRepository{db: db}
+}
+
+// Add puts a user on a product's waitlist
+// Returns ErrAlreadyOnWaitlist if they are on it already
+func (r *SQLWaitlistRepository) Add(productID, userID int) error {
+	_, err := r.db.Exec("INSERT INTO waitlist (product_id, user_id) VALUES (?, ?)", productID, userID)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return ErrAlreadyOnWaitlist
+		}
+		return fmt.Errorf("failed to join waitlist: %w", err)
+	}
+	return nil
+}
+
+// TakeAll returns everyone on a product's waitlist, oldest first, and clears it
+// Both happen in one transaction, so two restocks at the same moment can't
+// notify the same customer twice
+func (r *SQLWaitlistRepository) TakeAll(productID int) ([]models.WaitlistEntry, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Rollback does nothing once the transaction is committed
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT waitlist.product_id, waitlist.user_id, users.email, waitlist.created_at
+		FROM waitlist
+		JOIN users ON users.id = waitlist.user_id
+		WHERE waitlist.product_id = ?
+		ORDER BY waitlist.created_at, waitlist.user_id
+		FOR UPDATE
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get waitlist: %w", err)
+	}
+
+	entries := []models.WaitlistEntry{}
+	for rows.Next() {
+		var entry models.WaitlistEntry
+		if err := rows.Scan(&entry.ProductID, &entry.UserID, &entry.Email, &entry.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan waitlist entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read waitlist: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM waitlist WHERE product_id = ?", productID); err != nil {
+		return nil, fmt.Errorf("failed to clear waitlist: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return entries, nil
+}
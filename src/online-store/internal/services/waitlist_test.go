@@ -0,0 +1,92 @@
+// internal/services/waitlist_test.go
+// Tests for the waitlist of sold-out products
+
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"online-store/internal/models"
+)
+
+// waitlistNotifications returns the customers told that productID is back in stock
+func waitlistNotifications(s *testStore, productID int) []models.BackInStockEvent {
+	var notifications []models.BackInStockEvent
+	for _, event := range s.publisher.published("inventory/back_in_stock") {
+		if event, ok := event.(models.BackInStockEvent); ok && event.UserID != 0 && event.ProductID == productID {
+			notifications = append(notifications, event)
+		}
+	}
+	return notifications
+}
+
+func TestJoinWaitlist(t *testing.T) {
+	s := newTestStore(t)
+	product := s.addProduct("Mug", 900, 0)
+	ann, bob := s.addUser("ann@example.com"), s.addUser("bob@example.com")
+	s.waitlist.emails[ann], s.waitlist.emails[bob] = "ann@example.com", "bob@example.com"
+
+	for _, userID := range []int{ann, bob} {
+		if err := s.productService.JoinWaitlist(userID, product.ID); err != nil {
+			t.Fatalf("JoinWaitlist(%d): %v", userID, err)
+		}
+	}
+	if err := s.productService.JoinWaitlist(ann, product.ID); !errors.Is(err, ErrAlreadyOnWaitlist) {
+		t.Errorf("joining twice: err = %v, want ErrAlreadyOnWaitlist", err)
+	}
+
+	// The restock tells each customer once, then the waitlist is empty
+	if err := s.productService.UpdateStock(product.ID, 5); err != nil {
+		t.Fatalf("UpdateStock: %v", err)
+	}
+	notifications := waitlistNotifications(s, product.ID)
+	var told []string
+	for _, notification := range notifications {
+		told = append(told, notification.Email)
+		if notification.ProductName != "Mug" || notification.CurrentStock != 5 {
+			t.Errorf("notification = %+v, want the mug with 5 in stock", notification)
+		}
+	}
+	if want := []string{"ann@example.com", "bob@example.com"}; !reflect.DeepEqual(told, want) {
+		t.Errorf("notified %v, want %v", told, want)
+	}
+
+	s.productService.UpdateStock(product.ID, 0)
+	s.productService.UpdateStock(product.ID, 5)
+	if got := len(waitlistNotifications(s, product.ID)); got != 2 {
+		t.Errorf("%d notifications after the second restock, want still 2", got)
+	}
+
+	// After being told, a customer may join again
+	s.productService.UpdateStock(product.ID, 0)
+	if err := s.productService.JoinWaitlist(ann, product.ID); err != nil {
+		t.Errorf("joining again after the restock: %v", err)
+	}
+}
+
+func TestJoinWaitlistRejected(t *testing.T) {
+	s := newTestStore(t)
+	inStock := s.addProduct("Mug", 900, 3)
+	draft := s.products.add(models.Product{Name: "Lamp", PriceCents: 2499, Status: models.ProductStatusDraft})
+	userID := s.addUser("ann@example.com")
+
+	tests := []struct {
+		name      string
+		productID int
+		want      error
+	}{
+		{"in stock", inStock.ID, ErrProductInStock},
+		{"draft", draft.ID, ErrProductNotFound},
+		{"unknown", 42, ErrProductNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.productService.JoinWaitlist(userID, tt.productID); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}